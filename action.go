@@ -0,0 +1,62 @@
+package soap
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Implements the registry of SOAP actions by body type, from which requests infer their action.
+
+// registeredAction is the action, and endpoint path, registered for a body type.
+type registeredAction struct {
+	action string
+	path   string
+}
+
+var (
+	actionsMu sync.RWMutex
+	actions   = map[reflect.Type]registeredAction{}
+)
+
+// RegisterAction registers the SOAP action for requests whose body has the same type as body, so that NewRequest
+// can infer it rather than it being repeated at every call site. If path is not empty, it is the path of the
+// operation's endpoint, which is appended to the URL of the request when the action is inferred.
+// Bodies and pointers to them share their registration. Registering a type again replaces its registration.
+// RegisterAction is typically called from init functions, and is safe for concurrent use.
+func RegisterAction(body interface{}, action string, path string) {
+	actionsMu.Lock()
+	defer actionsMu.Unlock()
+
+	actions[bodyType(body)] = registeredAction{action: action, path: path}
+}
+
+// lookupAction returns the action registered for the type of body, if any.
+func lookupAction(body interface{}) (registeredAction, bool) {
+	if body == nil {
+		return registeredAction{}, false
+	}
+
+	actionsMu.RLock()
+	defer actionsMu.RUnlock()
+
+	registered, ok := actions[bodyType(body)]
+	return registered, ok
+}
+
+// bodyType returns the type of body, without any pointer indirection.
+func bodyType(body interface{}) reflect.Type {
+	t := reflect.TypeOf(body)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// joinPath appends the path to the URL, with a single slash between them.
+func joinPath(url string, path string) string {
+	if path == "" {
+		return url
+	}
+	return strings.TrimSuffix(url, "/") + "/" + strings.TrimPrefix(path, "/")
+}
@@ -0,0 +1,44 @@
+package soap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type actionTestBody struct {
+	Value string `xml:"Value"`
+}
+
+type actionTestPathBody struct {
+	Value string `xml:"Value"`
+}
+
+func TestNewRequestRegisteredAction(t *testing.T) {
+	RegisterAction(&actionTestBody{}, "http://example.com/Service/Get", "")
+	RegisterAction(actionTestPathBody{}, "http://example.com/Service/Put", "/Put.svc")
+
+	var tests = []struct {
+		name    string
+		action  string
+		url     string
+		body    interface{}
+		want    string
+		wantURL string
+	}{
+		{name: "registered", url: "http://example.com/service", body: &actionTestBody{}, want: "http://example.com/Service/Get", wantURL: "http://example.com/service"},
+		{name: "registered by value", url: "http://example.com/service", body: actionTestBody{}, want: "http://example.com/Service/Get", wantURL: "http://example.com/service"},
+		{name: "registered with path", url: "http://example.com/service/", body: &actionTestPathBody{}, want: "http://example.com/Service/Put", wantURL: "http://example.com/service/Put.svc"},
+		{name: "explicit action", action: "other", url: "http://example.com/service", body: &actionTestPathBody{}, want: "other", wantURL: "http://example.com/service"},
+		{name: "unregistered", url: "http://example.com/service", body: &envelopeContentExample{}, want: "", wantURL: "http://example.com/service"},
+		{name: "nil body", url: "http://example.com/service", want: "", wantURL: "http://example.com/service"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest(tt.action, tt.url, tt.body, nil, nil)
+			assert.Equal(t, tt.want, req.action)
+			assert.Equal(t, tt.wantURL, req.url)
+		})
+	}
+}
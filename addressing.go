@@ -0,0 +1,99 @@
+package soap
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+)
+
+// Implements the WS-Addressing 1.0 message addressing headers.
+
+const (
+	wsaNS        = "http://www.w3.org/2005/08/addressing"
+	wsaAnonymous = "http://www.w3.org/2005/08/addressing/anonymous"
+)
+
+// addressingHeader is a WS-Addressing header holding a single URI.
+type addressingHeader struct {
+	XMLName xml.Name
+
+	// XMLNSWsu and ID are set when the request is signed, so the header can be referenced by the signature.
+	XMLNSWsu string `xml:"xmlns:wsu,attr,omitempty"`
+	ID       string `xml:"wsu:Id,attr,omitempty"`
+
+	Value string `xml:",chardata"`
+}
+
+// endpointReferenceHeader is a WS-Addressing header holding an endpoint reference, such as wsa:ReplyTo.
+type endpointReferenceHeader struct {
+	XMLName xml.Name
+
+	XMLNSWsu string `xml:"xmlns:wsu,attr,omitempty"`
+	ID       string `xml:"wsu:Id,attr,omitempty"`
+
+	Address string `xml:"Address"`
+}
+
+// UseAddressing adds the WS-Addressing headers to the request: wsa:Action with the SOAP action, wsa:To with the
+// URL, a new wsa:MessageID for each call, and wsa:ReplyTo with the anonymous address, so the response is returned
+// on the same connection. The headers precede any others added to the request.
+// If the request is signed, the addressing headers are signed along with the body.
+func (r *Request) UseAddressing() {
+	r.addressing = true
+}
+
+// addressingHeaders returns the WS-Addressing headers of the request. If signed is set, each header is given a
+// wsu:Id attribute so that it is included in the signature.
+func (r *Request) addressingHeaders(signed bool) ([]interface{}, error) {
+	messageID, err := newMessageID()
+	if err != nil {
+		return nil, err
+	}
+
+	headers := []interface{}{
+		&addressingHeader{XMLName: xml.Name{Space: wsaNS, Local: "Action"}, Value: r.action},
+		&addressingHeader{XMLName: xml.Name{Space: wsaNS, Local: "MessageID"}, Value: messageID},
+		&endpointReferenceHeader{XMLName: xml.Name{Space: wsaNS, Local: "ReplyTo"}, Address: wsaAnonymous},
+		&addressingHeader{XMLName: xml.Name{Space: wsaNS, Local: "To"}, Value: r.url},
+	}
+	if !signed {
+		return headers, nil
+	}
+
+	for _, header := range headers {
+		id, err := generateWSUID("Addressing")
+		if err != nil {
+			return nil, err
+		}
+
+		switch h := header.(type) {
+		case *addressingHeader:
+			h.XMLNSWsu, h.ID = wsuNS, id
+		case *endpointReferenceHeader:
+			h.XMLNSWsu, h.ID = wsuNS, id
+		}
+	}
+	return headers, nil
+}
+
+// newMessageID returns a random UUID URI, as used for WS-Addressing message IDs.
+func newMessageID() (string, error) {
+	id, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	return "urn:uuid:" + id, nil
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	// Set the version (4) and variant bits of a random UUID.
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
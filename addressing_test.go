@@ -0,0 +1,97 @@
+package soap
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"regexp"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestUseAddressing(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name string
+		sign bool
+		opts serializeOptions
+	}{
+		{name: "unsigned"},
+		{name: "signed", sign: true},
+		{name: "signed with compatibility profile", sign: true, opts: serializeOptions{compat: wcfProfile}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := &envelopeContentExample{Attr1: 10, Field1: envelopeExampleField{Value: "This is a test string"}}
+			req := NewRequest("http://example.com/Service/Operation", "http://example.com/service", content, nil, nil)
+			req.AddHeader(headerExample{Attr1: 15, Value: "custom"})
+			req.UseAddressing()
+			if tt.sign {
+				req.SignWith(wsseInfo)
+			}
+
+			r, err := req.serialize(tt.opts)
+			assert.Nil(t, err)
+			data, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+
+			doc := etree.NewDocument()
+			if !assert.Nil(t, doc.ReadFromBytes(data)) {
+				return
+			}
+			header := doc.FindElement("Envelope/Header")
+			if !assert.NotNil(t, header) {
+				return
+			}
+
+			var tags []string
+			for _, entry := range header.ChildElements() {
+				tags = append(tags, entry.Tag)
+			}
+			if tt.sign {
+				assert.Equal(t, []string{"Action", "MessageID", "ReplyTo", "To", "HeaderExample", "Security"}, tags)
+			} else {
+				assert.Equal(t, []string{"Action", "MessageID", "ReplyTo", "To", "HeaderExample"}, tags)
+			}
+
+			assert.Equal(t, "http://example.com/Service/Operation", header.SelectElement("Action").Text())
+			assert.Equal(t, "http://example.com/service", header.SelectElement("To").Text())
+			assert.Equal(t, wsaAnonymous, header.FindElement("ReplyTo/Address").Text())
+			assert.Regexp(t, regexp.MustCompile(`^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`), header.SelectElement("MessageID").Text())
+			assert.Equal(t, wsaNS, header.SelectElement("Action").SelectAttrValue("xmlns", ""))
+
+			if !tt.sign {
+				assert.Empty(t, header.SelectElement("Action").SelectAttrValue("wsu:Id", ""))
+				return
+			}
+
+			// Every addressing header is referenced by the signature, with the digest of the header as sent.
+			references := doc.FindElements("//SignedInfo/Reference")
+			assert.Len(t, references, 5)
+			digests := map[string]string{}
+			for _, ref := range references {
+				digests[ref.SelectAttrValue("URI", "")] = ref.FindElement("DigestValue").Text()
+			}
+
+			for _, tag := range []string{"Action", "MessageID", "ReplyTo", "To"} {
+				entry := header.SelectElement(tag)
+				id := entry.SelectAttrValue("wsu:Id", "")
+				if !assert.NotEmpty(t, id, tag) {
+					continue
+				}
+
+				start := bytes.Index(data, []byte("<"+tag+" "))
+				end := bytes.Index(data, []byte("</"+tag+">")) + len("</"+tag+">")
+				digest := sha256.Sum256(data[start:end])
+				assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), digests["#"+id], tag)
+			}
+			assert.Empty(t, header.SelectElement("HeaderExample").SelectAttrValue("wsu:Id", ""))
+		})
+	}
+}
@@ -0,0 +1,239 @@
+package soap
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// DefaultContentIDDomain is the domain of the Content-IDs generated by NewContentID when none is given.
+const DefaultContentIDDomain = "gosoap.invalid"
+
+// Attachment is a binary part of a multipart (XOP) response, handed to an AttachmentHandler as it is read.
+// The attachment reads directly from the response body, so its content is never buffered in memory.
+type Attachment struct {
+	io.Reader
+
+	// ContentID is the Content-ID of the part, without the enclosing angle brackets.
+	ContentID string
+	// ContentType is the Content-Type of the part.
+	ContentType string
+	// Header contains all the MIME headers of the part.
+	Header textproto.MIMEHeader
+	// Path is the element path, below the envelope, of the XOP include referencing the part (i.e. Body/Report/Data).
+	// It is nil if the part isn't referenced from the envelope.
+	Path []string
+}
+
+// AttachmentHandler is called for every binary part of a multipart response, in the order they are received.
+// The attachment is only valid until the handler returns: its reader must be fully consumed (or abandoned) by then,
+// and must not be retained. The envelope has already been decoded when the handler is called.
+// Returning an error stops decoding, and the error is returned from Client.Do.
+type AttachmentHandler func(attachment *Attachment) error
+
+// newAttachment creates the attachment for a part, given the path of the include referencing it, if any.
+func newAttachment(r io.Reader, header textproto.MIMEHeader, path []string) *Attachment {
+	contentID := header.Get("Content-ID")
+
+	return &Attachment{
+		Reader:      r,
+		ContentID:   strings.TrimSuffix(strings.TrimPrefix(contentID, "<"), ">"),
+		ContentType: header.Get("Content-Type"),
+		Header:      header,
+		Path:        path,
+	}
+}
+
+// NewContentID returns a new, globally unique Content-ID for an outgoing attachment, of the form uuid@domain, as
+// required by RFC 2392. If domain is empty, DefaultContentIDDomain is used. The Content-ID has no enclosing angle
+// brackets; see ContentIDHeader and ContentIDURI for the forms used in MIME headers and XOP includes.
+func NewContentID(domain string) (string, error) {
+	id, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	if domain == "" {
+		domain = DefaultContentIDDomain
+	}
+	return id + "@" + domain, nil
+}
+
+// ContentIDHeader returns the value of the Content-ID header of the MIME part with the Content-ID, enclosed in angle
+// brackets.
+func ContentIDHeader(contentID string) string {
+	return "<" + contentID + ">"
+}
+
+// ContentIDURI returns the cid: URI referencing the MIME part with the Content-ID, as used for the href of an XOP
+// include. Characters not allowed in URIs are percent-encoded, as required by RFC 2392.
+func ContentIDURI(contentID string) string {
+	return "cid:" + (&url.URL{Path: contentID}).EscapedPath()
+}
+
+// contentIDFromURI returns the Content-ID referenced by a cid: URI, or the value unchanged if it isn't one.
+func contentIDFromURI(uri string) string {
+	if !strings.HasPrefix(strings.ToLower(uri), "cid:") {
+		return uri
+	}
+	contentID := uri[len("cid:"):]
+	if unescaped, err := url.PathUnescape(contentID); err == nil {
+		return unescaped
+	}
+	return contentID
+}
+
+// XopInclude is an xop:Include element, which stands in the envelope for the content of an outgoing attachment.
+type XopInclude struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2004/08/xop/include Include"`
+	Href    string   `xml:"href,attr"`
+}
+
+// NewXopInclude returns an include referencing the attachment with the Content-ID.
+func NewXopInclude(contentID string) *XopInclude {
+	return &XopInclude{Href: ContentIDURI(contentID)}
+}
+
+// MIMEPart is a part of a multipart request other than the root part holding the envelope; see Request.AddPart.
+// The part reads its content as the request is sent.
+type MIMEPart struct {
+	io.Reader
+
+	// ContentID is the Content-ID of the part, without the enclosing angle brackets, by which the envelope references
+	// it, i.e. with an XopInclude; see NewContentID.
+	ContentID string
+	// ContentType is the Content-Type of the part, which is application/octet-stream if empty.
+	ContentType string
+	// Header holds any other MIME headers of the part, which take precedence over those set by default: the content is
+	// sent as it is, with a Content-Transfer-Encoding of binary.
+	Header textproto.MIMEHeader
+}
+
+// MultipartConfig configures the MIME framing of multipart requests, for receivers which validate it strictly.
+// The zero value sends an XOP (MTOM) package with a random boundary, whose root part comes first and has a generated
+// Content-ID referenced by the start parameter.
+type MultipartConfig struct {
+	// Boundary is the boundary delimiting the parts, which is random if empty. It must be valid as defined by RFC 2046.
+	Boundary string
+	// SwA sends the request as SOAP with Attachments, with a text/xml root part, rather than as an XOP package with an
+	// application/xop+xml root part.
+	SwA bool
+	// RootContentID is the Content-ID of the root part, without the enclosing angle brackets, which is generated if
+	// empty.
+	RootContentID string
+	// RootHeader holds any other MIME headers of the root part, which take precedence over those set by default.
+	RootHeader textproto.MIMEHeader
+	// OmitStart leaves out the start parameter referencing the root part, which must then be the first part.
+	OmitStart bool
+	// StartInfo is the start-info parameter of XOP packages, the media type of the envelope, which is text/xml if
+	// empty. It is also the type parameter of the root part.
+	StartInfo string
+	// RootLast sends the root part after the other parts, rather than first.
+	RootLast bool
+	// ExpectContinue sends the Expect: 100-continue header, so that the service can reject the request, i.e. for its
+	// authentication or size, before the parts are sent. The parts are then only sent once the service has replied
+	// with 100 Continue, or after the ExpectContinueTimeout of the http.Transport, which must be set for the client
+	// to wait at all.
+	ExpectContinue bool
+}
+
+// errRootPartNotFirst is returned if the root part of a multipart request isn't first while it isn't referenced by
+// the start parameter.
+var errRootPartNotFirst = errors.New("the root part must be first if the start parameter is omitted")
+
+// multipartBody returns the multipart body of a request with the envelope, encoded in the charset, as its root part, followed or preceded by
+// the parts, along with its content type. The body is written as it is read.
+func multipartBody(envelope io.Reader, charset string, parts []*MIMEPart, config MultipartConfig) (io.Reader, string, error) {
+	if config.OmitStart && config.RootLast {
+		return nil, "", errRootPartNotFirst
+	}
+
+	rootID := config.RootContentID
+	if rootID == "" {
+		var err error
+		if rootID, err = NewContentID(""); err != nil {
+			return nil, "", err
+		}
+	}
+	startInfo := config.StartInfo
+	if startInfo == "" {
+		startInfo = "text/xml"
+	}
+
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	if config.Boundary != "" {
+		if err := w.SetBoundary(config.Boundary); err != nil {
+			return nil, "", err
+		}
+	}
+
+	params := map[string]string{"boundary": w.Boundary()}
+	rootHeader := textproto.MIMEHeader{}
+	if config.SwA {
+		params["type"] = "text/xml"
+		rootHeader.Set("Content-Type", mime.FormatMediaType("text/xml", map[string]string{"charset": charset}))
+	} else {
+		params["type"] = "application/xop+xml"
+		params["start-info"] = startInfo
+		rootHeader.Set("Content-Type", mime.FormatMediaType("application/xop+xml", map[string]string{"charset": charset, "type": startInfo}))
+	}
+	if !config.OmitStart {
+		params["start"] = ContentIDHeader(rootID)
+	}
+	rootHeader.Set("Content-Transfer-Encoding", "8bit")
+	rootHeader.Set("Content-ID", ContentIDHeader(rootID))
+	for key, values := range config.RootHeader {
+		rootHeader[textproto.CanonicalMIMEHeaderKey(key)] = values
+	}
+
+	root := &MIMEPart{Reader: envelope, Header: rootHeader}
+	ordered := append([]*MIMEPart{root}, parts...)
+	if config.RootLast {
+		ordered = append(append([]*MIMEPart(nil), parts...), root)
+	}
+
+	go func() {
+		err := writeParts(w, ordered, root)
+		// A streamed envelope which wasn't read in full, as the request failed, must be closed to stop its encoding.
+		if closer, ok := envelope.(io.Closer); ok {
+			closer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return pr, mime.FormatMediaType("multipart/related", params), nil
+}
+
+// writeParts writes the parts to w, closing it once they have all been written. The headers of the root part are
+// complete, while those of the others are completed from their fields.
+func writeParts(w *multipart.Writer, parts []*MIMEPart, root *MIMEPart) error {
+	for _, part := range parts {
+		header := part.Header
+		if part != root {
+			header = textproto.MIMEHeader{}
+			contentType := part.ContentType
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			header.Set("Content-Type", contentType)
+			header.Set("Content-Transfer-Encoding", "binary")
+			header.Set("Content-ID", ContentIDHeader(part.ContentID))
+			for key, values := range part.Header {
+				header[textproto.CanonicalMIMEHeaderKey(key)] = values
+			}
+		}
+
+		pw, err := w.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(pw, part); err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
@@ -0,0 +1,256 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewContentID(t *testing.T) {
+	var tests = []struct {
+		name   string
+		domain string
+		want   string
+	}{
+		{name: "default domain", want: "@" + regexp.QuoteMeta(DefaultContentIDDomain)},
+		{name: "domain", domain: "example.com", want: "@example\\.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := NewContentID(tt.domain)
+			assert.Nil(t, err)
+			assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}"+tt.want+"$", id)
+
+			other, err := NewContentID(tt.domain)
+			assert.Nil(t, err)
+			assert.NotEqual(t, id, other)
+		})
+	}
+}
+
+func TestContentIDForms(t *testing.T) {
+	var tests = []struct {
+		name      string
+		contentID string
+		header    string
+		uri       string
+	}{
+		{name: "plain", contentID: "part1@example.com", header: "<part1@example.com>", uri: "cid:part1@example.com"},
+		{name: "escaped", contentID: "part 1/%@example.com", header: "<part 1/%@example.com>", uri: "cid:part%201/%25@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.header, ContentIDHeader(tt.contentID))
+			assert.Equal(t, tt.uri, ContentIDURI(tt.contentID))
+			assert.Equal(t, tt.contentID, contentIDFromURI(tt.uri))
+
+			data, err := xml.Marshal(NewXopInclude(tt.contentID))
+			assert.Nil(t, err)
+			assert.Equal(t, `<Include xmlns="http://www.w3.org/2004/08/xop/include" href="`+tt.uri+`"></Include>`, string(data))
+		})
+	}
+}
+
+func TestRequestParts(t *testing.T) {
+	type part struct {
+		contentType string
+		contentID   string
+		header      textproto.MIMEHeader
+		content     string
+	}
+
+	var tests = []struct {
+		name        string
+		config      MultipartConfig
+		contentType string
+		parts       []part
+		err         error
+	}{
+		{
+			name:        "XOP",
+			config:      MultipartConfig{Boundary: "boundary", RootContentID: "root@example.com"},
+			contentType: `multipart/related; boundary=boundary; start="<root@example.com>"; start-info="text/xml"; type="application/xop+xml"`,
+			parts: []part{
+				{contentType: `application/xop+xml; charset=UTF-8; type="text/xml"`, contentID: "<root@example.com>"},
+				{contentType: "image/png", contentID: "<image@example.com>", content: "image"},
+				{contentType: "application/octet-stream", contentID: "<data@example.com>", header: textproto.MIMEHeader{"Content-Description": {"data"}}, content: "data"},
+			},
+		},
+		{
+			name: "SwA with the root last",
+			config: MultipartConfig{
+				Boundary:      "boundary",
+				SwA:           true,
+				RootContentID: "root@example.com",
+				RootHeader:    textproto.MIMEHeader{"content-transfer-encoding": {"binary"}},
+				RootLast:      true,
+			},
+			contentType: `multipart/related; boundary=boundary; start="<root@example.com>"; type="text/xml"`,
+			parts: []part{
+				{contentType: "image/png", contentID: "<image@example.com>", content: "image"},
+				{contentType: "application/octet-stream", contentID: "<data@example.com>", header: textproto.MIMEHeader{"Content-Description": {"data"}}, content: "data"},
+				{contentType: "text/xml; charset=UTF-8", contentID: "<root@example.com>"},
+			},
+		},
+		{
+			name:        "without start",
+			config:      MultipartConfig{Boundary: "boundary", RootContentID: "root@example.com", OmitStart: true, StartInfo: "application/soap+xml"},
+			contentType: `multipart/related; boundary=boundary; start-info="application/soap+xml"; type="application/xop+xml"`,
+			parts: []part{
+				{contentType: `application/xop+xml; charset=UTF-8; type="application/soap+xml"`, contentID: "<root@example.com>"},
+				{contentType: "image/png", contentID: "<image@example.com>", content: "image"},
+				{contentType: "application/octet-stream", contentID: "<data@example.com>", header: textproto.MIMEHeader{"Content-Description": {"data"}}, content: "data"},
+			},
+		},
+		{
+			name:   "root last without start",
+			config: MultipartConfig{OmitStart: true, RootLast: true},
+			err:    errRootPartNotFirst,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest("action", "http://example.com", NewXopInclude("image@example.com"), nil, nil)
+			req.AddPart(&MIMEPart{Reader: strings.NewReader("image"), ContentID: "image@example.com", ContentType: "image/png"})
+			req.AddPart(&MIMEPart{Reader: strings.NewReader("data"), ContentID: "data@example.com", Header: textproto.MIMEHeader{"Content-Description": {"data"}}})
+			req.ConfigureMultipart(tt.config)
+
+			data, header, err := NewClient(nil).Serialize(req)
+			assert.Equal(t, tt.err, err)
+			if err != nil {
+				return
+			}
+			assert.Equal(t, tt.contentType, header.Get("Content-Type"))
+			assert.Equal(t, "action", header.Get("SOAPAction"))
+
+			_, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+			assert.Nil(t, err)
+			r := multipart.NewReader(bytes.NewReader(data), params["boundary"])
+			for _, want := range tt.parts {
+				p, err := r.NextPart()
+				if !assert.Nil(t, err) {
+					return
+				}
+				content, err := ioutil.ReadAll(p)
+				assert.Nil(t, err)
+
+				assert.Equal(t, want.contentType, p.Header.Get("Content-Type"))
+				assert.Equal(t, want.contentID, p.Header.Get("Content-ID"))
+				for key := range want.header {
+					assert.Equal(t, want.header.Get(key), p.Header.Get(key))
+				}
+				if want.contentID == "<root@example.com>" {
+					assert.Contains(t, string(content), `<Include xmlns="http://www.w3.org/2004/08/xop/include" href="cid:image@example.com"></Include>`)
+				} else {
+					assert.Equal(t, "binary", p.Header.Get("Content-Transfer-Encoding"))
+					assert.Equal(t, want.content, string(content))
+				}
+			}
+			_, err = r.NextPart()
+			assert.NotNil(t, err)
+		})
+	}
+}
+
+func TestClientSerializeParts(t *testing.T) {
+	var sent []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(requestTestResponse))
+	}))
+	defer server.Close()
+
+	req := NewRequest("action", server.URL, NewXopInclude("data@example.com"), &envelopeContentExample{}, nil)
+	req.AddPart(&MIMEPart{Reader: strings.NewReader("data"), ContentID: "data@example.com"})
+	req.ConfigureMultipart(MultipartConfig{Boundary: "boundary", RootContentID: "root@example.com"})
+
+	client := NewClient(server.Client())
+	data, _, err := client.Serialize(req)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "\r\n\r\ndata\r\n--boundary--")
+
+	// The part is read again as the request is sent.
+	_, err = client.Do(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, string(data), string(sent))
+}
+
+func TestRequestPartsStreamed(t *testing.T) {
+	var tests = []struct {
+		name           string
+		expectContinue bool
+		status         int
+		sent           bool
+	}{
+		{name: "accepted", status: http.StatusOK, sent: true},
+		{name: "accepted expecting continue", expectContinue: true, status: http.StatusOK, sent: true},
+		{name: "rejected expecting continue", expectContinue: true, status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var expect string
+			var transferEncoding []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				expect = r.Header.Get("Expect")
+				transferEncoding = r.TransferEncoding
+				if tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+					return
+				}
+				ioutil.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(requestTestResponse))
+			}))
+			defer server.Close()
+
+			// The part records whether it was read, which it is only once the service has accepted the request if the
+			// client expects to continue.
+			content := &readRecorder{Reader: strings.NewReader(strings.Repeat("data", 1<<16))}
+			req := NewRequest("action", server.URL, NewXopInclude("data@example.com"), &envelopeContentExample{}, nil)
+			req.AddPart(&MIMEPart{Reader: content, ContentID: "data@example.com"})
+			req.ConfigureMultipart(MultipartConfig{ExpectContinue: tt.expectContinue})
+
+			transport := &http.Transport{ExpectContinueTimeout: time.Minute}
+			defer transport.CloseIdleConnections()
+			NewClient(&http.Client{Transport: transport}).Do(context.Background(), req)
+
+			assert.Equal(t, []string{"chunked"}, transferEncoding)
+			if tt.expectContinue {
+				assert.Equal(t, "100-continue", expect)
+			} else {
+				assert.Equal(t, "", expect)
+			}
+			assert.Equal(t, tt.sent, atomic.LoadInt32(&content.read) == 1)
+		})
+	}
+}
+
+// readRecorder is a reader recording whether it was read.
+type readRecorder struct {
+	io.Reader
+	read int32
+}
+
+func (r *readRecorder) Read(p []byte) (int, error) {
+	atomic.StoreInt32(&r.read, 1)
+	return r.Reader.Read(p)
+}
@@ -0,0 +1,227 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Implements the audit trail of the messages exchanged by a Client.
+
+// AuditSink receives a record of every request sent by a Client, with the messages exactly as they were exchanged, to
+// persist a complete audit trail. Implementations must be safe for concurrent use.
+type AuditSink interface {
+	// Audit is called once the request has completed, whether it succeeded or not, after the redactors of the client
+	// have been applied to the record. The record must not be retained after Audit returns, other than by copying it.
+	Audit(ctx context.Context, record *AuditRecord)
+}
+
+// AuditRecord is the record of a single request sent by a Client. Retried and hedged requests are recorded once
+// for every attempt sent.
+type AuditRecord struct {
+	// Action is the SOAP action of the request.
+	Action string
+	// Operation is the name of the operation of the request, as in its LogEntry.
+	Operation string
+	// URL is the endpoint the request was sent to.
+	URL string
+
+	// Sent is the time the request was sent, once serialized and signed.
+	Sent time.Time
+	// Finished is the time the response was read, or the request failed.
+	Finished time.Time
+
+	// RequestHeader holds the HTTP headers of the request.
+	RequestHeader http.Header
+	// Request is the body of the request as it was sent, after signing, including its attachments if it is multipart.
+	// The body of a streamed request only holds what the transport read of it.
+	Request []byte
+	// StatusCode is the HTTP status code of the audited response. A request which failed in transport is audited
+	// with 0, and without a response header or body.
+	StatusCode int
+	// ResponseHeader holds the HTTP headers of the response, or nil if none was received.
+	ResponseHeader http.Header
+	// Response is the raw body of the response, as read to decode it and to drain the connection. Nothing is read
+	// of bodies beyond the limit at which connections are closed rather than drained.
+	Response []byte
+	// FaultCode is the code of the SOAP fault returned by the service, if any.
+	FaultCode string
+	// Err is the error of the request, if any.
+	Err error
+}
+
+// AuditRedactor modifies an audit record before it is passed to the sink, i.e. to remove credentials and personal
+// data from the messages and headers. See RedactElements.
+type AuditRedactor func(record *AuditRecord)
+
+// WithAuditSink sets the sink receiving a record of every request sent by the client, after applying the redactors to
+// it in order. Recording the messages means the bodies of requests and responses are held in memory until the request
+// has completed, including those of streamed requests and attachments.
+func WithAuditSink(sink AuditSink, redactors ...AuditRedactor) ClientOption {
+	return func(c *Client) {
+		c.auditSink = sink
+		c.auditRedactors = redactors
+	}
+}
+
+// RedactedValue is the content of the elements redacted by RedactElements.
+const RedactedValue = "REDACTED"
+
+// RedactElements returns a redactor replacing the content of the elements with the local names, in the request and
+// response, with RedactedValue, such as the Password of a UsernameToken. Elements nested in a redacted element are
+// removed with its content. The messages are otherwise left byte for byte as they were. Messages are redacted up to
+// the first error in them, so that what follows the error in a message which isn't well-formed, such as the binary
+// attachments of a multipart message, is left as it is.
+func RedactElements(names ...string) AuditRedactor {
+	redacted := map[string]bool{}
+	for _, name := range names {
+		redacted[name] = true
+	}
+
+	return func(record *AuditRecord) {
+		record.Request = redactElements(record.Request, redacted)
+		record.Response = redactElements(record.Response, redacted)
+	}
+}
+
+// redactElements returns data with the content of the elements with the local names in redacted replaced.
+func redactElements(data []byte, redacted map[string]bool) []byte {
+	type span struct {
+		start, end int64
+	}
+	var spans []span
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	// Only the offsets of the elements are needed, so messages in other charsets are read as they are.
+	d.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	depth, redactDepth := 0, 0
+	var contentStart int64
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err != nil {
+			break
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			depth++
+			if redactDepth == 0 && redacted[token.Name.Local] {
+				redactDepth, contentStart = depth, d.InputOffset()
+			}
+		case xml.EndElement:
+			if depth == redactDepth {
+				if offset > contentStart {
+					spans = append(spans, span{contentStart, offset})
+				}
+				redactDepth = 0
+			}
+			depth--
+		}
+	}
+
+	if len(spans) == 0 {
+		return data
+	}
+
+	var buf bytes.Buffer
+	last := int64(0)
+	for _, s := range spans {
+		buf.Write(data[last:s.start])
+		buf.WriteString(RedactedValue)
+		last = s.end
+	}
+	buf.Write(data[last:])
+	return buf.Bytes()
+}
+
+// auditCapture records the bodies of a request and its response as they are sent and read.
+type auditCapture struct {
+	record   *AuditRecord
+	request  *captureReadCloser
+	response *captureReadCloser
+}
+
+// startAudit starts the record of the HTTP request about to be sent for req. The body of the request is copied if the
+// request can provide a copy of it, and recorded as the transport reads it otherwise.
+func (c *Client) startAudit(req *Request, httpReq *http.Request, entry *LogEntry) *auditCapture {
+	audit := &auditCapture{record: &AuditRecord{
+		Action:        req.action,
+		Operation:     entry.Operation,
+		URL:           req.url,
+		Sent:          time.Now(),
+		RequestHeader: httpReq.Header.Clone(),
+	}}
+
+	if httpReq.GetBody != nil {
+		if body, err := httpReq.GetBody(); err == nil {
+			audit.record.Request, _ = ioutil.ReadAll(body)
+			body.Close()
+			return audit
+		}
+	}
+	if httpReq.Body != nil && httpReq.Body != http.NoBody {
+		audit.request = &captureReadCloser{ReadCloser: httpReq.Body}
+		httpReq.Body = audit.request
+	}
+	return audit
+}
+
+// captureResponse records the body of the response as it is read.
+func (a *auditCapture) captureResponse(httpResp *http.Response) {
+	a.record.StatusCode = httpResp.StatusCode
+	a.record.ResponseHeader = httpResp.Header.Clone()
+	a.response = &captureReadCloser{ReadCloser: httpResp.Body}
+	httpResp.Body = a.response
+}
+
+// finishAudit completes the record with the outcome of the request, redacts it and passes it to the sink.
+func (c *Client) finishAudit(ctx context.Context, audit *auditCapture, resp *Response, err error) {
+	record := audit.record
+	record.Finished = time.Now()
+	record.Err = err
+	if audit.request != nil {
+		record.Request = audit.request.bytes()
+	}
+	if audit.response != nil {
+		record.Response = audit.response.bytes()
+	}
+	if resp != nil && resp.Fault() != nil {
+		record.FaultCode = resp.Fault().Code
+	}
+
+	for _, redact := range c.auditRedactors {
+		redact(record)
+	}
+	c.auditSink.Audit(ctx, record)
+}
+
+// captureReadCloser keeps a copy of the bytes read through it. The transport may still be reading the body of a
+// request while its response is read, so the copy is guarded by a mutex.
+type captureReadCloser struct {
+	io.ReadCloser
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (c *captureReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.mu.Lock()
+	c.buf.Write(p[:n])
+	c.mu.Unlock()
+	return n, err
+}
+
+// bytes returns a copy of the bytes read so far.
+func (c *captureReadCloser) bytes() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]byte(nil), c.buf.Bytes()...)
+}
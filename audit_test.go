@@ -0,0 +1,127 @@
+package soap
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingAuditSink struct {
+	mu      sync.Mutex
+	records []AuditRecord
+}
+
+func (s *recordingAuditSink) Audit(ctx context.Context, record *AuditRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, *record)
+}
+
+func TestClientAuditSink(t *testing.T) {
+	var tests = []struct {
+		name      string
+		status    int
+		response  string
+		stream    bool
+		faultCode string
+	}{
+		{name: "success", status: http.StatusOK, response: requestTestResponse},
+		{name: "streamed", status: http.StatusOK, response: requestTestResponse, stream: true},
+		{name: "fault", status: http.StatusInternalServerError, response: loggerTestFault, faultCode: "soap:Client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var received []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received, _ = ioutil.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			sink := &recordingAuditSink{}
+			client := NewClient(server.Client(), WithAuditSink(sink))
+
+			req := NewRequest("action", server.URL, &headerExample{Attr1: 1, Value: "value"}, &envelopeContentExample{}, nil)
+			req.StreamBody(tt.stream)
+			_, err := client.Do(context.Background(), req)
+			assert.Nil(t, err)
+
+			if !assert.Len(t, sink.records, 1) {
+				return
+			}
+			record := sink.records[0]
+			assert.Equal(t, "action", record.Action)
+			assert.Equal(t, "action", record.Operation)
+			assert.Equal(t, server.URL, record.URL)
+			assert.False(t, record.Finished.Before(record.Sent))
+			assert.Equal(t, "action", record.RequestHeader.Get("SOAPAction"))
+			assert.Equal(t, string(received), string(record.Request))
+			assert.Equal(t, tt.status, record.StatusCode)
+			assert.Equal(t, "text/xml", record.ResponseHeader.Get("Content-Type"))
+			assert.Equal(t, tt.response, string(record.Response))
+			assert.Equal(t, tt.faultCode, record.FaultCode)
+			assert.Nil(t, record.Err)
+		})
+	}
+}
+
+func TestClientAuditSinkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	sink := &recordingAuditSink{}
+	client := NewClient(server.Client(), WithAuditSink(sink))
+
+	_, err := client.Do(context.Background(), NewRequest("action", server.URL, &headerExample{}, &envelopeContentExample{}, nil))
+	assert.NotNil(t, err)
+	if assert.Len(t, sink.records, 1) {
+		assert.Equal(t, err, sink.records[0].Err)
+		assert.Equal(t, "{}", string(sink.records[0].Response))
+	}
+}
+
+func TestRedactElements(t *testing.T) {
+	var tests = []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			name: "text",
+			data: `<Envelope><Header><wsse:Password xmlns:wsse="urn:wsse" Type="text">secret</wsse:Password></Header><Body><Card>4111</Card><Name>Jo</Name></Body></Envelope>`,
+			want: `<Envelope><Header><wsse:Password xmlns:wsse="urn:wsse" Type="text">REDACTED</wsse:Password></Header><Body><Card>REDACTED</Card><Name>Jo</Name></Body></Envelope>`,
+		},
+		{
+			name: "nested",
+			data: `<Body><Card><Number>4111</Number><Card>x</Card></Card><Card/></Body>`,
+			want: `<Body><Card>REDACTED</Card><Card/></Body>`,
+		},
+		{
+			name: "malformed",
+			data: `<Body><Card>4111</Card><Password>secret</Body>`,
+			want: `<Body><Card>REDACTED</Card><Password>secret</Body>`,
+		},
+		{name: "none", data: `<Body><Name>Jo</Name></Body>`, want: `<Body><Name>Jo</Name></Body>`},
+	}
+
+	redact := RedactElements("Password", "Card")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := &AuditRecord{Request: []byte(tt.data), Response: []byte(tt.data)}
+			redact(record)
+			assert.Equal(t, tt.want, string(record.Request))
+			assert.Equal(t, tt.want, string(record.Response))
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package soap
+
+import (
+	"encoding"
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/beevik/etree"
+)
+
+// Implements the compatibility profile for Apache Axis 1.x services, which use the rpc/encoded style.
+
+const soapEncNS = "http://schemas.xmlsoap.org/soap/encoding/"
+
+// maxInlinedElements is the number of elements which may be copied into a response when inlining its multiRef
+// elements. Each reference is replaced by a copy of the element it references, including its own references, so a
+// small response whose multiRef elements reference each other several times would otherwise expand exponentially.
+const maxInlinedElements = 1 << 18
+
+// ErrMultiRefLimitExceeded is returned if inlining the multiRef elements of a response would copy more elements into
+// it than are allowed, as when they reference each other in order to make the response expand exponentially.
+var ErrMultiRefLimitExceeded = newCategoryError(ErrDecode, "response multiRef elements expand beyond the maximum number of elements")
+
+const (
+	// axisDateTimeFormat is the format of the xsd:dateTime values sent and expected by Axis 1.x, which can't parse
+	// fractional seconds beyond milliseconds.
+	axisDateTimeFormat = "2006-01-02T15:04:05.000Z"
+	// dateFormat is the format of xsd:date values.
+	dateFormat = "2006-01-02"
+)
+
+// WithAxisCompatibility adjusts requests and responses to suit Apache Axis 1.x services using the rpc/encoded style:
+//   - the operation element declares the SOAP encoding style,
+//   - elements holding simple values declare their XML schema type with xsi:type, based on the Go type they were
+//     marshalled from, as Axis won't deserialize untyped values,
+//   - time.Time values are sent in UTC with millisecond precision, and Date values are sent as xsd:date, and
+//   - multiRef elements in responses are inlined at each element referencing them with an href attribute before the
+//     response is decoded, so response types can be declared as though the values were nested. Responses whose
+//     multiRef elements would expand into too many elements are rejected with ErrMultiRefLimitExceeded.
+//
+// Complex values are left untyped, for the service to resolve from its type mappings. Multipart responses are not
+// rewritten.
+func WithAxisCompatibility() ClientOption {
+	return func(c *Client) {
+		c.compat = axisProfile
+	}
+}
+
+var axisProfile = &compatProfile{
+	quoteAction:       true,
+	transform:         axisTransform,
+	responseTransform: resolveMultiRefs,
+}
+
+// Date is an xsd:date value, marshalled without a time or time zone.
+type Date struct {
+	time.Time
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.Format(dateFormat)), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+// A trailing time zone, as allowed by xsd:date and sent by Axis 1.x, is accepted.
+func (d *Date) UnmarshalText(text []byte) error {
+	value := string(text)
+	layout := dateFormat
+	if len(value) > len(dateFormat) {
+		layout = dateFormat + "Z07:00"
+	}
+
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return err
+	}
+	d.Time = t
+	return nil
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	dateType          = reflect.TypeOf(Date{})
+	bytesType         = reflect.TypeOf([]byte(nil))
+	marshalerType     = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// xsdTypes are the XML schema types of the Go kinds Axis 1.x maps them from.
+var xsdTypes = map[reflect.Kind]string{
+	reflect.Bool:    "xsd:boolean",
+	reflect.Int:     "xsd:long",
+	reflect.Int8:    "xsd:byte",
+	reflect.Int16:   "xsd:short",
+	reflect.Int32:   "xsd:int",
+	reflect.Int64:   "xsd:long",
+	reflect.Uint:    "xsd:unsignedLong",
+	reflect.Uint8:   "xsd:unsignedByte",
+	reflect.Uint16:  "xsd:unsignedShort",
+	reflect.Uint32:  "xsd:unsignedInt",
+	reflect.Uint64:  "xsd:unsignedLong",
+	reflect.Float32: "xsd:float",
+	reflect.Float64: "xsd:double",
+	reflect.String:  "xsd:string",
+}
+
+func axisTransform(doc *etree.Document, content interface{}) {
+	root := doc.Root()
+	if root == nil {
+		return
+	}
+
+	declareNamespace(root, envelopePrefix, soapEnvNS)
+	declareNamespace(root, "soapenc", soapEncNS)
+	declareNamespace(root, "xsd", xsdNS)
+	declareNamespace(root, "xsi", xsiNS)
+
+	body := root.SelectElement("Body")
+	if body == nil {
+		return
+	}
+	for _, op := range body.ChildElements() {
+		op.CreateAttr(envelopePrefix+":encodingStyle", soapEncNS)
+		if content != nil {
+			annotateTypes(op, reflect.TypeOf(content))
+		}
+	}
+}
+
+// annotateTypes adds xsi:type attributes to elem and its children, which were marshalled from a value of type t.
+func annotateTypes(elem *etree.Element, t reflect.Type) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		if value, err := time.Parse(time.RFC3339Nano, elem.Text()); err == nil {
+			elem.SetText(value.UTC().Format(axisDateTimeFormat))
+		}
+		elem.CreateAttr("xsi:type", "xsd:dateTime")
+		return
+	case t == dateType:
+		elem.CreateAttr("xsi:type", "xsd:date")
+		return
+	case implements(t, marshalerType) || implements(t, textMarshalerType):
+		// The content of the element is up to the marshaler, so it can't be related back to the type.
+		return
+	}
+
+	if t.Kind() != reflect.Struct {
+		if xsdType, ok := xsdTypes[t.Kind()]; ok {
+			elem.CreateAttr("xsi:type", xsdType)
+		}
+		return
+	}
+
+	fields := elementFields(t)
+	for _, child := range elem.ChildElements() {
+		if ft, ok := fields[child.Tag]; ok {
+			annotateTypes(child, ft)
+		}
+	}
+
+	// A struct holding only attributes and character data is typed by its character data.
+	if ft, ok := fields[",chardata"]; ok && len(elem.ChildElements()) == 0 {
+		annotateTypes(elem, ft)
+	}
+}
+
+// implements returns whether the type t or a pointer to it implements the interface type iface.
+func implements(t reflect.Type, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+// elementFields maps the names of the elements marshalled from the fields of the struct type t to their types.
+// Slices map to the type of their items, as each item is marshalled as a separate element. The field holding
+// character data, if any, is mapped from ",chardata".
+func elementFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous || f.Name == "XMLName" {
+			continue
+		}
+
+		tag := f.Tag.Get("xml")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if idx := strings.Index(tag, ","); idx >= 0 {
+			name, opts = tag[:idx], tag[idx+1:]
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Slice && ft != bytesType {
+			ft = ft.Elem()
+		}
+
+		switch {
+		case strings.Contains(","+opts+",", ",chardata,"):
+			fields[",chardata"] = f.Type
+			continue
+		case opts != "" && opts != "omitempty":
+			// Attributes, inner XML, comments and any elements aren't typed.
+			continue
+		case f.Anonymous && name == "":
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for name, ft := range elementFields(embedded) {
+					if _, ok := fields[name]; !ok {
+						fields[name] = ft
+					}
+				}
+				continue
+			}
+		case strings.Contains(name, ">"):
+			// Parent elements of nested fields have no type of their own.
+			continue
+		}
+
+		if idx := strings.LastIndex(name, " "); idx >= 0 {
+			name = name[idx+1:]
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = ft
+	}
+	return fields
+}
+
+// resolveMultiRefs replaces each element referencing a multiRef element of the body with an href attribute by a
+// copy of the referenced element, then removes the multiRef elements. It returns ErrMultiRefLimitExceeded if more
+// than maxInlinedElements elements would be copied.
+func resolveMultiRefs(doc *etree.Document) error {
+	root := doc.Root()
+	if root == nil {
+		return nil
+	}
+	body := root.SelectElement("Body")
+	if body == nil {
+		return nil
+	}
+
+	refs := map[string]*etree.Element{}
+	for _, child := range body.ChildElements() {
+		if id := child.SelectAttrValue("id", ""); child.Tag == "multiRef" && id != "" {
+			refs[id] = child
+			body.RemoveChild(child)
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+
+	r := &multiRefResolver{refs: refs, active: map[string]bool{}, remaining: maxInlinedElements}
+	for _, child := range body.ChildElements() {
+		if err := r.inline(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// multiRefResolver inlines the multiRef elements of a response.
+type multiRefResolver struct {
+	// refs are the multiRef elements, by id.
+	refs map[string]*etree.Element
+	// active holds the references being inlined, so that cyclic references are left unresolved rather than being
+	// followed forever.
+	active map[string]bool
+	// remaining is the number of elements which may still be copied.
+	remaining int
+}
+
+// inline resolves the references of elem and its children.
+func (r *multiRefResolver) inline(elem *etree.Element) error {
+	href := elem.SelectAttrValue("href", "")
+	if strings.HasPrefix(href, "#") {
+		id := href[1:]
+		if ref, ok := r.refs[id]; ok && !r.active[id] {
+			if r.remaining -= len(ref.FindElements("//*")); r.remaining < 0 {
+				return ErrMultiRefLimitExceeded
+			}
+
+			elem.RemoveAttr("href")
+			for _, attr := range ref.Attr {
+				if isMultiRefAttr(attr) || elem.SelectAttr(attrKey(attr)) != nil {
+					continue
+				}
+				elem.Attr = append(elem.Attr, attr)
+			}
+			// Adding each child removes it from the copy.
+			for children := ref.Copy(); len(children.Child) > 0; {
+				elem.AddChild(children.Child[0])
+			}
+
+			r.active[id] = true
+			defer delete(r.active, id)
+		}
+	}
+
+	for _, child := range elem.ChildElements() {
+		if err := r.inline(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isMultiRefAttr returns whether attr only has meaning on a multiRef element.
+func isMultiRefAttr(attr etree.Attr) bool {
+	switch {
+	case attr.Space == "" && attr.Key == "id":
+		return true
+	case attr.Space != "" && attr.Space != "xmlns" && (attr.Key == "root" || attr.Key == "encodingStyle"):
+		return true
+	}
+	return false
+}
+
+// attrKey returns the key of attr as used by etree, including any prefix.
+func attrKey(attr etree.Attr) string {
+	if attr.Space != "" {
+		return attr.Space + ":" + attr.Key
+	}
+	return attr.Key
+}
@@ -0,0 +1,160 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type axisTestRequest struct {
+	XMLName  xml.Name          `xml:"urn:quotes getQuotes"`
+	Symbols  []string          `xml:"symbols"`
+	Limit    int32             `xml:"limit"`
+	Since    time.Time         `xml:"since"`
+	Day      Date              `xml:"day"`
+	Exchange *axisTestExchange `xml:"exchange"`
+}
+
+type axisTestExchange struct {
+	Code  string  `xml:"code,attr"`
+	Name  string  `xml:",chardata"`
+	Ratio float64 `xml:"-"`
+}
+
+type axisTestResponse struct {
+	XMLName xml.Name         `xml:"urn:quotes getQuotesResponse"`
+	Quotes  []*axisTestQuote `xml:"getQuotesReturn>item"`
+}
+
+type axisTestQuote struct {
+	Symbol string         `xml:"symbol"`
+	Price  float64        `xml:"price"`
+	Day    Date           `xml:"day"`
+	Prev   *axisTestQuote `xml:"previous"`
+}
+
+const axisTestMultiRefResponse = `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">
+<soapenv:Body>
+<ns1:getQuotesResponse soapenv:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/" xmlns:ns1="urn:quotes">
+<getQuotesReturn soapenc:arrayType="ns2:Quote[2]" xsi:type="soapenc:Array" xmlns:ns2="urn:quotes" xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/">
+<item href="#id0"/>
+<item href="#id1"/>
+</getQuotesReturn>
+</ns1:getQuotesResponse>
+<multiRef id="id0" soapenc:root="0" soapenv:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/" xsi:type="ns3:Quote" xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/" xmlns:ns3="urn:quotes">
+<symbol xsi:type="xsd:string">ACME</symbol>
+<price xsi:type="xsd:double">12.5</price>
+<day xsi:type="xsd:date">2019-03-01Z</day>
+<previous href="#id1"/>
+</multiRef>
+<multiRef id="id1" soapenc:root="0" soapenv:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/" xsi:type="ns4:Quote" xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/" xmlns:ns4="urn:quotes">
+<symbol xsi:type="xsd:string">ACME</symbol>
+<price xsi:type="xsd:double">12.25</price>
+<day xsi:type="xsd:date">2019-02-28Z</day>
+</multiRef>
+</soapenv:Body>
+</soapenv:Envelope>`
+
+func TestClientAxisCompatibility(t *testing.T) {
+	var action string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		action = r.Header.Get("SOAPAction")
+		body, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write([]byte(axisTestMultiRefResponse))
+	}))
+	defer server.Close()
+
+	since := time.Date(2019, 3, 1, 9, 30, 15, 123456789, time.FixedZone("EST", -5*60*60))
+	content := &axisTestRequest{
+		Symbols:  []string{"ACME", "INIT"},
+		Limit:    2,
+		Since:    since,
+		Day:      Date{time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)},
+		Exchange: &axisTestExchange{Code: "NYSE", Name: "New York"},
+	}
+	resp := &axisTestResponse{}
+
+	client := NewClient(server.Client(), WithAxisCompatibility())
+	_, err := client.Do(context.Background(), NewRequest("", server.URL, content, resp, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, `""`, action)
+
+	assert.Equal(t, `<Envelope xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/" xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns="http://schemas.xmlsoap.org/soap/envelope/">`+
+		`<Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><getQuotes xmlns="urn:quotes" soapenv:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">`+
+		`<symbols xsi:type="xsd:string">ACME</symbols><symbols xsi:type="xsd:string">INIT</symbols>`+
+		`<limit xsi:type="xsd:int">2</limit>`+
+		`<since xsi:type="xsd:dateTime">2019-03-01T14:30:15.123Z</since>`+
+		`<day xsi:type="xsd:date">2019-03-01</day>`+
+		`<exchange code="NYSE" xsi:type="xsd:string">New York</exchange>`+
+		`</getQuotes></Body></Envelope>`, string(body))
+
+	if assert.Len(t, resp.Quotes, 2) {
+		assert.Equal(t, "ACME", resp.Quotes[0].Symbol)
+		assert.Equal(t, 12.5, resp.Quotes[0].Price)
+		assert.Equal(t, "2019-03-01", resp.Quotes[0].Day.Format("2006-01-02"))
+		if assert.NotNil(t, resp.Quotes[0].Prev) {
+			assert.Equal(t, 12.25, resp.Quotes[0].Prev.Price)
+		}
+		assert.Equal(t, 12.25, resp.Quotes[1].Price)
+		assert.Nil(t, resp.Quotes[1].Prev)
+	}
+}
+
+func TestClientAxisMultiRefLimit(t *testing.T) {
+	// Each multiRef element references the next one twice, so inlining them would double the response 32 times.
+	var response strings.Builder
+	response.WriteString(`<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body>`)
+	response.WriteString(`<ns1:getQuotesResponse xmlns:ns1="urn:quotes"><getQuotesReturn><item href="#id0"/></getQuotesReturn></ns1:getQuotesResponse>`)
+	for i := 0; i < 32; i++ {
+		fmt.Fprintf(&response, `<multiRef id="id%d"><previous href="#id%d"/><previous href="#id%d"/></multiRef>`, i, i+1, i+1)
+	}
+	response.WriteString(`<multiRef id="id32"><symbol>ACME</symbol></multiRef></soapenv:Body></soapenv:Envelope>`)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write([]byte(response.String()))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client(), WithAxisCompatibility())
+	_, err := client.Do(context.Background(), NewRequest("", server.URL, &axisTestRequest{}, &axisTestResponse{}, nil))
+	assert.True(t, errors.Is(err, ErrMultiRefLimitExceeded), "%v is not %v", err, ErrMultiRefLimitExceeded)
+	assert.True(t, errors.Is(err, ErrDecode), "%v is not a decoding error", err)
+}
+
+func TestDateUnmarshalText(t *testing.T) {
+	var tests = []struct {
+		text string
+		want time.Time
+		err  bool
+	}{
+		{text: "2019-03-01", want: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{text: "2019-03-01Z", want: time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{text: "2019-03-01+01:00", want: time.Date(2019, 3, 1, 0, 0, 0, 0, time.FixedZone("", 60*60))},
+		{text: "2019-03-01T00:00:00Z", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var d Date
+			err := d.UnmarshalText([]byte(tt.text))
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.True(t, tt.want.Equal(d.Time))
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package soap
+
+import (
+	"encoding/xml"
+)
+
+// Implements non-wrapped ("bare") document/literal messages, whose body holds several elements.
+
+// BareParts are the parts of a non-wrapped ("bare") document/literal message, each bound directly to an element of
+// the body rather than wrapped in a single element named after the operation. They may be used as the body of a
+// request, and as its response type, in place of a struct wrapping the parts.
+// Each part is a pointer to a type marshalled as an element, named as for FaultDetails. The parts are marshalled in
+// order, as the elements of the body. When unmarshalled, each element of the body is decoded into the first part with
+// a matching name, whatever their order; elements matching none of the parts are skipped.
+type BareParts []interface{}
+
+// MarshalXML writes each part to the encoder as an element of its own, in place of the element start.
+func (p BareParts) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	for _, part := range p {
+		if err := e.Encode(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeElement decodes the element start into the part with a matching name, or skips it if there is none.
+func (p BareParts) decodeElement(d *xml.Decoder, start xml.StartElement, strict bool) error {
+	part := FaultDetails(p).match(start.Name)
+	switch {
+	case part == nil:
+		return d.Skip()
+	case strict:
+		return decodeStrict(d, part, start)
+	}
+	return d.DecodeElement(part, &start)
+}
@@ -0,0 +1,97 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bareQuote struct {
+	XMLName xml.Name `xml:"urn:quotes Quote"`
+	Symbol  string   `xml:"Symbol"`
+}
+
+type bareOptions struct {
+	XMLName  xml.Name `xml:"urn:quotes Options"`
+	Detailed bool     `xml:"Detailed"`
+}
+
+type bareStatus struct {
+	Code int `xml:"Code"`
+}
+
+func TestBareParts(t *testing.T) {
+	var tests = []struct {
+		name     string
+		response string
+		strict   bool
+		quote    bareQuote
+		status   bareStatus
+		err      bool
+	}{
+		{
+			name:     "parts in order",
+			response: `<q:Quote xmlns:q="urn:quotes"><Symbol>ABC</Symbol></q:Quote><bareStatus><Code>1</Code></bareStatus>`,
+			quote:    bareQuote{XMLName: xml.Name{Space: "urn:quotes", Local: "Quote"}, Symbol: "ABC"},
+			status:   bareStatus{Code: 1},
+		},
+		{
+			name:     "parts out of order with unknown elements",
+			response: `<bareStatus><Code>2</Code></bareStatus><Unknown/><q:Quote xmlns:q="urn:quotes"><Symbol>DEF</Symbol></q:Quote>`,
+			quote:    bareQuote{XMLName: xml.Name{Space: "urn:quotes", Local: "Quote"}, Symbol: "DEF"},
+			status:   bareStatus{Code: 2},
+		},
+		{
+			name:     "missing part",
+			response: `<bareStatus><Code>3</Code></bareStatus>`,
+			status:   bareStatus{Code: 3},
+		},
+		{
+			name:     "part in another namespace",
+			response: `<q:Quote xmlns:q="urn:other"><Symbol>ABC</Symbol></q:Quote>`,
+		},
+		{
+			name:     "strict namespaces",
+			response: `<q:Quote xmlns:q="urn:quotes"><x:Symbol xmlns:x="urn:other">ABC</x:Symbol></q:Quote>`,
+			strict:   true,
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := ioutil.ReadAll(r.Body)
+				body = string(data)
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>` + tt.response + `</Body></Envelope>`))
+			}))
+			defer server.Close()
+
+			var opts []ClientOption
+			if tt.strict {
+				opts = append(opts, WithStrictNamespaces())
+			}
+			client := NewClient(server.Client(), opts...)
+
+			quote, status := &bareQuote{}, &bareStatus{}
+			request := BareParts{&bareQuote{Symbol: "ABC"}, &bareOptions{Detailed: true}}
+			_, err := client.DoInto(context.Background(), "action", server.URL, request, BareParts{quote, status})
+			assert.True(t, strings.Contains(body, `><Quote xmlns="urn:quotes"><Symbol>ABC</Symbol></Quote><Options xmlns="urn:quotes"><Detailed>true</Detailed></Options></Body>`), body)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.quote, *quote)
+			assert.Equal(t, tt.status, *status)
+		})
+	}
+}
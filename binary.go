@@ -0,0 +1,151 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+)
+
+// Implements the streaming of base64-encoded binary content inline in envelopes, for services without MTOM support.
+
+// Base64Stream is the base64-encoded binary content of an element, which is encoded from Reader as the element is
+// marshalled and decoded to Writer as it is unmarshalled, rather than being held in memory as a []byte field.
+// The whole document is then never held in memory when large content is sent inline, provided the request is
+// streamed (see Request.StreamBody) and isn't buffered for signing or rewriting.
+// When decoding, the encoded text is decoded to Writer in chunks, without a copy of the decoded content. The encoded
+// text of the element is still held, as encoding/xml reads each run of character data as a single token, and
+// responses of known length are read in full before they are decoded, as described for Request.OnProgress.
+// Whitespace within the encoded text, such as the line breaks of MIME-style base64, is ignored, as are child elements.
+// SOAP encoding base64 elements, i.e. with an xsi:type of soapenc:base64, are decoded for []byte fields before they
+// reach UnmarshalXML, so they can't be streamed.
+// A nil Reader is marshalled as an empty element, and the content is skipped if Writer is nil. Neither is closed.
+type Base64Stream struct {
+	// Reader is the content encoded into the element when it is marshalled.
+	Reader io.Reader
+	// Writer is the destination of the content decoded from the element when it is unmarshalled.
+	Writer io.Writer
+}
+
+// base64ChunkSize is the size of the chunks of encoded text written to the encoder, or decoded at once.
+const base64ChunkSize = 4 << 10
+
+// base64Whitespace are the characters ignored within encoded text.
+const base64Whitespace = " \t\r\n"
+
+// MarshalXML writes the content of Reader to the encoder as base64-encoded character data of the element.
+func (s Base64Stream) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if s.Reader != nil {
+		w := base64.NewEncoder(base64.StdEncoding, charDataWriter{e})
+		// The chunks are a multiple of three bytes, so every write but the last is encoded in full.
+		buf := make([]byte, base64ChunkSize/4*3)
+		if _, err := io.CopyBuffer(w, s.Reader, buf); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+	}
+
+	return e.EncodeToken(start.End())
+}
+
+// charDataWriter writes to an encoder as character data.
+type charDataWriter struct {
+	e *xml.Encoder
+}
+
+// Write satisfies the io.Writer interface.
+func (w charDataWriter) Write(p []byte) (int, error) {
+	if err := w.e.EncodeToken(xml.CharData(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// UnmarshalXML decodes the base64-encoded character data of the element to Writer.
+func (s *Base64Stream) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if s.Writer == nil {
+		return d.Skip()
+	}
+
+	dec := base64StreamDecoder{w: s.Writer}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			if err := dec.write(t); err != nil {
+				return err
+			}
+		case xml.StartElement:
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return dec.close()
+		}
+	}
+}
+
+// base64StreamDecoder decodes base64-encoded text written to it in pieces to w, ignoring whitespace.
+type base64StreamDecoder struct {
+	w io.Writer
+	// pending holds the encoded text not decoded yet, which is less than a full chunk.
+	pending []byte
+	decoded []byte
+}
+
+// write decodes the text in full chunks, holding back the rest until more text, or the end of it, has been written.
+func (d *base64StreamDecoder) write(text []byte) error {
+	for {
+		text = bytes.TrimLeft(text, base64Whitespace)
+		if len(text) == 0 {
+			return nil
+		}
+
+		i := bytes.IndexAny(text, base64Whitespace)
+		if i < 0 {
+			i = len(text)
+		}
+		if n := base64ChunkSize - len(d.pending); i > n {
+			i = n
+		}
+		d.pending = append(d.pending, text[:i]...)
+		text = text[i:]
+
+		if len(d.pending) == base64ChunkSize {
+			if err := d.decode(d.pending); err != nil {
+				return err
+			}
+			d.pending = d.pending[:0]
+		}
+	}
+}
+
+// close decodes the rest of the text, which must be correctly padded.
+func (d *base64StreamDecoder) close() error {
+	err := d.decode(d.pending)
+	d.pending = nil
+	return err
+}
+
+// decode decodes the encoded text to w.
+func (d *base64StreamDecoder) decode(encoded []byte) error {
+	if cap(d.decoded) < base64.StdEncoding.DecodedLen(len(encoded)) {
+		d.decoded = make([]byte, base64.StdEncoding.DecodedLen(len(encoded)))
+	}
+	n, err := base64.StdEncoding.Decode(d.decoded[:cap(d.decoded)], encoded)
+	if err != nil {
+		return err
+	}
+	_, err = d.w.Write(d.decoded[:n])
+	return err
+}
@@ -0,0 +1,120 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type binaryExample struct {
+	XMLName xml.Name      `xml:"urn:example Upload"`
+	Name    string        `xml:"Name"`
+	Data    *Base64Stream `xml:"Data"`
+}
+
+func TestBase64StreamMarshal(t *testing.T) {
+	large := bytes.Repeat([]byte("binary content\x00\xff"), 1000)
+
+	var tests = []struct {
+		name    string
+		content []byte
+	}{
+		{name: "empty", content: []byte{}},
+		{name: "short", content: []byte("ab")},
+		{name: "several chunks", content: large},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := xml.Marshal(&binaryExample{Name: "file", Data: &Base64Stream{Reader: bytes.NewReader(tt.content)}})
+			assert.Nil(t, err)
+
+			expected := `<Upload xmlns="urn:example"><Name>file</Name><Data>` + base64.StdEncoding.EncodeToString(tt.content) + `</Data></Upload>`
+			assert.Equal(t, expected, string(enc))
+		})
+	}
+}
+
+func TestBase64StreamUnmarshal(t *testing.T) {
+	large := bytes.Repeat([]byte("binary content\x00\xff"), 1000)
+	encoded := base64.StdEncoding.EncodeToString(large)
+
+	// MIME-style base64, with the lines wrapped at 76 characters.
+	var wrapped strings.Builder
+	for i := 0; i < len(encoded); i += 76 {
+		end := i + 76
+		if end > len(encoded) {
+			end = len(encoded)
+		}
+		wrapped.WriteString(encoded[i:end] + "\r\n")
+	}
+
+	var tests = []struct {
+		name     string
+		data     string
+		expected []byte
+		err      bool
+	}{
+		{name: "empty", data: ``, expected: []byte{}},
+		{name: "short", data: `YWI=`, expected: []byte("ab")},
+		{name: "several chunks", data: encoded, expected: large},
+		{name: "wrapped", data: wrapped.String(), expected: large},
+		{name: "split by a comment", data: `YW<!-- comment -->I=`, expected: []byte("ab")},
+		{name: "invalid", data: `YW*=`, err: true},
+		{name: "truncated", data: `YWI`, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			v := &binaryExample{Data: &Base64Stream{Writer: &buf}}
+
+			err := xml.Unmarshal([]byte(`<Upload xmlns="urn:example"><Data>`+tt.data+`</Data><Name>file</Name></Upload>`), v)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, append([]byte{}, buf.Bytes()...))
+			assert.Equal(t, "file", v.Name)
+		})
+	}
+}
+
+func TestBase64StreamUnmarshalWithoutWriter(t *testing.T) {
+	v := &binaryExample{Data: &Base64Stream{}}
+
+	err := xml.Unmarshal([]byte(`<Upload xmlns="urn:example"><Data>YWI=</Data><Name>file</Name></Upload>`), v)
+	assert.Nil(t, err)
+	assert.Equal(t, "file", v.Name)
+}
+
+func TestBase64StreamRequest(t *testing.T) {
+	content := bytes.Repeat([]byte("binary content\x00\xff"), 1000)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The request is echoed back, with the upload as the response.
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	var received bytes.Buffer
+	resp := &binaryExample{Data: &Base64Stream{Writer: &received}}
+	req := NewRequest("action", server.URL, &binaryExample{Name: "file", Data: &Base64Stream{Reader: bytes.NewReader(content)}}, resp, nil)
+	req.StreamBody(true)
+
+	_, err := NewClient(server.Client()).Do(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, "file", resp.Name)
+	assert.Equal(t, content, received.Bytes())
+}
@@ -1,8 +1,11 @@
 package soap
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/beevik/etree"
 )
@@ -21,10 +24,6 @@ var (
 // It has not been tested with a comprehensive collection of possible input documents.
 // It happens to work with the XML documents we are generating in this project.
 func canonicalize(bytes []byte, rootElement string) ([]byte, error) {
-	var nsIdx int
-	nsMap := map[string]string{}
-	nsIdx = 1
-
 	existing := etree.NewDocument()
 	err := existing.ReadFromBytes(bytes)
 	if err != nil {
@@ -43,11 +42,202 @@ func canonicalize(bytes []byte, rootElement string) ([]byte, error) {
 		return nil, errInvalidCanonicalizationPath
 	}
 
-	canonicalizeChildren(startElem, &nsIdx, nsMap)
+	canonicalizeElement(startElem)
 
 	return canonicalDoc.WriteToBytes()
 }
 
+// canonicalizeElement canonicalizes the children of the supplied element in place, as described in canonicalize.
+// This allows a document that has already been parsed to be canonicalized without serializing and parsing it again.
+func canonicalizeElement(element *etree.Element) {
+	nsIdx := 1
+	canonicalizeChildren(element, &nsIdx, map[string]string{})
+}
+
+// xmlNS is the namespace of the xml prefix, which is bound without being declared.
+const xmlNS = "http://www.w3.org/XML/1998/namespace"
+
+var (
+	c14nTextReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "\r", "&#xD;")
+	c14nAttrReplacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", `"`, "&quot;", "\t", "&#x9;", "\n", "&#xA;", "\r", "&#xD;")
+)
+
+// serializeElement returns the Exclusive C14N form, without comments, of the element and its descendants other than
+// exclude, if set, as the enveloped signature transform leaves them. Unlike canonicalize, it doesn't rewrite the
+// prefixes of the element: it renders the form the signature of the element is computed over, wherever the element
+// was produced.
+// The namespaces declared by the element or its ancestors are rendered where they are visibly utilized, by the name
+// of an element or attribute, as are those whose prefixes are in inclusive, the PrefixList of the InclusiveNamespaces
+// of the transform, where "#default" stands for the default namespace.
+func serializeElement(element *etree.Element, inclusive []string, exclude *etree.Element) []byte {
+	c := c14nWriter{inclusive: map[string]bool{}, exclude: exclude}
+	for _, prefix := range inclusive {
+		if prefix == "#default" {
+			prefix = ""
+		}
+		c.inclusive[prefix] = true
+	}
+
+	c.writeElement(element, namespacesInScope(element.Parent()), map[string]string{})
+	return c.buf.Bytes()
+}
+
+// namespacesInScope returns the namespaces in scope at the element, by prefix, the default namespace having an empty
+// one.
+func namespacesInScope(elem *etree.Element) map[string]string {
+	var ancestors []*etree.Element
+	for e := elem; e != nil; e = e.Parent() {
+		ancestors = append(ancestors, e)
+	}
+
+	scope := map[string]string{}
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		for _, attr := range ancestors[i].Attr {
+			if prefix, ok := namespaceDeclaration(attr); ok {
+				scope[prefix] = attr.Value
+			}
+		}
+	}
+	return scope
+}
+
+// namespaceDeclaration checks whether the attribute declares a namespace, returning its prefix, which is empty for
+// the default namespace.
+func namespaceDeclaration(attr etree.Attr) (string, bool) {
+	switch {
+	case attr.Space == "xmlns":
+		return attr.Key, true
+	case attr.Space == "" && attr.Key == "xmlns":
+		return "", true
+	}
+	return "", false
+}
+
+// c14nWriter writes the Exclusive C14N form of elements.
+type c14nWriter struct {
+	buf bytes.Buffer
+	// inclusive are the prefixes whose namespaces are rendered as by inclusive canonicalization.
+	inclusive map[string]bool
+	// exclude is the element left out of the canonical form, if any.
+	exclude *etree.Element
+}
+
+// writeElement writes the canonical form of the element, whose parent has the namespaces in scope, rendered are the
+// namespaces rendered by the elements written around it.
+func (c *c14nWriter) writeElement(elem *etree.Element, parentScope map[string]string, rendered map[string]string) {
+	scope := parentScope
+	declares := false
+	var attrs []etree.Attr
+	for _, attr := range elem.Attr {
+		prefix, ok := namespaceDeclaration(attr)
+		if !ok {
+			attrs = append(attrs, attr)
+			continue
+		}
+		if !declares {
+			scope = copyNamespaces(parentScope)
+			declares = true
+		}
+		scope[prefix] = attr.Value
+	}
+
+	// The namespaces rendered are those the element utilizes visibly, or which are inclusive, and which the elements
+	// written around it don't render already.
+	utilized := map[string]bool{elem.Space: true}
+	for _, attr := range attrs {
+		if attr.Space != "" {
+			utilized[attr.Space] = true
+		}
+	}
+	for prefix := range c.inclusive {
+		if _, ok := scope[prefix]; ok {
+			utilized[prefix] = true
+		}
+	}
+	var prefixes []string
+	for prefix := range utilized {
+		if prefix != "xml" && scope[prefix] != rendered[prefix] && (prefix == "" || scope[prefix] != "") {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+	if len(prefixes) > 0 {
+		rendered = copyNamespaces(rendered)
+	}
+
+	// Attributes are sorted by namespace, then by local name, attributes without a prefix having no namespace.
+	attrNS := func(attr etree.Attr) string {
+		if attr.Space == "xml" {
+			return xmlNS
+		}
+		if attr.Space == "" {
+			return ""
+		}
+		return scope[attr.Space]
+	}
+	sort.SliceStable(attrs, func(i, j int) bool {
+		if nsi, nsj := attrNS(attrs[i]), attrNS(attrs[j]); nsi != nsj {
+			return nsi < nsj
+		}
+		return attrs[i].Key < attrs[j].Key
+	})
+
+	name := c14nName(elem.Space, elem.Tag)
+	c.buf.WriteString("<" + name)
+	for _, prefix := range prefixes {
+		rendered[prefix] = scope[prefix]
+		c.writeAttr(c14nName("xmlns", prefix), scope[prefix])
+	}
+	for _, attr := range attrs {
+		c.writeAttr(c14nName(attr.Space, attr.Key), attr.Value)
+	}
+	c.buf.WriteString(">")
+
+	for _, token := range elem.Child {
+		switch token := token.(type) {
+		case *etree.Element:
+			if token != c.exclude {
+				c.writeElement(token, scope, rendered)
+			}
+		case *etree.CharData:
+			c.buf.WriteString(c14nTextReplacer.Replace(token.Data))
+		case *etree.ProcInst:
+			c.buf.WriteString("<?" + token.Target)
+			if token.Inst != "" {
+				c.buf.WriteString(" " + token.Inst)
+			}
+			c.buf.WriteString("?>")
+		}
+	}
+	c.buf.WriteString("</" + name + ">")
+}
+
+// writeAttr writes an attribute, including a namespace declaration, with the value escaped.
+func (c *c14nWriter) writeAttr(name string, value string) {
+	c.buf.WriteString(" " + name + `="` + c14nAttrReplacer.Replace(value) + `"`)
+}
+
+// c14nName returns the name with the prefix, if any. The name of the declaration of the default namespace,
+// xmlns, is the "xmlns" prefix without a name.
+func c14nName(prefix string, name string) string {
+	switch {
+	case prefix == "":
+		return name
+	case name == "":
+		return prefix
+	}
+	return prefix + ":" + name
+}
+
+// copyNamespaces returns a copy of the namespaces, by prefix.
+func copyNamespaces(namespaces map[string]string) map[string]string {
+	c := make(map[string]string, len(namespaces)+1)
+	for prefix, uri := range namespaces {
+		c[prefix] = uri
+	}
+	return c
+}
+
 // canonicalizeChildren takes an element and an existing map of namespaces, and recursively canonicalizes all child nodes.
 // If a new namespace is encountered a handle is generated using the nsIdx value, and that namespace is added
 // to the nsMap argument.
@@ -60,7 +250,11 @@ func canonicalizeChildren(element *etree.Element, nsIdx *int, nsMap map[string]s
 	for _, token := range element.Child {
 		switch token := token.(type) {
 		case *etree.Element:
-			canonNs := token.Parent().Space
+			// Elements already written with a prefix, i.e. by Request.PrefixBody, keep it.
+			canonNs := token.Space
+			if canonNs == "" {
+				canonNs = token.Parent().Space
+			}
 			for _, attr := range token.Attr {
 				// Here we find or define a short-hand reference for the namespace
 				if attr.Key == "xmlns" {
@@ -3,6 +3,7 @@ package soap
 import (
 	"testing"
 
+	"github.com/beevik/etree"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -54,3 +55,77 @@ func TestCanonicalization(t *testing.T) {
 		})
 	}
 }
+
+func TestSerializeElement(t *testing.T) {
+	var tests = []struct {
+		name      string
+		xml       string
+		path      string
+		inclusive []string
+		exclude   string
+		result    string
+	}{
+		{
+			name:   "namespaces of ancestors",
+			xml:    `<a:Root xmlns:a="urn:a" xmlns:b="urn:b" xmlns:c="urn:c" xmlns:d="urn:d"><b:Child c:attr="1" z="2" a:y="3">text</b:Child></a:Root>`,
+			path:   "Root/Child",
+			result: `<b:Child xmlns:a="urn:a" xmlns:b="urn:b" xmlns:c="urn:c" z="2" a:y="3" c:attr="1">text</b:Child>`,
+		},
+		{
+			name:   "default namespace",
+			xml:    `<Root xmlns="urn:d" xmlns:x="urn:x"><Child><x:Leaf/><Leaf xmlns="urn:d"/></Child></Root>`,
+			path:   "Root/Child",
+			result: `<Child xmlns="urn:d"><x:Leaf xmlns:x="urn:x"></x:Leaf><Leaf></Leaf></Child>`,
+		},
+		{
+			name:   "undeclared default namespace",
+			xml:    `<Root xmlns="urn:d"><Child><Leaf xmlns=""/></Child></Root>`,
+			path:   "Root/Child",
+			result: `<Child xmlns="urn:d"><Leaf xmlns=""></Leaf></Child>`,
+		},
+		{
+			name:      "inclusive namespaces",
+			xml:       `<Root xmlns="urn:d" xmlns:x="urn:x" xmlns:y="urn:y"><z:Child xmlns:z="urn:z"><Leaf/></z:Child></Root>`,
+			path:      "Root/Child",
+			inclusive: []string{"x", "#default"},
+			result:    `<z:Child xmlns="urn:d" xmlns:x="urn:x" xmlns:z="urn:z"><Leaf></Leaf></z:Child>`,
+		},
+		{
+			name:    "excluded element",
+			xml:     `<Root><Keep/><Drop><Inner/></Drop></Root>`,
+			path:    "Root",
+			exclude: "Root/Drop",
+			result:  `<Root><Keep></Keep></Root>`,
+		},
+		{
+			name:   "escaping",
+			xml:    `<Root a="&lt;&gt;&quot;&apos;&#9;">&lt;&gt;&amp;&quot;&apos;</Root>`,
+			path:   "Root",
+			result: `<Root a="&lt;>&quot;'&#x9;">&lt;&gt;&amp;"'</Root>`,
+		},
+		{
+			name:   "comments and processing instructions",
+			xml:    `<Root><!-- comment --><?target data?>text</Root>`,
+			path:   "Root",
+			result: `<Root><?target data?>text</Root>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := etree.NewDocument()
+			if !assert.Nil(t, doc.ReadFromString(tt.xml)) {
+				return
+			}
+			elem := doc.FindElement(tt.path)
+			if !assert.NotNil(t, elem) {
+				return
+			}
+			var exclude *etree.Element
+			if tt.exclude != "" {
+				exclude = doc.FindElement(tt.exclude)
+			}
+			assert.Equal(t, tt.result, string(serializeElement(elem, tt.inclusive, exclude)))
+		})
+	}
+}
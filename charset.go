@@ -0,0 +1,111 @@
+package soap
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+)
+
+// Implements the serialization of requests in charsets other than UTF-8.
+
+// Charset is a character encoding requests can be sent in; see WithRequestCharset.
+type Charset struct {
+	// Name is the name of the charset, as declared by the XML declaration of requests and their Content-Type header.
+	Name string
+	// Encode appends the encoding of r to dst, returning false if r can't be encoded in the charset.
+	Encode func(dst []byte, r rune) ([]byte, bool)
+}
+
+var (
+	// ISO88591 is the ISO-8859-1 (Latin-1) charset.
+	ISO88591 = Charset{Name: "ISO-8859-1", Encode: singleByteEncoder(0xFF)}
+	// USASCII is the US-ASCII charset.
+	USASCII = Charset{Name: "US-ASCII", Encode: singleByteEncoder(0x7F)}
+)
+
+// singleByteEncoder returns the Encode function of a charset encoding the characters up to max as a single byte of
+// the same value.
+func singleByteEncoder(max rune) func(dst []byte, r rune) ([]byte, bool) {
+	return func(dst []byte, r rune) ([]byte, bool) {
+		if r > max {
+			return dst, false
+		}
+		return append(dst, byte(r)), true
+	}
+}
+
+// WithRequestCharset makes the client send requests encoded in the charset rather than UTF-8, with an XML declaration
+// and Content-Type header declaring it, for services rejecting UTF-8 requests holding characters outside of ASCII.
+// Characters which can't be encoded in the charset are written as character references, which is only valid within
+// text and attribute values: the names of elements and attributes, comments and CDATA sections must be encodable.
+// Signatures remain valid, as they are computed over the canonical form of the envelope, which is always UTF-8.
+func WithRequestCharset(charset Charset) ClientOption {
+	return func(c *Client) {
+		c.charset = &charset
+	}
+}
+
+// xmlDeclaration returns the XML declaration of documents encoded in the charset.
+func (c *Charset) xmlDeclaration() string {
+	return `<?xml version="1.0" encoding="` + c.Name + `"?>` + "\n"
+}
+
+// newCharsetReader returns a reader transcoding the UTF-8 document read from r to the charset, preceded by an XML
+// declaration. Closing it closes r, if r is an io.Closer, so that the encoding of a streamed envelope stops when the
+// request isn't sent in full.
+func newCharsetReader(r io.Reader, charset *Charset) io.ReadCloser {
+	return &charsetReader{src: r, r: bufio.NewReader(r), charset: charset, pending: []byte(charset.xmlDeclaration())}
+}
+
+// charsetReader is a reader transcoding a UTF-8 document to a charset, writing the characters which can't be encoded
+// as character references.
+type charsetReader struct {
+	src     io.Reader
+	r       *bufio.Reader
+	charset *Charset
+	pending []byte
+	buf     []byte
+}
+
+// Read satisfies the io.Reader interface. The XML declaration comes first, then each character transcoded as it is
+// read. Read hands over what it has once the underlying reader has nothing buffered, so the pipe of a streamed request
+// is drained as the encoder writes to it.
+func (r *charsetReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.pending) > 0 {
+			copied := copy(p[n:], r.pending)
+			r.pending = r.pending[copied:]
+			n += copied
+			continue
+		}
+		if n > 0 && r.r.Buffered() == 0 {
+			break
+		}
+
+		c, _, err := r.r.ReadRune()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		encoded, ok := r.charset.Encode(r.buf[:0], c)
+		if !ok {
+			encoded = strconv.AppendInt(append(r.buf[:0], "&#"...), int64(c), 10)
+			encoded = append(encoded, ';')
+		}
+		r.buf = encoded
+		r.pending = encoded
+	}
+	return n, nil
+}
+
+// Close satisfies the io.Closer interface.
+func (r *charsetReader) Close() error {
+	if closer, ok := r.src.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package soap
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCharsetReader(t *testing.T) {
+	var tests = []struct {
+		name    string
+		charset Charset
+		in      string
+		want    string
+	}{
+		{name: "ASCII", charset: ISO88591, in: "<a>abc</a>", want: "<a>abc</a>"},
+		{name: "Latin-1", charset: ISO88591, in: "<a b=\"é\">Bogotá</a>", want: "<a b=\"\xe9\">Bogot\xe1</a>"},
+		{name: "unencodable in Latin-1", charset: ISO88591, in: "<a>é€\U0001F600</a>", want: "<a>\xe9&#8364;&#128512;</a>"},
+		{name: "unencodable in US-ASCII", charset: USASCII, in: "<a>café</a>", want: "<a>caf&#233;</a>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ioutil.ReadAll(newCharsetReader(strings.NewReader(tt.in), &tt.charset))
+			assert.Nil(t, err)
+			assert.Equal(t, `<?xml version="1.0" encoding="`+tt.charset.Name+`"?>`+"\n"+tt.want, string(out))
+		})
+	}
+}
+
+func TestClientRequestCharset(t *testing.T) {
+	type body struct {
+		City string `xml:"City"`
+	}
+
+	var tests = []struct {
+		name        string
+		options     []ClientOption
+		contentType string
+		want        string
+	}{
+		{
+			name:        "UTF-8",
+			contentType: `text/xml; charset="utf-8"`,
+			want:        "<City>Bogotá</City>",
+		},
+		{
+			name:        "ISO-8859-1",
+			options:     []ClientOption{WithRequestCharset(ISO88591)},
+			contentType: "text/xml; charset=ISO-8859-1",
+			want:        "<City>Bogot\xe1</City>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest("action", "http://example.com", &body{City: "Bogotá"}, nil, nil)
+			data, header, err := NewClient(nil, tt.options...).Serialize(req)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.contentType, header.Get("Content-Type"))
+			assert.Contains(t, string(data), tt.want)
+			if tt.options != nil {
+				assert.True(t, strings.HasPrefix(string(data), `<?xml version="1.0" encoding="ISO-8859-1"?>`))
+			}
+		})
+	}
+}
+
+func TestClientRequestCharsetStreamed(t *testing.T) {
+	type body struct {
+		City []string `xml:"City"`
+	}
+
+	// The server is closed, so the request fails before its body is read.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Close()
+
+	for _, parts := range [][]*MIMEPart{nil, {{ContentID: "part", Reader: strings.NewReader("part")}}} {
+		goroutines := runtime.NumGoroutine()
+
+		req := NewRequest("action", server.URL, &body{City: make([]string, 1000)}, nil, nil)
+		req.StreamBody(true)
+		for _, part := range parts {
+			req.AddPart(part)
+		}
+		_, err := NewClient(nil, WithRequestCharset(ISO88591)).Do(context.Background(), req)
+		assert.NotNil(t, err)
+
+		// The goroutines encoding the request stop once the transport closes its body.
+		for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.True(t, runtime.NumGoroutine() <= goroutines, "%d goroutines left running with %d parts", runtime.NumGoroutine()-goroutines, len(parts))
+	}
+}
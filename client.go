@@ -2,32 +2,93 @@ package soap
 
 import (
 	"context"
-	"errors"
+	"crypto/tls"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"time"
 )
 
 var (
 	// ErrInvalidPEMFileSpecified is returned if the PEM file specified for WS signing is invalid
-	ErrInvalidPEMFileSpecified = errors.New("invalid PEM key specified")
+	ErrInvalidPEMFileSpecified = newCategoryError(ErrSecurity, "invalid PEM key specified")
 	// ErrEncryptedPEMFileSpecified is returnedd if the PEM file specified for WS signing is encrypted
-	ErrEncryptedPEMFileSpecified = errors.New("encrypted PEM key specified")
+	ErrEncryptedPEMFileSpecified = newCategoryError(ErrSecurity, "encrypted PEM key specified")
 	// ErrUnsupportedContentType is returned if we encounter a non-supported content type while querying
-	ErrUnsupportedContentType = errors.New("unsupported content-type in response")
+	ErrUnsupportedContentType = newCategoryError(ErrDecode, "unsupported content-type in response")
 )
 
 // Client is an opaque handle to a SOAP service.
 type Client struct {
-	http *http.Client
+	http    *http.Client
+	logger  Logger
+	limiter RateLimiter
+	compat  *compatProfile
+
+	lenientContentType bool
+	lenientMultipart   bool
+	lenientUTF8        bool
+	emptyResponses     bool
+	strictNamespaces   bool
+	indentRequests     bool
+	envelopeNS         string
+	invalidChars       InvalidCharMode
+	charset            *Charset
+	operationNamer     OperationNamer
+	entities           map[string]string
+	multipartBuffering multipartBuffering
+	limits             decodeLimits
+
+	slowThreshold time.Duration
+	slowHandler   SlowRequestHandler
+	faultHandler  FaultHandler
+
+	invalidUTF8Handler InvalidUTF8Handler
+
+	deprecatedHandler DeprecatedAlgorithmHandler
+
+	auditSink      AuditSink
+	auditRedactors []AuditRedactor
+
+	hedging    bool
+	hedgeDelay time.Duration
+	hedgeURL   string
+
+	verifyCert CertificateVerifier
+
+	verifyTimestamps bool
+	timestampSkew    time.Duration
+	timestampMaxAge  time.Duration
+
+	retryPolicy RetryPolicy
+
+	operations map[string]*clientOperation
+
+	healthCheck *HealthCheck
+
+	transportOpts []func(*http.Transport)
+	tlsOpts       []func(*tls.Config)
 }
 
 // NewClient creates a new Client that will access a SOAP service.
 // Requests made using this client will all be wrapped in a SOAP envelope.
 // See https://www.w3schools.com/xml/xml_soap.asp for more details.
-// The default HTTP client used has no timeout nor circuit breaking. Override with SettHTTPClient. You have been warned.
-func NewClient(http *http.Client) *Client {
-	return &Client{
-		http: http,
+// The HTTP client may be nil, which is recommended unless it needs a custom http.RoundTripper. If it is nil, or uses
+// the shared default transport (i.e. http.DefaultClient), a dedicated transport with HTTP/2 enabled and bounded dial,
+// TLS handshake and header timeouts is used in its place; see the Default constants and transport options.
+// The overall request has no timeout nor circuit breaking unless the HTTP client sets one, or the context passed to
+// Do has a deadline.
+// Optional behaviour, such as logging, is configured by the supplied options.
+func NewClient(http *http.Client, opts ...ClientOption) *Client {
+	c := &Client{}
+
+	for _, opt := range opts {
+		opt(c)
 	}
+
+	c.http = configureHTTPClient(http, c.transportOpts, c.tlsOpts)
+
+	return c
 }
 
 // Do invokes the SOAP request using its internal parameters.
@@ -36,22 +97,219 @@ func NewClient(http *http.Client) *Client {
 // Any errors that are encountered are returned.
 // If a SOAP fault is detected, then the 'details' property of the SOAP envelope will be deserialized into the faultDetailType argument.
 func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
-	httpReq, err := req.httpRequest()
+	entry := &LogEntry{
+		Action:    req.action,
+		Operation: req.action,
+		URL:       req.url,
+	}
+	if req.operation != "" {
+		entry.Operation = req.operation
+	} else if c.operationNamer != nil {
+		entry.Operation = c.operationNamer(req.action, req.body)
+	}
+
+	if c.logger != nil {
+		c.logger.RequestStarted(ctx, entry)
+	}
+
+	start := time.Now()
+
+	perform := func(req *Request) (*Response, error) {
+		if c.hedgeable(req) {
+			return c.doHedged(ctx, req, entry)
+		}
+		return c.do(ctx, req, entry)
+	}
+
+	var resp *Response
+	var err error
+	if c.retryPolicy.MaxAttempts > 1 && req.replayable() {
+		resp, err = c.doRetried(ctx, req, perform)
+	} else {
+		resp, err = perform(req)
+	}
+
+	entry.Duration = time.Since(start)
+	entry.Err = err
+
+	if c.logger != nil {
+		c.logger.RequestFinished(ctx, entry)
+	}
+	if c.slowHandler != nil && entry.Duration >= c.slowThreshold {
+		c.slowHandler(ctx, entry)
+	}
+	if c.faultHandler != nil && resp != nil && resp.Fault() != nil {
+		c.faultHandler(ctx, entry, resp.Fault())
+	}
+
+	return resp, err
+}
+
+// DoInto builds a request with the action, URL and body, invokes it as with Do, and decodes the response into resp.
+// A SOAP fault is returned as the error, as a *Fault, along with the response.
+// Requests needing headers, signing or other settings must be built with NewRequest and passed to Do instead.
+func (c *Client) DoInto(ctx context.Context, action string, url string, body interface{}, resp interface{}) (*Response, error) {
+	return c.DoIntoWithFault(ctx, action, url, body, resp, nil)
+}
+
+// DoIntoWithFault is as DoInto, also decoding the detail of a SOAP fault into faultDetail, which may be FaultDetails.
+func (c *Client) DoIntoWithFault(ctx context.Context, action string, url string, body interface{}, resp interface{}, faultDetail interface{}) (*Response, error) {
+	soapResp, err := c.Do(ctx, NewRequest(action, url, body, resp, faultDetail))
 	if err != nil {
 		return nil, err
 	}
+	if soapResp.Fault() != nil {
+		return soapResp, soapResp.Fault()
+	}
+	return soapResp, nil
+}
 
-	httpResp, err := c.http.Do(httpReq.WithContext(ctx))
+// Serialize returns the body and headers of the HTTP request Do would send for req, without sending it, i.e. to
+// validate or archive the request, or to replay it with another tool.
+// Values generated for each call, such as the IDs of signed elements and WS-Addressing message IDs, differ every time
+// the request is serialized.
+// The content of the parts of a request with parts (see Request.AddPart) is read into memory, and their readers are
+// replaced with readers of it, so that the request can still be sent once it has been serialized.
+func (c *Client) Serialize(req *Request) ([]byte, http.Header, error) {
+	opts := c.requestOptions()
+
+	parts, err := req.bufferParts()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() {
+		for _, part := range parts {
+			part.Seek(0, io.SeekStart)
+		}
+	}()
+
+	r, contentType, err := req.requestBody(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, req.httpHeader(opts, contentType), nil
+}
+
+// requestOptions returns the settings of the client which affect how requests are serialized.
+func (c *Client) requestOptions() serializeOptions {
+	return serializeOptions{compat: c.compat, indent: c.indentRequests, envelopeNS: c.envelopeNS, invalidChars: c.invalidChars, charset: c.charset}
+}
+
+// do performs the request, recording the details of the exchange in entry.
+func (c *Client) do(ctx context.Context, req *Request, entry *LogEntry) (resp *Response, err error) {
+	if c.limiter != nil {
+		if err := c.limiter.Wait(ctx, req.url, req.action); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.deprecatedHandler != nil && req.wsseInfo != nil && req.wsseInfo.suite.Deprecated() {
+		c.deprecatedHandler(ctx, entry, req.wsseInfo.suite)
+	}
+
+	phaseStart := time.Now()
+
+	httpReq, err := req.httpRequest(c.requestOptions())
+	entry.SerializeDuration = time.Since(phaseStart)
 	if err != nil {
 		return nil, err
 	}
-	defer httpResp.Body.Close()
 
-	resp := newResponse(httpResp, req)
+	entry.RequestSize = httpReq.ContentLength
+	if httpReq.ContentLength == 0 && httpReq.Body != nil && httpReq.Body != http.NoBody {
+		entry.RequestSize = -1
+	}
+
+	var audit *auditCapture
+	if c.auditSink != nil {
+		audit = c.startAudit(req, httpReq, entry)
+		defer func() {
+			c.finishAudit(ctx, audit, resp, err)
+		}()
+	}
+
+	phaseStart = time.Now()
+	httpResp, err := c.http.Do(httpReq.WithContext(ctx))
+	entry.RoundTripDuration = time.Since(phaseStart)
+	if err != nil {
+		return nil, classify(ErrTransport, err)
+	}
+	if audit != nil {
+		audit.captureResponse(httpResp)
+	}
+	defer drainBody(httpResp.Body)
+
+	entry.StatusCode = httpResp.StatusCode
+	if c.retryPolicy.throttles() && isThrottleStatus(httpResp.StatusCode) {
+		return nil, &ThrottledError{
+			StatusCode: httpResp.StatusCode,
+			RetryAfter: parseRetryAfter(httpResp.Header.Get("Retry-After"), time.Now()),
+		}
+	}
+	if c.retries(req) && c.retryPolicy.retryStatus(httpResp.StatusCode) {
+		return nil, &StatusError{StatusCode: httpResp.StatusCode}
+	}
+
+	body := &countingReadCloser{ReadCloser: httpResp.Body}
+	httpResp.Body = body
+	defer func() {
+		entry.ResponseSize = body.n
+	}()
+
+	phaseStart = time.Now()
+	resp = newResponse(httpResp, req, c.compat)
+	resp.lenientContentType = c.lenientContentType
+	resp.lenientMultipart = c.lenientMultipart
+	resp.multipartBuffering = c.multipartBuffering
+	resp.emptyResponses = c.emptyResponses
+	resp.envelopeNS = c.envelopeNS
+	resp.invalidChars = c.invalidChars
+	resp.lenientUTF8 = c.lenientUTF8
+	resp.entities = c.entities
+	resp.limits = c.limits
+	resp.strictNamespaces = c.strictNamespaces
+	resp.verifyCert = c.verifyCert
+	resp.signedTimestamp = c.verifyTimestamps
+
 	err = resp.deserialize()
+	entry.DecodeDuration = time.Since(phaseStart)
+	if c.invalidUTF8Handler != nil && resp.invalidUTF8 > 0 {
+		c.invalidUTF8Handler(ctx, entry, resp.invalidUTF8)
+	}
 	if err != nil {
-		return nil, err
+		return nil, classifyResponse(err)
+	}
+
+	if c.verifyTimestamps {
+		timestamp, err := responseTimestamp(resp)
+		if err != nil {
+			return nil, classify(ErrDecode, err)
+		}
+		if err := c.verifyTimestamp(resp, timestamp, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	if resp.Fault() != nil {
+		entry.FaultCode = resp.Fault().Code
 	}
 
 	return resp, nil
 }
+
+// maxDrainSize is the most that is read from an unconsumed response body to allow its connection to be reused.
+// Connections with more remaining are closed instead, as reading further would cost more than a new connection.
+const maxDrainSize = 64 << 10
+
+// drainBody discards what remains of the response body, up to maxDrainSize, then closes it.
+// The HTTP transport only returns a keep-alive connection to its pool once the body has been read to the end,
+// which doesn't happen when decoding stops early due to an error, or if anything follows the envelope.
+func drainBody(body io.ReadCloser) {
+	io.CopyN(ioutil.Discard, body, maxDrainSize)
+	body.Close()
+}
@@ -0,0 +1,500 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientReusesConnections(t *testing.T) {
+	var tests = []struct {
+		name        string
+		contentType string
+		response    string
+		err         bool
+		reused      bool
+	}{
+		{
+			name:        "success",
+			contentType: "text/xml",
+			response:    requestTestResponse,
+			reused:      true,
+		},
+		{
+			name:        "decode error",
+			contentType: "text/xml",
+			response:    "<Envelope><Body>" + strings.Repeat("x", 8<<10),
+			err:         true,
+			reused:      true,
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "application/json",
+			response:    strings.Repeat(" ", 8<<10),
+			err:         true,
+			reused:      true,
+		},
+		{
+			name:        "multipart error",
+			contentType: `multipart/related; boundary="boundary"`,
+			response:    "--boundary\r\nContent-Type: text/plain\r\n\r\ntext\r\n--boundary\r\nContent-Type: text/plain\r\n\r\n" + strings.Repeat("x", 8<<10) + "\r\n--boundary--\r\n",
+			err:         true,
+			reused:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.Client())
+
+			var reused []bool
+			ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) {
+					reused = append(reused, info.Reused)
+				},
+			})
+
+			for i := 0; i < 2; i++ {
+				_, err := client.Do(ctx, NewRequest("action", server.URL, &headerExample{}, &envelopeContentExample{}, nil))
+				assert.Equal(t, tt.err, err != nil)
+			}
+
+			assert.Equal(t, []bool{false, tt.reused}, reused)
+		})
+	}
+}
+
+type trackingBody struct {
+	*strings.Reader
+	closed bool
+}
+
+func (b *trackingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestDrainBody(t *testing.T) {
+	var tests = []struct {
+		name      string
+		size      int
+		remaining int
+	}{
+		{name: "empty", size: 0, remaining: 0},
+		{name: "small", size: 1024, remaining: 0},
+		{name: "oversized", size: 2 * maxDrainSize, remaining: maxDrainSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := &trackingBody{Reader: strings.NewReader(strings.Repeat("x", tt.size))}
+			drainBody(body)
+
+			assert.True(t, body.closed)
+			assert.Equal(t, tt.remaining, body.Len())
+		})
+	}
+}
+
+func TestClientSlowRequestHandler(t *testing.T) {
+	var tests = []struct {
+		name      string
+		delay     time.Duration
+		threshold time.Duration
+		slow      bool
+	}{
+		{name: "fast", delay: 0, threshold: time.Second, slow: false},
+		{name: "slow", delay: 20 * time.Millisecond, threshold: 10 * time.Millisecond, slow: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(tt.delay)
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(requestTestResponse))
+			}))
+			defer server.Close()
+
+			var entries []*LogEntry
+			client := NewClient(server.Client(), WithSlowRequestHandler(tt.threshold, func(ctx context.Context, entry *LogEntry) {
+				entries = append(entries, entry)
+			}))
+
+			_, err := client.Do(context.Background(), NewRequest("action", server.URL, &headerExample{}, &envelopeContentExample{}, nil))
+			assert.Nil(t, err)
+
+			if !tt.slow {
+				assert.Len(t, entries, 0)
+				return
+			}
+			if assert.Len(t, entries, 1) {
+				entry := entries[0]
+				assert.Equal(t, "action", entry.Action)
+				assert.True(t, entry.Duration >= tt.threshold)
+				assert.True(t, entry.RoundTripDuration >= tt.delay)
+				assert.True(t, entry.SerializeDuration > 0)
+				assert.True(t, entry.DecodeDuration > 0)
+				assert.True(t, entry.SerializeDuration+entry.RoundTripDuration+entry.DecodeDuration <= entry.Duration)
+			}
+		})
+	}
+}
+
+func TestClientFaultHandler(t *testing.T) {
+	var tests = []struct {
+		name     string
+		response string
+		fault    bool
+	}{
+		{name: "success", response: requestTestResponse},
+		{
+			name: "fault",
+			response: `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault>` +
+				`<faultcode>s:Server</faultcode><faultstring>Invalid account</faultstring>` +
+				`<detail><DetailExample attr1="7"><DetailField>account</DetailField></DetailExample></detail>` +
+				`</s:Fault></s:Body></s:Envelope>`,
+			fault: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				if tt.fault {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			var entries []*LogEntry
+			var faults []*Fault
+			client := NewClient(server.Client(), WithFaultHandler(func(ctx context.Context, entry *LogEntry, fault *Fault) {
+				entries = append(entries, entry)
+				faults = append(faults, fault)
+			}))
+
+			_, err := client.Do(context.Background(), NewRequest("action", server.URL, &headerExample{}, &envelopeContentExample{}, &faultDetailExample{}))
+			assert.Nil(t, err)
+
+			if !tt.fault {
+				assert.Len(t, faults, 0)
+				return
+			}
+			if assert.Len(t, faults, 1) {
+				assert.Equal(t, "action", entries[0].Action)
+				assert.Equal(t, server.URL, entries[0].URL)
+				assert.Equal(t, "s:Server", entries[0].FaultCode)
+				assert.Equal(t, "Invalid account", faults[0].String)
+				if detail, ok := faults[0].Detail().(*faultDetailExample); assert.True(t, ok) {
+					assert.Equal(t, int32(7), detail.Attr1)
+					assert.Equal(t, "account", detail.Field1.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestClientDeprecatedAlgorithmHandler(t *testing.T) {
+	var tests = []struct {
+		name   string
+		suite  AlgorithmSuite
+		called bool
+	}{
+		{name: "default", suite: RSASHA256},
+		{name: "legacy", suite: LegacyRSASHA1, called: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wsseInfo, err := NewWSSEAuthInfoWithSuite("./testdata/cert.pem", "./testdata/key.pem", tt.suite)
+			assert.Nil(t, err)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(requestTestResponse))
+			}))
+			defer server.Close()
+
+			var suites []AlgorithmSuite
+			client := NewClient(server.Client(), WithDeprecatedAlgorithmHandler(func(ctx context.Context, entry *LogEntry, suite AlgorithmSuite) {
+				assert.Equal(t, "action", entry.Action)
+				suites = append(suites, suite)
+			}))
+
+			req := NewRequest("action", server.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil)
+			req.SignWith(wsseInfo)
+			_, err = client.Do(context.Background(), req)
+			assert.Nil(t, err)
+
+			if tt.called {
+				assert.Equal(t, []AlgorithmSuite{tt.suite}, suites)
+			} else {
+				assert.Empty(t, suites)
+			}
+		})
+	}
+}
+
+func TestClientIndentedRequests(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name     string
+		opts     []ClientOption
+		sign     bool
+		envelope string
+	}{
+		{
+			name: "unsigned",
+			opts: []ClientOption{WithIndentedRequests()},
+			envelope: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Body xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+    <ContentExample attr1="10">
+      <ContentField attr1="" attr2="0">This is a test string</ContentField>
+    </ContentExample>
+  </Body>
+</Envelope>
+`,
+		},
+		{
+			name: "with compatibility profile",
+			opts: []ClientOption{WithIndentedRequests(), WithWCFCompatibility()},
+			envelope: `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+  <soapenv:Body>
+    <ContentExample attr1="10">
+      <ContentField attr1="" attr2="0">This is a test string</ContentField>
+    </ContentExample>
+  </soapenv:Body>
+</soapenv:Envelope>
+`,
+		},
+		{
+			name: "signed",
+			opts: []ClientOption{WithIndentedRequests()},
+			sign: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = ioutil.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(requestTestResponse))
+			}))
+			defer server.Close()
+
+			content := &envelopeContentExample{Attr1: 10, Field1: envelopeExampleField{Value: "This is a test string"}}
+			req := NewRequest("action", server.URL, content, &envelopeContentExample{}, nil)
+			if tt.sign {
+				req.SignWith(wsseInfo)
+			}
+
+			_, err := NewClient(server.Client(), tt.opts...).Do(context.Background(), req)
+			assert.Nil(t, err)
+
+			if !tt.sign {
+				assert.Equal(t, tt.envelope, string(body))
+				return
+			}
+
+			// The body is indented before it is digested.
+			start := bytes.Index(body, []byte("<Body "))
+			end := bytes.Index(body, []byte("</Body>")) + len("</Body>")
+			signed := body[start:end]
+			assert.Contains(t, string(signed), "\n    <ContentExample attr1=\"10\">\n")
+
+			doc := etree.NewDocument()
+			assert.Nil(t, doc.ReadFromBytes(body))
+			digest := sha256.Sum256(signed)
+			digestValue := doc.FindElement("//DigestValue")
+			if assert.NotNil(t, digestValue) {
+				assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), digestValue.Text())
+			}
+		})
+	}
+}
+
+func TestClientEnvelopeNamespace(t *testing.T) {
+	const draftNS = "http://example.com/draft/envelope"
+
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name     string
+		opts     []ClientOption
+		sign     bool
+		response string
+		envelope string
+		fault    xml.Name
+	}{
+		{
+			name:     "unsigned",
+			response: `<Envelope xmlns="` + draftNS + `"><Body><ContentExample attr1="10"></ContentExample></Body></Envelope>`,
+			envelope: `<Envelope xmlns="` + draftNS + `"><Body xmlns="` + draftNS + `"><ContentExample attr1="10"><ContentField attr1="" attr2="0">test</ContentField></ContentExample></Body></Envelope>`,
+		},
+		{
+			name:     "with compatibility profile",
+			opts:     []ClientOption{WithWCFCompatibility()},
+			response: requestTestResponse,
+			envelope: `<soapenv:Envelope xmlns:soapenv="` + draftNS + `"><soapenv:Body><ContentExample attr1="10"><ContentField attr1="" attr2="0">test</ContentField></ContentExample></soapenv:Body></soapenv:Envelope>`,
+		},
+		{
+			name:     "signed",
+			sign:     true,
+			response: `<e:Envelope xmlns:e="` + draftNS + `"><e:Body><ContentExample attr1="10"></ContentExample></e:Body></e:Envelope>`,
+		},
+		{
+			name:     "fault",
+			response: `<e:Envelope xmlns:e="` + draftNS + `"><e:Body><e:Fault><faultcode>e:Server</faultcode></e:Fault></e:Body></e:Envelope>`,
+			envelope: `<Envelope xmlns="` + draftNS + `"><Body xmlns="` + draftNS + `"><ContentExample attr1="10"><ContentField attr1="" attr2="0">test</ContentField></ContentExample></Body></Envelope>`,
+			fault:    xml.Name{Space: soapEnvNS, Local: "Server"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = ioutil.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			content := &envelopeContentExample{}
+			req := NewRequest("action", server.URL, &envelopeContentExample{Attr1: 10, Field1: envelopeExampleField{Value: "test"}}, content, nil)
+			if tt.sign {
+				req.SignWith(wsseInfo)
+			}
+
+			opts := append([]ClientOption{WithEnvelopeNamespace(draftNS)}, tt.opts...)
+			resp, err := NewClient(server.Client(), opts...).Do(context.Background(), req)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			if tt.fault.Local != "" {
+				if assert.NotNil(t, resp.Fault()) {
+					assert.Equal(t, tt.fault, resp.Fault().CodeName)
+				}
+			} else {
+				assert.Nil(t, resp.Fault())
+				assert.Equal(t, int32(10), content.Attr1)
+			}
+
+			if !tt.sign {
+				assert.Equal(t, tt.envelope, string(body))
+				return
+			}
+
+			// The security header is added in the envelope namespace.
+			assert.NotContains(t, string(body), soapEnvNS)
+			assert.Contains(t, string(body), `<Header xmlns="`+draftNS+`">`)
+		})
+	}
+}
+
+func TestClientDoInto(t *testing.T) {
+	var tests = []struct {
+		name     string
+		response string
+		detail   interface{}
+		fault    bool
+	}{
+		{name: "response", response: requestTestResponse},
+		{name: "fault", response: hedgeTestFault, detail: &headerExample{}, fault: true},
+		{name: "fault without detail type", response: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Fault><faultcode>soap:Server</faultcode></Fault></Body></Envelope>`, fault: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var action string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				action = r.Header.Get("SOAPAction")
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			client := NewClient(server.Client())
+			content := &envelopeContentExample{}
+
+			var resp *Response
+			var err error
+			if tt.detail != nil {
+				resp, err = client.DoIntoWithFault(context.Background(), "action", server.URL, &headerExample{}, content, tt.detail)
+			} else {
+				resp, err = client.DoInto(context.Background(), "action", server.URL, &headerExample{}, content)
+			}
+			assert.Equal(t, "action", action)
+			if !assert.NotNil(t, resp) {
+				return
+			}
+
+			if !tt.fault {
+				assert.Nil(t, err)
+				assert.Equal(t, int32(10), content.Attr1)
+				return
+			}
+
+			fault, ok := err.(*Fault)
+			if assert.True(t, ok) {
+				assert.Equal(t, "soap:Server", fault.Code)
+				assert.True(t, fault.Detail() == tt.detail)
+			}
+		})
+	}
+}
+
+func TestClientSerialize(t *testing.T) {
+	var sent []byte
+	var sentHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent, _ = ioutil.ReadAll(r.Body)
+		sentHeader = r.Header
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(requestTestResponse))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client(), WithWCFCompatibility(), WithIndentedRequests())
+	content := &envelopeContentExample{Attr1: 10, Field1: envelopeExampleField{Value: "test"}}
+	req := NewRequest("action", server.URL, content, &envelopeContentExample{}, nil)
+	req.StreamBody(true)
+
+	data, header, err := client.Serialize(req)
+	assert.Nil(t, err)
+
+	_, err = client.Do(context.Background(), req)
+	assert.Nil(t, err)
+
+	assert.Equal(t, string(sent), string(data))
+	assert.Equal(t, `"action"`, header.Get("SOAPAction"))
+	assert.Equal(t, sentHeader.Get("SOAPAction"), header.Get("SOAPAction"))
+	assert.Equal(t, sentHeader.Get("Content-Type"), header.Get("Content-Type"))
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/Enflick/gosoap"
+	"github.com/beevik/etree"
+)
+
+// Implements the call command, which sends a request and prints the response.
+
+// callFlags are the flags of the call command.
+type callFlags struct {
+	url     string
+	action  string
+	body    string
+	values  templateValues
+	cert    string
+	key     string
+	sha1    bool
+	timeout time.Duration
+	verbose bool
+}
+
+// templateValues are the values of the body template, set by repeated -set name=value flags.
+type templateValues map[string]string
+
+// String satisfies the flag.Value interface.
+func (v templateValues) String() string {
+	pairs := make([]string, 0, len(v))
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+// Set satisfies the flag.Value interface.
+func (v templateValues) Set(pair string) error {
+	i := strings.Index(pair, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected name=value, got %q", pair)
+	}
+	v[pair[:i]] = pair[i+1:]
+	return nil
+}
+
+// anyElement is the response type of calls, accepting any body element; the response is printed as it was received.
+type anyElement struct {
+	XMLName xml.Name
+}
+
+// runCall runs the call command with the arguments, returning its exit status.
+func runCall(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	opts := callFlags{values: templateValues{}}
+
+	fs := flag.NewFlagSet("call", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.url, "url", "", "URL of the service `endpoint`")
+	fs.StringVar(&opts.action, "action", "", "SOAP `action` of the request")
+	fs.StringVar(&opts.body, "body", "", "`file` holding the body template or envelope, or - for the standard input")
+	fs.Var(opts.values, "set", "set a body template value, as `name=value`; may be repeated")
+	fs.StringVar(&opts.cert, "cert", "", "PEM encoded certificate `file` to sign the request with")
+	fs.StringVar(&opts.key, "key", "", "PEM encoded RSA or EC key `file` to sign the request with")
+	fs.BoolVar(&opts.sha1, "sha1", false, "sign with the legacy RSA-SHA1 algorithm suite")
+	fs.DurationVar(&opts.timeout, "timeout", time.Minute, "timeout of the request")
+	fs.BoolVar(&opts.verbose, "v", false, "print the request envelope to the standard error before sending it")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if opts.url == "" || opts.body == "" || (opts.cert == "") != (opts.key == "") {
+		fmt.Fprintln(stderr, "gosoap call: -url and -body are required, and -cert and -key must be given together")
+		fs.Usage()
+		return 2
+	}
+
+	fault, err := call(opts, stdin, stdout, stderr)
+	if err != nil {
+		fmt.Fprintf(stderr, "gosoap call: %v\n", err)
+		return 1
+	}
+	if fault != nil {
+		fmt.Fprintf(stderr, "fault: %s: %s\n", fault.Code, fault.String)
+		return 1
+	}
+	return 0
+}
+
+// call sends the request described by the flags and prints the response to stdout, returning the fault returned by
+// the service, if any.
+func call(opts callFlags, stdin io.Reader, stdout io.Writer, stderr io.Writer) (*soap.Fault, error) {
+	body, headers, err := loadBody(opts.body, opts.values, stdin)
+	if err != nil {
+		return nil, err
+	}
+
+	req := soap.NewRequest(opts.action, opts.url, body, &anyElement{}, nil)
+	for _, header := range headers {
+		req.AddHeader(header)
+	}
+
+	if opts.cert != "" {
+		var info *soap.WSSEAuthInfo
+		if opts.sha1 {
+			info, err = soap.NewWSSEAuthInfoWithSuite(opts.cert, opts.key, soap.LegacyRSASHA1)
+		} else {
+			info, err = soap.NewWSSEAuthInfo(opts.cert, opts.key)
+		}
+		if err != nil {
+			return nil, err
+		}
+		req.SignWith(info)
+	}
+
+	// The raw response is captured as it is received, to be printed rather than the decoded response.
+	capture := &captureTransport{next: http.DefaultTransport}
+	client := soap.NewClient(&http.Client{Transport: capture})
+
+	if opts.verbose {
+		envelope, _, err := client.Serialize(req)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(stderr, "%s\n", envelope)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	resp, err := client.Do(ctx, req)
+	if err != nil {
+		if capture.body.Len() > 0 {
+			printResponse(stdout, capture.body.Bytes())
+		}
+		return nil, err
+	}
+
+	printResponse(stdout, capture.body.Bytes())
+	return resp.Fault(), nil
+}
+
+// loadBody reads the body template from the file, or from stdin if it is "-", and executes it with the values.
+// If the result is a whole envelope, its body and header entries are returned separately.
+func loadBody(path string, values templateValues, stdin io.Reader) (soap.RawXML, []soap.RawXML, error) {
+	var text []byte
+	var err error
+	if path == "-" {
+		text, err = ioutil.ReadAll(stdin)
+	} else {
+		text, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tmpl, err := template.New(path).Option("missingkey=error").Parse(string(text))
+	if err != nil {
+		return nil, nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, map[string]string(values)); err != nil {
+		return nil, nil, err
+	}
+
+	return splitEnvelope(buf.Bytes())
+}
+
+// splitEnvelope returns the body and header entries of data if it is an envelope, or data as the body otherwise.
+// The entries taken from an envelope declare the namespaces they inherited from it.
+func splitEnvelope(data []byte) (soap.RawXML, []soap.RawXML, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, nil, err
+	}
+
+	root := doc.Root()
+	if root == nil {
+		return nil, nil, errors.New("body has no element")
+	}
+	if root.Tag != "Envelope" {
+		return soap.RawXML(data), nil, nil
+	}
+
+	var body soap.RawXML
+	var headers []soap.RawXML
+	for _, section := range root.ChildElements() {
+		for _, entry := range section.ChildElements() {
+			raw, err := detachElement(entry, root, section)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			switch section.Tag {
+			case "Header":
+				headers = append(headers, raw)
+			case "Body":
+				body = append(body, raw...)
+			}
+		}
+	}
+	if body == nil {
+		return nil, nil, errors.New("envelope has an empty body")
+	}
+
+	return body, headers, nil
+}
+
+// detachElement serializes a copy of the element declaring the namespaces it inherits from its ancestors, which it
+// doesn't declare itself. The default namespace of unprefixed ancestors is the envelope namespace, so it isn't
+// inherited.
+func detachElement(elem *etree.Element, ancestors ...*etree.Element) (soap.RawXML, error) {
+	detached := elem.Copy()
+	for _, ancestor := range ancestors {
+		for _, attr := range ancestor.Attr {
+			switch {
+			case attr.Space == "xmlns":
+				if detached.SelectAttr("xmlns:"+attr.Key) == nil {
+					detached.CreateAttr("xmlns:"+attr.Key, attr.Value)
+				}
+			case attr.Space == "" && attr.Key == "xmlns" && ancestor.Space != "":
+				if detached.SelectAttr("xmlns") == nil {
+					detached.CreateAttr("xmlns", attr.Value)
+				}
+			}
+		}
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(detached)
+	return doc.WriteToBytes()
+}
+
+// printResponse writes the response indented if it is an XML document, or as it is otherwise, i.e. if it is a
+// multipart response.
+func printResponse(w io.Writer, data []byte) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil || doc.Root() == nil {
+		w.Write(data)
+		return
+	}
+	doc.Indent(2)
+	doc.WriteTo(w)
+}
+
+// captureTransport is an http.RoundTripper recording the body of the response as it is read.
+type captureTransport struct {
+	next http.RoundTripper
+	body bytes.Buffer
+}
+
+// RoundTrip satisfies the http.RoundTripper interface.
+func (t *captureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	t.body.Reset()
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(resp.Body, &t.body), resp.Body}
+	return resp, nil
+}
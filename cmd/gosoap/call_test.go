@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCall(t *testing.T) {
+	var tests = []struct {
+		name     string
+		args     []string
+		body     string
+		response string
+		status   int
+		sent     string
+		out      string
+		errOut   string
+	}{
+		{
+			name:     "template",
+			args:     []string{"-set", "symbol=TN"},
+			body:     `<GetQuote xmlns="urn:quotes"><Symbol>{{.symbol}}</Symbol></GetQuote>`,
+			response: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><GetQuoteResponse xmlns="urn:quotes"><Price>7</Price></GetQuoteResponse></Body></Envelope>`,
+			status:   http.StatusOK,
+			sent:     `<Symbol>TN</Symbol>`,
+			out: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Body>
+    <GetQuoteResponse xmlns="urn:quotes">
+      <Price>7</Price>
+    </GetQuoteResponse>
+  </Body>
+</Envelope>
+`,
+		},
+		{
+			name: "envelope",
+			body: `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:q="urn:quotes">
+  <soapenv:Header><q:Session>abc</q:Session></soapenv:Header>
+  <soapenv:Body><q:GetQuote><q:Symbol>TN</q:Symbol></q:GetQuote></soapenv:Body>
+</soapenv:Envelope>`,
+			response: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><GetQuoteResponse/></Body></Envelope>`,
+			status:   http.StatusOK,
+			sent:     `<q:GetQuote xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:q="urn:quotes"><q:Symbol>TN</q:Symbol></q:GetQuote>`,
+			out: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Body>
+    <GetQuoteResponse/>
+  </Body>
+</Envelope>
+`,
+		},
+		{
+			name:     "fault",
+			body:     `<GetQuote xmlns="urn:quotes"/>`,
+			response: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Fault><faultcode>Client</faultcode><faultstring>Unknown symbol</faultstring></Fault></Body></Envelope>`,
+			status:   http.StatusInternalServerError,
+			out: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Body>
+    <Fault>
+      <faultcode>Client</faultcode>
+      <faultstring>Unknown symbol</faultstring>
+    </Fault>
+  </Body>
+</Envelope>
+`,
+			errOut: "fault: Client: Unknown symbol\n",
+		},
+		{
+			name:   "missing template value",
+			body:   `<GetQuote xmlns="urn:quotes"><Symbol>{{.symbol}}</Symbol></GetQuote>`,
+			errOut: "gosoap call: template: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var sent []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				sent, _ = ioutil.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer ts.Close()
+
+			dir, err := ioutil.TempDir("", "gosoap")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "body.xml")
+			if err := ioutil.WriteFile(path, []byte(tt.body), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			args := append([]string{"call", "-url", ts.URL, "-action", "GetQuote", "-body", path}, tt.args...)
+			status := run(args, strings.NewReader(""), &stdout, &stderr)
+
+			assert.Equal(t, tt.out, stdout.String())
+			assert.True(t, strings.HasPrefix(stderr.String(), tt.errOut), stderr.String())
+			assert.Contains(t, string(sent), tt.sent)
+			if tt.errOut == "" {
+				assert.Equal(t, 0, status)
+			} else {
+				assert.Equal(t, 1, status)
+			}
+		})
+	}
+}
+
+func TestCallSigned(t *testing.T) {
+	var sent []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sent, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><GetQuoteResponse/></Body></Envelope>`))
+	}))
+	defer ts.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"call", "-url", ts.URL, "-body", "-", "-cert", "../../testdata/cert.pem", "-key", "../../testdata/key.pem"}
+	status := run(args, strings.NewReader(`<GetQuote xmlns="urn:quotes"/>`), &stdout, &stderr)
+
+	assert.Equal(t, 0, status, stderr.String())
+	assert.Contains(t, string(sent), "<SignatureValue>")
+}
+
+func TestRunUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(nil, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"call", "-body", "body.xml"}, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"unknown"}, nil, &stdout, &stderr))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Enflick/gosoap/wsdl"
+)
+
+// Implements the describe command, which lists the operations of a WSDL document.
+
+// runDescribe runs the describe command with the arguments, returning its exit status.
+func runDescribe(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	fs := flag.NewFlagSet("describe", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: gosoap describe FILE")
+		fmt.Fprintln(stderr, "Lists the services, ports and operations of the WSDL document in FILE, or - for the standard input.")
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var defs *wsdl.Definitions
+	var err error
+	if path := fs.Arg(0); path == "-" {
+		defs, err = wsdl.Parse(stdin)
+	} else {
+		defs, err = wsdl.ParseFile(path)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "gosoap describe: %v\n", err)
+		return 1
+	}
+
+	describe(stdout, defs)
+	return 0
+}
+
+// describe writes the services of the document, with the operations of each of their ports: the SOAPAction and
+// names of the elements of the messages, which are the action and body types to pass to NewRequest.
+func describe(w io.Writer, defs *wsdl.Definitions) {
+	for _, service := range defs.Services {
+		fmt.Fprintf(w, "service %s\n", service.Name)
+
+		for _, port := range service.Ports {
+			fmt.Fprintf(w, "  port %s\n", port.Name)
+			fmt.Fprintf(w, "    address  %s\n", port.Address())
+
+			binding := defs.Binding(port.Binding)
+			if binding == nil {
+				fmt.Fprintf(w, "    binding  %s (missing)\n", port.Binding)
+				continue
+			}
+			fmt.Fprintf(w, "    binding  %s\n", port.Binding)
+
+			for _, op := range defs.Operations(binding) {
+				version := "SOAP 1.1"
+				if op.SOAP12 {
+					version = "SOAP 1.2"
+				}
+
+				fmt.Fprintf(w, "    operation %s\n", op.Name)
+				fmt.Fprintf(w, "      style    %s, %s\n", op.Style, version)
+				fmt.Fprintf(w, "      action   %s\n", op.SOAPAction)
+				if op.Input != nil {
+					fmt.Fprintf(w, "      input    %s\n", messageElements(op, op.Input, op.BindingOperation.Input))
+				}
+				if op.Output != nil {
+					fmt.Fprintf(w, "      output   %s\n", messageElements(op, op.Output, op.BindingOperation.Output))
+				}
+				for _, fault := range op.Faults {
+					fmt.Fprintf(w, "      fault    %s\n", messageElements(op, fault, nil))
+				}
+			}
+		}
+	}
+}
+
+// messageElements describes the elements of the message, as they appear in the body of an envelope or the detail of
+// a fault. Document style messages consist of the elements referenced by their parts, while the parts of RPC style
+// input and output messages are wrapped in an element named after the operation, in the namespace of their soap:body.
+func messageElements(op *wsdl.BoundOperation, msg *wsdl.Message, bindingIO *wsdl.BindingIO) string {
+	parts := make([]string, 0, len(msg.Parts))
+	for _, part := range msg.Parts {
+		if !part.Element.IsZero() {
+			parts = append(parts, part.Element.String())
+		} else {
+			parts = append(parts, part.Name+" "+part.Type.String())
+		}
+	}
+	if op.Style != "rpc" || bindingIO == nil {
+		return strings.Join(parts, ", ")
+	}
+
+	wrapper := wsdl.QName{Local: op.Name}
+	if bindingIO == op.BindingOperation.Output {
+		wrapper.Local += "Response"
+	}
+	if body := bindingIO.SOAPBody; body != nil {
+		wrapper.Space = body.Namespace
+	} else if body := bindingIO.SOAP12Body; body != nil {
+		wrapper.Space = body.Namespace
+	}
+	return wrapper.String() + "(" + strings.Join(parts, ", ") + ")"
+}
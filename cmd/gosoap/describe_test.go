@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribe(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"describe", "../../wsdl/testdata/quotes.wsdl"}, nil, &stdout, &stderr)
+
+	assert.Equal(t, 0, status, stderr.String())
+	assert.Equal(t, `service QuoteService
+  port QuotePort
+    address  http://example.com/quotes/service
+    binding  {http://example.com/quotes/wsdl}QuoteBinding
+    operation GetQuote
+      style    document, SOAP 1.1
+      action   http://example.com/quotes/GetQuote
+      input    {http://example.com/quotes}GetQuote
+      output   {http://example.com/quotes}GetQuoteResponse
+      fault    {http://example.com/quotes}QuoteFault
+`, stdout.String())
+}
+
+func TestDescribeRPC(t *testing.T) {
+	doc := `<definitions xmlns="http://schemas.xmlsoap.org/wsdl/" xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/"
+	xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:tns="urn:calc" targetNamespace="urn:calc">
+	<message name="AddRequest"><part name="a" type="xsd:int"/><part name="b" type="xsd:int"/></message>
+	<message name="AddResponse"><part name="sum" type="xsd:int"/></message>
+	<portType name="Calc"><operation name="Add"><input message="tns:AddRequest"/><output message="tns:AddResponse"/></operation></portType>
+	<binding name="CalcBinding" type="tns:Calc">
+		<soap:binding style="rpc" transport="http://schemas.xmlsoap.org/soap/http"/>
+		<operation name="Add">
+			<soap:operation soapAction="urn:calc#Add"/>
+			<input><soap:body use="encoded" namespace="urn:calc"/></input>
+			<output><soap:body use="encoded" namespace="urn:calc"/></output>
+		</operation>
+	</binding>
+	<service name="CalcService"><port name="CalcPort" binding="tns:CalcBinding"><soap:address location="http://example.com/calc"/></port></service>
+</definitions>`
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"describe", "-"}, strings.NewReader(doc), &stdout, &stderr)
+
+	assert.Equal(t, 0, status, stderr.String())
+	assert.Equal(t, `service CalcService
+  port CalcPort
+    address  http://example.com/calc
+    binding  {urn:calc}CalcBinding
+    operation Add
+      style    rpc, SOAP 1.1
+      action   urn:calc#Add
+      input    {urn:calc}Add(a {http://www.w3.org/2001/XMLSchema}int, b {http://www.w3.org/2001/XMLSchema}int)
+      output   {urn:calc}AddResponse(sum {http://www.w3.org/2001/XMLSchema}int)
+`, stdout.String())
+}
+
+func TestDescribeUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run([]string{"describe"}, nil, &stdout, &stderr))
+	assert.Equal(t, 1, run([]string{"describe", "missing.wsdl"}, nil, &stdout, &stderr))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Enflick/gosoap/wsdl"
+	"github.com/Enflick/gosoap/wsdl/gen"
+)
+
+// Implements the generate command, which writes the Go code generated from a WSDL document to a package.
+
+// generateFlags are the flags of the generate command.
+type generateFlags struct {
+	pkg      string
+	out      string
+	contract bool
+}
+
+// runGenerate runs the generate command with the arguments, returning its exit status.
+func runGenerate(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	var opts generateFlags
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.pkg, "package", "", "name of the generated package (required)")
+	fs.StringVar(&opts.out, "out", ".", "directory of the generated package")
+	fs.BoolVar(&opts.contract, "contract", false, "also generate contract tests of the types against the document")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: gosoap generate -package NAME [flags] FILE")
+		fmt.Fprintln(stderr, "Generates the types, clients and mocks of the WSDL document in FILE.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || opts.pkg == "" {
+		fs.Usage()
+		return 2
+	}
+
+	files, err := generate(opts, fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "gosoap generate: %v\n", err)
+		return 1
+	}
+	for _, file := range files {
+		fmt.Fprintln(stdout, file)
+	}
+	return 0
+}
+
+// generatedFile is a file of the generated package, named after the document with the suffix.
+type generatedFile struct {
+	suffix   string
+	generate func(*wsdl.Definitions, gen.Options) ([]byte, error)
+}
+
+// generate writes the code generated from the document at path to the files of the package, named after the
+// document, and returns their paths: the types of its messages, the interfaces of its port types with their clients
+// and mocks, and optionally the contract tests.
+func generate(opts generateFlags, path string) ([]string, error) {
+	defs, err := wsdl.ParseFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	genOpts := gen.Options{Package: opts.pkg}
+	if opts.contract {
+		// The contract tests load the document relative to the directory of the package.
+		rel, err := relativePath(opts.out, path)
+		if err != nil {
+			return nil, err
+		}
+		genOpts.WSDLPath = rel
+	}
+
+	files := []generatedFile{{"_types.go", gen.Generate}, {"_client.go", gen.GenerateMocks}}
+	if opts.contract {
+		files = append(files, generatedFile{"_contract_test.go", gen.GenerateContractTests})
+	}
+
+	if err := os.MkdirAll(opts.out, 0755); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var paths []string
+	for _, file := range files {
+		src, err := file.generate(defs, genOpts)
+		if err != nil {
+			return nil, err
+		}
+
+		filePath := filepath.Join(opts.out, name+file.suffix)
+		if err := ioutil.WriteFile(filePath, src, 0644); err != nil {
+			return nil, err
+		}
+		paths = append(paths, filePath)
+	}
+	return paths, nil
+}
+
+// relativePath returns the path of target relative to the directory dir, with forward slashes.
+func relativePath(dir string, target string) (string, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absTarget, err := filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absDir, absTarget)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "quotes")
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"generate", "-package", "quotes", "-out", out, "-contract", "../../wsdl/testdata/quotes.wsdl"}, nil, &stdout, &stderr)
+	assert.Equal(t, 0, status, stderr.String())
+
+	files := []string{"quotes_types.go", "quotes_client.go", "quotes_contract_test.go"}
+	assert.Equal(t, filepath.Join(out, files[0])+"\n"+filepath.Join(out, files[1])+"\n"+filepath.Join(out, files[2])+"\n", stdout.String())
+
+	for _, file := range files {
+		src, err := ioutil.ReadFile(filepath.Join(out, file))
+		if assert.Nil(t, err, file) {
+			assert.True(t, strings.HasPrefix(string(src), "// Code generated by gosoap wsdl/gen. DO NOT EDIT.\n\npackage quotes\n"), file)
+		}
+	}
+
+	src, _ := ioutil.ReadFile(filepath.Join(out, "quotes_contract_test.go"))
+	wsdlPath, _ := filepath.Abs("../../wsdl/testdata/quotes.wsdl")
+	rel, _ := filepath.Rel(out, wsdlPath)
+	assert.Contains(t, string(src), `"`+filepath.ToSlash(rel)+`"`)
+}
+
+func TestGenerateUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run([]string{"generate", "../../wsdl/testdata/quotes.wsdl"}, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run([]string{"generate", "-package", "quotes"}, nil, &stdout, &stderr))
+	assert.Equal(t, 1, run([]string{"generate", "-package", "quotes", "-out", t.TempDir(), "missing.wsdl"}, nil, &stdout, &stderr))
+}
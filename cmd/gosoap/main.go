@@ -0,0 +1,66 @@
+// Command gosoap makes SOAP requests from the command line, to reproduce issues with services without writing a Go
+// program each time.
+//
+// Usage:
+//
+//	gosoap call -url URL -action ACTION -body FILE [flags]
+//	gosoap describe FILE
+//	gosoap generate -package NAME [-out DIR] [-contract] FILE
+//
+// The body file holds the XML of the request body. It is a text/template, executed with the values set by -set
+// name=value, so a single file can serve many requests. It may also hold a whole envelope, such as the sample
+// envelope written for generated types by soap.SampleEnvelope, in which case its header entries and body are sent.
+// The request is signed if a certificate and key are given.
+//
+// The response is pretty-printed to the standard output. If the service returns a fault, it is also summarized on
+// the standard error and the command exits with status 1.
+//
+// The describe command lists the services, ports and operations of a WSDL document, with the SOAPAction of each
+// operation and the elements of its messages, which are the action and body to send with call or NewRequest.
+//
+// The generate command writes the code generated by the wsdl/gen package from a WSDL document to the package in DIR,
+// in files named after the document: the types of its messages, the interfaces of its port types with a client for
+// each binding and a mock, and with -contract, the contract tests of the types, which load the document from its path
+// relative to DIR.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `usage: gosoap <command> [flags]
+
+commands:
+  call        send a SOAP request and print the response
+  describe    list the services, ports and operations of a WSDL document
+  generate    generate the types, clients and mocks of a WSDL document
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run runs the command with the arguments, returning its exit status.
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "call":
+		return runCall(args[1:], stdin, stdout, stderr)
+	case "describe":
+		return runDescribe(args[1:], stdin, stdout, stderr)
+	case "generate":
+		return runGenerate(args[1:], stdin, stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "gosoap: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+}
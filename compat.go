@@ -0,0 +1,155 @@
+package soap
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Implements compatibility profiles, which adjust the serialization of requests to suit particular SOAP stacks.
+
+// envelopePrefix is the prefix used for the envelope namespace by profiles requiring one.
+const envelopePrefix = "soapenv"
+
+// compatProfile adjusts the serialization of requests for interoperability with a particular SOAP stack.
+type compatProfile struct {
+	// quoteAction wraps the SOAPAction header value in double quotes.
+	quoteAction bool
+	// transform rewrites the serialized envelope, given the content of its body. It is applied before the body is signed.
+	transform func(doc *etree.Document, content interface{})
+	// responseTransform rewrites XML responses before they are decoded, returning an error if they can't be.
+	responseTransform func(doc *etree.Document) error
+}
+
+// WithWCFCompatibility adjusts requests to suit .NET WCF endpoints:
+//   - the SOAPAction header is quoted,
+//   - the envelope, header and body elements use the soapenv prefix rather than declaring the envelope namespace
+//     as the default, so the declaration on the operation element is the only default namespace in scope for the
+//     content, and
+//   - elements carrying a wsu:Id attribute declare the namespaces they use themselves, so the signed body is
+//     serialized exactly as WCF canonicalizes it when checking the digest.
+//
+// Streamed requests are buffered in this mode, as the envelope must be rewritten before it is sent.
+func WithWCFCompatibility() ClientOption {
+	return func(c *Client) {
+		c.compat = wcfProfile
+	}
+}
+
+var wcfProfile = &compatProfile{
+	quoteAction: true,
+	transform:   wcfTransform,
+}
+
+func wcfTransform(doc *etree.Document, content interface{}) {
+	root := doc.Root()
+	if root == nil || !prefixEnvelopeElement(root) {
+		return
+	}
+	declareNamespace(root, envelopePrefix, soapEnvNS)
+
+	for _, child := range root.ChildElements() {
+		if (child.Tag == "Header" || child.Tag == "Body") && prefixEnvelopeElement(child) && child.SelectAttr("wsu:Id") != nil {
+			declareNamespace(child, envelopePrefix, soapEnvNS)
+		}
+	}
+
+	declareIDNamespaces(root)
+}
+
+// prefixEnvelopeElement moves an element declaring the envelope namespace as its default namespace to the envelope
+// prefix, returning whether it did so.
+func prefixEnvelopeElement(elem *etree.Element) bool {
+	if elem.Space != "" || elem.SelectAttrValue("xmlns", "") != soapEnvNS {
+		return false
+	}
+
+	elem.Space = envelopePrefix
+	elem.RemoveAttr("xmlns")
+	return true
+}
+
+// declareIDNamespaces declares the WS-Security utility namespace on elem and its children wherever a wsu:Id attribute is used.
+func declareIDNamespaces(elem *etree.Element) {
+	if elem.SelectAttr("wsu:Id") != nil {
+		declareNamespace(elem, "wsu", wsuNS)
+	}
+	for _, child := range elem.ChildElements() {
+		declareIDNamespaces(child)
+	}
+}
+
+// declareNamespace declares prefix for namespace on elem, unless it is already declared there.
+// Namespace declarations are kept ahead of other attributes and ordered by prefix, as in canonical XML.
+func declareNamespace(elem *etree.Element, prefix string, namespace string) {
+	if elem.SelectAttr("xmlns:"+prefix) != nil {
+		return
+	}
+
+	idx := 0
+	for idx < len(elem.Attr) && elem.Attr[idx].Space == "xmlns" && elem.Attr[idx].Key < prefix {
+		idx++
+	}
+
+	attr := etree.Attr{Space: "xmlns", Key: prefix, Value: namespace}
+	elem.Attr = append(elem.Attr, etree.Attr{})
+	copy(elem.Attr[idx+1:], elem.Attr[idx:])
+	elem.Attr[idx] = attr
+}
+
+// soapActionHeader returns the value of the SOAPAction header for the action.
+func (p *compatProfile) soapActionHeader(action string) string {
+	if p != nil && p.quoteAction && !strings.HasPrefix(action, `"`) {
+		return `"` + action + `"`
+	}
+	return action
+}
+
+// envelopeTransform returns the transform of the profile for an envelope with the content, if it has one.
+func (p *compatProfile) envelopeTransform(content interface{}) func(doc *etree.Document) {
+	if p == nil || p.transform == nil {
+		return nil
+	}
+	return func(doc *etree.Document) {
+		p.transform(doc, content)
+	}
+}
+
+// decodeResponse decodes the XML response read from r into v, applying the response transform of the profile if it has one.
+// The namespace, if set, is accepted in place of the envelope namespace. The response is checked against the limits
+// before it is parsed into a tree to be transformed, and again as the transformed response is decoded, as the
+// transform may add elements to it.
+func (p *compatProfile) decodeResponse(r io.Reader, v interface{}, namespace string, limits decodeLimits) error {
+	if p == nil || p.responseTransform == nil {
+		return newEnvelopeDecoder(r, namespace, limits).Decode(v)
+	}
+
+	doc := etree.NewDocument()
+	if limits.set() {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if err := checkLimits(data, limits); err != nil {
+			return err
+		}
+		r = bytes.NewReader(data)
+	}
+	if _, err := doc.ReadFrom(r); err != nil {
+		return err
+	}
+	if err := p.responseTransform(doc); err != nil {
+		return err
+	}
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err := doc.WriteTo(buf); err != nil {
+		return err
+	}
+	return newEnvelopeDecoder(buf, namespace, limits).Decode(v)
+}
@@ -0,0 +1,105 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+var wcfCompatibilityTests = []struct {
+	name     string
+	action   string
+	sign     bool
+	stream   bool
+	header   string
+	envelope string
+}{
+	{
+		name:     "unsigned",
+		action:   "http://example.com/Service/Operation",
+		header:   `"http://example.com/Service/Operation"`,
+		envelope: `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><ContentExample attr1="10"><ContentField attr1="" attr2="0">This is a test string</ContentField></ContentExample></soapenv:Body></soapenv:Envelope>`,
+	},
+	{
+		name:     "action already quoted",
+		action:   `"http://example.com/Service/Operation"`,
+		header:   `"http://example.com/Service/Operation"`,
+		envelope: `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><ContentExample attr1="10"><ContentField attr1="" attr2="0">This is a test string</ContentField></ContentExample></soapenv:Body></soapenv:Envelope>`,
+	},
+	{
+		name:     "streamed",
+		action:   "http://example.com/Service/Operation",
+		stream:   true,
+		header:   `"http://example.com/Service/Operation"`,
+		envelope: `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"><soapenv:Body><ContentExample attr1="10"><ContentField attr1="" attr2="0">This is a test string</ContentField></ContentExample></soapenv:Body></soapenv:Envelope>`,
+	},
+	{
+		name:   "signed",
+		action: "http://example.com/Service/Operation",
+		sign:   true,
+		header: `"http://example.com/Service/Operation"`,
+	},
+}
+
+func TestClientWCFCompatibility(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	for _, tt := range wcfCompatibilityTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var action string
+			var body []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				action = r.Header.Get("SOAPAction")
+				body, _ = ioutil.ReadAll(r.Body)
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(requestTestResponse))
+			}))
+			defer server.Close()
+
+			content := &envelopeContentExample{Attr1: 10, Field1: envelopeExampleField{Value: "This is a test string"}}
+			req := NewRequest(tt.action, server.URL, content, &envelopeContentExample{}, nil)
+			req.StreamBody(tt.stream)
+			if tt.sign {
+				req.SignWith(wsseInfo)
+			}
+
+			client := NewClient(server.Client(), WithWCFCompatibility())
+			_, err := client.Do(context.Background(), req)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.header, action)
+
+			if !tt.sign {
+				assert.Equal(t, tt.envelope, string(body))
+				return
+			}
+
+			doc := etree.NewDocument()
+			assert.Nil(t, doc.ReadFromBytes(body))
+			assert.NotNil(t, doc.FindElement("soapenv:Envelope/soapenv:Header/Security"))
+
+			// The signed body declares every namespace it uses, and is digested exactly as it is sent.
+			start := bytes.Index(body, []byte("<soapenv:Body "))
+			end := bytes.Index(body, []byte("</soapenv:Body>")) + len("</soapenv:Body>")
+			if !assert.True(t, start >= 0 && end > start) {
+				return
+			}
+			signed := body[start:end]
+			assert.Contains(t, string(signed), `<soapenv:Body xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/" xmlns:wsu="`+wsuNS+`" wsu:Id="`)
+
+			digest := sha256.Sum256(signed)
+			digestValue := doc.FindElement("//DigestValue")
+			if assert.NotNil(t, digestValue) {
+				assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), digestValue.Text())
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+)
+
+// These are the standalone entry points into the parsing paths used when handling responses.
+// They're exported so that the handling of untrusted input can be exercised directly, i.e. by native Go fuzzing.
+
+// DecodeEnvelope deserializes the SOAP envelope in data.
+// The body is decoded into content, and if a fault is present its detail element is decoded into faultDetail.
+// Both arguments are pointers, as they would be supplied to NewRequest; faultDetail may be nil.
+// As for responses, elements typed as SOAP encoding base64 (soapenc:base64 or soapenc:base64Binary), as sent by
+// legacy rpc/encoded services, are decoded into []byte fields as their binary content.
+func DecodeEnvelope(data []byte, content interface{}, faultDetail interface{}) (*Envelope, error) {
+	envelope := NewEnvelopeWithFault(content, faultDetail)
+
+	if err := newEnvelopeDecoder(bytes.NewReader(data), "", decodeLimits{}).Decode(envelope); err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+// DecodeXOP deserializes a MIME multipart XOP message read from r, as received in a multipart response.
+// The mediaParams argument contains the parameters of the message Content-Type, and must include the boundary.
+// The body and fault detail are decoded as described in DecodeEnvelope, with the binary parts of the message
+// stored in the []byte fields referenced by the XOP includes in the body.
+// Parts referenced by fields holding a writer, such as an io.Writer field set to a file or a *bytes.Buffer field, are
+// instead copied into the writer as they are read, without being held in memory, and the writer is closed once the
+// part is copied if it is an io.Closer. Writers which need to be set before decoding, such as files, must be set in
+// structs reached through pointers that are already allocated, as the decoder allocates new values for nil pointers
+// and appends new elements to slices.
+func DecodeXOP(r io.Reader, mediaParams map[string]string, content interface{}, faultDetail interface{}) (*Envelope, error) {
+	envelope := NewEnvelopeWithFault(content, faultDetail)
+
+	if err := newXopDecoder(r, mediaParams).decode(envelope); err != nil {
+		return nil, err
+	}
+	return envelope, nil
+}
+
+// DecodeFrom decodes the envelope from r, which holds a message of the content type, as the body of a response is
+// decoded: XML media types are decoded as an envelope, and multipart media types as a MIME multipart XOP message.
+// This allows envelopes stored, or received through other transports, to be decoded in the same way.
+// The envelope is decoded into as when created by NewEnvelope or NewEnvelopeWithFault.
+func (e *Envelope) DecodeFrom(r io.Reader, contentType string) error {
+	mediaType, mediaParams, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+	return bodyDecoder{}.decode(r, mediaType, mediaParams, e)
+}
+
+// DecodeFault deserializes the standalone SOAP fault element in data, decoding its detail element into detail.
+// The detail argument may be nil if no detail is expected.
+func DecodeFault(data []byte, detail interface{}) (*Fault, error) {
+	fault := NewFault()
+	if detail != nil {
+		fault = NewFaultWithDetail(detail)
+	}
+
+	if err := newEnvelopeDecoder(bytes.NewReader(data), "", decodeLimits{}).Decode(fault); err != nil {
+		return nil, err
+	}
+	return fault, nil
+}
+
+// newEnvelopeDecoder returns a decoder reading an envelope, or a standalone fault, from r.
+// If namespace is set, elements in that namespace are decoded as though they were in the envelope namespace.
+func newEnvelopeDecoder(r io.Reader, namespace string, limits decodeLimits) *xml.Decoder {
+	return xml.NewTokenDecoder(envelopeTokenReader(xml.NewDecoder(r), namespace, limits))
+}
+
+// envelopeTokenReader wraps the token reader r of an envelope with the readers adjusting it for decoding, and
+// checking it against the limits.
+func envelopeTokenReader(r xml.TokenReader, namespace string, limits decodeLimits) xml.TokenReader {
+	if limits.set() {
+		r = &limitReader{r: r, limits: limits}
+	}
+	if namespace != "" && namespace != soapEnvNS {
+		r = &namespaceReader{r: r, from: namespace, to: soapEnvNS}
+	}
+	return &faultScopeReader{r: &soapEncBase64Reader{r: r}}
+}
+
+// namespaceReader is a token reader which moves the elements and attributes in the namespace from to the namespace
+// to, including the declarations of the namespace.
+type namespaceReader struct {
+	r    xml.TokenReader
+	from string
+	to   string
+}
+
+// Token satisfies the xml.TokenReader interface.
+func (r *namespaceReader) Token() (xml.Token, error) {
+	token, err := r.r.Token()
+	if err != nil {
+		return token, err
+	}
+
+	switch elem := token.(type) {
+	case xml.StartElement:
+		if elem.Name.Space == r.from {
+			elem.Name.Space = r.to
+		}
+		attrs := make([]xml.Attr, len(elem.Attr))
+		for i, attr := range elem.Attr {
+			if attr.Name.Space == r.from {
+				attr.Name.Space = r.to
+			} else if isNamespaceDecl(attr) && attr.Value == r.from {
+				attr.Value = r.to
+			}
+			attrs[i] = attr
+		}
+		elem.Attr = attrs
+		return elem, nil
+	case xml.EndElement:
+		if elem.Name.Space == r.from {
+			elem.Name.Space = r.to
+		}
+		return elem, nil
+	}
+
+	return token, nil
+}
@@ -0,0 +1,109 @@
+package soap
+
+import (
+	"bytes"
+	"mime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeEnvelope(t *testing.T) {
+	content := &envelopeContentExample{}
+	envelope, err := DecodeEnvelope([]byte(envelopeDecodeTests[0].in), content, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, envelope.Body.Fault)
+	assert.Equal(t, "This is a test content string", content.Field1.Value)
+
+	detail := &faultDetailExample{}
+	envelope, err = DecodeEnvelope([]byte(envelopeDecodeTests[1].in), &envelopeContentExample{}, detail)
+	assert.Nil(t, err)
+	assert.NotNil(t, envelope.Body.Fault)
+	assert.Equal(t, "FaultCodeValue", envelope.Body.Fault.Code)
+	assert.Equal(t, int32(10), detail.Attr1)
+
+	_, err = DecodeEnvelope([]byte(envelopeDecodeTests[0].in), nil, nil)
+	assert.Equal(t, ErrEnvelopeMisconfigured, err)
+}
+
+func TestDecodeXOP(t *testing.T) {
+	_, mediaParams, err := mime.ParseMediaType(testMultipartWithCSVContentType)
+	assert.Nil(t, err)
+
+	content := &RunTimeSeriesReportResponse{}
+	_, err = DecodeXOP(strings.NewReader(testMultipartWithCSV), mediaParams, content, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), content.Report.NumberOfDataSets)
+}
+
+func TestEnvelopeDecodeFrom(t *testing.T) {
+	content := &envelopeContentExample{}
+	assert.Nil(t, NewEnvelope(content).DecodeFrom(strings.NewReader(envelopeDecodeTests[0].in), `text/xml; charset="utf-8"`))
+	assert.Equal(t, "This is a test content string", content.Field1.Value)
+
+	report := &RunTimeSeriesReportResponse{}
+	assert.Nil(t, NewEnvelope(report).DecodeFrom(strings.NewReader(testMultipartWithCSV), testMultipartWithCSVContentType))
+	assert.Equal(t, int32(1), report.Report.NumberOfDataSets)
+
+	err := NewEnvelope(&envelopeContentExample{}).DecodeFrom(strings.NewReader("{}"), "application/json")
+	assert.Equal(t, ErrUnsupportedContentType, err)
+
+	err = NewEnvelope(&envelopeContentExample{}).DecodeFrom(strings.NewReader(envelopeDecodeTests[0].in), "")
+	assert.NotNil(t, err)
+}
+
+func TestDecodeFault(t *testing.T) {
+	detail := &faultDetailExample{}
+	fault, err := DecodeFault([]byte(faultDecodeTests[1].in), detail)
+	assert.Nil(t, err)
+	assert.Equal(t, "FaultCodeValue", fault.Code)
+	assert.Equal(t, int32(10), detail.Attr1)
+
+	_, err = DecodeFault([]byte(faultDecodeTests[1].in), nil)
+	assert.Equal(t, ErrFaultDetailPresentButNotSpecified, err)
+}
+
+// The fuzz targets below are seeded from the decode test tables, as well as the corpora in testdata/fuzz.
+// Run them with i.e. 'go test -fuzz FuzzDecodeEnvelope'.
+
+func FuzzDecodeEnvelope(f *testing.F) {
+	for _, tt := range envelopeDecodeTests {
+		f.Add([]byte(tt.in))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		envelope, err := DecodeEnvelope(data, &envelopeContentExample{}, &faultDetailExample{})
+		if err == nil && envelope == nil {
+			t.Errorf("no envelope returned for successful decode")
+		}
+	})
+}
+
+func FuzzDecodeXOP(f *testing.F) {
+	_, mediaParams, err := mime.ParseMediaType(testMultipartWithCSVContentType)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add([]byte(testMultipartWithCSV), mediaParams["boundary"])
+
+	f.Fuzz(func(t *testing.T, data []byte, boundary string) {
+		envelope, err := DecodeXOP(bytes.NewReader(data), map[string]string{"boundary": boundary}, &RunTimeSeriesReportResponse{}, nil)
+		if err == nil && envelope == nil {
+			t.Errorf("no envelope returned for successful decode")
+		}
+	})
+}
+
+func FuzzDecodeFault(f *testing.F) {
+	for _, tt := range faultDecodeTests {
+		f.Add([]byte(tt.in))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fault, err := DecodeFault(data, &faultDetailExample{})
+		if err == nil && fault == nil {
+			t.Errorf("no fault returned for successful decode")
+		}
+	})
+}
@@ -44,8 +44,8 @@ main() {
     // Sign the request
     soapReq.SignWith(wsseInfo)
 
-    // Create the SOAP client
-    soapClient := soap.NewClient(&http.Client{})
+    // Create the SOAP client, with the default transport and timeouts
+    soapClient := soap.NewClient(nil)
 
     // Make the request
     soapResp, err := soapClient.Do(context.Background(), soapReq)
@@ -0,0 +1,222 @@
+package soap
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Implements the xsd:duration type.
+
+// Duration is an xsd:duration, such as P1Y2M3DT4H5M6.5S, which may be used as the type of fields holding one,
+// whether elements or attributes. Unlike time.Duration, it holds the years, months and days of the duration apart
+// from its time, as their length depends on the date the duration is added to; see AddTo.
+// The components are non-negative, the duration being negative if Negative is set. A duration is parsed and formatted
+// with the components it has, so P1D and PT24H aren't the same, although they are equal as a time.Duration.
+type Duration struct {
+	// Negative is set if the duration is negative, i.e. -P1D.
+	Negative bool
+	Years    int
+	Months   int
+	Days     int
+	// Time is the time component of the duration: its hours, minutes and seconds, to the nanosecond.
+	Time time.Duration
+}
+
+// ParseDuration parses an xsd:duration in its lexical form, PnYnMnDTnHnMnS, in which every component is optional but
+// at least one must be present. Fractions of seconds beyond the nanosecond are truncated.
+func ParseDuration(s string) (Duration, error) {
+	var d Duration
+	invalid := fmt.Errorf("invalid xsd:duration %q", s)
+
+	rest := strings.TrimSpace(s)
+	if strings.HasPrefix(rest, "-") {
+		d.Negative = true
+		rest = rest[1:]
+	}
+	if !strings.HasPrefix(rest, "P") {
+		return Duration{}, invalid
+	}
+
+	date, timeOfDay := rest[1:], ""
+	if idx := strings.IndexByte(date, 'T'); idx >= 0 {
+		date, timeOfDay = date[:idx], date[idx+1:]
+		if timeOfDay == "" {
+			return Duration{}, invalid
+		}
+	}
+	if date == "" && timeOfDay == "" {
+		return Duration{}, invalid
+	}
+
+	dateComponents, ok := durationComponents(date, "YMD")
+	if !ok {
+		return Duration{}, invalid
+	}
+	for _, component := range dateComponents {
+		n, err := strconv.Atoi(component.value)
+		if err != nil || strings.Contains(component.value, ".") {
+			return Duration{}, invalid
+		}
+		switch component.designator {
+		case 'Y':
+			d.Years = n
+		case 'M':
+			d.Months = n
+		case 'D':
+			d.Days = n
+		}
+	}
+
+	timeComponents, ok := durationComponents(timeOfDay, "HMS")
+	if !ok {
+		return Duration{}, invalid
+	}
+	for _, component := range timeComponents {
+		whole, fraction := component.value, ""
+		if idx := strings.IndexByte(whole, '.'); idx >= 0 {
+			whole, fraction = whole[:idx], whole[idx+1:]
+			if component.designator != 'S' || whole == "" || fraction == "" {
+				return Duration{}, invalid
+			}
+		}
+
+		var err error
+		switch component.designator {
+		case 'H':
+			err = addDuration(&d.Time, whole, time.Hour)
+		case 'M':
+			err = addDuration(&d.Time, whole, time.Minute)
+		case 'S':
+			if err = addDuration(&d.Time, whole, time.Second); err == nil && fraction != "" {
+				err = addDuration(&d.Time, (fraction + "000000000")[:9], time.Nanosecond)
+			}
+		}
+		if err != nil {
+			return Duration{}, invalid
+		}
+	}
+
+	return d, nil
+}
+
+// durationComponent is a component of a duration: a number followed by its designator.
+type durationComponent struct {
+	value      string
+	designator byte
+}
+
+// durationComponents splits s into its components, whose designators must be among designators, in their order.
+func durationComponents(s string, designators string) ([]durationComponent, bool) {
+	var components []durationComponent
+	next := 0
+	for s != "" {
+		end := 0
+		for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.') {
+			end++
+		}
+		if end == 0 || end == len(s) {
+			return nil, false
+		}
+
+		idx := strings.IndexByte(designators[next:], s[end])
+		if idx < 0 {
+			return nil, false
+		}
+		next += idx + 1
+
+		components = append(components, durationComponent{value: s[:end], designator: s[end]})
+		s = s[end+1:]
+	}
+	return components, true
+}
+
+// addDuration adds the number of units in digits to d, failing if it overflows.
+func addDuration(d *time.Duration, digits string, unit time.Duration) error {
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return err
+	}
+	if n > int64(math.MaxInt64/unit) || time.Duration(n)*unit > math.MaxInt64-*d {
+		return strconv.ErrRange
+	}
+	*d += time.Duration(n) * unit
+	return nil
+}
+
+// String returns the duration in its lexical form, with the components it has, or PT0S if it has none.
+func (d Duration) String() string {
+	var b strings.Builder
+	b.WriteByte('P')
+	for _, component := range []struct {
+		value      int
+		designator byte
+	}{{d.Years, 'Y'}, {d.Months, 'M'}, {d.Days, 'D'}} {
+		if component.value != 0 {
+			b.WriteString(strconv.Itoa(component.value))
+			b.WriteByte(component.designator)
+		}
+	}
+
+	if d.Time != 0 {
+		b.WriteByte('T')
+		rest := d.Time
+		if hours := rest / time.Hour; hours != 0 {
+			b.WriteString(strconv.FormatInt(int64(hours), 10) + "H")
+			rest -= hours * time.Hour
+		}
+		if minutes := rest / time.Minute; minutes != 0 {
+			b.WriteString(strconv.FormatInt(int64(minutes), 10) + "M")
+			rest -= minutes * time.Minute
+		}
+		if rest != 0 {
+			b.WriteString(strconv.FormatInt(int64(rest/time.Second), 10))
+			if nanos := rest % time.Second; nanos != 0 {
+				b.WriteString("." + strings.TrimRight(fmt.Sprintf("%09d", int64(nanos)), "0"))
+			}
+			b.WriteByte('S')
+		}
+	}
+
+	if b.Len() == 1 {
+		return "PT0S"
+	}
+	if d.Negative {
+		return "-" + b.String()
+	}
+	return b.String()
+}
+
+// AddTo returns the time t plus the duration, as defined by XML Schema: the years and months are added first, the day
+// being clamped to the length of the resulting month, so that January 31 plus a month is the last day of February,
+// then the days, following the calendar, and then the time.
+func (d Duration) AddTo(t time.Time) time.Time {
+	sign := 1
+	if d.Negative {
+		sign = -1
+	}
+
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(sign*(d.Years*12+d.Months)), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1+sign*d.Days).Add(time.Duration(sign) * d.Time)
+}
+
+// MarshalText satisfies the encoding.TextMarshaler interface, for elements and attributes alike.
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText satisfies the encoding.TextUnmarshaler interface, for elements and attributes alike.
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
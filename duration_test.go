@@ -0,0 +1,87 @@
+package soap
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDuration(t *testing.T) {
+	var tests = []struct {
+		value    string
+		duration Duration
+		err      bool
+		format   string
+	}{
+		{value: "P1Y2M3DT4H5M6S", duration: Duration{Years: 1, Months: 2, Days: 3, Time: 4*time.Hour + 5*time.Minute + 6*time.Second}},
+		{value: "-P1D", duration: Duration{Negative: true, Days: 1}},
+		{value: "PT24H", duration: Duration{Time: 24 * time.Hour}},
+		{value: "PT90M", duration: Duration{Time: 90 * time.Minute}, format: "PT1H30M"},
+		{value: "PT6.5S", duration: Duration{Time: 6500 * time.Millisecond}},
+		{value: "PT0.0000000019S", duration: Duration{Time: 1}, format: "PT0.000000001S"},
+		{value: "P0D", duration: Duration{}, format: "PT0S"},
+		{value: " P1M\n", duration: Duration{Months: 1}, format: "P1M"},
+		{value: "P1MT1M", duration: Duration{Months: 1, Time: time.Minute}},
+		{value: "", err: true},
+		{value: "P", err: true},
+		{value: "PT", err: true},
+		{value: "P1DT", err: true},
+		{value: "1D", err: true},
+		{value: "P1H", err: true},
+		{value: "PT1D", err: true},
+		{value: "P1D2Y", err: true},
+		{value: "P1Y1Y", err: true},
+		{value: "P1.5D", err: true},
+		{value: "PT.5S", err: true},
+		{value: "PT5.S", err: true},
+		{value: "PT1.5M", err: true},
+		{value: "P-1D", err: true},
+		{value: "PT9999999999999H", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			duration, err := ParseDuration(tt.value)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.duration, duration)
+
+			format := tt.format
+			if format == "" {
+				format = tt.value
+			}
+			assert.Equal(t, format, duration.String())
+		})
+	}
+}
+
+func TestDurationAddTo(t *testing.T) {
+	start := time.Date(2024, time.January, 31, 12, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2024, time.March, 1, 13, 30, 0, 0, time.UTC), Duration{Months: 1, Days: 1, Time: 90 * time.Minute}.AddTo(start))
+	assert.Equal(t, time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC), Duration{Months: 1}.AddTo(start))
+	assert.Equal(t, time.Date(2023, time.January, 30, 12, 0, 0, 0, time.UTC), Duration{Negative: true, Years: 1, Days: 1}.AddTo(start))
+}
+
+func TestDurationXML(t *testing.T) {
+	type schedule struct {
+		XMLName  xml.Name `xml:"Schedule"`
+		Interval Duration `xml:"interval,attr"`
+		Timeout  Duration `xml:"Timeout"`
+	}
+
+	data, err := xml.Marshal(schedule{Interval: Duration{Days: 1}, Timeout: Duration{Time: 30 * time.Second}})
+	assert.Nil(t, err)
+	assert.Equal(t, `<Schedule interval="P1D"><Timeout>PT30S</Timeout></Schedule>`, string(data))
+
+	var decoded schedule
+	assert.Nil(t, xml.Unmarshal([]byte(`<Schedule interval="-P1Y"><Timeout> PT1M </Timeout></Schedule>`), &decoded))
+	assert.Equal(t, Duration{Negative: true, Years: 1}, decoded.Interval)
+	assert.Equal(t, Duration{Time: time.Minute}, decoded.Timeout)
+
+	assert.NotNil(t, xml.Unmarshal([]byte(`<Schedule interval="1 day"/>`), &decoded))
+}
@@ -1,8 +1,15 @@
 package soap
 
 import (
+	"bytes"
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/beevik/etree"
 )
 
 const xsdNS = "http://www.w3.org/2001/XMLSchema"
@@ -11,9 +18,12 @@ const soapEnvNS = "http://schemas.xmlsoap.org/soap/envelope/"
 
 var (
 	// ErrUnableToSignEmptyEnvelope is returned if the envelope to be signed is empty. This is not valid.
-	ErrUnableToSignEmptyEnvelope = errors.New("unable to sign, envelope is empty")
+	ErrUnableToSignEmptyEnvelope = newCategoryError(ErrSecurity, "unable to sign, envelope is empty")
 	// ErrEnvelopeMisconfigured is returned if we attempt to deserialize a SOAP envelope without a type to deserialize the body or fault into.
 	ErrEnvelopeMisconfigured = errors.New("envelope content or fault pointer empty")
+	// ErrEnvelopeMalformed is returned when decoding an envelope with more than one header or body, a header after
+	// the body, or elements other than them.
+	ErrEnvelopeMalformed = newCategoryError(ErrDecode, "envelope has duplicate or unexpected elements")
 )
 
 // Envelope is a SOAP envelope.
@@ -21,9 +31,11 @@ type Envelope struct {
 	// XMLName is the serialized name of this object.
 	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
 
-	// These are generic namespaces used by all messages.
+	// These are the XML schema namespaces, declared if set.
 	XMLNSXsd string `xml:"xmlns:xsd,attr,omitempty"`
 	XMLNSXsi string `xml:"xmlns:xsi,attr,omitempty"`
+	// Namespaces holds any other namespace declarations to write on the envelope.
+	Namespaces NamespaceDecls `xml:",any,attr,omitempty"`
 
 	Header *Header
 	Body   *Body
@@ -61,30 +73,383 @@ func (e *Envelope) AddHeaders(elems ...interface{}) {
 	e.Header.Headers = append(e.Header.Headers, elems)
 }
 
-// signWithWSSEInfo takes the supplied auth info, uses the WS Security X.509 signing standard and adds the resulting header.
-func (e *Envelope) signWithWSSEInfo(info *WSSEAuthInfo) error {
-	e.XMLNSXsd = xsdNS
-	e.XMLNSXsi = xsiNS
+// OnHeader sets v, a pointer, as the value the header entry with the name is decoded into when the envelope is
+// decoded, such as a WS-Addressing or session header. The namespace must match, unless name has none. Entries of
+// several names can be decoded into values of independent types by setting a target for each; entries are recorded
+// in the Entries of the header whether they have a target or not.
+func (e *Envelope) OnHeader(name xml.Name, v interface{}) {
+	if e.Header == nil {
+		e.Header = &Header{}
+	}
+	if e.Header.targets == nil {
+		e.Header.targets = map[xml.Name]interface{}{}
+	}
+	e.Header.targets[name] = v
+}
+
+// NamespaceMismatchError is returned when decoding an envelope whose envelope, header or body element is not in the
+// SOAP 1.1 envelope namespace, such as a SOAP 1.2 envelope, which would otherwise be decoded as empty.
+type NamespaceMismatchError struct {
+	// Expected is the local name of the element expected: Envelope, Header or Body.
+	Expected string
+	// Name is the name of the element found.
+	Name xml.Name
+}
+
+func (e *NamespaceMismatchError) Error() string {
+	return fmt.Sprintf("expected SOAP 1.1 %s, got %s", strings.ToLower(e.Expected), qualifiedName(e.Name))
+}
+
+// Unwrap returns the category of the error, ErrDecode.
+func (e *NamespaceMismatchError) Unwrap() error {
+	return ErrDecode
+}
+
+// qualifiedName returns the name in {namespace}local form, or just the local name if it has no namespace.
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
+
+// UnexpectedResponseError is returned when decoding a response whose body doesn't hold the element expected by the
+// request (see Request.ExpectResponse).
+type UnexpectedResponseError struct {
+	// Expected is the name of the element expected.
+	Expected xml.Name
+	// Name is the name of the element found, which is empty if the body was empty.
+	Name xml.Name
+}
+
+func (e *UnexpectedResponseError) Error() string {
+	if e.Name.Local == "" {
+		return fmt.Sprintf("expected response element %s, got an empty body", qualifiedName(e.Expected))
+	}
+	return fmt.Sprintf("expected response element %s, got %s", qualifiedName(e.Expected), qualifiedName(e.Name))
+}
+
+// Unwrap returns the category of the error, ErrDecode.
+func (e *UnexpectedResponseError) Unwrap() error {
+	return ErrDecode
+}
+
+// UnmarshalXML decodes the envelope, checking that it and its header and body are in the SOAP 1.1 envelope namespace,
+// and that it holds at most one header, followed by one body, and nothing else. Envelopes holding other elements are
+// rejected with ErrEnvelopeMalformed, as a second header or body could be decoded in place of the one which was signed.
+func (e *Envelope) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if start.Name.Space != soapEnvNS || start.Name.Local != "Envelope" {
+		return &NamespaceMismatchError{Expected: "Envelope", Name: start.Name}
+	}
+	e.XMLName = start.Name
+
+	var sawHeader, sawBody bool
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			switch {
+			case elem.Name.Space != soapEnvNS && (elem.Name.Local == "Header" || elem.Name.Local == "Body"):
+				return &NamespaceMismatchError{Expected: elem.Name.Local, Name: elem.Name}
+			case elem.Name.Local == "Header" && !sawHeader && !sawBody:
+				sawHeader = true
+				if e.Header == nil {
+					e.Header = &Header{}
+				}
+				err = d.DecodeElement(e.Header, &elem)
+			case elem.Name.Local == "Body" && !sawBody:
+				sawBody = true
+				if e.Body == nil {
+					e.Body = &Body{}
+				}
+				err = d.DecodeElement(e.Body, &elem)
+			default:
+				err = ErrEnvelopeMalformed
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// MarshalIndent returns the envelope serialized as it would be sent, unsigned, with each element on its own line
+// and indented as with WithIndentedRequests. Content with custom marshalers, such as RawXML, is serialized first and
+// indented along with the rest of the envelope, so the output is the same regardless of how the content was written.
+func (e *Envelope) MarshalIndent() ([]byte, error) {
+	return transformEnvelope(e, func(doc *etree.Document) {
+		doc.Indent(requestIndent)
+	})
+}
+
+// String returns the envelope indented as by MarshalIndent, for logging and debugging.
+func (e *Envelope) String() string {
+	data, err := e.MarshalIndent()
+	if err != nil {
+		return "unable to marshal envelope: " + err.Error()
+	}
+	return string(data)
+}
+
+// SignOption configures how Envelope.Sign signs an envelope.
+type SignOption func(*signOptions)
 
+// signOptions are the settings of Envelope.Sign, which requests hold themselves.
+type signOptions struct {
+	ids   *WSSEAuthIDs
+	scope SigningScope
+	order []xml.Name
+}
+
+// WithSigningIDs makes Envelope.Sign use the IDs rather than generating new ones, as Request.SignWithIDs does.
+func WithSigningIDs(ids *WSSEAuthIDs) SignOption {
+	return func(o *signOptions) {
+		o.ids = ids
+	}
+}
+
+// WithSigningScope sets the part of the envelope covered by the signature, as Request.SignScope does.
+func WithSigningScope(scope SigningScope) SignOption {
+	return func(o *signOptions) {
+		o.scope = scope
+	}
+}
+
+// WithSignedHeaderOrder sets the order of the header entries, including the security header, as Request.OrderHeaders
+// does.
+func WithSignedHeaderOrder(names ...xml.Name) SignOption {
+	return func(o *signOptions) {
+		o.order = names
+	}
+}
+
+// Sign signs the envelope with the credentials, as requests signed with Request.SignWith are, returning the signed
+// envelope serialized. This allows envelopes built outside of a Request, such as responses of a service or messages
+// generated offline, to be signed in the same way. The body is signed unless set otherwise with WithSigningScope.
+// The envelope must have content, and its body is given the wsu:Id it is signed by.
+func (e *Envelope) Sign(info *WSSEAuthInfo, opts ...SignOption) ([]byte, error) {
+	var o signOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return e.signWithWSSEInfo(info, o.ids, o.scope, o.order, nil)
+}
+
+// signWithWSSEInfo takes the supplied auth info, uses the WS Security X.509 signing standard and returns the signed,
+// serialized envelope.
+// The envelope is marshalled and canonicalized once: the signed elements are digested, and the security header is
+// inserted into the same document before it is written. This guarantees that the digested bytes are the bytes sent.
+// When signing the body, header entries with a wsu:Id attribute are canonicalized and signed in the same way.
+// When signing the whole envelope, it is canonicalized and digested once the security token has been inserted, and
+// the signature is then added to the security header.
+// The IDs set in presetIDs, if any, are used rather than generated.
+// If transform is set, it is applied to the marshalled envelope before it is canonicalized. The header entries,
+// including the security header, are then sorted into the order of the names in order, if any.
+func (e *Envelope) signWithWSSEInfo(info *WSSEAuthInfo, presetIDs *WSSEAuthIDs, scope SigningScope, order []xml.Name, transform func(doc *etree.Document)) ([]byte, error) {
 	if e.Body.Content == nil {
-		return ErrUnableToSignEmptyEnvelope
+		return nil, ErrUnableToSignEmptyEnvelope
+	}
+
+	ids, err := generateWSSEAuthIDs(presetIDs)
+	if err != nil {
+		return nil, classify(ErrSecurity, err)
 	}
 
 	e.Body.XMLNSWsu = wsuNS
+	e.Body.ID = ids.bodyID
+
+	enc := getEncoder()
+	defer putEncoder(enc)
+
+	if err := enc.encode(e); err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	doc.WriteSettings.CanonicalEndTags = true
+	if err := doc.ReadFromBytes(enc.bytes()); err != nil {
+		return nil, err
+	}
+
+	if transform != nil {
+		transform(doc)
+	}
+
+	body := doc.FindElement("Envelope/Body")
+	if body == nil {
+		return nil, errInvalidCanonicalizationPath
+	}
+
+	var references []SignatureReference
+	if scope == SignBody {
+		references = signedElementReferences(doc, body, ids, info.suite)
+	}
+
+	// The security header follows any custom headers, creating the Header element if there were none.
+	header := doc.FindElement("Envelope/Header")
+	if header == nil {
+		header = etree.NewElement("Header")
+		if body.Space != "" {
+			header.Space = body.Space
+		} else {
+			header.CreateAttr("xmlns", body.SelectAttrValue("xmlns", soapEnvNS))
+		}
+		doc.Root().InsertChild(body, header)
+	}
+	security := info.securityHeader(ids)
+	header.AddChild(security)
+	orderHeaderEntries(header, order)
+
+	if scope == SignEnvelope {
+		// The signature is yet to be added, so the envelope is digested as the enveloped signature transform sees it.
+		canonicalizeElement(doc.Root())
+		references = []SignatureReference{info.suite.newEnvelopeReference(serializeElement(doc.Root(), nil, nil))}
+	}
 
-	ids, err := generateWSSEAuthIDs()
+	signature, err := info.sign(ids, references)
 	if err != nil {
-		return err
+		return nil, classify(ErrSecurity, err)
 	}
 
-	securityHeader, err := info.sign(*e.Body, ids)
+	signatureEnc, err := xml.Marshal(signature)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	e.AddHeaders(securityHeader)
-	e.Body.ID = ids.bodyID
+	signatureDoc := etree.NewDocument()
+	if err := signatureDoc.ReadFromBytes(signatureEnc); err != nil {
+		return nil, err
+	}
+	security.AddChild(signatureDoc.Root())
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err := doc.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// signedElementReferences canonicalizes the body, and the header entries carrying a wsu:Id attribute, such as
+// WS-Addressing headers, in place, returning the references to them, digested as by the suite.
+func signedElementReferences(doc *etree.Document, body *etree.Element, ids *WSSEAuthIDs, suite AlgorithmSuite) []SignatureReference {
+	canonicalizeElement(body)
+	references := []SignatureReference{suite.newSignatureReference(ids.bodyID, serializeElement(body, nil, nil))}
+
+	if header := doc.FindElement("Envelope/Header"); header != nil {
+		for _, entry := range header.ChildElements() {
+			id := entry.SelectAttrValue("wsu:Id", "")
+			if id == "" {
+				continue
+			}
+
+			canonicalizeElement(entry)
+			references = append(references, suite.newSignatureReference(id, serializeElement(entry, nil, nil)))
+		}
+	}
+
+	return references
+}
 
+// transformEnvelope marshals the envelope and applies transform to it, returning the serialized result.
+func transformEnvelope(e *Envelope, transform func(doc *etree.Document)) ([]byte, error) {
+	enc := getEncoder()
+	defer putEncoder(enc)
+
+	if err := enc.encode(e); err != nil {
+		return nil, err
+	}
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(enc.bytes()); err != nil {
+		return nil, err
+	}
+	transform(doc)
+
+	buf := getBuffer()
+	defer putBuffer(buf)
+
+	if _, err := doc.WriteTo(buf); err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// withHeaderOrder returns the transform followed by sorting the header entries into the order of the names.
+func withHeaderOrder(transform func(doc *etree.Document), order []xml.Name) func(doc *etree.Document) {
+	return func(doc *etree.Document) {
+		if transform != nil {
+			transform(doc)
+		}
+		orderHeaderEntries(doc.FindElement("Envelope/Header"), order)
+	}
+}
+
+// orderHeaderEntries sorts the entries of the header element which have the names first, in the order of the names,
+// keeping the order of the other entries. Only the elements are moved, so that the whitespace of an indented header
+// is left in place.
+func orderHeaderEntries(header *etree.Element, order []xml.Name) {
+	if header == nil || len(order) == 0 {
+		return
+	}
+
+	var slots []int
+	var entries []*etree.Element
+	for i, token := range header.Child {
+		if elem, ok := token.(*etree.Element); ok {
+			slots = append(slots, i)
+			entries = append(entries, elem)
+		}
+	}
+
+	rank := func(elem *etree.Element) int {
+		name := xml.Name{Space: elementNamespace(elem), Local: elem.Tag}
+		for i, want := range order {
+			if want.Local == name.Local && (want.Space == "" || want.Space == name.Space) {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return rank(entries[i]) < rank(entries[j])
+	})
+
+	for i, slot := range slots {
+		header.Child[slot] = entries[i]
+	}
+}
+
+// replaceNamespace replaces the declarations of the namespace from by declarations of the namespace to, in elem and
+// its children.
+func replaceNamespace(elem *etree.Element, from string, to string) {
+	if elem == nil {
+		return
+	}
+
+	for i, attr := range elem.Attr {
+		if (attr.Space == "xmlns" || attr.Space == "" && attr.Key == "xmlns") && attr.Value == from {
+			elem.Attr[i].Value = to
+		}
+	}
+	for _, child := range elem.ChildElements() {
+		replaceNamespace(child, from, to)
+	}
+}
+
+// NamespaceDecls are namespace declarations to write on an element, as xmlns:prefix attributes.
+// They are only used when encoding: declarations in decoded documents are resolved by the decoder instead.
+type NamespaceDecls []xml.Attr
+
+// UnmarshalXMLAttr implements the xml.UnmarshalerAttr interface, ignoring the attribute.
+func (n *NamespaceDecls) UnmarshalXMLAttr(attr xml.Attr) error {
 	return nil
 }
 
@@ -95,6 +460,102 @@ type Header struct {
 
 	// Headers is an array of envelope headers to send.
 	Headers []interface{} `xml:",omitempty"`
+	// Entries lists the entries of a decoded header, in order.
+	Entries []HeaderEntry `xml:"-"`
+
+	// targets are the values header entries are decoded into, by element name.
+	targets map[xml.Name]interface{}
+}
+
+// HeaderEntry is an entry of a decoded envelope header.
+type HeaderEntry struct {
+	// Name is the namespace qualified name of the element.
+	Name xml.Name
+	// Raw is the element serialized as a standalone fragment, which can be decoded with xml.Unmarshal.
+	// The namespaces used are declared where they are used, so the prefixes may differ from those received.
+	Raw RawXML
+}
+
+// UnmarshalXML decodes the header, recording each of its entries. Entries with a target registered for their name
+// are decoded into it as well (see Envelope.OnHeader).
+func (h *Header) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	h.XMLName = start.Name
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			raw, err := captureElement(d, elem)
+			if err != nil {
+				return err
+			}
+			h.Entries = append(h.Entries, HeaderEntry{Name: elem.Name, Raw: raw})
+
+			if target, ok := h.target(elem.Name); ok {
+				if err := xml.Unmarshal(raw, target); err != nil {
+					return err
+				}
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// target returns the value the entry with the name is decoded into, registered either with its name or with its local
+// name alone.
+func (h *Header) target(name xml.Name) (interface{}, bool) {
+	if target, ok := h.targets[name]; ok {
+		return target, true
+	}
+	target, ok := h.targets[xml.Name{Local: name.Local}]
+	return target, ok
+}
+
+// captureElement reads the rest of the element started by start from d, returning it serialized as a standalone
+// fragment. Namespace declarations are dropped, as the encoder declares the namespaces of the names it writes.
+func captureElement(d *xml.Decoder, start xml.StartElement) (RawXML, error) {
+	var buf bytes.Buffer
+	enc := xml.NewEncoder(&buf)
+
+	var token xml.Token = start
+	for depth := 0; ; {
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			attrs := t.Attr[:0:0]
+			for _, attr := range t.Attr {
+				if attr.Name.Space != "xmlns" && !(attr.Name.Space == "" && attr.Name.Local == "xmlns") {
+					attrs = append(attrs, attr)
+				}
+			}
+			t.Attr = attrs
+			token = t
+		case xml.EndElement:
+			depth--
+		}
+
+		if err := enc.EncodeToken(token); err != nil {
+			return nil, err
+		}
+		if depth == 0 {
+			break
+		}
+
+		var err error
+		if token, err = d.Token(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+	return RawXML(buf.Bytes()), nil
 }
 
 // Body is a SOAP envelope body.
@@ -111,11 +572,20 @@ type Body struct {
 	Fault *Fault `xml:",omitempty"`
 	// Body is a SOAP request or response body.
 	Content interface{} `xml:",omitempty"`
+
+	// expected, if set, is the name the content element must have when decoding.
+	expected xml.Name
+	// strictNamespaces checks the namespaces of the content element and the elements within it when decoding.
+	strictNamespaces bool
 }
 
 // UnmarshalXML is an overridden deserialization routine used to decode a SOAP envelope body.
 // The elements are read from the decoder d, starting at the element start. The contents of the decode are stored
 // in the invoking body b. Any errors encountered are returned.
+// If the content is BareParts, each element of the body is decoded into the matching part.
+// If the content is a struct with a field tagged `xml:",any"`, elements following the content element in the body,
+// such as vendor extensions, are decoded into that field, which is appended to if it is a slice. They are otherwise
+// decoded into the content, replacing the values decoded from the content element.
 func (b *Body) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	if b.Content == nil {
 		return ErrEnvelopeMisconfigured
@@ -126,6 +596,7 @@ func (b *Body) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 		b.Fault = NewFault()
 	}
 
+	decoded, contentDecoded := false, false
 	for {
 		token, err := d.Token()
 		if err != nil {
@@ -136,6 +607,7 @@ func (b *Body) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 
 		switch elem := token.(type) {
 		case xml.StartElement:
+			decoded = true
 			// If the start element is a fault decode it as a fault, otherwise parse it as content.
 			if elem.Name.Space == soapEnvNS && elem.Name.Local == "Fault" {
 				err = d.DecodeElement(b.Fault, &elem)
@@ -144,17 +616,86 @@ func (b *Body) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 				}
 				// Clear the content if we have a fault
 				b.Content = nil
+			} else if extra := anyField(b.Content); contentDecoded && extra.IsValid() {
+				// Elements following the content are captured by its catch-all field.
+				if err := d.DecodeElement(extra.Addr().Interface(), &elem); err != nil {
+					return err
+				}
 			} else {
-				err = d.DecodeElement(b.Content, &elem)
+				if !b.expects(elem.Name) {
+					return &UnexpectedResponseError{Expected: b.expected, Name: elem.Name}
+				}
+				if parts, ok := b.Content.(BareParts); ok {
+					err = parts.decodeElement(d, elem, b.strictNamespaces)
+				} else if b.strictNamespaces {
+					err = decodeStrict(d, b.Content, elem)
+				} else {
+					err = d.DecodeElement(b.Content, &elem)
+				}
 				if err != nil {
 					return err
 				}
+				contentDecoded = true
 				// Clear the fault if we have content
 				b.Fault = nil
 			}
 		case xml.EndElement:
 			// We expect the Body to have a single entry, so once we encounter the end element we're done.
+			// An empty body, as in responses to some WS-ReliableMessaging messages, is not a fault.
+			if !decoded {
+				if b.expected.Local != "" {
+					return &UnexpectedResponseError{Expected: b.expected}
+				}
+				b.Fault = nil
+			}
 			return nil
 		}
 	}
 }
+
+// anyField returns the field of the struct pointed to by content tagged `xml:",any"`, or the zero Value if there is
+// none.
+func anyField(content interface{}) reflect.Value {
+	v := reflect.ValueOf(content)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		flags := strings.Split(field.Tag.Get("xml"), ",")
+		if flags[0] != "" {
+			continue
+		}
+		isAny, isAttr := false, false
+		for _, flag := range flags[1:] {
+			isAny = isAny || flag == "any"
+			isAttr = isAttr || flag == "attr"
+		}
+		if isAny && !isAttr {
+			return v.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// expects checks whether the content element may have the name.
+func (b *Body) expects(name xml.Name) bool {
+	switch {
+	case b.expected.Local == "":
+		return true
+	case b.expected.Space == "":
+		return name.Local == b.expected.Local
+	default:
+		return name == b.expected
+	}
+}
@@ -263,6 +263,81 @@ var envelopeDecodeTests = []envelopeDecodeTest{
 		out:        nil,
 		err:        ErrEnvelopeMisconfigured,
 	},
+	{
+		in: `<?xml version="1.0"?>
+			<soap:Envelope xmlns:soap="http://www.w3.org/2003/05/soap-envelope">
+				<soap:Body>
+					<ContentExample attr1="10"></ContentExample>
+				</soap:Body>
+			</soap:Envelope>`,
+		contentPtr: &envelopeContentExample{},
+		out:        nil,
+		err:        &NamespaceMismatchError{Expected: "Envelope", Name: xml.Name{Space: "http://www.w3.org/2003/05/soap-envelope", Local: "Envelope"}},
+	},
+	{
+		in: `<?xml version="1.0"?>
+			<ContentExample attr1="10"></ContentExample>`,
+		contentPtr: &envelopeContentExample{},
+		out:        nil,
+		err:        &NamespaceMismatchError{Expected: "Envelope", Name: xml.Name{Local: "ContentExample"}},
+	},
+	{
+		in: `<?xml version="1.0"?>
+			<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+				<Body>
+					<ContentExample attr1="10"></ContentExample>
+				</Body>
+			</soap:Envelope>`,
+		contentPtr: &envelopeContentExample{},
+		out:        nil,
+		err:        &NamespaceMismatchError{Expected: "Body", Name: xml.Name{Local: "Body"}},
+	},
+	{
+		in: `<?xml version="1.0"?>
+			<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+				<soap:Body>
+					<ContentExample attr1="10"></ContentExample>
+				</soap:Body>
+				<soap:Body>
+					<ContentExample attr1="11"></ContentExample>
+				</soap:Body>
+			</soap:Envelope>`,
+		contentPtr: &envelopeContentExample{},
+		out:        nil,
+		err:        ErrEnvelopeMalformed,
+	},
+	{
+		in: `<?xml version="1.0"?>
+			<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+				<soap:Header></soap:Header>
+				<soap:Header></soap:Header>
+				<soap:Body>
+					<ContentExample attr1="10"></ContentExample>
+				</soap:Body>
+			</soap:Envelope>`,
+		contentPtr: &envelopeContentExample{},
+		out:        nil,
+		err:        ErrEnvelopeMalformed,
+	},
+	{
+		in: `<?xml version="1.0"?>
+			<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+				<soap:Body>
+					<ContentExample attr1="10"></ContentExample>
+				</soap:Body>
+				<Trailer></Trailer>
+			</soap:Envelope>`,
+		contentPtr: &envelopeContentExample{},
+		out:        nil,
+		err:        ErrEnvelopeMalformed,
+	},
+}
+
+func TestNamespaceMismatchError(t *testing.T) {
+	err := &NamespaceMismatchError{Expected: "Envelope", Name: xml.Name{Space: "http://www.w3.org/2003/05/soap-envelope", Local: "Envelope"}}
+	if want := "expected SOAP 1.1 envelope, got {http://www.w3.org/2003/05/soap-envelope}Envelope"; err.Error() != want {
+		t.Errorf("mismatch\nhave: %s\nwant: %s", err.Error(), want)
+	}
 }
 
 func TestEnvelopeDecode(t *testing.T) {
@@ -291,3 +366,154 @@ func TestEnvelopeDecode(t *testing.T) {
 		}
 	}
 }
+
+type envelopeSessionHeader struct {
+	ID string `xml:"ID"`
+}
+
+func TestEnvelopeOnHeader(t *testing.T) {
+	in := `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Header>` +
+		`<wsa:RelatesTo xmlns:wsa="http://www.w3.org/2005/08/addressing">urn:uuid:1</wsa:RelatesTo>` +
+		`<Session xmlns="urn:session"><ID>abc</ID></Session>` +
+		`<HeaderExample attr1="15">custom</HeaderExample>` +
+		`</s:Header><s:Body><ContentExample attr1="10"></ContentExample></s:Body></s:Envelope>`
+
+	var relatesTo envelopeExtension
+	var session envelopeSessionHeader
+	var other envelopeSessionHeader
+	content := &envelopeContentExample{}
+	envelope := NewEnvelope(content)
+	envelope.OnHeader(xml.Name{Space: wsaNS, Local: "RelatesTo"}, &relatesTo)
+	envelope.OnHeader(xml.Name{Local: "Session"}, &session)
+	envelope.OnHeader(xml.Name{Space: "urn:other", Local: "HeaderExample"}, &other)
+
+	if err := xml.Unmarshal([]byte(in), envelope); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if relatesTo.Value != "urn:uuid:1" {
+		t.Errorf("RelatesTo mismatch\nhave: %q\nwant: %q", relatesTo.Value, "urn:uuid:1")
+	}
+	if session.ID != "abc" {
+		t.Errorf("Session mismatch\nhave: %q\nwant: %q", session.ID, "abc")
+	}
+	if other.ID != "" {
+		t.Errorf("header in another namespace decoded: %#v", other)
+	}
+	if len(envelope.Header.Entries) != 3 {
+		t.Errorf("have %d entries, want 3", len(envelope.Header.Entries))
+	}
+	if content.Attr1 != 10 {
+		t.Errorf("body mismatch\nhave: %d\nwant: %d", content.Attr1, 10)
+	}
+}
+
+type envelopeExtension struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type envelopeContentAny struct {
+	XMLName    xml.Name            `xml:"ContentExample"`
+	Attr1      int32               `xml:"attr1,attr"`
+	Extensions []envelopeExtension `xml:",any"`
+}
+
+type envelopeContentAnySingle struct {
+	XMLName   xml.Name           `xml:"ContentExample"`
+	Attr1     int32              `xml:"attr1,attr"`
+	Extension *envelopeExtension `xml:",any"`
+}
+
+func TestBodyDecodeAny(t *testing.T) {
+	in := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>` +
+		`<ContentExample attr1="10"><Nested xmlns="urn:nested">inner</Nested></ContentExample>` +
+		`<Extension xmlns="urn:vendor">first</Extension>` +
+		`<Other xmlns="urn:vendor">second</Other>` +
+		`</Body></Envelope>`
+
+	content := &envelopeContentAny{}
+	if _, err := DecodeEnvelope([]byte(in), content, nil); err != nil {
+		t.Fatalf("unable to decode envelope: %v", err)
+	}
+	want := &envelopeContentAny{
+		XMLName: xml.Name{Space: soapEnvNS, Local: "ContentExample"},
+		Attr1:   10,
+		Extensions: []envelopeExtension{
+			{XMLName: xml.Name{Space: "urn:nested", Local: "Nested"}, Value: "inner"},
+			{XMLName: xml.Name{Space: "urn:vendor", Local: "Extension"}, Value: "first"},
+			{XMLName: xml.Name{Space: "urn:vendor", Local: "Other"}, Value: "second"},
+		},
+	}
+	if !reflect.DeepEqual(content, want) {
+		t.Errorf("mismatch\nhave: %#v\nwant: %#v", content, want)
+	}
+
+	single := &envelopeContentAnySingle{}
+	if _, err := DecodeEnvelope([]byte(in), single, nil); err != nil {
+		t.Fatalf("unable to decode envelope: %v", err)
+	}
+	if single.Attr1 != 10 {
+		t.Errorf("attr1 mismatch: have %d, want 10", single.Attr1)
+	}
+	if single.Extension == nil || single.Extension.Value != "second" {
+		t.Errorf("extension mismatch: %#v", single.Extension)
+	}
+}
+
+func TestEnvelopeMarshalIndent(t *testing.T) {
+	var tests = []struct {
+		name    string
+		content interface{}
+		headers []interface{}
+		out     string
+	}{
+		{
+			name:    "struct",
+			content: &envelopeContentExample{Attr1: 10, Field1: envelopeExampleField{Value: "test"}},
+			out: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Body xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+    <ContentExample attr1="10">
+      <ContentField attr1="" attr2="0">test</ContentField>
+    </ContentExample>
+  </Body>
+</Envelope>
+`,
+		},
+		{
+			name:    "raw XML",
+			content: RawXML(`<ns:Operation xmlns:ns="urn:example"><ns:Value>test</ns:Value></ns:Operation>`),
+			headers: []interface{}{headerExample{Attr1: 15, Value: "custom"}},
+			out: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Header xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+    <HeaderExample attr1="15">custom</HeaderExample>
+  </Header>
+  <Body xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+    <ns:Operation xmlns:ns="urn:example">
+      <ns:Value>test</ns:Value>
+    </ns:Operation>
+  </Body>
+</Envelope>
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope := NewEnvelope(tt.content)
+			if tt.headers != nil {
+				envelope.AddHeaders(tt.headers...)
+			}
+
+			data, err := envelope.MarshalIndent()
+			if err != nil {
+				t.Fatalf("unable to marshal envelope: %v", err)
+			}
+			if string(data) != tt.out {
+				t.Errorf("mismatch\nhave: %s\nwant: %s", data, tt.out)
+			}
+			if envelope.String() != tt.out {
+				t.Errorf("String mismatch\nhave: %s\nwant: %s", envelope.String(), tt.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Implements the categories of the errors returned by the package, so that callers can branch on the kind of failure
+// with errors.Is rather than matching error strings.
+
+var (
+	// ErrTransport is the category of errors sending a request or receiving its response, such as connection
+	// failures, timeouts and throttling (see ThrottledError).
+	ErrTransport = errors.New("transport error")
+	// ErrDecode is the category of errors decoding a response, such as malformed envelopes, unsupported content types
+	// and missing XOP parts.
+	ErrDecode = errors.New("unable to decode response")
+	// ErrSecurity is the category of WS-Security errors: loading signing credentials, signing requests, and verifying
+	// the security headers of responses.
+	ErrSecurity = errors.New("ws-security error")
+)
+
+// categoryError is a sentinel error of one of the categories, whose message is its own.
+type categoryError struct {
+	category error
+	msg      string
+}
+
+// newCategoryError returns a sentinel error with the message, matching the category with errors.Is.
+func newCategoryError(category error, msg string) error {
+	return &categoryError{category: category, msg: msg}
+}
+
+func (e *categoryError) Error() string {
+	return e.msg
+}
+
+// Unwrap returns the category of the error.
+func (e *categoryError) Unwrap() error {
+	return e.category
+}
+
+// classify wraps err in the category, unless it is nil or already of a category.
+func classify(category error, err error) error {
+	if err == nil || errors.Is(err, ErrTransport) || errors.Is(err, ErrDecode) || errors.Is(err, ErrSecurity) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", category, err)
+}
+
+// classifyResponse wraps an error reading the response in its category: failures reading the body from the
+// connection, or the context expiring while it is read, are transport errors, and any others are decoding errors.
+func classifyResponse(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return classify(ErrTransport, err)
+	}
+	return classify(ErrDecode, err)
+}
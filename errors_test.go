@@ -0,0 +1,87 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientErrorCategories(t *testing.T) {
+	var tests = []struct {
+		name        string
+		contentType string
+		response    string
+		closed      bool
+		category    error
+		err         error
+	}{
+		{name: "connection refused", closed: true, category: ErrTransport},
+		{name: "malformed envelope", contentType: "text/xml", response: `<Envelope`, category: ErrDecode},
+		{name: "unsupported content type", contentType: "application/json", response: `{}`, category: ErrDecode, err: ErrUnsupportedContentType},
+		{name: "wrong namespace", contentType: "text/xml", response: `<Envelope xmlns="urn:example"><Body/></Envelope>`, category: ErrDecode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.response))
+			}))
+			if tt.closed {
+				server.Close()
+			} else {
+				defer server.Close()
+			}
+
+			client := NewClient(server.Client())
+			_, err := client.Do(context.Background(), NewRequest("action", server.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil))
+			if !assert.NotNil(t, err) {
+				return
+			}
+			assert.True(t, errors.Is(err, tt.category), "%v is not %v", err, tt.category)
+			for _, category := range []error{ErrTransport, ErrDecode, ErrSecurity} {
+				if category != tt.category {
+					assert.False(t, errors.Is(err, category), "%v is %v", err, category)
+				}
+			}
+			if tt.err != nil {
+				assert.True(t, errors.Is(err, tt.err))
+			}
+		})
+	}
+}
+
+func TestSecurityErrorCategories(t *testing.T) {
+	var tests = []struct {
+		name     string
+		certPath string
+		keyPath  string
+	}{
+		{name: "missing certificate", certPath: "./testdata/missing.pem", keyPath: "./testdata/key.pem"},
+		{name: "invalid key", certPath: "./testdata/cert.pem", keyPath: "./testdata/cert.pem"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWSSEAuthInfo(tt.certPath, tt.keyPath)
+			assert.True(t, errors.Is(err, ErrSecurity), "%v is not %v", err, ErrSecurity)
+		})
+	}
+}
+
+func TestClassify(t *testing.T) {
+	cause := errors.New("cause")
+
+	assert.Nil(t, classify(ErrDecode, nil))
+	assert.Equal(t, ErrMissingXOPPart, classify(ErrDecode, ErrMissingXOPPart))
+	assert.Equal(t, ErrTimestampStale, classify(ErrDecode, ErrTimestampStale))
+
+	err := classify(ErrTransport, cause)
+	assert.True(t, errors.Is(err, ErrTransport))
+	assert.True(t, errors.Is(err, cause))
+	assert.Equal(t, "transport error: cause", err.Error())
+}
@@ -2,14 +2,15 @@ package soap
 
 import (
 	"encoding/xml"
-	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 )
 
 var (
 	// ErrFaultDetailPresentButNotSpecified is returned if the SOAP Fault details element is present but
 	// the fault was not constructed with a type for it.
-	ErrFaultDetailPresentButNotSpecified = errors.New("fault detail element present but no type supplied")
+	ErrFaultDetailPresentButNotSpecified = newCategoryError(ErrDecode, "fault detail element present but no type supplied")
 )
 
 // Fault is a SOAP fault code.
@@ -21,6 +22,11 @@ type Fault struct {
 	String string `xml:"faultstring,omitempty"`
 	Actor  string `xml:"faultactor,omitempty"`
 
+	// CodeName is the decoded fault code resolved against the namespace declarations in scope, so that it can be
+	// classified regardless of the prefix used, i.e. soap:Server is {http://schemas.xmlsoap.org/soap/envelope/}Server.
+	// The namespace is empty if the code has no prefix and there is no default namespace, or the prefix isn't declared.
+	CodeName xml.Name `xml:"-"`
+
 	// DetailInternal is a handle to the internal fault detail type. Do not directly access;
 	// this is made public only to allow for XML deserialization.
 	// Use the Detail() method instead.
@@ -32,8 +38,27 @@ func NewFault() *Fault {
 	return &Fault{}
 }
 
-// NewFaultWithDetail returns a new XML fault struct with a specified DetailInternal field
+// NewFaultWithDetail returns a new XML fault struct with a specified DetailInternal field.
+// The detail may be FaultDetails, to decode the detail element into whichever of several types matches it, or
+// FaultDetailEntries, to decode each of several elements in it into a value of the matching type.
+// A detail whose XMLName field is tagged "detail" is decoded from the detail element itself rather than from the
+// element in it, so that several differently named elements can be decoded into the fields tagged with their names.
 func NewFaultWithDetail(detail interface{}) *Fault {
+	switch detail := detail.(type) {
+	case FaultDetails:
+		return &Fault{
+			DetailInternal: &faultDetail{
+				candidates: detail,
+			},
+		}
+	case FaultDetailEntries:
+		return &Fault{
+			DetailInternal: &faultDetail{
+				entries: detail,
+			},
+		}
+	}
+
 	return &Fault{
 		DetailInternal: &faultDetail{
 			Content: detail,
@@ -41,7 +66,24 @@ func NewFaultWithDetail(detail interface{}) *Fault {
 	}
 }
 
+// FaultDetails are the candidate types of the detail of a fault, for services which return different detail elements
+// depending on the fault. Each is a pointer to a type marshalled as an element, whose name is given by its XMLName
+// field, or by the name of the type if it has none.
+// The detail element is decoded into the first candidate with a matching name, which is returned by Fault.Detail.
+// If none match, the detail is skipped and Fault.Detail returns nil.
+type FaultDetails []interface{}
+
+// FaultDetailEntries are the types of the elements in the detail of a fault, for services which return several
+// elements in the detail of a fault. Each is a pointer to a type marshalled as an element, named as for FaultDetails.
+// Each element in the detail is decoded into a new value of the first type with a matching name, and Fault.Detail
+// returns the values in the order of the elements, as a []interface{} holding pointers of the same types. Elements
+// which match none of the types are skipped.
+type FaultDetailEntries []interface{}
+
 // Detail exposes the type supplied during creation (if a type was supplied).
+// If the fault was created with FaultDetails, this is the candidate the detail was decoded into, if any.
+// If it was created with FaultDetailEntries, this is the []interface{} of the entries decoded, which is empty if
+// there were none.
 func (f *Fault) Detail() interface{} {
 	if f.DetailInternal == nil {
 		return nil
@@ -54,9 +96,122 @@ func (f *Fault) Error() string {
 	return fmt.Sprintf("soap fault: %s (%s)", f.Code, f.String)
 }
 
+// UnmarshalXML decodes the fault, resolving the namespace of its code. Faults decoded as part of an envelope have
+// the namespaces declared by their ancestors in scope; standalone faults only those declared on the fault itself.
+func (f *Fault) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	f.XMLName = start.Name
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch se := token.(type) {
+		case xml.StartElement:
+			switch se.Name.Local {
+			case "faultcode":
+				err = d.DecodeElement(&f.Code, &se)
+				f.CodeName = resolveQName(f.Code, append(start.Attr[:len(start.Attr):len(start.Attr)], se.Attr...))
+			case "faultstring":
+				err = d.DecodeElement(&f.String, &se)
+			case "faultactor":
+				err = d.DecodeElement(&f.Actor, &se)
+			case "detail":
+				if f.DetailInternal == nil {
+					f.DetailInternal = &faultDetail{}
+				}
+				err = d.DecodeElement(f.DetailInternal, &se)
+			default:
+				err = d.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// resolveQName resolves a prefix:local value against the namespace declarations among attrs, the last of which
+// take precedence.
+func resolveQName(value string, attrs []xml.Attr) xml.Name {
+	value = strings.TrimSpace(value)
+
+	prefix, local := "", value
+	if idx := strings.Index(value, ":"); idx >= 0 {
+		prefix, local = value[:idx], value[idx+1:]
+	}
+
+	name := xml.Name{Local: local}
+	for _, attr := range attrs {
+		if isNamespaceDecl(attr) && (attr.Name.Space == "" && prefix == "" || attr.Name.Space != "" && attr.Name.Local == prefix) {
+			name.Space = attr.Value
+		}
+	}
+	return name
+}
+
+// isNamespaceDecl returns whether attr declares a namespace, either for a prefix or as the default.
+func isNamespaceDecl(attr xml.Attr) bool {
+	return attr.Name.Space == "xmlns" || attr.Name.Space == "" && attr.Name.Local == "xmlns"
+}
+
+// faultScopeReader is a token reader which declares the namespaces in scope on each fault element, so that the
+// prefix of the fault code can be resolved when it is decoded. encoding/xml resolves the prefixes used in the names
+// of elements and attributes, but doesn't expose the declarations needed to resolve those used in character data.
+type faultScopeReader struct {
+	r xml.TokenReader
+	// scopes holds the namespace declarations of each open element, starting with the root element.
+	scopes [][]xml.Attr
+}
+
+// Token satisfies the xml.TokenReader interface.
+func (r *faultScopeReader) Token() (xml.Token, error) {
+	token, err := r.r.Token()
+	if err != nil {
+		return token, err
+	}
+
+	switch elem := token.(type) {
+	case xml.StartElement:
+		var decls []xml.Attr
+		for _, attr := range elem.Attr {
+			if isNamespaceDecl(attr) {
+				decls = append(decls, attr)
+			}
+		}
+
+		if elem.Name.Space == soapEnvNS && elem.Name.Local == "Fault" {
+			// The declarations of the ancestors precede those of the fault, which take precedence.
+			var attrs []xml.Attr
+			for _, scope := range r.scopes {
+				attrs = append(attrs, scope...)
+			}
+			elem.Attr = append(attrs, elem.Attr...)
+			token = elem
+		}
+		r.scopes = append(r.scopes, decls)
+	case xml.EndElement:
+		if len(r.scopes) > 0 {
+			r.scopes = r.scopes[:len(r.scopes)-1]
+		}
+	}
+
+	return token, nil
+}
+
 // faultDetail is an implementation detail of how we parse out the optional detail element of the XML fault.
 type faultDetail struct {
 	Content interface{} `xml:",omitempty"`
+
+	// candidates are the values the detail may be decoded into, if any, in which case the matching one is set as the
+	// content.
+	candidates FaultDetails
+	// entries are the types of the elements of the detail, if any, in which case the content is set to the values
+	// they were decoded into.
+	entries FaultDetailEntries
 }
 
 // UnmarshalXML is an overridden deserialization routine used to decode a SOAP fault.
@@ -64,10 +219,21 @@ type faultDetail struct {
 // in the invoking fault f. Any errors encountered are returned.
 func (f *faultDetail) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
 	// We still want to decode what we can, even if we don't have a field to store the details in.
-	if f.Content == nil {
+	if f.Content == nil && f.candidates == nil && f.entries == nil {
 		return ErrFaultDetailPresentButNotSpecified
 	}
 
+	// A type representing the detail element itself has the elements in it decoded into its fields.
+	if f.candidates == nil && f.entries == nil && elementName(f.Content).Local == start.Name.Local {
+		return d.DecodeElement(f.Content, &start)
+	}
+
+	var entries []interface{}
+	if f.entries != nil {
+		entries = []interface{}{}
+		f.Content = entries
+	}
+
 	for {
 		token, err := d.Token()
 		if err != nil {
@@ -78,7 +244,25 @@ func (f *faultDetail) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error
 
 		switch se := token.(type) {
 		case xml.StartElement:
-			if err = d.DecodeElement(f.Content, &se); err != nil {
+			target := f.Content
+			switch {
+			case f.candidates != nil:
+				f.Content = f.candidates.match(se.Name)
+				target = f.Content
+			case f.entries != nil:
+				target = nil
+				if match := FaultDetails(f.entries).match(se.Name); match != nil {
+					target = reflect.New(bodyType(match)).Interface()
+					entries = append(entries, target)
+					f.Content = entries
+				}
+			}
+			if target == nil {
+				err = d.Skip()
+			} else {
+				err = d.DecodeElement(target, &se)
+			}
+			if err != nil {
 				return err
 			}
 		case xml.EndElement:
@@ -87,3 +271,59 @@ func (f *faultDetail) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error
 		}
 	}
 }
+
+// adopt replaces the value the detail was decoded into by the equivalent in detail, as passed to NewFaultWithDetail.
+func (f *faultDetail) adopt(detail interface{}) {
+	candidates, ok := detail.(FaultDetails)
+	if !ok || f.candidates == nil {
+		f.Content = detail
+		return
+	}
+
+	for i, candidate := range f.candidates {
+		if f.Content != nil && candidate == f.Content && i < len(candidates) {
+			f.Content = candidates[i]
+			break
+		}
+	}
+	f.candidates = candidates
+}
+
+// match returns the first candidate marshalled as an element with the name, or nil if there is none.
+// A candidate without a namespace matches an element in any namespace.
+func (c FaultDetails) match(name xml.Name) interface{} {
+	for _, candidate := range c {
+		if candidateName := elementName(candidate); candidateName.Local == name.Local && (candidateName.Space == "" || candidateName.Space == name.Space) {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// elementName returns the name of the element v is marshalled as: that of the tag of its XMLName field, if it has
+// one, or else the name of its type.
+func elementName(v interface{}) xml.Name {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return xml.Name{}
+	}
+
+	if t.Kind() == reflect.Struct {
+		if f, ok := t.FieldByName("XMLName"); ok && f.Type == reflect.TypeOf(xml.Name{}) {
+			tag := f.Tag.Get("xml")
+			if idx := strings.Index(tag, ","); idx >= 0 {
+				tag = tag[:idx]
+			}
+			if idx := strings.LastIndex(tag, " "); idx >= 0 {
+				return xml.Name{Space: tag[:idx], Local: tag[idx+1:]}
+			}
+			if tag != "" {
+				return xml.Name{Local: tag}
+			}
+		}
+	}
+	return xml.Name{Local: t.Name()}
+}
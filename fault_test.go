@@ -275,3 +275,205 @@ func TestFaultDecode(t *testing.T) {
 		}
 	}
 }
+
+func TestFaultCodeName(t *testing.T) {
+	var tests = []struct {
+		name     string
+		envelope bool
+		in       string
+		code     string
+		codeName xml.Name
+	}{
+		{
+			name:     "envelope prefix",
+			envelope: true,
+			in:       `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode></soap:Fault></soap:Body></soap:Envelope>`,
+			code:     "soap:Server",
+			codeName: xml.Name{Space: soapEnvNS, Local: "Server"},
+		},
+		{
+			name:     "prefix declared on the body",
+			envelope: true,
+			in:       `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body xmlns:ns2="urn:errors"><s:Fault><faultcode>ns2:InvalidInput</faultcode></s:Fault></s:Body></s:Envelope>`,
+			code:     "ns2:InvalidInput",
+			codeName: xml.Name{Space: "urn:errors", Local: "InvalidInput"},
+		},
+		{
+			name:     "redeclared prefix",
+			envelope: true,
+			in:       `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" xmlns:e="urn:outer"><s:Body><s:Fault xmlns:e="urn:inner"><faultcode>e:Code</faultcode></s:Fault></s:Body></s:Envelope>`,
+			code:     "e:Code",
+			codeName: xml.Name{Space: "urn:inner", Local: "Code"},
+		},
+		{
+			name:     "prefix declared on the fault code",
+			in:       `<Fault xmlns="http://schemas.xmlsoap.org/soap/envelope/"><faultcode xmlns:e="urn:errors"> e:Code </faultcode></Fault>`,
+			code:     " e:Code ",
+			codeName: xml.Name{Space: "urn:errors", Local: "Code"},
+		},
+		{
+			name:     "default namespace",
+			in:       `<Fault xmlns="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>Server</faultcode></Fault>`,
+			code:     "Server",
+			codeName: xml.Name{Space: soapEnvNS, Local: "Server"},
+		},
+		{
+			name:     "undeclared prefix",
+			in:       `<f:Fault xmlns:f="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>x:Server</faultcode></f:Fault>`,
+			code:     "x:Server",
+			codeName: xml.Name{Local: "Server"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fault *Fault
+			if tt.envelope {
+				envelope, err := DecodeEnvelope([]byte(tt.in), new(faultDetailExample), nil)
+				if err != nil {
+					t.Fatalf("unable to decode envelope: %v", err)
+				}
+				fault = envelope.Body.Fault
+			} else {
+				var err error
+				if fault, err = DecodeFault([]byte(tt.in), nil); err != nil {
+					t.Fatalf("unable to decode fault: %v", err)
+				}
+			}
+
+			if fault == nil {
+				t.Fatal("no fault decoded")
+			}
+			if fault.Code != tt.code {
+				t.Errorf("code mismatch\nhave: %q\nwant: %q", fault.Code, tt.code)
+			}
+			if fault.CodeName != tt.codeName {
+				t.Errorf("code name mismatch\nhave: %v\nwant: %v", fault.CodeName, tt.codeName)
+			}
+		})
+	}
+}
+
+type faultDetailNamespaced struct {
+	XMLName xml.Name `xml:"urn:errors DetailExample"`
+	Attr1   int32    `xml:"attr1,attr"`
+}
+
+type faultDetailUntagged struct {
+	Attr1 int32 `xml:"attr1,attr"`
+}
+
+func TestFaultDetails(t *testing.T) {
+	var tests = []struct {
+		name    string
+		detail  string
+		matched int
+	}{
+		{name: "by namespace", detail: `<DetailExample xmlns="urn:errors" attr1="10"></DetailExample>`, matched: 0},
+		{name: "by local name", detail: `<DetailExample attr1="10"></DetailExample>`, matched: 1},
+		{name: "by type name", detail: `<faultDetailUntagged attr1="10"></faultDetailUntagged>`, matched: 2},
+		{name: "none", detail: `<Unknown attr1="10"></Unknown>`, matched: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := FaultDetails{&faultDetailNamespaced{}, &faultDetailExample{}, &faultDetailUntagged{}}
+
+			in := `<Fault xmlns="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>Server</faultcode><detail>` + tt.detail + `</detail></Fault>`
+			fault, err := DecodeFault([]byte(in), candidates)
+			if err != nil {
+				t.Fatalf("unable to decode fault: %v", err)
+			}
+
+			if tt.matched < 0 {
+				if fault.Detail() != nil {
+					t.Errorf("unexpected detail: %#v", fault.Detail())
+				}
+				return
+			}
+			if fault.Detail() != candidates[tt.matched] {
+				t.Fatalf("detail mismatch\nhave: %#v\nwant: %#v", fault.Detail(), candidates[tt.matched])
+			}
+			if attr := reflect.ValueOf(fault.Detail()).Elem().FieldByName("Attr1").Int(); attr != 10 {
+				t.Errorf("attr1 mismatch: have %d, want 10", attr)
+			}
+		})
+	}
+}
+
+type faultDetailFields struct {
+	XMLName  xml.Name               `xml:"detail"`
+	Example  *faultDetailExample    `xml:"DetailExample"`
+	Untagged []faultDetailUntagged  `xml:"faultDetailUntagged"`
+	Other    *faultDetailNamespaced `xml:"urn:errors DetailExample"`
+}
+
+func TestFaultDetailFields(t *testing.T) {
+	in := `<Fault xmlns="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>Server</faultcode><detail>` +
+		`<faultDetailUntagged attr1="1"></faultDetailUntagged>` +
+		`<DetailExample attr1="10"></DetailExample>` +
+		`<faultDetailUntagged attr1="2"></faultDetailUntagged>` +
+		`</detail></Fault>`
+
+	detail := &faultDetailFields{}
+	fault, err := DecodeFault([]byte(in), detail)
+	if err != nil {
+		t.Fatalf("unable to decode fault: %v", err)
+	}
+
+	if fault.Detail() != detail {
+		t.Fatalf("detail mismatch\nhave: %#v\nwant: %#v", fault.Detail(), detail)
+	}
+	if detail.Example == nil || detail.Example.Attr1 != 10 {
+		t.Errorf("example mismatch: %#v", detail.Example)
+	}
+	if len(detail.Untagged) != 2 || detail.Untagged[0].Attr1 != 1 || detail.Untagged[1].Attr1 != 2 {
+		t.Errorf("untagged mismatch: %#v", detail.Untagged)
+	}
+	if detail.Other != nil {
+		t.Errorf("unexpected namespaced detail: %#v", detail.Other)
+	}
+}
+
+func TestFaultDetailEntries(t *testing.T) {
+	var tests = []struct {
+		name   string
+		detail string
+		want   []interface{}
+	}{
+		{
+			name:   "ordered",
+			detail: `<DetailExample attr1="10"></DetailExample><faultDetailUntagged attr1="1"></faultDetailUntagged><DetailExample xmlns="urn:errors" attr1="2"></DetailExample>`,
+			want: []interface{}{
+				&faultDetailExample{XMLName: xml.Name{Space: soapEnvNS, Local: "DetailExample"}, Attr1: 10},
+				&faultDetailUntagged{Attr1: 1},
+				&faultDetailNamespaced{XMLName: xml.Name{Space: "urn:errors", Local: "DetailExample"}, Attr1: 2},
+			},
+		},
+		{
+			name:   "unknown skipped",
+			detail: `<Unknown attr1="3"></Unknown><faultDetailUntagged attr1="4"></faultDetailUntagged>`,
+			want:   []interface{}{&faultDetailUntagged{Attr1: 4}},
+		},
+		{
+			name: "empty",
+			want: []interface{}{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := FaultDetailEntries{&faultDetailNamespaced{}, &faultDetailExample{}, &faultDetailUntagged{}}
+
+			in := `<Fault xmlns="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>Server</faultcode><detail>` + tt.detail + `</detail></Fault>`
+			fault, err := DecodeFault([]byte(in), entries)
+			if err != nil {
+				t.Fatalf("unable to decode fault: %v", err)
+			}
+
+			if !reflect.DeepEqual(fault.Detail(), tt.want) {
+				t.Errorf("detail mismatch\nhave: %#v\nwant: %#v", fault.Detail(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package soap
+
+import (
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Implements a gateway forwarding SOAP requests to a backend service, as an intermediary between clients and a
+// service with different security requirements.
+
+// errMissingBody is returned if an envelope forwarded by a gateway has no body.
+var errMissingBody = errors.New("envelope has no body")
+
+// GatewayOption configures optional behaviour of a Gateway.
+type GatewayOption func(*Gateway)
+
+// WithInboundVerification makes the gateway verify the WS-Security signature of requests before forwarding them,
+// rejecting those which aren't signed, whose signature is invalid or doesn't cover their body, or whose certificate
+// verify doesn't trust, with a Client fault. The signature must be made with the key of a binary security token, over
+// elements canonicalized with Exclusive C14N.
+func WithInboundVerification(verify CertificateVerifier) GatewayOption {
+	return func(g *Gateway) {
+		g.verify = verify
+	}
+}
+
+// WithOutboundSigning makes the gateway sign the requests it forwards with the credentials, as with Request.SignWith.
+func WithOutboundSigning(info *WSSEAuthInfo) GatewayOption {
+	return func(g *Gateway) {
+		g.signer = info
+	}
+}
+
+// Gateway is an http.Handler accepting SOAP 1.1 requests and forwarding them to a backend service with a Client, as
+// an enterprise service bus would, relaying the response, or fault, of the backend to the caller.
+// The body and header entries of requests are forwarded as they were received, along with the SOAPAction header,
+// but for the wsse:Security header, which applies to the inbound request only and is stripped once it has been
+// verified; see WithInboundVerification and WithOutboundSigning. The security header of the response is stripped
+// in the same way.
+// Requests which can't be parsed are rejected with a Client fault, and those which can't be forwarded, i.e. as the
+// backend is unreachable, with a Server fault. The options of the client, such as its timeouts, throttling and
+// compatibility profile, apply to the forwarded requests, which are canceled along with the inbound requests.
+type Gateway struct {
+	client  *Client
+	backend string
+	verify  CertificateVerifier
+	signer  *WSSEAuthInfo
+}
+
+// NewGateway returns a gateway forwarding requests to the backend URL with the client.
+func NewGateway(client *Client, backend string, opts ...GatewayOption) *Gateway {
+	g := &Gateway{
+		client:  client,
+		backend: backend,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	return g
+}
+
+// gatewayElement is an element of a message relayed by a gateway, captured as it was decoded.
+type gatewayElement struct {
+	Raw RawXML
+}
+
+// UnmarshalXML captures the element.
+func (e *gatewayElement) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	raw, err := captureElement(d, start)
+	e.Raw = raw
+	return err
+}
+
+// gatewayDetail is the detail of a fault relayed by a gateway, whose entries are captured as they were decoded.
+type gatewayDetail struct {
+	XMLName xml.Name         `xml:"detail"`
+	Entries []gatewayElement `xml:",any"`
+}
+
+// ServeHTTP satisfies the http.Handler interface.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		WriteFault(w, &Fault{Code: "soap:Client", String: "unable to read request"}, SOAP11)
+		return
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil || doc.Root() == nil || doc.Root().Tag != "Envelope" {
+		WriteFault(w, &Fault{Code: "soap:Client", String: "request is not a SOAP envelope"}, SOAP11)
+		return
+	}
+	if elementNamespace(doc.Root()) != soapEnvNS {
+		WriteFault(w, &Fault{Code: "soap:VersionMismatch", String: "only SOAP 1.1 requests are accepted"}, SOAP11)
+		return
+	}
+
+	if g.verify != nil {
+		if err := verifySignature(doc, g.verify); err != nil {
+			WriteFault(w, &Fault{Code: "soap:Client", String: "request security is invalid"}, SOAP11)
+			return
+		}
+	}
+
+	req, err := g.forwardedRequest(doc, strings.Trim(r.Header.Get("SOAPAction"), `"`))
+	if err != nil {
+		WriteFault(w, &Fault{Code: "soap:Client", String: "unable to forward request"}, SOAP11)
+		return
+	}
+
+	resp, err := g.client.Do(r.Context(), req)
+	if err != nil {
+		WriteFault(w, &Fault{Code: "soap:Server", String: "backend request failed"}, SOAP11)
+		return
+	}
+
+	if fault := resp.Fault(); fault != nil {
+		WriteFault(w, relayedFault(fault), SOAP11)
+		return
+	}
+
+	envelope := NewEnvelope(RawXML(nil))
+	if body, ok := resp.Body().(*gatewayElement); ok {
+		envelope.Body.Content = body.Raw
+	}
+	for _, entry := range resp.Headers() {
+		if entry.Name != securityName {
+			envelope.AddHeaders(entry.Raw)
+		}
+	}
+	envelopeEnc, err := xml.Marshal(envelope)
+	if err != nil {
+		WriteFault(w, &Fault{Code: "soap:Server", String: "unable to relay response"}, SOAP11)
+		return
+	}
+
+	w.Header().Set("Content-Type", SOAP11.ContentType())
+	w.WriteHeader(http.StatusOK)
+	w.Write(envelopeEnc)
+}
+
+// forwardedRequest returns the request forwarding the envelope to the backend, with the body and header entries of
+// the envelope but for its security header.
+func (g *Gateway) forwardedRequest(doc *etree.Document, action string) (*Request, error) {
+	root := doc.Root()
+	header := childElement(root, soapEnvNS, "Header")
+	body := childElement(root, soapEnvNS, "Body")
+	if body == nil {
+		return nil, errMissingBody
+	}
+
+	var content RawXML
+	for _, elem := range body.ChildElements() {
+		raw, err := detachElement(elem, root, body)
+		if err != nil {
+			return nil, err
+		}
+		content = append(content, raw...)
+	}
+
+	req := NewRequest(action, g.backend, content, &gatewayElement{}, &gatewayDetail{})
+	if header != nil {
+		for _, elem := range header.ChildElements() {
+			if elem.Tag == "Security" && elementNamespace(elem) == wsseNS {
+				continue
+			}
+			raw, err := detachElement(elem, root, header)
+			if err != nil {
+				return nil, err
+			}
+			req.AddHeader(raw)
+		}
+	}
+	if g.signer != nil {
+		req.SignWith(g.signer)
+	}
+	return req, nil
+}
+
+// relayedFault returns a copy of the fault returned by the backend, with the entries of its detail as they were
+// decoded.
+func relayedFault(fault *Fault) *Fault {
+	relayed := NewFault()
+	if detail, ok := fault.Detail().(*gatewayDetail); ok && len(detail.Entries) > 0 {
+		var entries RawXML
+		for _, entry := range detail.Entries {
+			entries = append(entries, entry.Raw...)
+		}
+		relayed = NewFaultWithDetail(entries)
+	}
+	relayed.Code = fault.Code
+	relayed.String = fault.String
+	relayed.Actor = fault.Actor
+	return relayed
+}
+
+// detachElement serializes a copy of the element declaring the namespaces it inherits from its ancestors, from the
+// outermost to its parent, which it doesn't declare itself. The ancestors are walked from the nearest outwards, so
+// that a prefix declared again by an inner ancestor is bound as it is in scope at the element. The default namespace
+// of unprefixed ancestors is the envelope namespace, so it isn't inherited.
+func detachElement(elem *etree.Element, ancestors ...*etree.Element) (RawXML, error) {
+	detached := elem.Copy()
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		ancestor := ancestors[i]
+		for _, attr := range ancestor.Attr {
+			switch {
+			case attr.Space == "xmlns":
+				if detached.SelectAttr("xmlns:"+attr.Key) == nil {
+					detached.CreateAttr("xmlns:"+attr.Key, attr.Value)
+				}
+			case attr.Space == "" && attr.Key == "xmlns" && ancestor.Space != "":
+				if detached.SelectAttr("xmlns") == nil {
+					detached.CreateAttr("xmlns", attr.Value)
+				}
+			}
+		}
+	}
+
+	doc := etree.NewDocument()
+	doc.SetRoot(detached)
+	return doc.WriteToBytes()
+}
@@ -0,0 +1,134 @@
+package soap
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+type gatewayFaultExample struct {
+	XMLName xml.Name `xml:"urn:example FaultExample"`
+	Reason  string   `xml:"Reason"`
+}
+
+func TestGateway(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+	trusted := func(cert *x509.Certificate) error { return nil }
+
+	const response = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header>` +
+		`<HeaderExample attr1="20">response header</HeaderExample></soap:Header>` +
+		`<soap:Body><ContentExample xmlns="urn:example" attr1="30"><ContentField>result</ContentField></ContentExample></soap:Body></soap:Envelope>`
+	const fault = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+		`<faultcode>soap:Server</faultcode><faultstring>backend fault</faultstring>` +
+		`<detail><ex:FaultExample xmlns:ex="urn:example"><Reason>broken</Reason></ex:FaultExample></detail>` +
+		`</soap:Fault></soap:Body></soap:Envelope>`
+
+	var tests = []struct {
+		name      string
+		sign      bool
+		backend   string
+		faultCode string
+		faultText string
+		detail    *gatewayFaultExample
+	}{
+		{name: "forwarded", sign: true, backend: response},
+		{name: "unsigned", faultCode: "soap:Client", faultText: "request security is invalid"},
+		{name: "backend fault", sign: true, backend: fault, faultCode: "soap:Server", faultText: "backend fault", detail: &gatewayFaultExample{XMLName: xml.Name{Space: "urn:example", Local: "FaultExample"}, Reason: "broken"}},
+		{name: "backend unreachable", sign: true, faultCode: "soap:Server", faultText: "backend request failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var forwarded *etree.Document
+			var action string
+			backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				data, _ := ioutil.ReadAll(r.Body)
+				forwarded = etree.NewDocument()
+				forwarded.ReadFromBytes(data)
+				action = r.Header.Get("SOAPAction")
+
+				status := http.StatusOK
+				if tt.backend == fault {
+					status = http.StatusInternalServerError
+				}
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(status)
+				w.Write([]byte(tt.backend))
+			}))
+			defer backend.Close()
+			backendURL := backend.URL
+			if tt.backend == "" {
+				backendURL = "http://127.0.0.1:1"
+			}
+
+			gateway := httptest.NewServer(NewGateway(NewClient(nil), backendURL, WithInboundVerification(trusted), WithOutboundSigning(wsseInfo)))
+			defer gateway.Close()
+
+			body := &envelopeContentExample{}
+			req := NewRequest("urn:action", gateway.URL, &envelopeContentExample{Attr1: 10, Field1: envelopeExampleField{Value: "request"}}, body, &gatewayFaultExample{})
+			req.AddHeader(headerExample{Attr1: 15, Value: "request header"})
+			if tt.sign {
+				req.SignWith(wsseInfo)
+			}
+
+			resp, err := NewClient(nil).Do(context.Background(), req)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			if tt.faultCode != "" {
+				if !assert.NotNil(t, resp.Fault()) {
+					return
+				}
+				assert.Equal(t, tt.faultCode, resp.Fault().Code)
+				assert.Equal(t, tt.faultText, resp.Fault().String)
+				if tt.detail != nil {
+					assert.Equal(t, tt.detail, resp.Fault().Detail())
+				}
+				return
+			}
+
+			// The request is forwarded re-signed, without the inbound security header.
+			assert.Equal(t, "urn:action", action)
+			assert.Nil(t, verifySignature(forwarded, trusted))
+			assert.Len(t, forwarded.FindElements("//Security"), 1)
+			if header := forwarded.FindElement("//HeaderExample"); assert.NotNil(t, header) {
+				assert.Equal(t, "request header", header.Text())
+			}
+
+			assert.Nil(t, resp.Fault())
+			assert.Equal(t, &envelopeContentExample{XMLName: xml.Name{Space: "urn:example", Local: "ContentExample"}, Attr1: 30, Field1: envelopeExampleField{XMLName: xml.Name{Space: "urn:example", Local: "ContentField"}, Value: "result"}}, body)
+			if assert.Len(t, resp.Headers(), 1) {
+				assert.Equal(t, "HeaderExample", resp.Headers()[0].Name.Local)
+			}
+		})
+	}
+}
+
+func TestDetachElement(t *testing.T) {
+	doc := etree.NewDocument()
+	err := doc.ReadFromString(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ex="urn:outer" xmlns:other="urn:other">` +
+		`<soap:Body xmlns:ex="urn:inner"><ex:ContentExample other:attr1="10"></ex:ContentExample></soap:Body></soap:Envelope>`)
+	if !assert.Nil(t, err) {
+		return
+	}
+	root := doc.Root()
+	body := root.SelectElement("Body")
+
+	// The prefix is bound to the namespace declared by the body, which is the one in scope at the element.
+	raw, err := detachElement(body.SelectElement("ContentExample"), root, body)
+	assert.Nil(t, err)
+	detached := etree.NewDocument()
+	if assert.Nil(t, detached.ReadFromBytes(raw)) {
+		assert.Equal(t, "urn:inner", detached.Root().SelectAttrValue("xmlns:ex", ""))
+		assert.Equal(t, "urn:other", detached.Root().SelectAttrValue("xmlns:other", ""))
+	}
+}
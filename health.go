@@ -0,0 +1,152 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Implements health checks of endpoints, so that they can be probed ahead of requests rather than found to be down
+// by them.
+
+// ErrNoHealthCheck is returned by Client.Ping if the client has no health check; see WithHealthCheck.
+var ErrNoHealthCheck = errors.New("no health check configured")
+
+// HealthCheck is how Client.Ping probes an endpoint: with a plain HTTP request, or with a SOAP request.
+type HealthCheck struct {
+	// URL is the endpoint probed by HTTP health checks.
+	URL string
+	// Method is the method of HTTP health checks, which is HEAD if empty. GET suits endpoints which don't answer HEAD
+	// requests, such as the URL of their WSDL document.
+	Method string
+	// Request, if set, is a lightweight SOAP request sent in place of an HTTP request, such as an echo or version
+	// operation, in which case URL and Method are ignored. It is sent as with Do, but for the logger and handlers of
+	// the client, and its response and fault are decoded into new values of its types, so that it can be sent
+	// concurrently.
+	Request *Request
+}
+
+// WithHealthCheck sets how the client probes an endpoint with Ping.
+func WithHealthCheck(check HealthCheck) ClientOption {
+	return func(c *Client) {
+		c.healthCheck = &check
+	}
+}
+
+// HealthStatus is the health of an endpoint as reported by Client.Ping.
+type HealthStatus int
+
+const (
+	// Healthy is the status of endpoints which responded successfully.
+	Healthy HealthStatus = iota
+	// Unhealthy is the status of endpoints which responded with an HTTP error status or a SOAP fault, or whose
+	// response couldn't be decoded.
+	Unhealthy
+	// Unreachable is the status of endpoints which didn't respond, i.e. as the connection failed or timed out.
+	Unreachable
+)
+
+// String returns the name of the status.
+func (s HealthStatus) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Unhealthy:
+		return "unhealthy"
+	}
+	return "unreachable"
+}
+
+// PingResult is the outcome of a health check.
+type PingResult struct {
+	// URL is the endpoint probed.
+	URL string
+	// Status is the health of the endpoint.
+	Status HealthStatus
+	// StatusCode is the HTTP status code the endpoint answered the probe with. It is 0 if the endpoint was
+	// unreachable or didn't answer before the context of the check was done.
+	StatusCode int
+	// Fault is the SOAP fault returned by SOAP health checks, if any.
+	Fault *Fault
+	// Latency is the time taken by the health check.
+	Latency time.Duration
+	// Err is the error which made the endpoint unhealthy or unreachable, if any.
+	Err error
+}
+
+// Ping probes the endpoint with the health check of the client, returning its health. Endpoints are healthy if they
+// respond with a successful HTTP status and, for SOAP health checks, a response other than a fault. The error is only
+// set if the client has no health check; failures of the health check itself are reported by the result.
+// The context bounds the health check, which is otherwise bounded by the timeouts of the client.
+func (c *Client) Ping(ctx context.Context) (*PingResult, error) {
+	if c.healthCheck == nil {
+		return nil, ErrNoHealthCheck
+	}
+
+	start := time.Now()
+	var result *PingResult
+	if c.healthCheck.Request != nil {
+		result = c.pingSOAP(ctx, c.healthCheck.Request)
+	} else {
+		result = c.pingHTTP(ctx, c.healthCheck.URL, c.healthCheck.Method)
+	}
+	result.Latency = time.Since(start)
+	return result, nil
+}
+
+// pingHTTP probes the URL with an HTTP request with the method.
+func (c *Client) pingHTTP(ctx context.Context, url string, method string) *PingResult {
+	result := &PingResult{URL: url, Status: Unreachable}
+	if method == "" {
+		method = http.MethodHead
+	}
+
+	httpReq, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	httpResp, err := c.http.Do(httpReq.WithContext(ctx))
+	if err != nil {
+		result.Err = classify(ErrTransport, err)
+		return result
+	}
+	drainBody(httpResp.Body)
+
+	result.StatusCode = httpResp.StatusCode
+	result.Status = statusHealth(httpResp.StatusCode)
+	return result
+}
+
+// pingSOAP probes the endpoint of the request by sending a copy of it.
+func (c *Client) pingSOAP(ctx context.Context, req *Request) *PingResult {
+	attempt := req.Clone(req.body, newLike(req.resp), newLike(req.fault))
+	entry := &LogEntry{Action: attempt.action, Operation: attempt.action, URL: attempt.url}
+	result := &PingResult{URL: attempt.url}
+
+	resp, err := c.do(ctx, attempt, entry)
+	result.StatusCode = entry.StatusCode
+	switch {
+	case errors.Is(err, ErrTransport):
+		result.Status = Unreachable
+		result.Err = err
+	case err != nil:
+		result.Status = Unhealthy
+		result.Err = err
+	case resp.Fault() != nil:
+		result.Status = Unhealthy
+		result.Fault = resp.Fault()
+	default:
+		result.Status = statusHealth(resp.StatusCode)
+	}
+	return result
+}
+
+// statusHealth returns the health of an endpoint responding with the HTTP status code.
+func statusHealth(statusCode int) HealthStatus {
+	if statusCode >= 200 && statusCode < 400 {
+		return Healthy
+	}
+	return Unhealthy
+}
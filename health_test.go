@@ -0,0 +1,74 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientPing(t *testing.T) {
+	var tests = []struct {
+		name        string
+		soap        bool
+		method      string
+		status      int
+		response    string
+		unreachable bool
+		wantMethod  string
+		want        HealthStatus
+		faultCode   string
+		err         bool
+	}{
+		{name: "HEAD", status: http.StatusOK, wantMethod: http.MethodHead, want: Healthy},
+		{name: "GET", method: http.MethodGet, status: http.StatusOK, wantMethod: http.MethodGet, want: Healthy},
+		{name: "HTTP error", status: http.StatusServiceUnavailable, wantMethod: http.MethodHead, want: Unhealthy},
+		{name: "unreachable", unreachable: true, want: Unreachable, err: true},
+		{name: "SOAP", soap: true, status: http.StatusOK, response: requestTestResponse, wantMethod: http.MethodPost, want: Healthy},
+		{name: "SOAP fault", soap: true, status: http.StatusInternalServerError, response: loggerTestFault, wantMethod: http.MethodPost, want: Unhealthy, faultCode: "soap:Client"},
+		{name: "SOAP undecodable", soap: true, status: http.StatusOK, response: "<html>", wantMethod: http.MethodPost, want: Unhealthy, err: true},
+		{name: "SOAP unreachable", soap: true, unreachable: true, want: Unreachable, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method = r.Method
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			url := server.URL
+			if tt.unreachable {
+				server.Close()
+			} else {
+				defer server.Close()
+			}
+
+			check := HealthCheck{URL: url, Method: tt.method}
+			if tt.soap {
+				check.Request = NewRequest("urn:Ping", url, &headerExample{Value: "ping"}, &envelopeContentExample{}, nil)
+			}
+			result, err := NewClient(nil, WithHealthCheck(check)).Ping(context.Background())
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			assert.Equal(t, url, result.URL)
+			assert.Equal(t, tt.want, result.Status)
+			assert.Equal(t, tt.status, result.StatusCode)
+			assert.Equal(t, tt.wantMethod, method)
+			assert.Equal(t, tt.err, result.Err != nil)
+			assert.True(t, result.Latency > 0)
+			if tt.faultCode != "" && assert.NotNil(t, result.Fault) {
+				assert.Equal(t, tt.faultCode, result.Fault.Code)
+			}
+		})
+	}
+
+	_, err := NewClient(nil).Ping(context.Background())
+	assert.Equal(t, ErrNoHealthCheck, err)
+}
@@ -0,0 +1,163 @@
+package soap
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// Implements hedged requests: a duplicate of a slow idempotent request is sent after a delay, and whichever
+// response arrives first is used.
+
+// WithHedging enables hedged requests for idempotent requests (see Request.MarkIdempotent).
+// If no response has been received delay after a request is sent, a duplicate is sent to secondaryURL, or to the
+// same endpoint if it is empty. The first successful response is used, and the other request is canceled.
+// Requests streaming their body, handling attachments or reporting progress are never hedged, as none of these can
+// be safely duplicated, nor are requests whose response type has fields XOP parts are streamed into (see DecodeXOP).
+func WithHedging(delay time.Duration, secondaryURL string) ClientOption {
+	return func(c *Client) {
+		c.hedgeDelay = delay
+		c.hedgeURL = secondaryURL
+		c.hedging = true
+	}
+}
+
+// hedgeable checks whether the request may be hedged.
+func (c *Client) hedgeable(req *Request) bool {
+	return c.hedging && req.idempotent && !req.stream && req.attachments == nil && req.progress == nil && !hasWriterFields(req.resp)
+}
+
+// hedgeResult is the outcome of a single attempt of a hedged request.
+type hedgeResult struct {
+	req   *Request
+	resp  *Response
+	entry *LogEntry
+	err   error
+}
+
+// doHedged performs a hedged request. Each attempt decodes into its own copies of the response and fault types and
+// of the header targets, and the winning attempt's are copied into those of the request.
+func (c *Client) doHedged(ctx context.Context, req *Request, entry *LogEntry) (*Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, 2)
+	launch := func(url string) {
+		attempt := req.attempt()
+		attempt.url = url
+
+		attemptEntry := &LogEntry{Action: entry.Action, Operation: entry.Operation, URL: url}
+		go func() {
+			resp, err := c.do(ctx, attempt, attemptEntry)
+			results <- hedgeResult{req: attempt, resp: resp, entry: attemptEntry, err: err}
+		}()
+	}
+
+	launch(req.url)
+	pending := 1
+
+	timer := time.NewTimer(c.hedgeDelay)
+	defer timer.Stop()
+
+	hedgeURL := c.hedgeURL
+	if hedgeURL == "" {
+		hedgeURL = req.url
+	}
+
+	var firstErr hedgeResult
+	for {
+		select {
+		case <-timer.C:
+			launch(hedgeURL)
+			pending++
+		case result := <-results:
+			pending--
+
+			if result.err == nil {
+				*entry = *result.entry
+				return adoptResult(req, result.req, result.resp), nil
+			}
+
+			if firstErr.err == nil {
+				firstErr = result
+			}
+			// Failures are only reported once no attempt is left in flight. This includes the original attempt
+			// failing before the duplicate is sent, in which case the request is not hedged at all.
+			if pending == 0 {
+				*entry = *firstErr.entry
+				return nil, firstErr.err
+			}
+		}
+	}
+}
+
+// attempt returns a clone of the request for an attempt of it, which decodes into its own copies of the response and
+// fault types and of the values header entries are decoded into (see OnHeader), so that attempts in flight at the same
+// time don't decode into the same values.
+func (r *Request) attempt() *Request {
+	attempt := r.Clone(r.body, newLike(r.resp), newLike(r.fault))
+	attempt.headerTargets = nil
+	for name, target := range r.headerTargets {
+		attempt.decodeHeader(name, newLike(target))
+	}
+	return attempt
+}
+
+// adoptResult copies the response, fault and header entries decoded by an attempt of the request, such as the winning
+// attempt of a hedged request, into those of the original request.
+func adoptResult(req *Request, attempt *Request, resp *Response) *Response {
+	for name, target := range req.headerTargets {
+		copyInto(target, attempt.headerTargets[name])
+	}
+	if copyInto(req.resp, attempt.resp) {
+		resp.body = req.resp
+	}
+	if copyInto(req.fault, attempt.fault) {
+		resp.faultDetail = req.fault
+		if resp.fault != nil && resp.fault.DetailInternal != nil {
+			resp.fault.DetailInternal.adopt(req.fault)
+		}
+	}
+	return resp
+}
+
+// newLike returns a new zero value of the type pointed to by v, or v itself if it isn't a pointer.
+// Each of FaultDetails is replaced in the same way.
+func newLike(v interface{}) interface{} {
+	if details, ok := v.(FaultDetails); ok {
+		like := make(FaultDetails, len(details))
+		for i, detail := range details {
+			like[i] = newLike(detail)
+		}
+		return like
+	}
+
+	val := reflect.ValueOf(v)
+	if val.Kind() != reflect.Ptr || val.IsNil() {
+		return v
+	}
+	return reflect.New(val.Type().Elem()).Interface()
+}
+
+// copyInto copies the value pointed to by src into the value pointed to by dst, if both are non-nil pointers.
+// FaultDetails are copied item by item.
+func copyInto(dst interface{}, src interface{}) bool {
+	if dstDetails, ok := dst.(FaultDetails); ok {
+		srcDetails, ok := src.(FaultDetails)
+		if !ok || len(srcDetails) != len(dstDetails) {
+			return false
+		}
+		copied := false
+		for i := range dstDetails {
+			copied = copyInto(dstDetails[i], srcDetails[i]) || copied
+		}
+		return copied
+	}
+
+	dstVal, srcVal := reflect.ValueOf(dst), reflect.ValueOf(src)
+	if dstVal.Kind() != reflect.Ptr || dstVal.IsNil() || srcVal.Kind() != reflect.Ptr || srcVal.IsNil() || dstVal == srcVal {
+		return false
+	}
+	dstVal.Elem().Set(srcVal.Elem())
+	return true
+}
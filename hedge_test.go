@@ -0,0 +1,208 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const hedgeTestFault = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Fault xmlns="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>soap:Server</faultcode><faultstring>busy</faultstring><detail><HeaderExample attr1="7">detail</HeaderExample></detail></Fault></Body></Envelope>`
+
+func TestClientHedging(t *testing.T) {
+	var tests = []struct {
+		name       string
+		idempotent bool
+		secondary  bool
+		delays     []time.Duration
+		response   string
+		requests   int32
+		secondHits int32
+	}{
+		{
+			name:       "hedged to the same endpoint",
+			idempotent: true,
+			delays:     []time.Duration{500 * time.Millisecond, 0},
+			response:   requestTestResponse,
+			requests:   2,
+		},
+		{
+			name:       "hedged to a secondary endpoint",
+			idempotent: true,
+			secondary:  true,
+			delays:     []time.Duration{500 * time.Millisecond},
+			response:   requestTestResponse,
+			requests:   1,
+			secondHits: 1,
+		},
+		{
+			name:       "fast response not hedged",
+			idempotent: true,
+			delays:     []time.Duration{0},
+			response:   requestTestResponse,
+			requests:   1,
+		},
+		{
+			name:     "not idempotent",
+			delays:   []time.Duration{100 * time.Millisecond},
+			response: requestTestResponse,
+			requests: 1,
+		},
+		{
+			name:       "hedged fault",
+			idempotent: true,
+			delays:     []time.Duration{500 * time.Millisecond, 0},
+			response:   hedgeTestFault,
+			requests:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests, secondHits int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1)
+				if int(n) <= len(tt.delays) {
+					select {
+					case <-time.After(tt.delays[n-1]):
+					case <-r.Context().Done():
+						return
+					}
+				}
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			secondary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&secondHits, 1)
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(tt.response))
+			}))
+			defer secondary.Close()
+
+			secondaryURL := ""
+			if tt.secondary {
+				secondaryURL = secondary.URL
+			}
+
+			client := NewClient(server.Client(), WithHedging(20*time.Millisecond, secondaryURL))
+
+			resp := &envelopeContentExample{}
+			fault := &headerExample{}
+			req := NewRequest("action", server.URL, &headerExample{}, resp, fault)
+			if tt.idempotent {
+				req.MarkIdempotent()
+			}
+
+			start := time.Now()
+			soapResp, err := client.Do(context.Background(), req)
+			assert.Nil(t, err)
+			if tt.idempotent && len(tt.delays) > 0 && tt.delays[0] > 0 {
+				assert.True(t, time.Since(start) < tt.delays[0])
+			}
+
+			assert.Equal(t, tt.requests, atomic.LoadInt32(&requests))
+			assert.Equal(t, tt.secondHits, atomic.LoadInt32(&secondHits))
+
+			if tt.response == hedgeTestFault {
+				if assert.NotNil(t, soapResp.Fault()) {
+					assert.Equal(t, "soap:Server", soapResp.Fault().Code)
+					assert.True(t, soapResp.Fault().Detail() == fault)
+				}
+				assert.Equal(t, int32(7), fault.Attr1)
+			} else {
+				assert.True(t, soapResp.Body() == resp)
+				assert.Equal(t, int32(10), resp.Attr1)
+			}
+		})
+	}
+}
+
+func TestClientHedgingErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client(), WithHedging(time.Hour, ""))
+
+	req := NewRequest("action", server.URL, &headerExample{}, &envelopeContentExample{}, nil)
+	req.MarkIdempotent()
+
+	_, err := client.Do(context.Background(), req)
+	assert.Equal(t, ErrUnsupportedContentType, err)
+}
+
+func TestClientHedgingFaultDetails(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			select {
+			case <-time.After(500 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(hedgeTestFault))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client(), WithHedging(20*time.Millisecond, ""))
+
+	other, fault := &faultDetailExample{}, &headerExample{}
+	req := NewRequest("action", server.URL, &headerExample{}, &envelopeContentExample{}, FaultDetails{other, fault})
+	req.MarkIdempotent()
+
+	soapResp, err := client.Do(context.Background(), req)
+	if !assert.Nil(t, err) || !assert.NotNil(t, soapResp.Fault()) {
+		return
+	}
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.True(t, soapResp.Fault().Detail() == fault)
+	assert.Equal(t, int32(7), fault.Attr1)
+	assert.Equal(t, int32(0), other.Attr1)
+}
+
+func TestClientHedgingHeaders(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		if atomic.AddInt32(&requests, 1) == 1 {
+			// The header of the slow attempt is decoded before the attempt is abandoned.
+			w.Write([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Header>` +
+				`<wsa:RelatesTo xmlns:wsa="http://www.w3.org/2005/08/addressing">urn:uuid:1</wsa:RelatesTo>` +
+				`<HeaderExample attr1="1">slow</HeaderExample></s:Header>`))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Header>` +
+			`<HeaderExample attr1="2">fast</HeaderExample>` +
+			`</s:Header><s:Body><ContentExample attr1="10"></ContentExample></s:Body></s:Envelope>`))
+	}))
+	defer server.Close()
+
+	client := NewClient(server.Client(), WithHedging(100*time.Millisecond, ""))
+
+	var relatesTo envelopeExtension
+	var header headerExample
+	req := NewRequest("action", server.URL, &headerExample{}, &envelopeContentExample{}, nil)
+	req.MarkIdempotent()
+	req.OnHeader(xml.Name{Space: wsaNS, Local: "RelatesTo"}, &relatesTo)
+	req.OnHeader(xml.Name{Local: "HeaderExample"}, &header)
+
+	_, err := client.Do(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	// Only the headers of the winning attempt are decoded into the targets.
+	assert.Equal(t, envelopeExtension{}, relatesTo)
+	assert.Equal(t, headerExample{XMLName: xml.Name{Local: "HeaderExample"}, Attr1: 2, Value: "fast"}, header)
+}
@@ -0,0 +1,85 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// Implements limits on the size of the documents decoded from responses.
+
+var (
+	// ErrDepthLimitExceeded is returned if the elements of a response are nested deeper than the limit set with
+	// WithDecodeLimits.
+	ErrDepthLimitExceeded = newCategoryError(ErrDecode, "response exceeds the maximum element depth")
+	// ErrElementLimitExceeded is returned if a response has more elements than the limit set with WithDecodeLimits.
+	ErrElementLimitExceeded = newCategoryError(ErrDecode, "response exceeds the maximum number of elements")
+)
+
+// decodeLimits are the limits on the documents decoded from responses. A limit of 0 is no limit.
+type decodeLimits struct {
+	maxDepth    int
+	maxElements int
+}
+
+// WithDecodeLimits limits the nesting depth of the elements of responses, counting the envelope as 1, and the number
+// of elements in them, failing requests whose responses exceed either with ErrDepthLimitExceeded or
+// ErrElementLimitExceeded. This protects long-running services from the unbounded memory use of decoding deeply nested
+// or huge documents sent by buggy or compromised services. The limits apply to XML responses and to the root part of
+// multipart responses, as they are decoded; responses of known length are still read in full beforehand, as described
+// for Request.OnProgress. A limit of 0 leaves that dimension unlimited.
+func WithDecodeLimits(maxDepth int, maxElements int) ClientOption {
+	return func(c *Client) {
+		c.limits = decodeLimits{maxDepth: maxDepth, maxElements: maxElements}
+	}
+}
+
+// set returns whether any limit is set.
+func (l decodeLimits) set() bool {
+	return l.maxDepth > 0 || l.maxElements > 0
+}
+
+// limitReader is a token reader failing once the elements read exceed the limits.
+type limitReader struct {
+	r      xml.TokenReader
+	limits decodeLimits
+
+	depth    int
+	elements int
+}
+
+// Token satisfies the xml.TokenReader interface.
+func (r *limitReader) Token() (xml.Token, error) {
+	token, err := r.r.Token()
+	if err != nil {
+		return token, err
+	}
+
+	switch token.(type) {
+	case xml.StartElement:
+		r.depth++
+		r.elements++
+		if r.limits.maxDepth > 0 && r.depth > r.limits.maxDepth {
+			return nil, ErrDepthLimitExceeded
+		}
+		if r.limits.maxElements > 0 && r.elements > r.limits.maxElements {
+			return nil, ErrElementLimitExceeded
+		}
+	case xml.EndElement:
+		r.depth--
+	}
+	return token, nil
+}
+
+// checkLimits reads the document in data, returning an error if it exceeds the limits, before it is parsed into a
+// tree.
+func checkLimits(data []byte, limits decodeLimits) error {
+	r := &limitReader{r: xml.NewDecoder(bytes.NewReader(data)), limits: limits}
+	for {
+		if _, err := r.Token(); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientDecodeLimits(t *testing.T) {
+	nested := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Customer xmlns="urn:example">` +
+		strings.Repeat("<Note>", 10) + strings.Repeat("</Note>", 10) + `</Customer></Body></Envelope>`
+	wide := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Customer xmlns="urn:example">` +
+		strings.Repeat("<Note>note</Note>", 100) + `</Customer></Body></Envelope>`
+	// The multiRef response has 24 elements, which are 113 once the multiRef element is inlined at each reference.
+	multiRef := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Customer xmlns="urn:example">` +
+		strings.Repeat(`<Note href="#id0"/>`, 10) + `</Customer><multiRef id="id0">` + strings.Repeat("<Line>note</Line>", 10) +
+		`</multiRef></Body></Envelope>`
+
+	var tests = []struct {
+		name        string
+		contentType string
+		response    string
+		opts        []ClientOption
+		resp        interface{}
+		err         error
+	}{
+		{name: "within limits", contentType: "text/xml", response: nested, opts: []ClientOption{WithDecodeLimits(13, 13)}},
+		{name: "too deep", contentType: "text/xml", response: nested, opts: []ClientOption{WithDecodeLimits(12, 0)}, err: ErrDepthLimitExceeded},
+		{name: "too many elements", contentType: "text/xml", response: wide, opts: []ClientOption{WithDecodeLimits(0, 100)}, err: ErrElementLimitExceeded},
+		{name: "axis", contentType: "text/xml", response: wide, opts: []ClientOption{WithAxisCompatibility(), WithDecodeLimits(0, 100)}, err: ErrElementLimitExceeded},
+		{name: "axis multiRef within limits", contentType: "text/xml", response: multiRef, opts: []ClientOption{WithAxisCompatibility(), WithDecodeLimits(0, 113)}},
+		{name: "axis multiRef", contentType: "text/xml", response: multiRef, opts: []ClientOption{WithAxisCompatibility(), WithDecodeLimits(0, 50)}, err: ErrElementLimitExceeded},
+		{name: "multipart", contentType: testMultipartWithCSVContentType, response: testMultipartWithCSV, opts: []ClientOption{WithDecodeLimits(0, 3)}, resp: &RunTimeSeriesReportResponse{}, err: ErrElementLimitExceeded},
+		{name: "unlimited", contentType: "text/xml", response: wide},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			resp := tt.resp
+			if resp == nil {
+				resp = &invalidCharsExample{}
+			}
+
+			client := NewClient(server.Client(), tt.opts...)
+			_, err := client.Do(context.Background(), NewRequest("action", server.URL, &invalidCharsExample{}, resp, nil))
+			if tt.err == nil {
+				assert.Nil(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, tt.err), "%v", err)
+			assert.True(t, errors.Is(err, ErrDecode))
+		})
+	}
+}
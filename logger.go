@@ -0,0 +1,60 @@
+package soap
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// Logger receives structured events for the requests made by a Client, allowing operational logging without wrapping
+// every call to Do. Implementations must be safe for concurrent use.
+type Logger interface {
+	// RequestStarted is called before the request is serialized and sent. Only the Action, Operation and URL are set.
+	RequestStarted(ctx context.Context, entry *LogEntry)
+	// RequestFinished is called once the request has completed, whether it succeeded or not.
+	RequestFinished(ctx context.Context, entry *LogEntry)
+}
+
+// LogEntry describes a single request made by a Client.
+type LogEntry struct {
+	// Action is the SOAP action of the request.
+	Action string
+	// Operation is the name of the operation of the request, by which metrics and traces can be grouped. It is the
+	// action, unless it is named otherwise with WithOperationNamer, or the name of the operation registered with
+	// WithOperations the request was built for.
+	Operation string
+	// URL is the endpoint the request was sent to.
+	URL string
+
+	// Duration is the time taken by the request, including serialization and deserialization.
+	Duration time.Duration
+	// SerializeDuration is the part of Duration spent serializing (and signing) the request.
+	// Streamed requests are serialized as they are sent, so that time is included in RoundTripDuration instead.
+	SerializeDuration time.Duration
+	// RoundTripDuration is the part of Duration spent sending the request and waiting for the response headers.
+	RoundTripDuration time.Duration
+	// DecodeDuration is the part of Duration spent reading and decoding the response body.
+	DecodeDuration time.Duration
+	// StatusCode is the HTTP status code of the response, or 0 if none was received.
+	StatusCode int
+	// FaultCode is the code of the SOAP fault returned by the service, if any.
+	FaultCode string
+	// RequestSize is the size of the serialized request body in bytes, or -1 if it was streamed.
+	RequestSize int64
+	// ResponseSize is the number of bytes of the response body that were read.
+	ResponseSize int64
+	// Err is the error returned by Do, if any.
+	Err error
+}
+
+// countingReadCloser counts the bytes read through it, to report the size of response bodies.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,60 @@
+//go:build go1.21
+// +build go1.21
+
+package soap
+
+import (
+	"context"
+	"log/slog"
+)
+
+// slogLogger is a Logger writing to a log/slog logger.
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger which writes request events to the supplied slog logger.
+// Request starts are logged at debug level. Completed requests are logged at info level, or at warn level if the
+// service returned a fault and at error level if the request failed.
+func NewSlogLogger(logger *slog.Logger) Logger {
+	return &slogLogger{
+		logger: logger,
+	}
+}
+
+// RequestStarted satisfies the Logger interface.
+func (l *slogLogger) RequestStarted(ctx context.Context, entry *LogEntry) {
+	l.logger.DebugContext(ctx, "soap request started",
+		slog.String("action", entry.Action),
+		slog.String("operation", entry.Operation),
+		slog.String("url", entry.URL),
+	)
+}
+
+// RequestFinished satisfies the Logger interface.
+func (l *slogLogger) RequestFinished(ctx context.Context, entry *LogEntry) {
+	attrs := []slog.Attr{
+		slog.String("action", entry.Action),
+		slog.String("operation", entry.Operation),
+		slog.String("url", entry.URL),
+		slog.Duration("duration", entry.Duration),
+		slog.Duration("serialize_duration", entry.SerializeDuration),
+		slog.Duration("round_trip_duration", entry.RoundTripDuration),
+		slog.Duration("decode_duration", entry.DecodeDuration),
+		slog.Int("status", entry.StatusCode),
+		slog.Int64("request_size", entry.RequestSize),
+		slog.Int64("response_size", entry.ResponseSize),
+	}
+
+	level := slog.LevelInfo
+	if entry.FaultCode != "" {
+		level = slog.LevelWarn
+		attrs = append(attrs, slog.String("fault_code", entry.FaultCode))
+	}
+	if entry.Err != nil {
+		level = slog.LevelError
+		attrs = append(attrs, slog.String("error", entry.Err.Error()))
+	}
+
+	l.logger.LogAttrs(ctx, level, "soap request finished", attrs...)
+}
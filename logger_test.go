@@ -0,0 +1,155 @@
+package soap
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingLogger struct {
+	mu       sync.Mutex
+	started  []LogEntry
+	finished []LogEntry
+}
+
+func (l *recordingLogger) RequestStarted(ctx context.Context, entry *LogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.started = append(l.started, *entry)
+}
+
+func (l *recordingLogger) RequestFinished(ctx context.Context, entry *LogEntry) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.finished = append(l.finished, *entry)
+}
+
+const loggerTestFault = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Fault xmlns="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>soap:Client</faultcode><faultstring>bad</faultstring></Fault></Body></Envelope>`
+
+type loggerTest struct {
+	name        string
+	status      int
+	contentType string
+	response    string
+	stream      bool
+	requestSize int64
+	faultCode   string
+	err         bool
+}
+
+var loggerTests = []loggerTest{
+	{
+		name:        "success",
+		status:      http.StatusOK,
+		contentType: "text/xml",
+		response:    requestTestResponse,
+		requestSize: 180,
+	},
+	{
+		name:        "streamed",
+		status:      http.StatusOK,
+		contentType: "text/xml",
+		response:    requestTestResponse,
+		stream:      true,
+		requestSize: -1,
+	},
+	{
+		name:        "fault",
+		status:      http.StatusInternalServerError,
+		contentType: "text/xml",
+		response:    loggerTestFault,
+		requestSize: 180,
+		faultCode:   "soap:Client",
+	},
+	{
+		name:        "error",
+		status:      http.StatusOK,
+		contentType: "application/json",
+		response:    "{}",
+		requestSize: 180,
+		err:         true,
+	},
+}
+
+func TestClientLogger(t *testing.T) {
+	for _, tt := range loggerTests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			logger := &recordingLogger{}
+			client := NewClient(server.Client(), WithLogger(logger))
+
+			req := NewRequest("action", server.URL, &headerExample{Attr1: 1, Value: "value"}, &envelopeContentExample{}, nil)
+			req.StreamBody(tt.stream)
+			_, err := client.Do(context.Background(), req)
+			assert.Equal(t, tt.err, err != nil)
+
+			if !assert.Len(t, logger.started, 1) || !assert.Len(t, logger.finished, 1) {
+				return
+			}
+			assert.Equal(t, LogEntry{Action: "action", Operation: "action", URL: server.URL}, logger.started[0])
+
+			entry := logger.finished[0]
+			assert.Equal(t, "action", entry.Action)
+			assert.Equal(t, server.URL, entry.URL)
+			assert.True(t, entry.Duration > 0)
+			assert.Equal(t, tt.status, entry.StatusCode)
+			assert.Equal(t, tt.faultCode, entry.FaultCode)
+			assert.Equal(t, tt.requestSize, entry.RequestSize)
+			assert.Equal(t, err, entry.Err)
+			if !tt.err {
+				assert.Equal(t, int64(len(tt.response)), entry.ResponseSize)
+			}
+		})
+	}
+}
+
+func TestClientOperationNamer(t *testing.T) {
+	var tests = []struct {
+		name    string
+		options []ClientOption
+		want    string
+	}{
+		{name: "action", want: "urn:tenants/42/GetQuote"},
+		{
+			name: "namer",
+			options: []ClientOption{WithOperationNamer(func(action string, body interface{}) string {
+				return action[strings.LastIndex(action, "/")+1:]
+			})},
+			want: "GetQuote",
+		},
+		{name: "body element", options: []ClientOption{WithOperationNamer(OperationByBodyElement)}, want: "HeaderExample"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(requestTestResponse))
+			}))
+			defer server.Close()
+
+			logger := &recordingLogger{}
+			client := NewClient(server.Client(), append(tt.options, WithLogger(logger))...)
+
+			req := NewRequest("urn:tenants/42/GetQuote", server.URL, &headerExample{Attr1: 1, Value: "value"}, &envelopeContentExample{}, nil)
+			_, err := client.Do(context.Background(), req)
+			assert.Nil(t, err)
+
+			if assert.Len(t, logger.started, 1) && assert.Len(t, logger.finished, 1) {
+				assert.Equal(t, tt.want, logger.started[0].Operation)
+				assert.Equal(t, tt.want, logger.finished[0].Operation)
+			}
+		})
+	}
+}
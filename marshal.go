@@ -0,0 +1,164 @@
+package soap
+
+import (
+	"encoding/xml"
+	"reflect"
+
+	"github.com/beevik/etree"
+)
+
+// MarshalContext describes the namespace prefixes declared on the envelope of a request (see
+// Request.DeclareNamespace), so that content with a custom marshaler can use them rather than declaring its
+// namespaces again on every element.
+type MarshalContext struct {
+	// prefixes maps namespaces to their declared prefix.
+	prefixes map[string]string
+}
+
+// ContextMarshaler is implemented by request content which marshals itself using the namespace prefixes in scope.
+// It is used in place of xml.Marshaler for the body of a request and its header entries; nested values can be
+// passed the context with MarshalContext.EncodeElement.
+type ContextMarshaler interface {
+	MarshalXMLContext(e *xml.Encoder, start xml.StartElement, ctx *MarshalContext) error
+}
+
+// Prefix returns the prefix declared for the namespace, and whether one was declared.
+func (c *MarshalContext) Prefix(namespace string) (string, bool) {
+	prefix, ok := c.prefixes[namespace]
+	return prefix, ok
+}
+
+// Name returns the name of an element or attribute in the namespace. If a prefix is declared for the namespace, the
+// name is written with that prefix; otherwise the namespace is declared by the encoder as usual.
+func (c *MarshalContext) Name(namespace string, local string) xml.Name {
+	if prefix, ok := c.Prefix(namespace); ok {
+		// The encoder writes local names as-is, so the prefix is added to the local name.
+		return xml.Name{Local: prefix + ":" + local}
+	}
+	return xml.Name{Space: namespace, Local: local}
+}
+
+// EncodeElement encodes v using start, passing the context on if v implements ContextMarshaler.
+func (c *MarshalContext) EncodeElement(e *xml.Encoder, v interface{}, start xml.StartElement) error {
+	if m, ok := v.(ContextMarshaler); ok {
+		return m.MarshalXMLContext(e, start, c)
+	}
+	return e.EncodeElement(v, start)
+}
+
+// namespaceDecl is a namespace prefix declared on the envelope.
+type namespaceDecl struct {
+	prefix    string
+	namespace string
+}
+
+// newMarshalContext creates the context for content marshalled within an envelope declaring decls.
+func newMarshalContext(decls []namespaceDecl) *MarshalContext {
+	c := &MarshalContext{prefixes: make(map[string]string, len(decls))}
+	for _, decl := range decls {
+		c.prefixes[decl.namespace] = decl.prefix
+	}
+	return c
+}
+
+// withContext returns v wrapped to be marshalled with the context if it implements ContextMarshaler,
+// and v itself otherwise.
+func withContext(v interface{}, ctx *MarshalContext) interface{} {
+	m, ok := v.(ContextMarshaler)
+	if !ok {
+		return v
+	}
+
+	// The encoder names the element after the type of the wrapper, so the name the value itself would be given is kept.
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return &contextMarshaler{m: m, name: t.Name(), ctx: ctx}
+}
+
+// contextMarshaler adapts a ContextMarshaler to xml.Marshaler.
+type contextMarshaler struct {
+	m    ContextMarshaler
+	name string
+	ctx  *MarshalContext
+}
+
+// MarshalXML implements the xml.Marshaler interface.
+func (c *contextMarshaler) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Name = xml.Name{Local: c.name}
+	return c.m.MarshalXMLContext(e, start, c.ctx)
+}
+
+// withPrefixes returns a transform rewriting the body content to use the prefixes of decls, followed by transform.
+// If declare is set, the prefixes used are declared on the content elements.
+func withPrefixes(decls []namespaceDecl, declare bool, transform func(doc *etree.Document)) func(doc *etree.Document) {
+	prefixes := newMarshalContext(decls).prefixes
+	return func(doc *etree.Document) {
+		if body := doc.FindElement("Envelope/Body"); body != nil {
+			for _, content := range body.ChildElements() {
+				used := applyPrefixes(content, prefixes)
+				if !declare {
+					continue
+				}
+				for _, decl := range decls {
+					if used[decl.prefix] {
+						content.CreateAttr("xmlns:"+decl.prefix, decl.namespace)
+					}
+				}
+			}
+		}
+		if transform != nil {
+			transform(doc)
+		}
+	}
+}
+
+// applyPrefixes rewrites the element and its children to use the prefixes of the namespaces, removing the
+// declarations of those namespaces, and returns the prefixes used. The namespaces are resolved before any declaration
+// is removed.
+func applyPrefixes(elem *etree.Element, prefixes map[string]string) map[string]bool {
+	type rename struct {
+		space *string
+		to    string
+	}
+
+	var renames []rename
+	var elems []*etree.Element
+	var visit func(e *etree.Element)
+	visit = func(e *etree.Element) {
+		elems = append(elems, e)
+		if prefix, ok := prefixes[elementNamespace(e)]; ok {
+			renames = append(renames, rename{space: &e.Space, to: prefix})
+		}
+		for i, attr := range e.Attr {
+			if attr.Space == "" || attr.Space == "xmlns" {
+				continue
+			}
+			if prefix, ok := prefixes[resolvePrefix(e, attr.Space)]; ok {
+				renames = append(renames, rename{space: &e.Attr[i].Space, to: prefix})
+			}
+		}
+		for _, child := range e.ChildElements() {
+			visit(child)
+		}
+	}
+	visit(elem)
+
+	used := map[string]bool{}
+	for _, r := range renames {
+		*r.space = r.to
+		used[r.to] = true
+	}
+	for _, e := range elems {
+		attrs := e.Attr[:0]
+		for _, attr := range e.Attr {
+			if _, ok := prefixes[attr.Value]; ok && (attr.Space == "xmlns" || attr.Space == "" && attr.Key == "xmlns") {
+				continue
+			}
+			attrs = append(attrs, attr)
+		}
+		e.Attr = attrs
+	}
+	return used
+}
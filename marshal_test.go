@@ -0,0 +1,156 @@
+package soap
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const marshalTestNS = "urn:orders"
+
+type marshalTestOrder struct {
+	ID    string
+	Items []marshalTestItem
+}
+
+func (o *marshalTestOrder) MarshalXMLContext(e *xml.Encoder, start xml.StartElement, ctx *MarshalContext) error {
+	start.Name = ctx.Name(marshalTestNS, start.Name.Local)
+	start.Attr = []xml.Attr{{Name: ctx.Name(marshalTestNS, "id"), Value: o.ID}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, item := range o.Items {
+		if err := ctx.EncodeElement(e, item, xml.StartElement{Name: xml.Name{Local: "Item"}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+type marshalTestItem string
+
+func (i marshalTestItem) MarshalXMLContext(e *xml.Encoder, start xml.StartElement, ctx *MarshalContext) error {
+	start.Name = ctx.Name(marshalTestNS, start.Name.Local)
+	return e.EncodeElement(string(i), start)
+}
+
+type marshalTestTrace struct {
+	ID string
+}
+
+func (h marshalTestTrace) MarshalXMLContext(e *xml.Encoder, start xml.StartElement, ctx *MarshalContext) error {
+	prefix, _ := ctx.Prefix(marshalTestNS)
+	return e.EncodeElement(h.ID+"@"+prefix, xml.StartElement{Name: ctx.Name(marshalTestNS, "Trace")})
+}
+
+func TestMarshalContext(t *testing.T) {
+	var tests = []struct {
+		name     string
+		declare  bool
+		envelope string
+	}{
+		{
+			name:     "declared",
+			declare:  true,
+			envelope: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:o="urn:orders"><Header xmlns="http://schemas.xmlsoap.org/soap/envelope/"><o:Trace>abc@o</o:Trace></Header><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><o:marshalTestOrder o:id="10"><o:Item>first</o:Item><o:Item>second</o:Item></o:marshalTestOrder></Body></Envelope>`,
+		},
+		{
+			name:     "undeclared",
+			envelope: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Header xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Trace xmlns="urn:orders">abc@</Trace></Header><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><marshalTestOrder xmlns="urn:orders" xmlns:_="urn:orders" _:id="10"><Item xmlns="urn:orders">first</Item><Item xmlns="urn:orders">second</Item></marshalTestOrder></Body></Envelope>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &marshalTestOrder{ID: "10", Items: []marshalTestItem{"first", "second"}}
+			req := NewRequest("action", "http://localhost", order, nil, nil)
+			req.AddHeader(marshalTestTrace{ID: "abc"})
+			if tt.declare {
+				req.DeclareNamespace("o", "urn:replaced")
+				req.DeclareNamespace("o", marshalTestNS)
+				req = req.Clone(order, nil, nil)
+			}
+
+			r, err := req.serialize(serializeOptions{})
+			assert.Nil(t, err)
+			data, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.envelope, string(data))
+		})
+	}
+}
+
+func TestEnvelopeDecodeIgnoresNamespaces(t *testing.T) {
+	envelope := NewEnvelope(&envelopeContentExample{})
+	err := xml.Unmarshal([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:o="urn:orders"><Body><ContentExample attr1="10"></ContentExample></Body></Envelope>`), envelope)
+	assert.Nil(t, err)
+	assert.Nil(t, envelope.Namespaces)
+}
+
+type marshalTestQuote struct {
+	XMLName  xml.Name `xml:"urn:quotes GetQuote"`
+	Currency string   `xml:"urn:money currency,attr"`
+	Symbol   string   `xml:"urn:quotes Symbol"`
+	Exchange string   `xml:"urn:exchanges Exchange"`
+}
+
+func TestRequestPrefixBody(t *testing.T) {
+	var tests = []struct {
+		name     string
+		prefix   bool
+		body     interface{}
+		envelope string
+	}{
+		{
+			name:     "disabled",
+			body:     &marshalTestQuote{Currency: "USD", Symbol: "TN", Exchange: "NYSE"},
+			envelope: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:q="urn:quotes" xmlns:m="urn:money"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><GetQuote xmlns="urn:quotes" xmlns:_="urn:money" _:currency="USD"><Symbol xmlns="urn:quotes">TN</Symbol><Exchange xmlns="urn:exchanges">NYSE</Exchange></GetQuote></Body></Envelope>`,
+		},
+		{
+			name:     "enabled",
+			prefix:   true,
+			body:     &marshalTestQuote{Currency: "USD", Symbol: "TN", Exchange: "NYSE"},
+			envelope: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:q="urn:quotes" xmlns:m="urn:money"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><q:GetQuote m:currency="USD"><q:Symbol>TN</q:Symbol><Exchange xmlns="urn:exchanges">NYSE</Exchange></q:GetQuote></Body></Envelope>`,
+		},
+		{
+			name:     "raw XML",
+			prefix:   true,
+			body:     RawXML(`<a:GetQuote xmlns:a="urn:quotes"><Symbol xmlns="urn:quotes">TN</Symbol></a:GetQuote>`),
+			envelope: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:q="urn:quotes" xmlns:m="urn:money"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><q:GetQuote><q:Symbol>TN</q:Symbol></q:GetQuote></Body></Envelope>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest("action", "http://localhost", tt.body, nil, nil)
+			req.DeclareNamespace("q", "urn:quotes")
+			req.DeclareNamespace("m", "urn:money")
+			req.PrefixBody(tt.prefix)
+
+			r, err := req.serialize(serializeOptions{})
+			assert.Nil(t, err)
+			data, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.envelope, string(data))
+		})
+	}
+}
+
+func TestRequestPrefixBodySigned(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	req := NewRequest("action", "http://localhost", &marshalTestQuote{Currency: "USD", Symbol: "TN"}, nil, nil)
+	req.DeclareNamespace("q", "urn:quotes")
+	req.DeclareNamespace("m", "urn:money")
+	req.PrefixBody(true)
+	req.SignWith(wsseInfo)
+
+	r, err := req.serialize(serializeOptions{})
+	assert.Nil(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `<q:GetQuote m:currency="USD" xmlns:q="urn:quotes" xmlns:m="urn:money"><q:Symbol>TN</q:Symbol><ns1:Exchange xmlns:ns1="urn:exchanges"></ns1:Exchange></q:GetQuote>`)
+}
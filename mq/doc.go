@@ -0,0 +1,19 @@
+/*
+Package mq carries SOAP envelopes over message brokers, for services which only accept SOAP over queues such as AMQP.
+
+The Transport is an http.RoundTripper, so it plugs into the soap package's client like any other transport. Each
+request is published to the queue named by the request URL, with a fresh correlation ID and the reply queue of the
+transport, and the call completes when the reply with the same correlation ID is delivered:
+
+	transport := mq.NewTransport(broker, "billing.replies")
+	defer transport.Close()
+
+	client := soap.NewClient(&http.Client{Transport: transport})
+	soapReq := soap.NewRequest("GetInvoice", "amqp://esb/billing.requests", &GetInvoice{ID: 10}, &GetInvoiceResponse{}, nil)
+	soapResp, err := client.Do(ctx, soapReq)
+
+The Broker interface adapts a particular broker client to the transport. Message maps onto the standard properties
+of most brokers: for AMQP, CorrelationID, ReplyTo and ContentType are the message properties of the same names, and
+Headers are the message headers. MemoryBroker is an in-process reference implementation.
+*/
+package mq
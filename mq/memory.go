@@ -0,0 +1,78 @@
+package mq
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryBroker is a Broker which passes messages between queues held in memory.
+// It is the reference implementation of Broker, and is useful for testing code using the Transport without a broker.
+// Each queue delivers its messages to a single consumer at a time; messages published with no consumer are held
+// until one starts, up to the capacity of the queue.
+type MemoryBroker struct {
+	size int
+
+	mu     sync.Mutex
+	queues map[string]chan *Message
+}
+
+// NewMemoryBroker creates a broker whose queues each hold up to size undelivered messages.
+// Publishing to a full queue waits for a message to be consumed.
+func NewMemoryBroker(size int) *MemoryBroker {
+	return &MemoryBroker{
+		size:   size,
+		queues: make(map[string]chan *Message),
+	}
+}
+
+// Publish sends msg to the named queue, waiting for room in the queue until ctx is done.
+func (b *MemoryBroker) Publish(ctx context.Context, queue string, msg *Message) error {
+	select {
+	case b.queue(queue) <- msg:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Consume delivers the messages sent to the named queue until ctx is done.
+func (b *MemoryBroker) Consume(ctx context.Context, queue string) (<-chan *Message, error) {
+	messages := b.queue(queue)
+	delivery := make(chan *Message)
+
+	go func() {
+		defer close(delivery)
+		for {
+			select {
+			case msg := <-messages:
+				select {
+				case delivery <- msg:
+				case <-ctx.Done():
+					// Return the message to the queue for the next consumer, unless it has since filled up.
+					select {
+					case messages <- msg:
+					default:
+					}
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return delivery, nil
+}
+
+// queue returns the named queue, creating it if needed.
+func (b *MemoryBroker) queue(name string) chan *Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		q = make(chan *Message, b.size)
+		b.queues[name] = q
+	}
+	return q
+}
@@ -0,0 +1,255 @@
+package mq
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+var (
+	// ErrNoQueue is returned if the request URL doesn't name a queue.
+	ErrNoQueue = errors.New("mq: request URL does not name a queue")
+	// ErrTransportClosed is returned for requests made after the transport is closed, or which were waiting
+	// for a reply when it was closed or the reply queue stopped delivering messages.
+	ErrTransportClosed = errors.New("mq: transport closed")
+)
+
+// Message is a SOAP envelope carried by a message broker, along with the properties used to route its reply.
+type Message struct {
+	// CorrelationID identifies the request a reply is for. Replies must carry the ID of their request.
+	CorrelationID string
+	// ReplyTo is the name of the queue replies to a request are published to.
+	ReplyTo string
+	// ContentType is the media type of the body, as it would be sent in the HTTP Content-Type header.
+	ContentType string
+	// Headers holds any other headers of the message, such as the SOAPAction of requests.
+	Headers map[string]string
+	// Body is the serialized SOAP envelope.
+	Body []byte
+}
+
+// Broker adapts a message broker client for use by a Transport.
+// Implementations must be safe for concurrent use.
+type Broker interface {
+	// Publish sends msg to the named queue.
+	Publish(ctx context.Context, queue string, msg *Message) error
+	// Consume starts delivering the messages sent to the named queue on the returned channel.
+	// Delivery stops, and the channel is closed, once ctx is done.
+	Consume(ctx context.Context, queue string) (<-chan *Message, error)
+}
+
+// Transport is an http.RoundTripper which carries requests over a message broker.
+// The destination queue of a request is the path of its URL without the leading slash (i.e. amqp://esb/orders),
+// or the opaque part of the URL (i.e. mq:orders). Replies are consumed from a single queue per transport, and are
+// matched to their requests by correlation ID; replies matching no pending request are dropped.
+// All methods are safe for concurrent use.
+type Transport struct {
+	broker  Broker
+	replyTo string
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	once       sync.Once
+	consumeErr error
+
+	mu      sync.Mutex
+	closed  bool
+	pending map[string]chan *Message
+}
+
+// NewTransport creates a transport publishing requests through broker, and consuming their replies from the
+// replyTo queue. The caller should call Close when finished to stop consuming replies.
+func NewTransport(broker Broker, replyTo string) *Transport {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Transport{
+		broker:  broker,
+		replyTo: replyTo,
+		ctx:     ctx,
+		cancel:  cancel,
+		pending: make(map[string]chan *Message),
+	}
+}
+
+// RoundTrip publishes the request, then waits for its reply or for the context of the request to be done.
+// The Content-Type header of the request is sent as the content type of the message, and its other headers as
+// message headers. The response carries the content type and headers of the reply with a 200 OK status, as
+// faults are distinguished by the envelope.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	queue := queueName(req.URL)
+	if queue == "" {
+		closeBody(req)
+		return nil, ErrNoQueue
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := t.startConsuming(); err != nil {
+		return nil, err
+	}
+
+	id, err := newCorrelationID()
+	if err != nil {
+		return nil, err
+	}
+	replies, err := t.register(id)
+	if err != nil {
+		return nil, err
+	}
+	defer t.unregister(id)
+
+	msg := &Message{
+		CorrelationID: id,
+		ReplyTo:       t.replyTo,
+		ContentType:   req.Header.Get("Content-Type"),
+		Headers:       make(map[string]string, len(req.Header)),
+		Body:          body,
+	}
+	for key := range req.Header {
+		if key != "Content-Type" {
+			msg.Headers[key] = req.Header.Get(key)
+		}
+	}
+
+	ctx := req.Context()
+	if err := t.broker.Publish(ctx, queue, msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply, ok := <-replies:
+		if !ok {
+			return nil, ErrTransportClosed
+		}
+		return newResponse(req, reply), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops consuming replies. Requests waiting for a reply fail with ErrTransportClosed.
+func (t *Transport) Close() error {
+	t.cancel()
+	t.closePending()
+	return nil
+}
+
+// startConsuming starts consuming from the reply queue the first time it is called.
+func (t *Transport) startConsuming() error {
+	t.once.Do(func() {
+		var replies <-chan *Message
+		replies, t.consumeErr = t.broker.Consume(t.ctx, t.replyTo)
+		if t.consumeErr == nil {
+			go t.dispatch(replies)
+		}
+	})
+	return t.consumeErr
+}
+
+// dispatch passes each reply to the request waiting for it, until the reply queue stops delivering messages.
+func (t *Transport) dispatch(replies <-chan *Message) {
+	for reply := range replies {
+		t.mu.Lock()
+		if ch, ok := t.pending[reply.CorrelationID]; ok {
+			ch <- reply
+			delete(t.pending, reply.CorrelationID)
+		}
+		t.mu.Unlock()
+	}
+	t.closePending()
+}
+
+// register adds a pending request with the correlation ID, returning the channel its reply is delivered on.
+func (t *Transport) register(id string) (<-chan *Message, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil, ErrTransportClosed
+	}
+	// The channel is buffered so that dispatching a reply never waits for the request to receive it.
+	ch := make(chan *Message, 1)
+	t.pending[id] = ch
+	return ch, nil
+}
+
+// unregister removes the pending request with the correlation ID, if it is still waiting.
+func (t *Transport) unregister(id string) {
+	t.mu.Lock()
+	delete(t.pending, id)
+	t.mu.Unlock()
+}
+
+// closePending fails every pending request, and any made afterwards.
+func (t *Transport) closePending() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closed = true
+	for id, ch := range t.pending {
+		close(ch)
+		delete(t.pending, id)
+	}
+}
+
+// queueName returns the name of the queue the request URL refers to.
+func queueName(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return strings.TrimPrefix(u.Path, "/")
+}
+
+// newCorrelationID returns a random correlation ID.
+func newCorrelationID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newResponse creates the HTTP response for the reply to req.
+func newResponse(req *http.Request, reply *Message) *http.Response {
+	header := make(http.Header, len(reply.Headers)+1)
+	for key, value := range reply.Headers {
+		header.Set(key, value)
+	}
+	if reply.ContentType != "" {
+		header.Set("Content-Type", reply.ContentType)
+	}
+
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(reply.Body)),
+		ContentLength: int64(len(reply.Body)),
+		Request:       req,
+	}
+}
+
+// closeBody closes the body of a request which won't be sent, as required of a RoundTripper.
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
@@ -0,0 +1,165 @@
+package mq
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Enflick/gosoap"
+	"github.com/stretchr/testify/assert"
+)
+
+type quoteRequest struct {
+	XMLName xml.Name `xml:"http://example.com/quotes GetQuote"`
+	Symbol  string   `xml:"Symbol"`
+}
+
+type quoteResponse struct {
+	XMLName xml.Name `xml:"http://example.com/quotes GetQuoteResponse"`
+	Price   int32    `xml:"Price"`
+}
+
+// respond answers each request published to the queue with the reply built by reply, until ctx is done.
+func respond(ctx context.Context, broker Broker, queue string, reply func(req *Message) *Message) {
+	requests, err := broker.Consume(ctx, queue)
+	if err != nil {
+		return
+	}
+	go func() {
+		for req := range requests {
+			if resp := reply(req); resp != nil {
+				resp.CorrelationID = req.CorrelationID
+				broker.Publish(ctx, req.ReplyTo, resp)
+			}
+		}
+	}()
+}
+
+func TestTransport(t *testing.T) {
+	var tests = []struct {
+		name  string
+		url   string
+		price int32
+	}{
+		{name: "path", url: "amqp://esb/quotes.requests", price: 12},
+		{name: "opaque", url: "mq:quotes.requests", price: 12},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			broker := NewMemoryBroker(4)
+			received := make(chan *Message, 1)
+			respond(ctx, broker, "quotes.requests", func(req *Message) *Message {
+				received <- req
+				body, _ := xml.Marshal(soap.NewEnvelope(&quoteResponse{Price: tt.price}))
+				return &Message{ContentType: "text/xml; charset=utf-8", Body: body}
+			})
+
+			transport := NewTransport(broker, "quotes.replies")
+			defer transport.Close()
+
+			resp := &quoteResponse{}
+			client := soap.NewClient(&http.Client{Transport: transport})
+			soapResp, err := client.Do(ctx, soap.NewRequest("GetQuote", tt.url, &quoteRequest{Symbol: "TN"}, resp, nil))
+			assert.Nil(t, err)
+			if assert.NotNil(t, soapResp) {
+				assert.Equal(t, http.StatusOK, soapResp.StatusCode)
+				assert.Equal(t, "text/xml; charset=utf-8", soapResp.Header.Get("Content-Type"))
+			}
+			assert.Equal(t, tt.price, resp.Price)
+
+			req := <-received
+			assert.NotEmpty(t, req.CorrelationID)
+			assert.Equal(t, "quotes.replies", req.ReplyTo)
+			assert.Equal(t, `text/xml; charset="utf-8"`, req.ContentType)
+			assert.Equal(t, "GetQuote", req.Headers["Soapaction"])
+			assert.Contains(t, string(req.Body), "<Symbol>TN</Symbol>")
+		})
+	}
+}
+
+func TestTransportCorrelation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := NewMemoryBroker(8)
+	// Both requests are held back, then answered in reverse order after a reply to an unknown request.
+	var held []*Message
+	respond(ctx, broker, "quotes.requests", func(req *Message) *Message {
+		held = append(held, req)
+		if len(held) < 2 {
+			return nil
+		}
+
+		broker.Publish(ctx, "quotes.replies", &Message{CorrelationID: "unknown"})
+		for i := len(held) - 1; i >= 0; i-- {
+			quote := &quoteRequest{}
+			xml.Unmarshal(held[i].Body, soap.NewEnvelope(quote))
+			body, _ := xml.Marshal(soap.NewEnvelope(&quoteResponse{Price: int32(len(quote.Symbol))}))
+			broker.Publish(ctx, held[i].ReplyTo, &Message{CorrelationID: held[i].CorrelationID, ContentType: "text/xml", Body: body})
+		}
+		return nil
+	})
+
+	transport := NewTransport(broker, "quotes.replies")
+	defer transport.Close()
+	client := soap.NewClient(&http.Client{Transport: transport})
+
+	symbols := []string{"A", "BBBB"}
+	prices := make(chan [2]int32, len(symbols))
+	for _, symbol := range symbols {
+		go func(symbol string) {
+			resp := &quoteResponse{}
+			_, err := client.Do(ctx, soap.NewRequest("GetQuote", "mq:quotes.requests", &quoteRequest{Symbol: symbol}, resp, nil))
+			assert.Nil(t, err)
+			prices <- [2]int32{int32(len(symbol)), resp.Price}
+		}(symbol)
+	}
+	for range symbols {
+		price := <-prices
+		assert.Equal(t, price[0], price[1])
+	}
+}
+
+func TestTransportErrors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		url     string
+		timeout time.Duration
+		close   bool
+		err     error
+	}{
+		{name: "no queue", url: "amqp://esb/", err: ErrNoQueue},
+		{name: "no reply", url: "mq:quotes.requests", timeout: 50 * time.Millisecond, err: context.DeadlineExceeded},
+		{name: "closed", url: "mq:quotes.requests", close: true, err: ErrTransportClosed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+
+			transport := NewTransport(NewMemoryBroker(4), "quotes.replies")
+			if tt.close {
+				transport.Close()
+			} else {
+				defer transport.Close()
+			}
+
+			client := soap.NewClient(&http.Client{Transport: transport})
+			_, err := client.Do(ctx, soap.NewRequest("GetQuote", tt.url, &quoteRequest{Symbol: "TN"}, &quoteResponse{}, nil))
+			if assert.NotNil(t, err) {
+				assert.Contains(t, err.Error(), tt.err.Error())
+			}
+		})
+	}
+}
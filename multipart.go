@@ -0,0 +1,283 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Implements the normalization of malformed multipart bodies.
+
+// multipartNormalizer is a reader which repairs the framing of a multipart body, so that bodies mangled by proxies
+// or produced by misbehaving stacks can be read by multipart.Reader:
+//   - anything before the first boundary delimiter is dropped, even if it is on the same line;
+//   - the boundary delimiter lines and part headers end with CRLF, whether they used CRLF or a bare LF;
+//   - the line ending before each boundary delimiter, which belongs to the delimiter, is CRLF.
+//
+// The content of the parts is otherwise passed through unchanged, so binary content is unaffected.
+type multipartNormalizer struct {
+	r            *bufio.Reader
+	dashBoundary []byte
+
+	state multipartState
+	// pending is the last line of part content read, held back until it is known whether a delimiter follows it.
+	pending []byte
+	// midLine is set if the content read last didn't end a line, as a delimiter can only start at a line.
+	midLine bool
+
+	out bytes.Buffer
+	err error
+}
+
+type multipartState int
+
+const (
+	multipartPreamble multipartState = iota
+	multipartHeaders
+	multipartContent
+	multipartEpilogue
+)
+
+func newMultipartNormalizer(r io.Reader, boundary string) *multipartNormalizer {
+	return &multipartNormalizer{
+		r:            bufio.NewReader(r),
+		dashBoundary: []byte("--" + boundary),
+	}
+}
+
+// Read satisfies the io.Reader interface.
+func (n *multipartNormalizer) Read(p []byte) (int, error) {
+	for n.out.Len() == 0 && n.err == nil {
+		n.readLine()
+	}
+	if n.out.Len() > 0 {
+		return n.out.Read(p)
+	}
+	return 0, n.err
+}
+
+// readLine reads the next line, or part of a line too long to buffer, writing what is known to be output to out.
+func (n *multipartNormalizer) readLine() {
+	line, err := n.r.ReadSlice('\n')
+	partial := err == bufio.ErrBufferFull
+	if err != nil && !partial {
+		defer func() {
+			n.out.Write(n.pending)
+			n.pending = nil
+			n.err = err
+		}()
+	}
+	if len(line) == 0 {
+		return
+	}
+
+	switch n.state {
+	case multipartPreamble:
+		if i := bytes.Index(line, n.dashBoundary); i >= 0 {
+			n.writeDelimiter(line[i:])
+		}
+	case multipartHeaders:
+		n.out.Write(bytes.TrimRight(line, "\r\n"))
+		if !partial {
+			n.out.WriteString("\r\n")
+			if len(bytes.TrimRight(line, "\r\n")) == 0 {
+				n.state = multipartContent
+			}
+		}
+	case multipartContent:
+		if !n.midLine && n.isDelimiter(line) {
+			// The line ending of the content before the delimiter is part of the delimiter.
+			n.out.Write(bytes.TrimSuffix(bytes.TrimSuffix(n.pending, []byte("\n")), []byte("\r")))
+			n.out.WriteString("\r\n")
+			n.pending = nil
+			n.writeDelimiter(line)
+			break
+		}
+		n.out.Write(n.pending)
+		n.pending = append(n.pending[:0], line...)
+	default:
+		n.out.Write(line)
+	}
+	n.midLine = partial
+}
+
+// isDelimiter checks whether the line is a boundary delimiter line, allowing for trailing whitespace.
+func (n *multipartNormalizer) isDelimiter(line []byte) bool {
+	if !bytes.HasPrefix(line, n.dashBoundary) {
+		return false
+	}
+	rest := bytes.TrimRight(line[len(n.dashBoundary):], " \t\r\n")
+	return len(rest) == 0 || bytes.Equal(rest, []byte("--"))
+}
+
+// writeDelimiter writes the delimiter line with a CRLF line ending, moving on to the headers of the next part, or to
+// the epilogue after the close delimiter.
+func (n *multipartNormalizer) writeDelimiter(line []byte) {
+	delimiter := bytes.TrimRight(line, " \t\r\n")
+	n.out.Write(delimiter)
+	n.out.WriteString("\r\n")
+
+	if bytes.HasSuffix(delimiter, []byte("--")) && len(delimiter) > len(n.dashBoundary) {
+		n.state = multipartEpilogue
+	} else {
+		n.state = multipartHeaders
+	}
+}
+
+// boundaryPeekSize is how much of a multipart body is searched for the delimiter of its boundary, as sent.
+const boundaryPeekSize = 4 << 10
+
+// multipartBoundary returns the boundary of the multipart body read from r, given the boundary parameter of its
+// content type. Some proxies rewrite the parameter in ways mime.ParseMediaType preserves, such as with trailing
+// whitespace, or quotes within the value, which then doesn't match the delimiters in the body. Both of these are
+// legal in a boundary, so the parameter is only normalized, by removing trailing whitespace and quotes around the
+// boundary, if the delimiter of the parameter as it is can't be found at the start of the body.
+func multipartBoundary(r *bufio.Reader, boundary string) string {
+	normalized := strings.TrimRight(boundary, " \t")
+	for len(normalized) >= 2 {
+		first, last := normalized[0], normalized[len(normalized)-1]
+		if first != last || first != '"' && first != '\'' {
+			break
+		}
+		normalized = strings.TrimRight(normalized[1:len(normalized)-1], " \t")
+	}
+	if normalized == boundary {
+		return boundary
+	}
+
+	start, _ := r.Peek(boundaryPeekSize)
+	if bytes.Contains(start, []byte("--"+boundary)) {
+		return boundary
+	}
+	return normalized
+}
+
+// multipartBuffering is how the body of multipart responses is buffered as it is read; see WithMultipartBuffering.
+type multipartBuffering struct {
+	size      int
+	readAhead int
+}
+
+// defaultMultipartBufferSize is the size of the buffer multipart bodies are read into by default, that of bufio.
+const defaultMultipartBufferSize = 4 << 10
+
+// bufferSize returns the size of the buffers the body is read into.
+func (b multipartBuffering) bufferSize() int {
+	if b.size <= 0 {
+		return defaultMultipartBufferSize
+	}
+	return b.size
+}
+
+// maxPartPreallocation is the largest buffer allocated for the content of a part ahead of reading it, from its
+// Content-Length header, so that a part declaring a huge length can't make the client allocate it up front.
+const maxPartPreallocation = 64 << 20
+
+// readPart reads the content of a part with the header. If it has a Content-Length, the content is read into a buffer
+// of that size, rather than into one grown, and copied, as the content is read.
+func readPart(part io.Reader, header textproto.MIMEHeader) ([]byte, error) {
+	size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if err != nil || size <= 0 {
+		return ioutil.ReadAll(part)
+	}
+	if size > maxPartPreallocation {
+		size = maxPartPreallocation
+	}
+
+	// The buffer has room for bytes.MinRead more, so that it isn't grown to find out that the content has ended.
+	buf := bytes.NewBuffer(make([]byte, 0, int(size)+bytes.MinRead))
+	_, err = buf.ReadFrom(part)
+	return buf.Bytes(), err
+}
+
+// readAheadReader is a reader reading ahead of its reader from a goroutine, into a fixed number of buffers, so that
+// reading from a connection overlaps with processing what has been read.
+type readAheadReader struct {
+	chunks chan readAheadChunk
+	// free holds the buffers available to the goroutine.
+	free chan []byte
+	done chan struct{}
+	// finished is closed once the goroutine has returned.
+	finished chan struct{}
+
+	// buf is the buffer being read from, whose unread part is current.
+	buf     []byte
+	current []byte
+	err     error
+}
+
+// readAheadChunk is what a read into a buffer returned.
+type readAheadChunk struct {
+	data []byte
+	err  error
+}
+
+// newReadAheadReader returns a reader reading ahead from r into up to depth buffers of size bytes.
+func newReadAheadReader(r io.Reader, size int, depth int) *readAheadReader {
+	ra := &readAheadReader{
+		chunks:   make(chan readAheadChunk, depth),
+		free:     make(chan []byte, depth+1),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+	// One buffer more than the depth is allocated, as the one being read from isn't available to the goroutine.
+	for i := 0; i <= depth; i++ {
+		ra.free <- make([]byte, size)
+	}
+	go ra.fill(r)
+	return ra
+}
+
+// fill reads from r into the free buffers until it fails or the reader is closed.
+func (ra *readAheadReader) fill(r io.Reader) {
+	defer close(ra.finished)
+	for {
+		var buf []byte
+		select {
+		case buf = <-ra.free:
+		case <-ra.done:
+			return
+		}
+
+		n, err := r.Read(buf)
+		select {
+		case ra.chunks <- readAheadChunk{data: buf[:n], err: err}:
+		case <-ra.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read satisfies the io.Reader interface.
+func (ra *readAheadReader) Read(p []byte) (int, error) {
+	for len(ra.current) == 0 {
+		if ra.buf != nil {
+			ra.free <- ra.buf[:cap(ra.buf)]
+			ra.buf = nil
+		}
+		if ra.err != nil {
+			return 0, ra.err
+		}
+
+		chunk := <-ra.chunks
+		ra.buf, ra.current, ra.err = chunk.data, chunk.data, chunk.err
+	}
+
+	n := copy(p, ra.current)
+	ra.current = ra.current[n:]
+	return n, nil
+}
+
+// Close stops reading ahead, waiting for a read in progress to return, so that the reader can be read from again
+// once it has returned, i.e. to drain it.
+func (ra *readAheadReader) Close() {
+	close(ra.done)
+	<-ra.finished
+}
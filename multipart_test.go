@@ -0,0 +1,177 @@
+package soap
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultipartNormalizer(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+
+	var tests = []struct {
+		name  string
+		body  string
+		parts []string
+	}{
+		{name: "well formed", body: "--B\r\nContent-Id: a\r\n\r\nhello\r\n--B--\r\n", parts: []string{"hello"}},
+		{name: "bare LF", body: "--B\nContent-Id: a\n\nhello\n--B--\n", parts: []string{"hello"}},
+		{name: "bare LF delimiters", body: "--B\r\nContent-Id: a\r\n\r\nhello\n--B--\n", parts: []string{"hello"}},
+		{name: "bare LF first delimiter", body: "--B\nContent-Id: a\r\n\r\nhello\r\n--B--\r\n", parts: []string{"hello"}},
+		{name: "junk on delimiter line", body: "junk--B\r\nContent-Id: a\r\n\r\nhello\r\n--B--\r\n", parts: []string{"hello"}},
+		{name: "junk lines", body: "junk\nmore junk\r\n--B\nContent-Id: a\r\n\r\nhello\r\n--B--", parts: []string{"hello"}},
+		{name: "content line endings", body: "--B\nContent-Id: a\n\none\ntwo\r\n\nthree\n--B\nContent-Id: b\n\n" + long + "\n--B--\n", parts: []string{"one\ntwo\r\n\nthree", long}},
+		{name: "delimiter whitespace", body: "--B \nContent-Id: a\n\nhello\n--B-- \n", parts: []string{"hello"}},
+		{name: "epilogue", body: "--B\nContent-Id: a\n\nhello\n--B--\nepilogue\n", parts: []string{"hello"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := multipart.NewReader(newMultipartNormalizer(strings.NewReader(tt.body), "B"), "B")
+
+			var parts []string
+			for {
+				part, err := reader.NextPart()
+				if err != nil {
+					assert.Equal(t, "EOF", err.Error())
+					break
+				}
+				content, err := ioutil.ReadAll(part)
+				assert.Nil(t, err)
+				parts = append(parts, string(content))
+			}
+			assert.Equal(t, tt.parts, parts)
+		})
+	}
+}
+
+func TestMultipartResponseLenient(t *testing.T) {
+	body := "garbage from a proxy" + strings.Replace(testMultipartWithCSV, "\n", "\r\n", -1)
+	body = strings.Replace(body, "\r\n--uuid:d7287a84-8be6-4284-afeb-26ee43e46edd", "\n--uuid:d7287a84-8be6-4284-afeb-26ee43e46edd", -1)
+
+	_, mediaParams, err := mime.ParseMediaType(testMultipartWithCSVContentType)
+	assert.Nil(t, err)
+
+	testResp := &RunTimeSeriesReportResponse{}
+	decoder := newXopDecoder(strings.NewReader(body), mediaParams)
+	decoder.lenient = true
+	assert.Nil(t, decoder.decode(NewEnvelope(testResp)))
+	assert.Equal(t, int32(1), testResp.Report.NumberOfDataSets)
+	assert.Equal(t, "tn_prod-e03d921e-ed56-4d51-826d-c54f0288bfef,2019-08-19T10:20:59.000Z,332682498\r\n", string(testResp.Report.DataSets.DataSet[0].CsvAttachment.CsvData))
+}
+
+func TestMultipartBoundary(t *testing.T) {
+	var tests = []struct {
+		name        string
+		contentType string
+		delimiter   string
+		want        string
+	}{
+		{name: "plain", contentType: `multipart/related; boundary=B`, delimiter: "B", want: "B"},
+		{name: "uppercase parameter", contentType: `multipart/related; Boundary=B`, delimiter: "B", want: "B"},
+		{name: "trailing whitespace", contentType: `multipart/related; boundary="B  "`, delimiter: "B", want: "B"},
+		{name: "single quotes", contentType: `multipart/related; boundary="'B'"`, delimiter: "B", want: "B"},
+		{name: "escaped double quotes", contentType: `multipart/related; boundary="\"B \""`, delimiter: "B", want: "B"},
+		{name: "single quotes in body", contentType: `multipart/related; boundary="'B'"`, delimiter: "'B'", want: "'B'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, params, err := mime.ParseMediaType(tt.contentType)
+			assert.Nil(t, err)
+
+			body := bufio.NewReader(strings.NewReader("--" + tt.delimiter + "\r\nContent-Id: a\r\n\r\nhello\r\n--" + tt.delimiter + "--\r\n"))
+			boundary := multipartBoundary(body, params["boundary"])
+			assert.Equal(t, tt.want, boundary)
+
+			part, err := multipart.NewReader(body, boundary).NextPart()
+			if assert.Nil(t, err) {
+				content, err := ioutil.ReadAll(part)
+				assert.Nil(t, err)
+				assert.Equal(t, "hello", string(content))
+			}
+		})
+	}
+}
+
+func TestMultipartResponseBuffering(t *testing.T) {
+	var tests = []struct {
+		name      string
+		buffering multipartBuffering
+	}{
+		{name: "default"},
+		{name: "small buffers", buffering: multipartBuffering{size: 16}},
+		{name: "large buffers", buffering: multipartBuffering{size: 1 << 20}},
+		{name: "read ahead", buffering: multipartBuffering{size: 16, readAhead: 4}},
+		{name: "read ahead with default size", buffering: multipartBuffering{readAhead: 1}},
+	}
+
+	_, mediaParams, err := mime.ParseMediaType(testMultipartWithCSVContentType)
+	assert.Nil(t, err)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testResp := &RunTimeSeriesReportResponse{}
+			decoder := newXopDecoder(strings.NewReader(testMultipartWithCSV), mediaParams)
+			decoder.buffering = tt.buffering
+			assert.Nil(t, decoder.decode(NewEnvelope(testResp)))
+			assert.Equal(t, int32(1), testResp.Report.NumberOfDataSets)
+			assert.Equal(t, "tn_prod-e03d921e-ed56-4d51-826d-c54f0288bfef,2019-08-19T10:20:59.000Z,332682498\n", string(testResp.Report.DataSets.DataSet[0].CsvAttachment.CsvData))
+		})
+	}
+}
+
+func TestReadAheadReader(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+
+	reader := newReadAheadReader(strings.NewReader(content), 7, 3)
+	read, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, content, string(read))
+	reader.Close()
+
+	// Closing before the end leaves the rest to be read from the underlying reader.
+	underlying := strings.NewReader(content)
+	reader = newReadAheadReader(underlying, 10, 2)
+	first := make([]byte, 10)
+	_, err = io.ReadFull(reader, first)
+	assert.Nil(t, err)
+	assert.Equal(t, content[:10], string(first))
+	reader.Close()
+	rest, err := ioutil.ReadAll(underlying)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasSuffix(content, string(rest)))
+}
+
+func TestReadPart(t *testing.T) {
+	var tests = []struct {
+		name          string
+		contentLength string
+		content       string
+	}{
+		{name: "no content length", content: "hello"},
+		{name: "exact content length", contentLength: "5", content: "hello"},
+		{name: "short content length", contentLength: "2", content: "hello"},
+		{name: "long content length", contentLength: "1000", content: "hello"},
+		{name: "invalid content length", contentLength: "five", content: "hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := textproto.MIMEHeader{}
+			if tt.contentLength != "" {
+				header.Set("Content-Length", tt.contentLength)
+			}
+			content, err := readPart(strings.NewReader(tt.content), header)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.content, string(content))
+		})
+	}
+}
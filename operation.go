@@ -0,0 +1,89 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// Implements the registry of the operations of a Client, which are called by name.
+
+// ErrUnknownOperation is returned when calling an operation which isn't registered with the client.
+var ErrUnknownOperation = errors.New("unknown operation")
+
+// Operation describes an operation of a service, so that it can be called by name with Client.Call rather than
+// building a request with its action, URL and types at every call site.
+type Operation struct {
+	// Name is the name the operation is called by, which is also the Operation of the log entries of its requests.
+	Name string
+	// Action is the SOAP action of the operation. If empty, it is inferred from the body as by NewRequest, along with
+	// the path registered with it.
+	Action string
+	// Path is the path of the endpoint of the operation, appended to the URL the operation is registered with, if any.
+	Path string
+	// Request is a value of the type of the bodies of the operation's requests, if any. Calls with bodies of another
+	// type are rejected; bodies and pointers to them are of the same type.
+	Request interface{}
+	// Response is a pointer to a value of the type of the body of the operation's responses, such as
+	// &GetQuoteResponse{}, or nil if the operation has none. A new value of the type is decoded into for each call.
+	Response interface{}
+	// FaultDetail is a pointer to a value of the type of the detail of the operation's faults, or FaultDetails if it
+	// may be of several types. New values of the types are decoded into for each call.
+	FaultDetail interface{}
+}
+
+// clientOperation is an operation registered with a client, along with the URL of its service.
+type clientOperation struct {
+	Operation
+	url string
+}
+
+// WithOperations registers the operations of the service at url with the client, to be called by name with Call.
+// The option may be used once per service; an operation registered again replaces the previous registration.
+func WithOperations(url string, ops ...Operation) ClientOption {
+	return func(c *Client) {
+		if c.operations == nil {
+			c.operations = map[string]*clientOperation{}
+		}
+		for _, op := range ops {
+			c.operations[op.Name] = &clientOperation{Operation: op, url: url}
+		}
+	}
+}
+
+// OperationRequest builds a request for the operation registered with the client under name, with the body, for
+// calls needing headers, signing or other settings before being passed to Do. The response and fault detail are
+// decoded into new values of the types of the operation.
+func (c *Client) OperationRequest(name string, body interface{}) (*Request, error) {
+	op, ok := c.operations[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownOperation, name)
+	}
+	if op.Request != nil && bodyType(body) != bodyType(op.Request) {
+		return nil, fmt.Errorf("operation %s: request body must be a %s, not %s", name, bodyType(op.Request), reflect.TypeOf(body))
+	}
+
+	req := NewRequest(op.Action, joinPath(op.url, op.Path), body, newLike(op.Response), newLike(op.FaultDetail))
+	req.operation = name
+	return req, nil
+}
+
+// Call calls the operation registered with the client under name, with the body, and returns the response, whose
+// Body is a new value of the response type of the operation. A SOAP fault is returned as the error, as a *Fault,
+// along with the response, as by DoInto.
+func (c *Client) Call(ctx context.Context, name string, body interface{}) (*Response, error) {
+	req, err := c.OperationRequest(name, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Fault() != nil {
+		return resp, resp.Fault()
+	}
+	return resp, nil
+}
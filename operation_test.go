@@ -0,0 +1,100 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type operationTestBody struct {
+	Value string `xml:"Value"`
+}
+
+type operationTestDetail struct {
+	Code int `xml:"Code"`
+}
+
+func TestClientCall(t *testing.T) {
+	var gotPath, gotAction string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotAction = r.URL.Path, r.Header.Get("SOAPAction")
+		w.Header().Set("Content-Type", "text/xml")
+		if r.URL.Path == "/service/Fail.svc" {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><s:Fault><faultcode>s:Server</faultcode><faultstring>Failed</faultstring><detail><operationTestDetail><Code>42</Code></operationTestDetail></detail></s:Fault></s:Body></s:Envelope>`, soapEnvNS)
+			return
+		}
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><ContentExample attr1="7"></ContentExample></s:Body></s:Envelope>`, soapEnvNS)
+	}))
+	defer ts.Close()
+
+	logger := &recordingLogger{}
+	client := NewClient(nil, WithLogger(logger), WithOperations(ts.URL+"/service",
+		Operation{Name: "Get", Action: "urn:Get", Request: operationTestBody{}, Response: &envelopeContentExample{}},
+		Operation{Name: "Fail", Action: "urn:Fail", Path: "/Fail.svc", Response: &envelopeContentExample{}, FaultDetail: &operationTestDetail{}},
+	))
+
+	var tests = []struct {
+		name       string
+		operation  string
+		body       interface{}
+		wantPath   string
+		wantAction string
+		wantAttr   int32
+		wantCode   int
+		err        error
+	}{
+		{name: "response", operation: "Get", body: &operationTestBody{Value: "a"}, wantPath: "/service", wantAction: "urn:Get", wantAttr: 7},
+		{name: "fault", operation: "Fail", body: &operationTestBody{}, wantPath: "/service/Fail.svc", wantAction: "urn:Fail", wantCode: 42},
+		{name: "unknown operation", operation: "Put", body: &operationTestBody{}, err: ErrUnknownOperation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPath, gotAction = "", ""
+			resp, err := client.Call(context.Background(), tt.operation, tt.body)
+			assert.Equal(t, tt.wantPath, gotPath)
+			assert.Equal(t, tt.wantAction, gotAction)
+
+			switch {
+			case tt.err != nil:
+				assert.True(t, errors.Is(err, tt.err), "%v", err)
+			case tt.wantCode != 0:
+				var fault *Fault
+				if assert.True(t, errors.As(err, &fault), "%v", err) {
+					assert.Equal(t, &operationTestDetail{Code: tt.wantCode}, fault.Detail())
+				}
+			default:
+				if assert.Nil(t, err) {
+					assert.Equal(t, tt.wantAttr, resp.Body().(*envelopeContentExample).Attr1)
+					assert.Equal(t, tt.operation, logger.finished[len(logger.finished)-1].Operation)
+				}
+			}
+		})
+	}
+}
+
+func TestClientOperationRequest(t *testing.T) {
+	response := &envelopeContentExample{}
+	client := NewClient(nil, WithOperations("http://example.com/service/",
+		Operation{Name: "Get", Action: "urn:Get", Path: "Get.svc", Request: &operationTestBody{}, Response: response},
+	))
+
+	req, err := client.OperationRequest("Get", operationTestBody{})
+	if assert.Nil(t, err) {
+		assert.Equal(t, "urn:Get", req.action)
+		assert.Equal(t, "http://example.com/service/Get.svc", req.url)
+		assert.Equal(t, "Get", req.operation)
+		assert.IsType(t, &envelopeContentExample{}, req.resp)
+		// Each request decodes into a new response.
+		assert.True(t, req.resp != response)
+	}
+
+	_, err = client.OperationRequest("Get", &envelopeContentExample{})
+	assert.NotNil(t, err)
+}
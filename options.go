@@ -0,0 +1,164 @@
+package soap
+
+import (
+	"context"
+	"time"
+)
+
+// ClientOption configures optional behaviour of a Client.
+type ClientOption func(*Client)
+
+// WithLogger sets the logger notified at the start and end of every request made by the client.
+func WithLogger(logger Logger) ClientOption {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// OperationNamer returns the name of the operation of a request, from its action and body, for the Operation of its
+// log entry. The name should have a low cardinality, i.e. not include tenant specific parts of the action, so that
+// metrics and traces can be grouped by operation.
+type OperationNamer func(action string, body interface{}) string
+
+// WithOperationNamer sets the function naming the operation of requests in their log entries, which are otherwise
+// named after their action. See OperationByBodyElement.
+func WithOperationNamer(namer OperationNamer) ClientOption {
+	return func(c *Client) {
+		c.operationNamer = namer
+	}
+}
+
+// OperationByBodyElement is an OperationNamer naming operations after the local name of the body element of their
+// requests, i.e. the name of the XMLName field of the body, or of its type, for services whose actions vary by
+// endpoint or are empty.
+func OperationByBodyElement(action string, body interface{}) string {
+	return elementName(body).Local
+}
+
+// SlowRequestHandler is called with the details of requests which took longer than the configured threshold.
+// The entry breaks the duration of the request down into serialization, round trip and decoding.
+type SlowRequestHandler func(ctx context.Context, entry *LogEntry)
+
+// WithSlowRequestHandler sets a handler called after every request taking threshold or longer, whether it succeeded
+// or not, to help identify the operations responsible for high latency.
+func WithSlowRequestHandler(threshold time.Duration, handler SlowRequestHandler) ClientOption {
+	return func(c *Client) {
+		c.slowThreshold = threshold
+		c.slowHandler = handler
+	}
+}
+
+// FaultHandler is called with the details of requests whose response was a SOAP fault. The entry identifies the
+// action and endpoint of the request, and the fault holds its code, string and decoded detail, if any.
+type FaultHandler func(ctx context.Context, entry *LogEntry, fault *Fault)
+
+// WithFaultHandler sets a handler called after every request whose response is a SOAP fault, so that faults can be
+// reported or alerted on in one place rather than at every call site.
+func WithFaultHandler(handler FaultHandler) ClientOption {
+	return func(c *Client) {
+		c.faultHandler = handler
+	}
+}
+
+// DeprecatedAlgorithmHandler is called with the details of requests signed with a deprecated algorithm suite.
+type DeprecatedAlgorithmHandler func(ctx context.Context, entry *LogEntry, suite AlgorithmSuite)
+
+// WithDeprecatedAlgorithmHandler sets a handler called before sending every request signed with a deprecated
+// algorithm suite, such as LegacyRSASHA1, so that the integrations still relying on it can be found and migrated.
+func WithDeprecatedAlgorithmHandler(handler DeprecatedAlgorithmHandler) ClientOption {
+	return func(c *Client) {
+		c.deprecatedHandler = handler
+	}
+}
+
+// WithLenientContentType makes the client assume responses are text/xml when the Content-Type header is missing or
+// can't be parsed, rather than failing the request. If only the parameters of the header are malformed, such as a
+// repeated charset, the media type is still used.
+func WithLenientContentType() ClientOption {
+	return func(c *Client) {
+		c.lenientContentType = true
+	}
+}
+
+// WithLenientMultipart makes the client repair the framing of malformed multipart responses before decoding them,
+// as produced by some proxies: content before the first boundary is dropped, and line endings mixing CRLF and bare LF
+// around the boundaries and in the part headers are normalized. The content of the parts is left unchanged.
+func WithLenientMultipart() ClientOption {
+	return func(c *Client) {
+		c.lenientMultipart = true
+	}
+}
+
+// WithMultipartBuffering sets how the bodies of multipart responses are buffered as they are read, for the throughput
+// of large attachments on fast links. The body is read from the connection in reads of up to bufferSize bytes, which
+// is 4 KiB if 0; mime/multipart itself then scans the parts for boundaries in chunks of 4 KiB from that buffer.
+// If readAhead is above 0, up to that many buffers are read ahead by a goroutine while the parts are decoded or
+// handed to the attachment handler, so that reading from the connection overlaps with processing the parts, at the
+// cost of bufferSize bytes of memory for each buffer.
+// Parts decoded into []byte fields are read into a buffer of the size of their Content-Length header, if they have
+// one, rather than into a buffer grown as they are read, whether or not this option is set.
+func WithMultipartBuffering(bufferSize int, readAhead int) ClientOption {
+	return func(c *Client) {
+		c.multipartBuffering = multipartBuffering{size: bufferSize, readAhead: readAhead}
+	}
+}
+
+// InvalidUTF8Handler is called with the details of requests whose response held bytes which aren't valid UTF-8, and
+// the number of them which were replaced.
+type InvalidUTF8Handler func(ctx context.Context, entry *LogEntry, replaced int)
+
+// WithLenientUTF8 makes the client replace the bytes of XML responses, and of the root part of multipart responses,
+// which aren't valid UTF-8 with U+FFFD before decoding them, rather than failing to decode them, as for services
+// emitting raw Latin-1 bytes in documents declared as UTF-8. The handler, which may be nil, is called after every
+// request whose response held any, so that they can be logged, before Do returns.
+func WithLenientUTF8(handler InvalidUTF8Handler) ClientOption {
+	return func(c *Client) {
+		c.lenientUTF8 = true
+		c.invalidUTF8Handler = handler
+	}
+}
+
+// WithEntities makes the client replace the entities in responses with their values before decoding them, for services
+// emitting entities which aren't defined in XML, such as the HTML entities of xml.HTMLEntity, rather than failing to
+// decode them with an "invalid character entity" error. The entities predefined by XML (&amp;, &lt;, &gt;, &apos; and
+// &quot;) are left as they are, while the values of the others are escaped where necessary. Entities are replaced
+// throughout XML responses, and the root part of multipart responses, including within CDATA sections and comments.
+func WithEntities(entities map[string]string) ClientOption {
+	return func(c *Client) {
+		c.entities = entities
+	}
+}
+
+// WithEmptyResponses makes the client accept successful responses with an empty body, as returned by some services
+// for operations without a result, rather than failing to decode them. The response body is left as it was.
+// Empty responses are always accepted for requests without a response type.
+func WithEmptyResponses() ClientOption {
+	return func(c *Client) {
+		c.emptyResponses = true
+	}
+}
+
+// requestIndent is the number of spaces each level of an indented request is indented by.
+const requestIndent = 2
+
+// WithIndentedRequests makes the client pretty-print request envelopes, so that captured requests are readable while
+// debugging. This is applied before signed requests are digested, so the signature remains valid, although the
+// security header itself is added without indentation.
+// Indentation adds whitespace to the content of elements with children, which some services treat as significant;
+// it should not be relied on outside of debugging.
+func WithIndentedRequests() ClientOption {
+	return func(c *Client) {
+		c.indentRequests = true
+	}
+}
+
+// WithEnvelopeNamespace makes the client use namespace in place of the SOAP 1.1 envelope namespace, for services
+// using a nonstandard or draft namespace for the envelope, header, body and fault elements. Responses using either
+// namespace are accepted.
+// Only the namespace changes: envelopes are otherwise encoded and decoded as SOAP 1.1. Streamed requests are buffered
+// in this mode, as the envelope must be rewritten before it is sent.
+func WithEnvelopeNamespace(namespace string) ClientOption {
+	return func(c *Client) {
+		c.envelopeNS = namespace
+	}
+}
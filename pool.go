@@ -0,0 +1,102 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"sync"
+)
+
+// Implements the pooling of the buffers and encoders used to serialize and deserialize envelopes.
+// Services issuing many requests would otherwise allocate (and grow) a fresh buffer and encoder for every call.
+
+// maxPooledBufferSize is the capacity above which buffers are dropped rather than returned to their pool,
+// so that an occasional very large message doesn't pin its memory for the life of the process.
+const maxPooledBufferSize = 1 << 20
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer returns an empty buffer from the pool.
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns a buffer to the pool. The buffer must not be used afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+var readerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReader(nil)
+	},
+}
+
+// getReader returns a buffered reader from the pool, reading from r. The XML decoder reads from it directly rather
+// than allocating a buffered reader of its own for every body it decodes.
+func getReader(r io.Reader) *bufio.Reader {
+	br := readerPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
+
+// putReader returns a buffered reader to the pool. The reader must not be used afterwards.
+func putReader(br *bufio.Reader) {
+	br.Reset(nil)
+	readerPool.Put(br)
+}
+
+// pooledEncoder is an XML encoder along with the buffer it writes to.
+// The encoder can't be pointed at a different writer, so the two are pooled together.
+type pooledEncoder struct {
+	buf bytes.Buffer
+	enc *xml.Encoder
+	// failed is set if encoding failed, as the encoder may then have been left in an inconsistent state.
+	failed bool
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		e := &pooledEncoder{}
+		e.enc = xml.NewEncoder(&e.buf)
+		return e
+	},
+}
+
+// getEncoder returns an encoder from the pool.
+func getEncoder() *pooledEncoder {
+	return encoderPool.Get().(*pooledEncoder)
+}
+
+// putEncoder returns an encoder to the pool. Neither the encoder nor its bytes may be used afterwards.
+func putEncoder(e *pooledEncoder) {
+	if e.failed || e.buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	encoderPool.Put(e)
+}
+
+// encode serializes v, replacing anything previously encoded. The result is available from bytes.
+func (e *pooledEncoder) encode(v interface{}) error {
+	e.buf.Reset()
+	if err := e.enc.Encode(v); err != nil {
+		e.failed = true
+		return err
+	}
+	return nil
+}
+
+// bytes returns the result of the last call to encode. The slice is only valid until the encoder is reused.
+func (e *pooledEncoder) bytes() []byte {
+	return e.buf.Bytes()
+}
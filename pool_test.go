@@ -0,0 +1,82 @@
+package soap
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPooledEncoder(t *testing.T) {
+	enc := getEncoder()
+
+	assert.Nil(t, enc.encode(&envelopeContentExample{Attr1: 1}))
+	assert.Equal(t, `<ContentExample attr1="1"><ContentField attr1="" attr2="0"></ContentField></ContentExample>`, string(enc.bytes()))
+
+	// Encoding again replaces the previous result.
+	assert.Nil(t, enc.encode(&headerExample{Attr1: 2, Value: "value"}))
+	assert.Equal(t, `<HeaderExample attr1="2">value</HeaderExample>`, string(enc.bytes()))
+
+	assert.NotNil(t, enc.encode(make(chan int)))
+	assert.True(t, enc.failed)
+}
+
+func TestPutBuffer(t *testing.T) {
+	buf := getBuffer()
+	buf.WriteString("data")
+	putBuffer(buf)
+
+	// Buffers are always empty when taken from the pool, whichever one is returned.
+	assert.Equal(t, 0, getBuffer().Len())
+}
+
+func TestPutReader(t *testing.T) {
+	br := getReader(strings.NewReader("first"))
+	br.Peek(1)
+	putReader(br)
+
+	// Readers only read from the reader they're taken for, whichever one is returned.
+	data, err := ioutil.ReadAll(getReader(strings.NewReader("second")))
+	assert.Nil(t, err)
+	assert.Equal(t, "second", string(data))
+}
+
+var benchmarkContent = &envelopeContentExample{
+	Attr1: 10,
+	Field1: envelopeExampleField{
+		Attr1: "test attr",
+		Attr2: 11,
+		Value: "This is a test string",
+	},
+}
+
+func BenchmarkRequestSerialize(b *testing.B) {
+	req := NewRequest("action", "http://localhost", benchmarkContent, nil, nil)
+	req.AddHeader(headerExample{Attr1: 15, Value: "test header value"})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := req.serialize(serializeOptions{}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResponseDeserialize(b *testing.B) {
+	data := []byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><ContentExample attr1="10"><ContentField attr1="test attr" attr2="11">This is a test string</ContentField></ContentExample></Body></Envelope>`)
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		httpResp := &http.Response{
+			Header: http.Header{"Content-Type": []string{"text/xml; charset=utf-8"}},
+			Body:   ioutil.NopCloser(bytes.NewReader(data)),
+		}
+		resp := newResponse(httpResp, NewRequest("action", "http://localhost", nil, &envelopeContentExample{}, nil), nil)
+		if err := resp.deserialize(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Implements client-side rate limiting of requests.
+
+// ErrInvalidRate is returned by NewTokenBucketLimiter if the rate isn't positive.
+var ErrInvalidRate = errors.New("rate limit must be positive")
+
+// minBucketSweep is the number of buckets a tokenBucketLimiter holds before it first removes the full ones.
+const minBucketSweep = 64
+
+// RateLimiter controls the rate at which a Client dispatches requests. It is consulted before every request is sent,
+// including duplicates sent when hedging. Implementations must be safe for concurrent use.
+type RateLimiter interface {
+	// Wait blocks until a request to the endpoint for the action may be sent.
+	// It returns an error, typically that of the context, if the request must not be sent.
+	Wait(ctx context.Context, url string, action string) error
+}
+
+// WithRateLimiter sets the rate limiter consulted before each request is sent.
+func WithRateLimiter(limiter RateLimiter) ClientOption {
+	return func(c *Client) {
+		c.limiter = limiter
+	}
+}
+
+// RateLimitKey maps a request to the bucket it is limited by.
+type RateLimitKey func(url string, action string) string
+
+// ByEndpoint limits the requests to each endpoint together, regardless of their action.
+func ByEndpoint(url string, action string) string {
+	return url
+}
+
+// ByAction limits the requests for each action of each endpoint separately.
+func ByAction(url string, action string) string {
+	return url + " " + action
+}
+
+// tokenBucketLimiter is a RateLimiter with a token bucket for each key.
+type tokenBucketLimiter struct {
+	rate  float64
+	burst int
+	key   RateLimitKey
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// sweepAt is the number of buckets at which those which are full are removed, as a full bucket is the same as
+	// a new one.
+	sweepAt int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucketLimiter returns a RateLimiter allowing rate requests per second for each key, with bursts of up to
+// burst requests. Requests waiting for a token are served in the order they arrive. It returns ErrInvalidRate if rate
+// isn't positive.
+// The limiter keeps a bucket for each key it has seen, but drops those which have refilled, so keys which change
+// over time, such as endpoints with per-session URLs, don't hold on to memory.
+func NewTokenBucketLimiter(rate float64, burst int, key RateLimitKey) (RateLimiter, error) {
+	if !(rate > 0) {
+		return nil, ErrInvalidRate
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &tokenBucketLimiter{
+		rate:    rate,
+		burst:   burst,
+		key:     key,
+		buckets: map[string]*tokenBucket{},
+		sweepAt: minBucketSweep,
+	}, nil
+}
+
+// Wait satisfies the RateLimiter interface.
+func (l *tokenBucketLimiter) Wait(ctx context.Context, url string, action string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	delay, bucket := l.reserve(l.key(url, action))
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// The token reserved for this request is handed back for the next one.
+		l.mu.Lock()
+		bucket.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token from the bucket for key, returning how long to wait until the token is actually available.
+// The token count goes negative while requests are waiting, which queues them behind each other.
+func (l *tokenBucketLimiter) reserve(key string) (time.Duration, *tokenBucket) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.sweepAt {
+			l.sweep(now)
+		}
+		bucket = &tokenBucket{tokens: float64(l.burst), last: now}
+		l.buckets[key] = bucket
+	}
+
+	l.refill(bucket, now)
+
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0, bucket
+	}
+	return time.Duration(-bucket.tokens / l.rate * float64(time.Second)), bucket
+}
+
+// refill adds the tokens generated since the bucket was last used, up to the burst.
+func (l *tokenBucketLimiter) refill(bucket *tokenBucket, now time.Time) {
+	bucket.tokens += now.Sub(bucket.last).Seconds() * l.rate
+	if bucket.tokens > float64(l.burst) {
+		bucket.tokens = float64(l.burst)
+	}
+	bucket.last = now
+}
+
+// sweep removes the buckets which are full, then sets the number of buckets at which to sweep again to twice those
+// remaining, so that sweeping takes constant time per bucket added. No request waits on a full bucket.
+func (l *tokenBucketLimiter) sweep(now time.Time) {
+	for key, bucket := range l.buckets {
+		l.refill(bucket, now)
+		if bucket.tokens >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	if l.sweepAt = 2 * len(l.buckets); l.sweepAt < minBucketSweep {
+		l.sweepAt = minBucketSweep
+	}
+}
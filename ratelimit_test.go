@@ -0,0 +1,110 @@
+package soap
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	var tests = []struct {
+		name    string
+		key     RateLimitKey
+		actions []string
+		// delayed is the number of requests expected to wait for a token.
+		delayed int
+	}{
+		{name: "within burst", key: ByEndpoint, actions: []string{"a", "a"}, delayed: 0},
+		{name: "beyond burst", key: ByEndpoint, actions: []string{"a", "a", "a", "a"}, delayed: 2},
+		{name: "shared by endpoint", key: ByEndpoint, actions: []string{"a", "b", "a", "b"}, delayed: 2},
+		{name: "separate by action", key: ByAction, actions: []string{"a", "b", "a", "b"}, delayed: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter, err := NewTokenBucketLimiter(50, 2, tt.key)
+			assert.Nil(t, err)
+
+			start := time.Now()
+			for _, action := range tt.actions {
+				assert.Nil(t, limiter.Wait(context.Background(), "http://localhost", action))
+			}
+			elapsed := time.Since(start)
+
+			// Each delayed request waits for a further token, generated every 20ms.
+			minimum := time.Duration(tt.delayed) * 20 * time.Millisecond
+			assert.True(t, elapsed >= minimum, "elapsed %v, expected at least %v", elapsed, minimum)
+			if tt.delayed == 0 {
+				assert.True(t, elapsed < 20*time.Millisecond, "elapsed %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestTokenBucketLimiterContext(t *testing.T) {
+	limiter, err := NewTokenBucketLimiter(1, 1, ByEndpoint)
+	assert.Nil(t, err)
+	assert.Nil(t, limiter.Wait(context.Background(), "http://localhost", "a"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, limiter.Wait(ctx, "http://localhost", "a"))
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, limiter.Wait(canceled, "http://localhost", "a"))
+}
+
+func TestNewTokenBucketLimiterInvalidRate(t *testing.T) {
+	for _, rate := range []float64{0, -1, math.NaN()} {
+		limiter, err := NewTokenBucketLimiter(rate, 1, ByEndpoint)
+		assert.Nil(t, limiter)
+		assert.Equal(t, ErrInvalidRate, err, "rate %v", rate)
+	}
+}
+
+func TestTokenBucketLimiterSweep(t *testing.T) {
+	limiter, err := NewTokenBucketLimiter(1000, 1, ByEndpoint)
+	assert.Nil(t, err)
+	buckets := limiter.(*tokenBucketLimiter)
+
+	// Each bucket refills within 1ms, so the buckets of endpoints which aren't used any more are dropped.
+	for i := 0; i < 10*minBucketSweep; i++ {
+		assert.Nil(t, limiter.Wait(context.Background(), fmt.Sprintf("http://localhost/%d", i), "a"))
+		if i%minBucketSweep == 0 {
+			time.Sleep(2 * time.Millisecond)
+		}
+	}
+	assert.True(t, len(buckets.buckets) <= 2*minBucketSweep, "%d buckets", len(buckets.buckets))
+}
+
+func TestClientRateLimiter(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(requestTestResponse))
+	}))
+	defer server.Close()
+
+	limiter, err := NewTokenBucketLimiter(0.001, 1, ByAction)
+	assert.Nil(t, err)
+	client := NewClient(server.Client(), WithRateLimiter(limiter))
+
+	_, err = client.Do(context.Background(), NewRequest("action", server.URL, &headerExample{}, &envelopeContentExample{}, nil))
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = client.Do(ctx, NewRequest("action", server.URL, &headerExample{}, &envelopeContentExample{}, nil))
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
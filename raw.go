@@ -0,0 +1,58 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+)
+
+// RawXML is pre-serialized XML, such as the output of a template or other tooling, which is embedded into the
+// envelope as-is when used as the body of a request, a header entry, or a field of either.
+// It may hold any number of elements, along with comments and character data. The content must be well-formed,
+// with every namespace prefix it uses declared within it; an XML declaration at the start is dropped.
+// Only lexical details change when the content is embedded: attribute values are always quoted with double quotes,
+// empty elements are written with an end tag, and characters are escaped where required.
+type RawXML []byte
+
+// MarshalXML writes the raw content to the encoder in place of the element start.
+// Names are written with the prefixes used in the content, rather than being resolved to namespaces and
+// declared again by the encoder.
+func (r RawXML) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	d := xml.NewDecoder(bytes.NewReader(r))
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		switch t := token.(type) {
+		case xml.ProcInst:
+			if t.Target == "xml" {
+				continue
+			}
+		case xml.StartElement:
+			t.Name = prefixedName(t.Name)
+			for i := range t.Attr {
+				t.Attr[i].Name = prefixedName(t.Attr[i].Name)
+			}
+			token = t
+		case xml.EndElement:
+			t.Name = prefixedName(t.Name)
+			token = t
+		}
+
+		if err := e.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+}
+
+// prefixedName returns the name as it was written, with its namespace prefix as part of the local name.
+func prefixedName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
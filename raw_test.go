@@ -0,0 +1,72 @@
+package soap
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var rawXMLTests = []struct {
+	name     string
+	body     interface{}
+	headers  []interface{}
+	stream   bool
+	envelope string
+	err      string
+}{
+	{
+		name:     "body",
+		body:     RawXML(`<?xml version="1.0" encoding="UTF-8"?><q:GetQuote xmlns:q="urn:quotes"><q:Symbol exchange='NYSE'>TN &amp; co</q:Symbol><Empty/><!-- from template --></q:GetQuote>`),
+		envelope: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><q:GetQuote xmlns:q="urn:quotes"><q:Symbol exchange="NYSE">TN &amp; co</q:Symbol><Empty></Empty><!-- from template --></q:GetQuote></Body></Envelope>`,
+	},
+	{
+		name:     "streamed body",
+		body:     RawXML(`<GetQuote xmlns="urn:quotes"><Symbol>TN</Symbol></GetQuote>`),
+		stream:   true,
+		envelope: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><GetQuote xmlns="urn:quotes"><Symbol>TN</Symbol></GetQuote></Body></Envelope>`,
+	},
+	{
+		name:     "header",
+		body:     &envelopeContentExample{Attr1: 10},
+		headers:  []interface{}{RawXML(`<h:Auth xmlns:h="urn:auth" h:token="abc"/>`), headerExample{Attr1: 15, Value: "test"}},
+		envelope: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Header xmlns="http://schemas.xmlsoap.org/soap/envelope/"><h:Auth xmlns:h="urn:auth" h:token="abc"></h:Auth><HeaderExample attr1="15">test</HeaderExample></Header><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><ContentExample attr1="10"><ContentField attr1="" attr2="0"></ContentField></ContentExample></Body></Envelope>`,
+	},
+	{
+		name: "mismatched end tag",
+		body: RawXML(`<GetQuote><Symbol></GetQuote>`),
+		err:  "xml: end tag </GetQuote> does not match start tag <Symbol>",
+	},
+	{
+		name: "unclosed element",
+		body: RawXML(`<GetQuote>`),
+		err:  "xml: soap.RawXML.MarshalXML wrote invalid XML: <GetQuote> not closed",
+	},
+}
+
+func TestRawXML(t *testing.T) {
+	for _, tt := range rawXMLTests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest("action", "http://localhost", tt.body, nil, nil)
+			for _, header := range tt.headers {
+				req.AddHeader(header)
+			}
+			req.StreamBody(tt.stream)
+
+			r, err := req.serialize(serializeOptions{})
+			var data []byte
+			if err == nil {
+				data, err = ioutil.ReadAll(r)
+			}
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.Equal(t, tt.err, err.Error())
+				}
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.envelope, string(data))
+		})
+	}
+}
@@ -4,17 +4,49 @@ import (
 	"bytes"
 	"encoding/xml"
 	"io"
+	"io/ioutil"
+	"mime"
 	"net/http"
+
+	"github.com/beevik/etree"
 )
 
 // Request represents a single request to a SOAP service.
+// A Request is decoded into by the call it is passed to, so it must not be used by concurrent calls, nor modified
+// while a call is in progress. To reuse shared settings such as headers and signing credentials across concurrent
+// calls, configure a prototype request and Clone it for each call.
 type Request struct {
-	headers []interface{}
+	headers     []interface{}
+	headerOrder []xml.Name
+	namespaces  []namespaceDecl
+
+	url        string
+	action     string
+	actionMode SOAPActionMode
+	// operation is the name of the operation registered with the client the request was built for, if any.
+	operation string
+	// method is the HTTP method the request is sent with, POST if empty, and methodOverride, if set, the method
+	// sent in the X-HTTP-Method-Override header.
+	method         string
+	methodOverride string
 
-	url    string
-	action string
+	wsseInfo   *WSSEAuthInfo
+	wsseIDs    *WSSEAuthIDs
+	wsseScope  SigningScope
+	stream     bool
+	prefixBody bool
+	idempotent bool
+	addressing bool
 
-	wsseInfo *WSSEAuthInfo
+	attachments AttachmentHandler
+	progress    ProgressFunc
+	// parts are the parts sent along with the envelope in a multipart request, if any, framed as set by multipart.
+	parts     []*MIMEPart
+	multipart MultipartConfig
+	// expectedResponse, if set, is the name the element in the body of a response other than a fault must have.
+	expectedResponse xml.Name
+	// headerTargets are the values response header entries are decoded into, by element name.
+	headerTargets map[xml.Name]interface{}
 
 	body  interface{}
 	resp  interface{}
@@ -26,9 +58,21 @@ type Request struct {
 // the response and fault types are supplied so they can be properly parsed during envelope handling.
 // Second, since we may perform WSSE signing on the request we do not supply a reader,
 // instead the body is supplied here.
+// Bodies which don't map cleanly to Go structs can be supplied as RawXML.
+// If the service returns different fault details depending on the fault, the candidates can be supplied as FaultDetails,
+// or as FaultDetailEntries if a fault may have several detail elements.
 // If signing is desired, set the WSSE credentials on the request before passing it to the Client.
+// If the action is empty, it is inferred from the type of the body if registered with RegisterAction, along with the
+// path of the endpoint, if any, which is appended to the URL.
 // NOTE: if custom SOAP headers are going to be supplied, they must be added before signing.
 func NewRequest(action string, url string, body interface{}, respType interface{}, faultType interface{}) *Request {
+	if action == "" {
+		if registered, ok := lookupAction(body); ok {
+			action = registered.action
+			url = joinPath(url, registered.path)
+		}
+	}
+
 	req := &Request{
 		action: action,
 		url:    url,
@@ -40,65 +84,405 @@ func NewRequest(action string, url string, body interface{}, respType interface{
 	return req
 }
 
+// Clone returns a copy of the request with the supplied body, response and fault types, sharing none of the state
+// that is modified by a call. The headers, signing credentials and other settings are copied, so headers added to
+// the clone don't affect the original request and vice versa. The header values themselves are not copied and must
+// not be modified while in use.
+func (r *Request) Clone(body interface{}, respType interface{}, faultType interface{}) *Request {
+	clone := *r
+	clone.headers = append([]interface{}(nil), r.headers...)
+	clone.headerOrder = append([]xml.Name(nil), r.headerOrder...)
+	clone.namespaces = append([]namespaceDecl(nil), r.namespaces...)
+	clone.parts = append([]*MIMEPart(nil), r.parts...)
+	clone.headerTargets = nil
+	for name, target := range r.headerTargets {
+		clone.decodeHeader(name, target)
+	}
+	clone.body = body
+	clone.resp = respType
+	clone.fault = faultType
+
+	return &clone
+}
+
 // AddHeader adds the header argument to the list of elements set in the SOAP envelope Header element.
-// This will be serialized to XML when the request is made to the service.
+// This will be serialized to XML when the request is made to the service. Pre-serialized headers can be added as RawXML.
+// Header entries are serialized in a fixed order: the WS-Addressing headers, if enabled, then the headers added, in
+// the order they were added, and finally the wsse:Security header of signed requests. See OrderHeaders to change it.
 func (r *Request) AddHeader(header interface{}) {
 	r.headers = append(r.headers, header)
 }
 
+// OrderHeaders sets the order of the header entries, for receivers which validate it. The entries with the names are
+// serialized first, in the order of the names, followed by the other entries in their usual order (see AddHeader).
+// The names may include those of the WS-Addressing headers, and of the security header of signed requests, which is
+// {WSSENamespace}Security. A name without a namespace matches entries in any namespace. Entries are ordered before
+// the request is signed, so the order is covered by signatures of the whole envelope.
+// Streamed requests are buffered if the headers are ordered, as the envelope must be rewritten before it is sent.
+func (r *Request) OrderHeaders(names ...xml.Name) {
+	r.headerOrder = names
+}
+
+// DeclareNamespace declares prefix for namespace on the envelope element, replacing any previous declaration of
+// the prefix. Content implementing ContextMarshaler is told of the declarations through its MarshalContext, so it
+// can use the prefix rather than declaring the namespace on each element.
+func (r *Request) DeclareNamespace(prefix string, namespace string) {
+	for i, decl := range r.namespaces {
+		if decl.prefix == prefix {
+			r.namespaces[i].namespace = namespace
+			return
+		}
+	}
+	r.namespaces = append(r.namespaces, namespaceDecl{prefix: prefix, namespace: namespace})
+}
+
+// DeclareSchemaNamespaces declares the xsd and xsi prefixes for the XML schema namespaces on the envelope element,
+// for services expecting content which refers to them, such as xsi:type attributes, to be able to use the prefixes
+// without declaring them. They are not declared otherwise.
+func (r *Request) DeclareSchemaNamespaces() {
+	r.DeclareNamespace("xsd", xsdNS)
+	r.DeclareNamespace("xsi", xsiNS)
+}
+
 // SignWith supplies the authentication data to use for signing.
+// Signed envelopes only declare the namespaces they use, as intermediaries checking digests may reject unused
+// declarations; see DeclareSchemaNamespaces to declare the XML schema namespaces.
 func (r *Request) SignWith(wsseInfo *WSSEAuthInfo) {
 	r.wsseInfo = wsseInfo
 }
 
-// serialize takes the data supplied in the request and serializes the SOAP data to the returned reader.
-func (r *Request) serialize() (io.Reader, error) {
-	envelope := NewEnvelope(r.body)
+// SignWithIDs sets the IDs used when signing the request, rather than generating new ones for each call, i.e. for
+// gateways requiring deterministic IDs, or to reproduce a captured message. The IDs are shared by clones of the
+// request.
+func (r *Request) SignWithIDs(ids *WSSEAuthIDs) {
+	r.wsseIDs = ids
+}
 
-	if len(r.headers) > 0 {
-		envelope.AddHeaders(r.headers)
-	}
+// SignScope sets the part of the request covered by its signature, which is the body unless set otherwise.
+func (r *Request) SignScope(scope SigningScope) {
+	r.wsseScope = scope
+}
 
-	var envelopeEnc []byte
-	var err error
+// StreamBody enables or disables streaming of the serialized envelope into the HTTP request body.
+// When enabled the envelope is encoded as it is sent, rather than being buffered in memory first, which is useful for
+// very large payloads. The request is then sent with chunked transfer encoding, and can't be replayed on redirects.
+// Signed requests are always buffered, as the whole body must be canonicalized and digested before it is sent.
+// Requests which the client rewrites, such as for compatibility profiles or indentation, are buffered too.
+func (r *Request) StreamBody(stream bool) {
+	r.stream = stream
+}
 
-	if r.wsseInfo != nil {
-		if err := envelope.signWithWSSEInfo(r.wsseInfo); err != nil {
+// PrefixBody enables or disables rewriting the body content to use the prefixes declared with DeclareNamespace.
+// When enabled, elements and attributes in a declared namespace are written with its prefix, and the declarations of
+// the namespace within the content are dropped, rather than the namespace being declared again as the default on
+// each element as by encoding/xml. This produces compact output matching the samples of services which expect
+// particular prefixes, i.e. to reproduce a signed message byte for byte. Other namespaces are left as they are.
+// The prefixes used are declared again on the body content of signed requests, where exclusive canonicalization
+// places them, so that the signed content is the same for the service as for the client.
+// Streamed requests are buffered when enabled, as the envelope must be rewritten before it is sent.
+func (r *Request) PrefixBody(enabled bool) {
+	r.prefixBody = enabled
+}
+
+// SOAPActionMode is how the SOAPAction header of a request is sent.
+type SOAPActionMode int
+
+const (
+	// SendAction sends the action of the request, quoted as required by the compatibility profile. This is the
+	// default.
+	SendAction SOAPActionMode = iota
+	// SendEmptyAction sends an empty quoted string, which SOAP 1.1 defines as the intent of the request being given
+	// by its URL, whatever the action of the request.
+	SendEmptyAction
+	// OmitAction sends no SOAPAction header, as expected by some document-style services which define no action and
+	// reject requests with one.
+	OmitAction
+)
+
+// SetActionMode sets how the SOAPAction header of the request is sent. The action of the request is still used
+// elsewhere, such as for the WS-Addressing Action header and in log entries.
+func (r *Request) SetActionMode(mode SOAPActionMode) {
+	r.actionMode = mode
+}
+
+// SetHTTPMethod sets the HTTP method the request is sent with, which is POST by default, for gateways which tunnel
+// SOAP over other methods.
+func (r *Request) SetHTTPMethod(method string) {
+	r.method = method
+}
+
+// OverrideHTTPMethod sets the method sent in the X-HTTP-Method-Override header, for gateways which expect requests
+// to be tunneled through another method, such as POST, and dispatch them according to the header.
+func (r *Request) OverrideHTTPMethod(method string) {
+	r.methodOverride = method
+}
+
+// MarkIdempotent marks the request as safe to send more than once, i.e. because it only reads data.
+// Idempotent requests may be duplicated by the client, as when hedging or retrying requests (see WithHedging and
+// WithRetryPolicy).
+func (r *Request) MarkIdempotent() {
+	r.idempotent = true
+}
+
+// AddPart adds a part to be sent along with the envelope, such as an attachment the envelope references with an
+// XopInclude. Requests with parts are sent as multipart/related messages, with the envelope as the root part: as XOP
+// (MTOM) packages, or as SOAP with Attachments, as set with ConfigureMultipart. The parts are sent in the order they
+// were added, and their content is read as the request is sent, so the request is always streamed and can't be sent
+// more than once, as when hedging, retrying or following redirects. As the length of the parts isn't known, the
+// request is sent with chunked transfer encoding, straight from the readers of the parts, so that parts of any size
+// can be sent without being held in memory; see also MultipartConfig.ExpectContinue.
+func (r *Request) AddPart(part *MIMEPart) {
+	r.parts = append(r.parts, part)
+}
+
+// bufferParts reads the content of the parts of the request into memory, replacing their readers with readers of the
+// content, which it returns so that they can be rewound once the request has been serialized.
+func (r *Request) bufferParts() ([]*bytes.Reader, error) {
+	var buffered []*bytes.Reader
+	for _, part := range r.parts {
+		data, err := ioutil.ReadAll(part.Reader)
+		if err != nil {
 			return nil, err
 		}
+		content := bytes.NewReader(data)
+		part.Reader = content
+		buffered = append(buffered, content)
+	}
+	return buffered, nil
+}
+
+// ConfigureMultipart sets the MIME framing of the request if it is sent as a multipart message, i.e. because parts
+// were added with AddPart.
+func (r *Request) ConfigureMultipart(config MultipartConfig) {
+	r.multipart = config
+}
+
+// HandleAttachments sets a handler to be called with each binary part of a multipart (XOP) response.
+// The handler reads the parts straight from the response body, allowing large attachments to be streamed elsewhere
+// without being held in memory. The []byte fields referencing the parts are then left empty.
+// Alternatively, parts referenced by fields of the response holding a writer are streamed into it; see DecodeXOP.
+// If the root part holds a fault, the fault is decoded as for other responses and the handler isn't called: the
+// parts following it are discarded.
+func (r *Request) HandleAttachments(handler AttachmentHandler) {
+	r.attachments = handler
+}
+
+// OnProgress sets a function to be called as the response body is read, to report the progress of large responses.
+// Responses sent without a Content-Length, such as those using chunked transfer encoding, are decoded as they are
+// received rather than being read in full first, so content types with custom unmarshalers can start processing
+// the elements that have arrived while the rest is still being sent.
+func (r *Request) OnProgress(progress ProgressFunc) {
+	r.progress = progress
+}
+
+// ExpectResponse sets the name of the element expected in the body of the response, such as the response element
+// of the operation declared by its WSDL. Responses with any other element, or an empty body, fail with an
+// UnexpectedResponseError rather than being decoded into the response type, which would otherwise leave it with zero
+// values, i.e. if the service returns the response of another operation or a wrapped error document. Faults are
+// decoded as usual. The namespace must match, unless name has none.
+func (r *Request) ExpectResponse(name xml.Name) {
+	r.expectedResponse = name
+}
+
+// OnHeader sets v, a pointer, as the value the header entry with the name is decoded into when the response is
+// decoded, such as a WS-Addressing or session header returned by the service. The namespace must match, unless name
+// has none. Entries of several names can be decoded into values of independent types by setting a target for each;
+// all entries can also be read from Response.Headers. Faults are decoded the same way.
+func (r *Request) OnHeader(name xml.Name, v interface{}) {
+	r.decodeHeader(name, v)
+}
+
+// decodeHeader sets v as the value the response header entry with the specified name is decoded into.
+func (r *Request) decodeHeader(name xml.Name, v interface{}) {
+	if r.headerTargets == nil {
+		r.headerTargets = map[xml.Name]interface{}{}
+	}
+	r.headerTargets[name] = v
+}
+
+// serializeOptions holds the settings of the client which affect how requests are serialized.
+type serializeOptions struct {
+	// compat is the compatibility profile applied to the envelope, if any.
+	compat *compatProfile
+	// indent pretty-prints the envelope.
+	indent bool
+	// envelopeNS, if set, replaces the envelope namespace.
+	envelopeNS string
+	// invalidChars, if set, is how illegal characters are filtered out of the body and header values.
+	invalidChars InvalidCharMode
+	// charset, if set, is the charset the envelope is encoded in rather than UTF-8.
+	charset *Charset
+}
+
+// envelopeTransform returns the transform applied to an envelope with the content, if any.
+// The envelope namespace is replaced after the compatibility profile is applied, as profiles look for the standard
+// namespace, and indentation is applied last, so that elements added by the others are indented too.
+func (o serializeOptions) envelopeTransform(content interface{}) func(doc *etree.Document) {
+	var transforms []func(doc *etree.Document)
+	if transform := o.compat.envelopeTransform(content); transform != nil {
+		transforms = append(transforms, transform)
+	}
+	if o.envelopeNS != "" && o.envelopeNS != soapEnvNS {
+		transforms = append(transforms, func(doc *etree.Document) {
+			replaceNamespace(doc.Root(), soapEnvNS, o.envelopeNS)
+		})
+	}
+	if o.indent {
+		transforms = append(transforms, func(doc *etree.Document) {
+			doc.Indent(requestIndent)
+		})
+	}
+
+	switch len(transforms) {
+	case 0:
+		return nil
+	case 1:
+		return transforms[0]
+	}
+	return func(doc *etree.Document) {
+		for _, transform := range transforms {
+			transform(doc)
+		}
+	}
+}
+
+// serialize takes the data supplied in the request and serializes the SOAP data to the returned reader.
+func (r *Request) serialize(opts serializeOptions) (io.Reader, error) {
+	ctx := newMarshalContext(r.namespaces)
+	body := r.body
+	if opts.invalidChars != 0 {
+		body = filterInvalidChars(body, opts.invalidChars)
+	}
+	envelope := NewEnvelope(withContext(body, ctx))
 
-		envelopeEnc, err = xml.Marshal(envelope)
+	for _, decl := range r.namespaces {
+		envelope.Namespaces = append(envelope.Namespaces, xml.Attr{Name: xml.Name{Local: "xmlns:" + decl.prefix}, Value: decl.namespace})
+	}
+
+	var headers []interface{}
+	if r.addressing {
+		addressingHeaders, err := r.addressingHeaders(r.wsseInfo != nil)
 		if err != nil {
 			return nil, err
 		}
+		headers = append(headers, addressingHeaders...)
+	}
+	for _, header := range r.headers {
+		if opts.invalidChars != 0 {
+			header = filterInvalidChars(header, opts.invalidChars)
+		}
+		headers = append(headers, withContext(header, ctx))
+	}
+	if len(headers) > 0 {
+		envelope.AddHeaders(headers)
+	}
 
-		envelopeEnc, err = canonicalize(envelopeEnc, "Envelope/Body")
+	transform := opts.envelopeTransform(r.body)
+	if r.prefixBody && len(r.namespaces) > 0 {
+		transform = withPrefixes(r.namespaces, r.wsseInfo != nil, transform)
+	}
+
+	if r.wsseInfo != nil {
+		envelopeEnc, err := envelope.signWithWSSEInfo(r.wsseInfo, r.wsseIDs, r.wsseScope, r.headerOrder, transform)
 		if err != nil {
 			return nil, err
 		}
-	} else {
-		envelopeEnc, err = xml.Marshal(envelope)
+		return bytes.NewReader(envelopeEnc), nil
+	}
+
+	if len(r.headerOrder) > 0 {
+		transform = withHeaderOrder(transform, r.headerOrder)
+	}
+	if transform != nil {
+		envelopeEnc, err := transformEnvelope(envelope, transform)
 		if err != nil {
 			return nil, err
 		}
+		return bytes.NewReader(envelopeEnc), nil
 	}
 
-	return bytes.NewBuffer(envelopeEnc), nil
+	if r.stream {
+		// Any encoding error is reported to the reader, failing the request as it is sent.
+		pr, pw := io.Pipe()
+		go func() {
+			pw.CloseWithError(xml.NewEncoder(pw).Encode(envelope))
+		}()
+		return pr, nil
+	}
+
+	enc := getEncoder()
+	defer putEncoder(enc)
+
+	if err := enc.encode(envelope); err != nil {
+		return nil, err
+	}
+
+	// The encoder is returned to the pool, so the request body gets its own exactly sized copy.
+	return bytes.NewReader(append([]byte(nil), enc.bytes()...)), nil
 }
 
-func (r *Request) httpRequest() (*http.Request, error) {
-	buf, err := r.serialize()
+// requestBody returns the body of the HTTP request, and its content type: the serialized envelope, or a multipart
+// message holding it if the request has parts.
+func (r *Request) requestBody(opts serializeOptions) (io.Reader, string, error) {
+	envelope, err := r.serialize(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.charset == nil {
+		if len(r.parts) == 0 {
+			return envelope, `text/xml; charset="utf-8"`, nil
+		}
+		return multipartBody(envelope, "UTF-8", r.parts, r.multipart)
+	}
+
+	envelope = newCharsetReader(envelope, opts.charset)
+	if len(r.parts) == 0 {
+		return envelope, mime.FormatMediaType("text/xml", map[string]string{"charset": opts.charset.Name}), nil
+	}
+	return multipartBody(envelope, opts.charset.Name, r.parts, r.multipart)
+}
+
+func (r *Request) httpRequest(opts serializeOptions) (*http.Request, error) {
+	buf, contentType, err := r.requestBody(opts)
 	if err != nil {
 		return nil, err
 	}
 
-	httpReq, err := http.NewRequest("POST", r.url, buf)
+	method := r.method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	httpReq, err := http.NewRequest(method, r.url, buf)
 	if err != nil {
+		// Streamed bodies must be closed to stop the encoding goroutine.
+		if closer, ok := buf.(io.Closer); ok {
+			closer.Close()
+		}
 		return nil, err
 	}
 
-	httpReq.Header.Add("Content-Type", "text/xml; charset=\"utf-8\"")
-	httpReq.Header.Add("SOAPAction", r.action)
+	httpReq.Header = r.httpHeader(opts, contentType)
 
 	return httpReq, nil
 }
+
+// httpHeader returns the HTTP headers sent with the request, whose body has the content type.
+func (r *Request) httpHeader(opts serializeOptions, contentType string) http.Header {
+	header := http.Header{}
+	header.Add("Content-Type", contentType)
+	switch r.actionMode {
+	case SendEmptyAction:
+		header.Add("SOAPAction", `""`)
+	case OmitAction:
+	default:
+		header.Add("SOAPAction", opts.compat.soapActionHeader(r.action))
+	}
+	if len(r.parts) > 0 && r.multipart.ExpectContinue {
+		header.Add("Expect", "100-continue")
+	}
+	if r.methodOverride != "" {
+		header.Add("X-HTTP-Method-Override", r.methodOverride)
+	}
+	return header
+}
@@ -0,0 +1,369 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+const requestTestResponse = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><ContentExample attr1="10"><ContentField attr1="test attr" attr2="11">This is a test string</ContentField></ContentExample></Body></Envelope>`
+
+type requestStreamTest struct {
+	name     string
+	stream   bool
+	content  interface{}
+	chunked  bool
+	received string
+	err      bool
+}
+
+var requestStreamTests = []requestStreamTest{
+	{
+		name:     "buffered",
+		content:  &headerExample{Attr1: 1, Value: "value"},
+		received: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><HeaderExample attr1="1">value</HeaderExample></Body></Envelope>`,
+	},
+	{
+		name:     "streamed",
+		stream:   true,
+		content:  &headerExample{Attr1: 1, Value: "value"},
+		chunked:  true,
+		received: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><HeaderExample attr1="1">value</HeaderExample></Body></Envelope>`,
+	},
+	{
+		name:    "streamed encoding error",
+		stream:  true,
+		content: make(chan int),
+		err:     true,
+	},
+}
+
+func TestRequestStreamBody(t *testing.T) {
+	for _, tt := range requestStreamTests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunked bool
+			var received []byte
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				chunked = len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked"
+				received, _ = ioutil.ReadAll(r.Body)
+
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(requestTestResponse))
+			}))
+			defer server.Close()
+
+			req := NewRequest("action", server.URL, tt.content, &envelopeContentExample{}, nil)
+			req.StreamBody(tt.stream)
+
+			_, err := NewClient(server.Client()).Do(context.Background(), req)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tt.chunked, chunked)
+			assert.Equal(t, tt.received, string(received))
+		})
+	}
+}
+
+func TestRequestClone(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	prototype := NewRequest("action", "http://localhost", nil, nil, nil)
+	prototype.AddHeader(headerExample{Attr1: 1})
+	prototype.SignWith(wsseInfo)
+	prototype.StreamBody(true)
+	prototype.PrefixBody(true)
+	prototype.DeclareNamespace("ex", "urn:example")
+	prototype.OrderHeaders(xml.Name{Local: "headerExample"})
+	prototype.ExpectResponse(xml.Name{Local: "envelopeContentExample"})
+
+	body, resp, fault := &headerExample{}, &envelopeContentExample{}, &headerExample{}
+	clone := prototype.Clone(body, resp, fault)
+
+	assert.Equal(t, "action", clone.action)
+	assert.Equal(t, "http://localhost", clone.url)
+	assert.Equal(t, wsseInfo, clone.wsseInfo)
+	assert.True(t, clone.stream)
+	assert.True(t, clone.prefixBody)
+	assert.Equal(t, xml.Name{Local: "envelopeContentExample"}, clone.expectedResponse)
+	assert.True(t, clone.body == body)
+	assert.True(t, clone.resp == resp)
+	assert.True(t, clone.fault == fault)
+
+	// Headers added to either request don't affect the other.
+	clone.AddHeader(headerExample{Attr1: 2})
+	prototype.AddHeader(headerExample{Attr1: 3})
+	assert.Equal(t, []interface{}{headerExample{Attr1: 1}, headerExample{Attr1: 2}}, clone.headers)
+	assert.Equal(t, []interface{}{headerExample{Attr1: 1}, headerExample{Attr1: 3}}, prototype.headers)
+
+	// Nor do the namespaces declared on either request.
+	clone.DeclareNamespace("ex", "urn:clone")
+	assert.Equal(t, []namespaceDecl{{prefix: "ex", namespace: "urn:clone"}}, clone.namespaces)
+	assert.Equal(t, []namespaceDecl{{prefix: "ex", namespace: "urn:example"}}, prototype.namespaces)
+	assert.Equal(t, prototype.headerOrder, clone.headerOrder)
+}
+
+func TestRequestCloneConcurrent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(requestTestResponse))
+	}))
+	defer server.Close()
+
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	prototype := NewRequest("action", server.URL, nil, nil, nil)
+	prototype.AddHeader(headerExample{Attr1: 1, Value: "shared"})
+	prototype.SignWith(wsseInfo)
+
+	client := NewClient(server.Client())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			resp := &envelopeContentExample{}
+			req := prototype.Clone(&headerExample{Attr1: int32(i)}, resp, nil)
+			req.AddHeader(headerExample{Attr1: int32(i)})
+
+			_, err := client.Do(context.Background(), req)
+			assert.Nil(t, err)
+			assert.Equal(t, int32(10), resp.Attr1)
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Len(t, prototype.headers, 1)
+}
+
+func TestRequestDeclareSchemaNamespaces(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name    string
+		sign    bool
+		declare bool
+	}{
+		{name: "unsigned"},
+		{name: "unsigned declared", declare: true},
+		{name: "signed", sign: true},
+		{name: "signed declared", sign: true, declare: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest("action", "http://localhost", &envelopeContentExample{Attr1: 10}, nil, nil)
+			if tt.sign {
+				req.SignWith(wsseInfo)
+			}
+			if tt.declare {
+				req.DeclareSchemaNamespaces()
+			}
+
+			r, err := req.serialize(serializeOptions{})
+			assert.Nil(t, err)
+			data, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+
+			if tt.declare {
+				assert.Contains(t, string(data), `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">`)
+			} else {
+				assert.NotContains(t, string(data), "XMLSchema")
+			}
+		})
+	}
+}
+
+func TestRequestOrderHeaders(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name       string
+		sign       bool
+		scope      SigningScope
+		addressing bool
+		indent     bool
+		order      []xml.Name
+		want       []string
+	}{
+		{
+			name: "default",
+			want: []string{"First", "Second", "Third"},
+		},
+		{
+			name:  "ordered",
+			order: []xml.Name{{Space: "urn:headers", Local: "Third"}, {Local: "First"}},
+			want:  []string{"Third", "First", "Second"},
+		},
+		{
+			name:   "ordered indented",
+			indent: true,
+			order:  []xml.Name{{Local: "Second"}},
+			want:   []string{"Second", "First", "Third"},
+		},
+		{
+			name:  "other namespace",
+			order: []xml.Name{{Space: "urn:other", Local: "Third"}},
+			want:  []string{"First", "Second", "Third"},
+		},
+		{
+			name: "signed default",
+			sign: true,
+			want: []string{"First", "Second", "Third", "Security"},
+		},
+		{
+			name:  "signed security first",
+			sign:  true,
+			order: []xml.Name{{Space: WSSENamespace, Local: "Security"}},
+			want:  []string{"Security", "First", "Second", "Third"},
+		},
+		{
+			name:  "signed envelope",
+			sign:  true,
+			scope: SignEnvelope,
+			order: []xml.Name{{Local: "Third"}, {Local: "Security"}},
+			want:  []string{"Third", "Security", "First", "Second"},
+		},
+		{
+			name:       "addressing",
+			addressing: true,
+			order:      []xml.Name{{Local: "First"}, {Space: wsaNS, Local: "To"}},
+			want:       []string{"First", "To", "Action", "MessageID", "ReplyTo", "Second", "Third"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest("action", "http://localhost", &envelopeContentExample{Attr1: 10}, nil, nil)
+			req.AddHeader(RawXML(`<First xmlns="urn:headers"/>`))
+			req.AddHeader(RawXML(`<h:Second xmlns:h="urn:headers"/>`))
+			req.AddHeader(RawXML(`<Third xmlns="urn:headers"/>`))
+			if tt.sign {
+				req.SignWith(wsseInfo)
+				req.SignScope(tt.scope)
+			}
+			if tt.addressing {
+				req.UseAddressing()
+			}
+			req.OrderHeaders(tt.order...)
+
+			r, err := req.serialize(serializeOptions{indent: tt.indent})
+			assert.Nil(t, err)
+			data, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+
+			doc := etree.NewDocument()
+			assert.Nil(t, doc.ReadFromBytes(data))
+			var names []string
+			for _, entry := range doc.FindElements("Envelope/Header/*") {
+				names = append(names, entry.Tag)
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+}
+
+func TestRequestActionMode(t *testing.T) {
+	var tests = []struct {
+		name    string
+		mode    SOAPActionMode
+		compat  *compatProfile
+		present bool
+		header  string
+	}{
+		{name: "default", mode: SendAction, present: true, header: "urn:action"},
+		{name: "default quoted", mode: SendAction, compat: wcfProfile, present: true, header: `"urn:action"`},
+		{name: "empty", mode: SendEmptyAction, present: true, header: `""`},
+		{name: "empty quoted", mode: SendEmptyAction, compat: wcfProfile, present: true, header: `""`},
+		{name: "omitted", mode: OmitAction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest("urn:action", "http://localhost", &envelopeContentExample{}, nil, nil)
+			req.SetActionMode(tt.mode)
+
+			header := req.httpHeader(serializeOptions{compat: tt.compat}, "text/xml")
+			values, present := header["Soapaction"]
+			assert.Equal(t, tt.present, present)
+			if tt.present {
+				assert.Equal(t, []string{tt.header}, values)
+			}
+		})
+	}
+}
+
+func TestRequestHTTPMethod(t *testing.T) {
+	var tests = []struct {
+		name     string
+		method   string
+		override string
+		want     string
+	}{
+		{name: "default", want: http.MethodPost},
+		{name: "method", method: http.MethodPut, want: http.MethodPut},
+		{name: "override", override: http.MethodPut, want: http.MethodPost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var method, override string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				method = r.Method
+				override = r.Header.Get("X-HTTP-Method-Override")
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(requestTestResponse))
+			}))
+			defer server.Close()
+
+			req := NewRequest("action", server.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil)
+			req.SetHTTPMethod(tt.method)
+			req.OverrideHTTPMethod(tt.override)
+
+			_, err := NewClient(server.Client()).Do(context.Background(), req)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, method)
+			assert.Equal(t, tt.override, override)
+		})
+	}
+}
+
+func TestRequestOnHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Header>` +
+			`<wsa:RelatesTo xmlns:wsa="http://www.w3.org/2005/08/addressing">urn:uuid:1</wsa:RelatesTo>` +
+			`<HeaderExample attr1="15">custom</HeaderExample>` +
+			`</s:Header><s:Body><ContentExample attr1="10"></ContentExample></s:Body></s:Envelope>`))
+	}))
+	defer ts.Close()
+
+	var relatesTo envelopeExtension
+	var header headerExample
+	req := NewRequest("action", ts.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil)
+	req.OnHeader(xml.Name{Space: wsaNS, Local: "RelatesTo"}, &relatesTo)
+	req.OnHeader(xml.Name{Local: "HeaderExample"}, &header)
+
+	resp, err := NewClient(nil).Do(context.Background(), req)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "urn:uuid:1", relatesTo.Value)
+		assert.Equal(t, headerExample{XMLName: xml.Name{Local: "HeaderExample"}, Attr1: 15, Value: "custom"}, header)
+		assert.Len(t, resp.Headers(), 2)
+	}
+}
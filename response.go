@@ -1,26 +1,75 @@
 package soap
 
 import (
+	"bufio"
 	"encoding/xml"
+	"io"
 	"mime"
 	"net/http"
 	"strings"
 )
 
 // Response contains the result of the request.
+// The HTTP response body is read and closed before Client.Do returns, whether decoding succeeded or not, including
+// when attachments are streamed to an AttachmentHandler, so a Response never holds on to a connection and needn't be
+// closed.
 type Response struct {
 	*http.Response
 
 	body        interface{}
 	fault       *Fault
+	header      *Header
 	faultDetail interface{}
+	attachments AttachmentHandler
+	progress    ProgressFunc
+	compat      *compatProfile
+	// expected is the name of the element expected in the body, if set.
+	expected xml.Name
+	// headerTargets are the values header entries are decoded into, by element name.
+	headerTargets map[xml.Name]interface{}
+
+	// envelopeNS, if set, is accepted in place of the envelope namespace.
+	envelopeNS string
+	// lenientContentType assumes a text/xml response if the Content-Type header is missing or malformed.
+	lenientContentType bool
+	// lenientMultipart repairs the framing of malformed multipart responses.
+	lenientMultipart bool
+	// multipartBuffering is how the body of multipart responses is buffered as it is read.
+	multipartBuffering multipartBuffering
+	// emptyResponses accepts successful responses with an empty body.
+	emptyResponses bool
+	// invalidChars, if set, is how illegal characters are filtered out of the response before it is decoded.
+	invalidChars InvalidCharMode
+	// lenientUTF8 replaces invalid UTF-8 in the response before it is decoded, counting the bytes in invalidUTF8.
+	lenientUTF8 bool
+	invalidUTF8 int
+	// entities, if set, are the entities beyond those predefined by XML which are replaced before decoding.
+	entities map[string]string
+	// limits are the limits the response is checked against as it is decoded.
+	limits decodeLimits
+	// strictNamespaces checks the namespaces of the elements of the body against those of the response type.
+	strictNamespaces bool
+	// verifyCert, if set, makes the signature of the response be verified, trusting the certificates it accepts.
+	verifyCert CertificateVerifier
+	// signedTimestamp requires the timestamp of the response, if any, to be signed when its signature is verified.
+	signedTimestamp bool
+
+	// mediaType and mediaParams are parsed from the Content-Type header as the response is deserialized.
+	mediaType   string
+	mediaParams map[string]string
 }
 
-func newResponse(httpResp *http.Response, req *Request) *Response {
+func newResponse(httpResp *http.Response, req *Request, compat *compatProfile) *Response {
 	return &Response{
 		Response:    httpResp,
 		body:        req.resp,
 		faultDetail: req.fault,
+		attachments: req.attachments,
+		progress:    req.progress,
+		compat:      compat,
+		expected:    req.expectedResponse,
+
+		headerTargets: req.headerTargets,
 	}
 }
 
@@ -34,32 +83,243 @@ func (r *Response) Fault() *Fault {
 	return r.fault
 }
 
+// Headers returns the entries of the SOAP header, in the order they were received, or nil if there were none.
+// Each entry holds its name and the element itself, so that headers which weren't anticipated, such as notices
+// of rate limits or deprecation, can be detected and decoded.
+func (r *Response) Headers() []HeaderEntry {
+	if r.header == nil {
+		return nil
+	}
+	return r.header.Entries
+}
+
+// MediaType returns the media type of the response, parsed from its Content-Type header and in lower case, e.g.
+// "multipart/related". With WithLenientContentType, it is the media type the response was decoded as, which is
+// "text/xml" if the header was missing or malformed. It is empty if the header couldn't be parsed.
+func (r *Response) MediaType() string {
+	return r.mediaType
+}
+
+// MediaParams returns the parameters of the Content-Type header of the response, keyed by their name in lower case,
+// e.g. the boundary, start, type and start-info of multipart responses, the charset, or the action of SOAP 1.2
+// responses. It is nil if the header had no parameters or they couldn't be parsed, and mustn't be modified.
+func (r *Response) MediaParams() map[string]string {
+	return r.mediaParams
+}
+
 func (r *Response) deserialize() error {
+	// The media type is parsed first, so that it is available even for responses without an envelope.
 	mediaType, mediaParams, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
-	if err != nil {
+	if err != nil && r.lenientContentType {
+		// The media type is still returned if only the parameters are malformed.
+		if err != mime.ErrInvalidMediaParameter || mediaType == "" {
+			mediaType = "text/xml"
+		}
+	} else if err != nil {
+		mediaType = ""
+	}
+	r.mediaType, r.mediaParams = mediaType, mediaParams
+
+	// One-way messages are accepted without a response envelope.
+	if r.StatusCode == http.StatusAccepted && r.ContentLength == 0 {
+		return nil
+	}
+
+	var body io.Reader = r.Response.Body
+	if r.acceptsEmpty() {
+		var empty bool
+		var err error
+		if body, empty, err = peekEmpty(body, r.ContentLength); err != nil || empty {
+			return err
+		}
+	}
+
+	if err != nil && !r.lenientContentType {
 		return err
 	}
 
 	envelope := NewEnvelopeWithFault(r.body, r.faultDetail)
+	envelope.Body.expected = r.expected
+	envelope.Body.strictNamespaces = r.strictNamespaces
+	if len(r.headerTargets) > 0 {
+		envelope.Header = &Header{targets: r.headerTargets}
+	}
 
-	if strings.HasPrefix(mediaType, "multipart/") {
-		// Here we handle any SOAP requests embedded in a MIME multipart response.
-		err = newXopDecoder(r.Response.Body, mediaParams).decode(envelope)
-	} else if strings.Contains(mediaType, "text/xml") {
-		// This is normal SOAP XML response handling.
-		err = xml.NewDecoder(r.Response.Body).Decode(&envelope)
-	} else {
-		err = ErrUnsupportedContentType
+	if r.progress != nil {
+		body = &progressReader{r: body, total: r.ContentLength, progress: r.progress}
 	}
 
-	if err != nil {
+	// Responses may be very large and arrive slowly, as when using chunked transfer encoding, so they're decoded as
+	// they are received, unless their signature must be verified first.
+	decoder := bodyDecoder{
+		compat:      r.compat,
+		envelopeNS:  r.envelopeNS,
+		attachments: r.attachments,
+
+		lenientMultipart:   r.lenientMultipart,
+		multipartBuffering: r.multipartBuffering,
+		invalidChars:       r.invalidChars,
+		entities:           r.entities,
+		limits:             r.limits,
+		verifyCert:         r.verifyCert,
+		signedTimestamp:    r.signedTimestamp,
+	}
+	if r.lenientUTF8 {
+		decoder.invalidUTF8 = &r.invalidUTF8
+	}
+	if err := decoder.decode(body, mediaType, mediaParams, envelope); err != nil {
 		return err
 	}
 
 	// Propagate the changes from parsing the envelope to the response struct
+	r.header = envelope.Header
 	if envelope.Body.Fault != nil {
 		r.fault = envelope.Body.Fault
 	}
 
 	return nil
 }
+
+// acceptsEmpty checks whether the response may have an empty body: it must be successful, and either the request
+// expects no response or the client accepts empty responses.
+func (r *Response) acceptsEmpty() bool {
+	return r.StatusCode >= 200 && r.StatusCode < 300 && (r.body == nil || r.emptyResponses)
+}
+
+// peekEmpty checks whether the body of the given length, which is -1 if unknown, is empty, returning a reader for the
+// whole body.
+func peekEmpty(body io.Reader, length int64) (io.Reader, bool, error) {
+	if length >= 0 {
+		return body, length == 0, nil
+	}
+
+	buffered := bufio.NewReader(body)
+	if _, err := buffered.Peek(1); err == io.EOF {
+		return buffered, true, nil
+	} else if err != nil {
+		return buffered, false, err
+	}
+	return buffered, false, nil
+}
+
+// bodyDecoder decodes envelopes from message bodies, according to their media type.
+type bodyDecoder struct {
+	// compat is the compatibility profile applied to XML bodies, if any.
+	compat *compatProfile
+	// envelopeNS, if set, is accepted in place of the envelope namespace.
+	envelopeNS string
+	// attachments, if set, is handed the binary parts of multipart bodies.
+	attachments AttachmentHandler
+	// lenientMultipart repairs the framing of multipart bodies before decoding them.
+	lenientMultipart bool
+	// multipartBuffering is how multipart bodies are buffered as they are read.
+	multipartBuffering multipartBuffering
+	// invalidChars, if set, is how illegal characters are filtered out of XML bodies, or the root part of multipart
+	// bodies, before decoding them.
+	invalidChars InvalidCharMode
+	// invalidUTF8, if set, makes the bytes of XML bodies, or of the root part of multipart bodies, which aren't valid
+	// UTF-8 be replaced before decoding them, counting them in it.
+	invalidUTF8 *int
+	// entities, if set, are the entities beyond those predefined by XML which are replaced in XML bodies, or the root
+	// part of multipart bodies, before decoding them.
+	entities map[string]string
+	// limits are the limits XML bodies, or the root part of multipart bodies, are checked against as they are decoded.
+	limits decodeLimits
+	// verifyCert, if set, makes the signature of XML bodies, or of the root part of multipart bodies, be verified
+	// before decoding them, trusting the certificates it accepts.
+	verifyCert CertificateVerifier
+	// signedTimestamp requires the timestamp in the security header, if any, to be signed when verifying signatures.
+	signedTimestamp bool
+}
+
+// decode decodes the envelope from body, a message of the media type with the parameters.
+func (d bodyDecoder) decode(body io.Reader, mediaType string, mediaParams map[string]string, envelope *Envelope) error {
+	if isXMLMediaType(mediaType) {
+		body = d.repairXML(body)
+	}
+
+	switch {
+	case strings.HasPrefix(mediaType, "multipart/"):
+		// Here we handle any SOAP requests embedded in a MIME multipart response.
+		decoder := newXopDecoder(body, mediaParams)
+		decoder.attachments = d.attachments
+		decoder.envelopeNS = d.envelopeNS
+		decoder.lenient = d.lenientMultipart
+		decoder.buffering = d.multipartBuffering
+		decoder.repair = d.repairXML
+		decoder.limits = d.limits
+		decoder.verifyCert = d.verifyCert
+		decoder.signedTimestamp = d.signedTimestamp
+		return decoder.decode(envelope)
+	case isXMLMediaType(mediaType) && d.verifyCert == nil:
+		br := getReader(body)
+		defer putReader(br)
+
+		return d.compat.decodeResponse(br, envelope, d.envelopeNS, d.limits)
+	case isXMLMediaType(mediaType):
+		// The signature covers the raw bytes, so the body is read in full into a pooled buffer, which the decoder then
+		// reads from directly rather than buffering it again.
+		buf := getBuffer()
+		defer putBuffer(buf)
+
+		if _, err := buf.ReadFrom(body); err != nil {
+			return err
+		}
+		if d.verifyCert != nil {
+			if err := verifyEnvelope(buf.Bytes(), d.verifyCert, d.signedTimestamp); err != nil {
+				return err
+			}
+		}
+		return d.compat.decodeResponse(buf, envelope, d.envelopeNS, d.limits)
+	}
+	return ErrUnsupportedContentType
+}
+
+// repairXML wraps the reader of an XML document with the readers repairing it before it is decoded, if any: invalid
+// UTF-8 is replaced first, so that the others read valid UTF-8, then entities, then illegal characters, including
+// any the entities stand for.
+func (d bodyDecoder) repairXML(r io.Reader) io.Reader {
+	if d.invalidUTF8 != nil {
+		r = newUTF8Reader(r, d.invalidUTF8)
+	}
+	if len(d.entities) > 0 {
+		r = newEntityReader(r, d.entities)
+	}
+	if d.invalidChars != 0 {
+		r = newInvalidCharReader(r, d.invalidChars)
+	}
+	return r
+}
+
+// ProgressFunc is called with the number of bytes of the response body read so far, and the total size of the body,
+// which is -1 if the response didn't specify it.
+type ProgressFunc func(read int64, total int64)
+
+// progressReader reports the progress of reading from r.
+type progressReader struct {
+	r        io.Reader
+	read     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.read += int64(n)
+		p.progress(p.read, p.total)
+	}
+	return n, err
+}
+
+// isXMLMediaType returns whether the media type is one used for XML documents: text/xml, application/xml,
+// or an application/*+xml type such as application/soap+xml.
+func isXMLMediaType(mediaType string) bool {
+	switch {
+	case mediaType == "text/xml", mediaType == "application/xml":
+		return true
+	case strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	return false
+}
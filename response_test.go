@@ -0,0 +1,434 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResponseDeserializeContentType(t *testing.T) {
+	var tests = []struct {
+		contentType string
+		err         error
+	}{
+		{contentType: "text/xml"},
+		{contentType: `text/xml; charset="utf-8"`},
+		{contentType: "application/xml"},
+		{contentType: "Application/XML; charset=utf-8"},
+		{contentType: "application/soap+xml; charset=utf-8"},
+		{contentType: "application/vnd.example+xml"},
+		{contentType: "application/json", err: ErrUnsupportedContentType},
+		{contentType: "text/html", err: ErrUnsupportedContentType},
+		{contentType: "application/xml-dtd", err: ErrUnsupportedContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			httpResp := &http.Response{
+				Header: http.Header{"Content-Type": []string{tt.contentType}},
+				Body:   ioutil.NopCloser(strings.NewReader(requestTestResponse)),
+			}
+			content := &envelopeContentExample{}
+			resp := newResponse(httpResp, NewRequest("action", "http://localhost", nil, content, nil), nil)
+
+			err := resp.deserialize()
+			assert.Equal(t, tt.err, err)
+			if tt.err == nil {
+				assert.Equal(t, int32(10), content.Attr1)
+			}
+		})
+	}
+}
+
+func TestResponseDeserializeLenientContentType(t *testing.T) {
+	var tests = []struct {
+		name        string
+		contentType string
+		lenient     bool
+		err         string
+	}{
+		{name: "missing", contentType: "", err: "mime: no media type"},
+		{name: "missing lenient", contentType: "", lenient: true},
+		{name: "duplicate charset", contentType: "text/xml; charset=utf-8; charset=iso-8859-1", err: "mime: duplicate parameter name"},
+		{name: "duplicate charset lenient", contentType: "text/xml; charset=utf-8; charset=iso-8859-1", lenient: true},
+		{name: "malformed parameter lenient", contentType: "application/xml; charset", lenient: true},
+		{name: "malformed type lenient", contentType: "text/xml charset=utf-8", lenient: true},
+		{name: "unsupported lenient", contentType: "application/json", lenient: true, err: ErrUnsupportedContentType.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpResp := &http.Response{
+				Header: http.Header{"Content-Type": []string{tt.contentType}},
+				Body:   ioutil.NopCloser(strings.NewReader(requestTestResponse)),
+			}
+			content := &envelopeContentExample{}
+			resp := newResponse(httpResp, NewRequest("action", "http://localhost", nil, content, nil), nil)
+			resp.lenientContentType = tt.lenient
+
+			err := resp.deserialize()
+			if tt.err != "" {
+				if assert.NotNil(t, err) {
+					assert.Equal(t, tt.err, err.Error())
+				}
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, int32(10), content.Attr1)
+		})
+	}
+}
+
+func TestResponseMediaType(t *testing.T) {
+	var tests = []struct {
+		name        string
+		contentType string
+		lenient     bool
+		mediaType   string
+		mediaParams map[string]string
+	}{
+		{name: "plain", contentType: "text/xml", mediaType: "text/xml", mediaParams: map[string]string{}},
+		{
+			name:        "soap 1.2",
+			contentType: `Application/SOAP+XML; Charset=utf-8; action="urn:action"`,
+			mediaType:   "application/soap+xml",
+			mediaParams: map[string]string{"charset": "utf-8", "action": "urn:action"},
+		},
+		{name: "malformed", contentType: "text/xml charset=utf-8"},
+		{name: "malformed lenient", contentType: "text/xml charset=utf-8", lenient: true, mediaType: "text/xml"},
+		{name: "missing lenient", lenient: true, mediaType: "text/xml"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpResp := &http.Response{
+				Header: http.Header{"Content-Type": []string{tt.contentType}},
+				Body:   ioutil.NopCloser(strings.NewReader(requestTestResponse)),
+			}
+			resp := newResponse(httpResp, NewRequest("action", "http://localhost", nil, &envelopeContentExample{}, nil), nil)
+			resp.lenientContentType = tt.lenient
+
+			_ = resp.deserialize()
+			assert.Equal(t, tt.mediaType, resp.MediaType())
+			assert.Equal(t, tt.mediaParams, resp.MediaParams())
+		})
+	}
+}
+
+func TestResponseDeserializeEmpty(t *testing.T) {
+	var tests = []struct {
+		name          string
+		statusCode    int
+		contentLength int64
+		body          string
+		noRespType    bool
+		accept        bool
+		decoded       bool
+		err           bool
+	}{
+		{name: "no response type", statusCode: http.StatusOK, noRespType: true},
+		{name: "no response type, unknown length", statusCode: http.StatusOK, contentLength: -1, noRespType: true},
+		{name: "accepted by client", statusCode: http.StatusOK, accept: true},
+		{name: "accepted by client, unknown length", statusCode: http.StatusOK, contentLength: -1, accept: true},
+		{name: "not accepted", statusCode: http.StatusOK, err: true},
+		{name: "error status", statusCode: http.StatusInternalServerError, noRespType: true, err: true},
+		{name: "not empty", statusCode: http.StatusOK, contentLength: -1, body: requestTestResponse, accept: true, decoded: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpResp := &http.Response{
+				StatusCode:    tt.statusCode,
+				ContentLength: tt.contentLength,
+				Header:        http.Header{"Content-Type": []string{"text/xml"}},
+				Body:          ioutil.NopCloser(strings.NewReader(tt.body)),
+			}
+			var content *envelopeContentExample
+			var respType interface{}
+			if !tt.noRespType {
+				content = &envelopeContentExample{}
+				respType = content
+			}
+			resp := newResponse(httpResp, NewRequest("action", "http://localhost", nil, respType, nil), nil)
+			resp.emptyResponses = tt.accept
+
+			err := resp.deserialize()
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Nil(t, resp.Fault())
+			if tt.decoded {
+				assert.Equal(t, int32(10), content.Attr1)
+			}
+		})
+	}
+}
+
+func TestResponseDeserializeExpected(t *testing.T) {
+	var tests = []struct {
+		name     string
+		expected xml.Name
+		body     string
+		err      error
+		fault    bool
+	}{
+		{name: "not set", body: requestTestResponse},
+		{name: "local name", expected: xml.Name{Local: "ContentExample"}, body: requestTestResponse},
+		{
+			name:     "qualified name",
+			expected: xml.Name{Space: "urn:example", Local: "ContentExample"},
+			body:     `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><ContentExample xmlns="urn:example" attr1="10"/></Body></Envelope>`,
+		},
+		{
+			name:     "other element",
+			expected: xml.Name{Local: "ContentExample"},
+			body:     `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><OtherResponse attr1="10"/></Body></Envelope>`,
+			err:      &UnexpectedResponseError{Expected: xml.Name{Local: "ContentExample"}, Name: xml.Name{Space: soapEnvNS, Local: "OtherResponse"}},
+		},
+		{
+			name:     "other namespace",
+			expected: xml.Name{Space: "urn:example", Local: "ContentExample"},
+			body:     `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><ContentExample xmlns="urn:other" attr1="10"/></Body></Envelope>`,
+			err:      &UnexpectedResponseError{Expected: xml.Name{Space: "urn:example", Local: "ContentExample"}, Name: xml.Name{Space: "urn:other", Local: "ContentExample"}},
+		},
+		{
+			name:     "empty body",
+			expected: xml.Name{Local: "ContentExample"},
+			body:     `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body></Body></Envelope>`,
+			err:      &UnexpectedResponseError{Expected: xml.Name{Local: "ContentExample"}},
+		},
+		{
+			name:     "fault",
+			expected: xml.Name{Local: "ContentExample"},
+			body:     `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Fault><faultcode>Server</faultcode></Fault></Body></Envelope>`,
+			fault:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpResp := &http.Response{
+				StatusCode:    http.StatusOK,
+				ContentLength: int64(len(tt.body)),
+				Header:        http.Header{"Content-Type": []string{"text/xml"}},
+				Body:          ioutil.NopCloser(strings.NewReader(tt.body)),
+			}
+			content := &envelopeContentExample{}
+			req := NewRequest("action", "http://localhost", nil, content, nil)
+			req.ExpectResponse(tt.expected)
+
+			resp := newResponse(httpResp, req, nil)
+			err := resp.deserialize()
+			assert.Equal(t, tt.err, err)
+			if err != nil {
+				return
+			}
+			if tt.fault {
+				assert.NotNil(t, resp.Fault())
+			} else {
+				assert.Equal(t, int32(10), content.Attr1)
+			}
+		})
+	}
+}
+
+func TestUnexpectedResponseError(t *testing.T) {
+	err := &UnexpectedResponseError{Expected: xml.Name{Space: "urn:example", Local: "GetQuoteResponse"}, Name: xml.Name{Local: "Error"}}
+	assert.Equal(t, "expected response element {urn:example}GetQuoteResponse, got Error", err.Error())
+
+	err = &UnexpectedResponseError{Expected: xml.Name{Local: "GetQuoteResponse"}}
+	assert.Equal(t, "expected response element GetQuoteResponse, got an empty body", err.Error())
+}
+
+func TestResponseBodyClosed(t *testing.T) {
+	var bodies []*trackingBody
+	client := NewClient(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		body := &trackingBody{Reader: strings.NewReader(requestTestResponse)}
+		bodies = append(bodies, body)
+		return &http.Response{
+			StatusCode:    http.StatusOK,
+			Header:        http.Header{"Content-Type": []string{"text/xml"}},
+			ContentLength: -1,
+			Body:          body,
+		}, nil
+	})})
+
+	resp, err := client.Do(context.Background(), NewRequest("action", "http://localhost", &envelopeContentExample{}, &envelopeContentExample{}, nil))
+	if !assert.Nil(t, err) || !assert.Len(t, bodies, 1) {
+		return
+	}
+
+	// The body is consumed and closed by Do, so the response holds nothing to be released.
+	assert.NotNil(t, resp)
+	assert.True(t, bodies[0].closed)
+	assert.Equal(t, 0, bodies[0].Len())
+}
+
+type progressTestExport struct {
+	XMLName xml.Name          `xml:"Export"`
+	Rows    []progressTestRow `xml:"Row"`
+}
+
+// progressTestRow signals the first time a row is decoded, to check decoding starts before the response is complete.
+type progressTestRow struct {
+	Value string `xml:",chardata"`
+}
+
+var progressTestDecoded = make(chan struct{}, 1)
+
+func (r *progressTestRow) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	select {
+	case progressTestDecoded <- struct{}{}:
+	default:
+	}
+	var value string
+	if err := d.DecodeElement(&value, &start); err != nil {
+		return err
+	}
+	r.Value = value
+	return nil
+}
+
+func TestResponseProgress(t *testing.T) {
+	const head = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><Export><Row>1</Row>`
+	const tail = `<Row>2</Row><Row>3</Row></Export></Body></Envelope>`
+
+	var tests = []struct {
+		name    string
+		chunked bool
+	}{
+		{name: "chunked", chunked: true},
+		{name: "content length", chunked: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Drain any signal left over by a previous case.
+			select {
+			case <-progressTestDecoded:
+			default:
+			}
+
+			early := make(chan bool, 1)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				if !tt.chunked {
+					w.Header().Set("Content-Length", strconv.Itoa(len(head)+len(tail)))
+				}
+				w.Write([]byte(head))
+				w.(http.Flusher).Flush()
+
+				// The rest is only sent once the first row has been decoded, or after a timeout.
+				select {
+				case <-progressTestDecoded:
+					early <- true
+				case <-time.After(200 * time.Millisecond):
+					early <- false
+				}
+				w.Write([]byte(tail))
+			}))
+			defer server.Close()
+
+			var reads []int64
+			var totals []int64
+			export := &progressTestExport{}
+			req := NewRequest("action", server.URL, &envelopeContentExample{}, export, nil)
+			req.OnProgress(func(read int64, total int64) {
+				reads = append(reads, read)
+				totals = append(totals, total)
+			})
+
+			_, err := NewClient(server.Client()).Do(context.Background(), req)
+			assert.Nil(t, err)
+			assert.Len(t, export.Rows, 3)
+			// Responses are decoded as they are received, whether or not their length is known.
+			assert.True(t, <-early)
+
+			if assert.NotEmpty(t, reads) {
+				assert.Equal(t, int64(len(head)+len(tail)), reads[len(reads)-1])
+				for i := 1; i < len(reads); i++ {
+					assert.True(t, reads[i] > reads[i-1])
+				}
+			}
+			wantTotal := int64(len(head) + len(tail))
+			if tt.chunked {
+				wantTotal = -1
+			}
+			for _, total := range totals {
+				assert.Equal(t, wantTotal, total)
+			}
+		})
+	}
+}
+
+func TestResponseHeaders(t *testing.T) {
+	var tests = []struct {
+		name  string
+		in    string
+		names []xml.Name
+	}{
+		{
+			name: "no header",
+			in:   `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><ContentExample attr1="10"></ContentExample></soap:Body></soap:Envelope>`,
+		},
+		{
+			name: "entries",
+			in: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:n="urn:notices">` +
+				`<soap:Header><n:RateLimit remaining="5"><n:Reset>60</n:Reset></n:RateLimit><Deprecated xmlns="urn:other">v1</Deprecated></soap:Header>` +
+				`<soap:Body><ContentExample attr1="10"></ContentExample></soap:Body></soap:Envelope>`,
+			names: []xml.Name{{Space: "urn:notices", Local: "RateLimit"}, {Space: "urn:other", Local: "Deprecated"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			httpResp := &http.Response{
+				Header: http.Header{"Content-Type": []string{"text/xml"}},
+				Body:   ioutil.NopCloser(strings.NewReader(tt.in)),
+			}
+			content := &envelopeContentExample{}
+			resp := newResponse(httpResp, NewRequest("action", "http://localhost", nil, content, nil), nil)
+			if !assert.Nil(t, resp.deserialize()) {
+				return
+			}
+			assert.Equal(t, int32(10), content.Attr1)
+
+			var names []xml.Name
+			for _, entry := range resp.Headers() {
+				names = append(names, entry.Name)
+			}
+			assert.Equal(t, tt.names, names)
+		})
+	}
+}
+
+func TestResponseHeadersRaw(t *testing.T) {
+	in := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:n="urn:notices">` +
+		`<soap:Header><n:RateLimit remaining="5"><n:Reset>60</n:Reset></n:RateLimit></soap:Header>` +
+		`<soap:Body><ContentExample attr1="10"></ContentExample></soap:Body></soap:Envelope>`
+
+	envelope, err := DecodeEnvelope([]byte(in), &envelopeContentExample{}, nil)
+	if !assert.Nil(t, err) || !assert.Len(t, envelope.Header.Entries, 1) {
+		return
+	}
+
+	// The prefix declared on the envelope isn't needed to decode the entry.
+	var rateLimit struct {
+		XMLName   xml.Name `xml:"urn:notices RateLimit"`
+		Remaining int      `xml:"remaining,attr"`
+		Reset     int      `xml:"urn:notices Reset"`
+	}
+	assert.Nil(t, xml.Unmarshal(envelope.Header.Entries[0].Raw, &rateLimit))
+	assert.Equal(t, 5, rateLimit.Remaining)
+	assert.Equal(t, 60, rateLimit.Reset)
+}
@@ -0,0 +1,213 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Implements the retrying of requests which failed for reasons which may be transient, such as connection failures.
+
+// DefaultRetryStatusCodes are the HTTP status codes of the responses retried by a RetryPolicy which doesn't set its own:
+// the errors of gateways and proxies in front of the service. 500 isn't included, as SOAP 1.1 faults are sent with it.
+var DefaultRetryStatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// StatusError is returned when the service responds with one of the status codes retried by the RetryPolicy of a
+// Client to a request which may be retried, and no attempts remain. The body of such responses isn't decoded.
+type StatusError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("request failed with status: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Unwrap returns the category of the error, ErrTransport.
+func (e *StatusError) Unwrap() error {
+	return ErrTransport
+}
+
+// RetryPolicy configures the retrying of requests which failed for reasons which may be transient. Each attempt
+// serializes the request again, so signatures, timestamps and message IDs are fresh for every attempt.
+//
+// As a request may have been processed by the service even though it failed, only requests marked idempotent (see
+// Request.MarkIdempotent) are retried, unless the connection to the service couldn't be established at all, or the
+// service throttled the request and RetryThrottled is set.
+// Requests with parts (see Request.AddPart) are never retried, as their content can only be read once, nor are
+// requests whose response type has fields XOP parts are streamed into (see DecodeXOP), as a part written into such a
+// field by a failed attempt can't be taken back.
+type RetryPolicy struct {
+	// MaxAttempts is the most attempts made for a request, including the first. Values below 2 disable retries.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, which doubles with each further retry.
+	Backoff time.Duration
+	// MaxBackoff is the longest delay between attempts, or 0 for no maximum.
+	MaxBackoff time.Duration
+	// Jitter is the fraction of each delay, between 0 and 1, which is randomized, so that clients failing at the same
+	// time don't retry at the same time: a delay d is replaced with a random delay between d*(1-Jitter) and d.
+	Jitter float64
+	// StatusCodes are the HTTP status codes of the responses which are retried, DefaultRetryStatusCodes if nil.
+	StatusCodes []int
+	// FaultCodes are the codes of the SOAP faults which are retried, such as those the service returns when a backend
+	// is unavailable. Each is compared with the fault code without its prefix, as well as with the whole fault code.
+	FaultCodes []string
+	// RetryThrottled retries requests throttled by the service, which are those whose response has a 429 Too Many
+	// Requests or 503 Service Unavailable status, or is a fault with one of ThrottleFaultCodes. Throttled requests
+	// weren't processed by the service, so they are retried whether or not they are idempotent, and a throttled
+	// response which is the last attempt is returned as a ThrottledError. The delay indicated by the Retry-After header
+	// of the response is used in place of the backoff, if there is one.
+	RetryThrottled bool
+	// ThrottleFaultCodes are the codes of the SOAP faults the service returns when it throttles requests, for services
+	// which signal throttling with a fault rather than an HTTP status. They are compared as FaultCodes are.
+	ThrottleFaultCodes []string
+}
+
+// WithRetryPolicy retries requests which fail due to connection errors, or with the status codes or fault codes of
+// the policy, as configured by the policy. Retries are made within the deadline of the context: if the delay before
+// the next attempt would pass the deadline, the last failure is returned without waiting.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retryPolicy = policy
+	}
+}
+
+// retries checks whether the request may be retried once it has been sent, in which case responses with the status
+// codes retried by the policy are returned as a StatusError rather than being decoded.
+func (c *Client) retries(req *Request) bool {
+	return c.retryPolicy.MaxAttempts > 1 && req.idempotent && req.replayable()
+}
+
+// throttles checks whether responses showing that the service throttled a request are returned as a ThrottledError
+// rather than being decoded.
+func (p RetryPolicy) throttles() bool {
+	return p.MaxAttempts > 1 && p.RetryThrottled
+}
+
+// replayable checks whether the request may be sent again by a retry: its parts can only be read once, and the parts
+// of the response streamed into writer fields by an attempt can't be taken back.
+func (r *Request) replayable() bool {
+	return len(r.parts) == 0 && !hasWriterFields(r.resp)
+}
+
+// retryStatus checks whether responses with the status code are retried.
+func (p RetryPolicy) retryStatus(code int) bool {
+	codes := p.StatusCodes
+	if codes == nil {
+		codes = DefaultRetryStatusCodes
+	}
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the delay before the attempt following the one numbered attempt, starting at 1.
+func (p RetryPolicy) delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || delay < p.MaxBackoff); i++ {
+		delay *= 2
+	}
+	if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if jitter := int64(float64(delay) * p.Jitter); jitter > 0 {
+		delay -= time.Duration(rand.Int63n(jitter + 1))
+	}
+	return delay
+}
+
+// doRetried performs the request with perform, retrying it as configured by the retry policy of the client. Each
+// attempt decodes into its own copies of the response and fault types and of the header targets, and only those of
+// the attempt whose outcome is returned are copied into the ones of the request, so that nothing decoded by a failed
+// attempt remains.
+func (c *Client) doRetried(ctx context.Context, req *Request, perform func(req *Request) (*Response, error)) (*Response, error) {
+	policy := c.retryPolicy
+	for attempt := 1; ; attempt++ {
+		attemptReq := req.attempt()
+		resp, err := perform(attemptReq)
+
+		done := attempt >= policy.MaxAttempts || ctx.Err() != nil || !c.retryable(req, resp, err)
+		var delay time.Duration
+		if !done {
+			if delay = c.retryAfter(resp, err); delay <= 0 {
+				delay = policy.delay(attempt)
+			}
+			deadline, ok := ctx.Deadline()
+			done = ok && time.Now().Add(delay).After(deadline)
+		}
+		if done {
+			if resp != nil {
+				resp = adoptResult(req, attemptReq, resp)
+			}
+			return resp, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// retryable checks whether the outcome of an attempt of the request may be retried.
+func (c *Client) retryable(req *Request, resp *Response, err error) bool {
+	policy := c.retryPolicy
+	if err == nil {
+		if resp == nil || resp.Fault() == nil {
+			return false
+		}
+		fault := resp.Fault()
+		return (policy.RetryThrottled && hasFaultCode(fault, policy.ThrottleFaultCodes)) ||
+			(req.idempotent && hasFaultCode(fault, policy.FaultCodes))
+	}
+
+	var throttledErr *ThrottledError
+	if errors.As(err, &throttledErr) {
+		return true
+	}
+	if !errors.Is(err, ErrTransport) {
+		return false
+	}
+	return req.idempotent || dialFailed(err)
+}
+
+// hasFaultCode checks whether the code of the fault is one of codes, each being compared with the fault code without
+// its prefix, i.e. "Throttled" matches a fault code of "s:Throttled", as well as with the whole fault code.
+func hasFaultCode(fault *Fault, codes []string) bool {
+	for _, code := range codes {
+		if code == fault.Code || code == fault.CodeName.Local {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter returns the delay the service asked for in the Retry-After header of a response showing that it throttled
+// the request, or 0 if it didn't ask for one or the request wasn't throttled.
+func (c *Client) retryAfter(resp *Response, err error) time.Duration {
+	var throttledErr *ThrottledError
+	if errors.As(err, &throttledErr) {
+		return throttledErr.RetryAfter
+	}
+	if err == nil && resp != nil && resp.Fault() != nil && hasFaultCode(resp.Fault(), c.retryPolicy.ThrottleFaultCodes) {
+		return parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return 0
+}
+
+// dialFailed checks whether the error is a failure to establish the connection to the service, in which case the
+// request can't have been sent.
+func dialFailed(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
@@ -0,0 +1,250 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, FaultCodes: []string{"Unavailable"}}
+
+	var tests = []struct {
+		name          string
+		policy        RetryPolicy
+		notIdempotent bool
+		fail          func(w http.ResponseWriter)
+		failures      int32
+		attempts      int32
+		statusCode    int
+		err           bool
+	}{
+		{
+			name:   "bad gateway",
+			policy: policy,
+			fail: func(w http.ResponseWriter) {
+				http.Error(w, "bad gateway", http.StatusBadGateway)
+			},
+			failures: 2,
+			attempts: 3,
+		},
+		{
+			name:   "attempts exhausted",
+			policy: policy,
+			fail: func(w http.ResponseWriter) {
+				http.Error(w, "timeout", http.StatusGatewayTimeout)
+			},
+			failures:   5,
+			attempts:   3,
+			statusCode: http.StatusGatewayTimeout,
+		},
+		{
+			name:   "fault",
+			policy: policy,
+			fail: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><s:Fault><faultcode>s:Unavailable</faultcode><faultstring>Backend down</faultstring><detail><ContentExample attr1="2"></ContentExample></detail></s:Fault></s:Body></s:Envelope>`, soapEnvNS)
+			},
+			failures: 1,
+			attempts: 2,
+		},
+		{
+			name:   "status not retried",
+			policy: RetryPolicy{MaxAttempts: 3, StatusCodes: []int{http.StatusBadGateway}},
+			fail: func(w http.ResponseWriter) {
+				http.Error(w, "timeout", http.StatusGatewayTimeout)
+			},
+			failures: 1,
+			attempts: 1,
+			err:      true,
+		},
+		{
+			name:          "not idempotent",
+			policy:        policy,
+			notIdempotent: true,
+			fail: func(w http.ResponseWriter) {
+				http.Error(w, "bad gateway", http.StatusBadGateway)
+			},
+			failures: 1,
+			attempts: 1,
+			err:      true,
+		},
+		{
+			name: "disabled",
+			fail: func(w http.ResponseWriter) {
+				http.Error(w, "bad gateway", http.StatusBadGateway)
+			},
+			failures: 1,
+			attempts: 1,
+			err:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) <= tt.failures {
+					tt.fail(w)
+					return
+				}
+				w.Header().Set("Content-Type", "text/xml")
+				fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><ContentExample attr1="1"></ContentExample></s:Body></s:Envelope>`, soapEnvNS)
+			}))
+			defer ts.Close()
+
+			content := &envelopeContentExample{}
+			detail := &envelopeContentExample{}
+			req := NewRequest("action", ts.URL, &envelopeContentExample{}, content, detail)
+			if !tt.notIdempotent {
+				req.MarkIdempotent()
+			}
+			resp, err := NewClient(nil, WithRetryPolicy(tt.policy)).Do(context.Background(), req)
+			assert.Equal(t, tt.attempts, atomic.LoadInt32(&attempts))
+
+			switch {
+			case tt.statusCode != 0:
+				assert.Equal(t, &StatusError{StatusCode: tt.statusCode}, err)
+				assert.True(t, errors.Is(err, ErrTransport))
+			case tt.err:
+				assert.NotNil(t, err)
+			default:
+				if assert.Nil(t, err) {
+					assert.Nil(t, resp.Fault())
+					assert.Equal(t, int32(1), content.Attr1)
+					// Nothing decoded by the failed attempts remains.
+					assert.Equal(t, int32(0), detail.Attr1)
+				}
+			}
+		})
+	}
+}
+
+func TestClientRetryPolicyWithThrottling(t *testing.T) {
+	var tests = []struct {
+		name        string
+		maxAttempts int
+		attempts    int32
+		err         error
+	}{
+		{name: "retried", maxAttempts: 3, attempts: 3},
+		{name: "attempts exhausted", maxAttempts: 2, attempts: 2, err: &StatusError{StatusCode: http.StatusBadGateway}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch atomic.AddInt32(&attempts, 1) {
+				case 1:
+					http.Error(w, "slow down", http.StatusTooManyRequests)
+				case 2:
+					http.Error(w, "bad gateway", http.StatusBadGateway)
+				default:
+					w.Header().Set("Content-Type", "text/xml")
+					fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><ContentExample attr1="1"></ContentExample></s:Body></s:Envelope>`, soapEnvNS)
+				}
+			}))
+			defer ts.Close()
+
+			// Throttled attempts count towards the attempts of the policy.
+			client := NewClient(nil, WithRetryPolicy(RetryPolicy{MaxAttempts: tt.maxAttempts, Backoff: time.Millisecond, RetryThrottled: true}))
+			req := NewRequest("action", ts.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil)
+			req.MarkIdempotent()
+			_, err := client.Do(context.Background(), req)
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.attempts, atomic.LoadInt32(&attempts))
+		})
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	assert.Equal(t, 10*time.Millisecond, policy.delay(1))
+	assert.Equal(t, 20*time.Millisecond, policy.delay(2))
+	assert.Equal(t, 40*time.Millisecond, policy.delay(3))
+	assert.Equal(t, 50*time.Millisecond, policy.delay(4))
+	assert.Equal(t, 50*time.Millisecond, policy.delay(100))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		delay := policy.delay(2)
+		assert.True(t, delay >= 10*time.Millisecond && delay <= 20*time.Millisecond, "%s", delay)
+	}
+}
+
+func TestRetryableDialFailure(t *testing.T) {
+	client := NewClient(nil, WithRetryPolicy(RetryPolicy{MaxAttempts: 2}))
+
+	_, err := client.Do(context.Background(), NewRequest("action", "http://127.0.0.1:1", &envelopeContentExample{}, nil, nil))
+	assert.True(t, dialFailed(err), "%v is not a dial failure", err)
+
+	req := NewRequest("action", "http://127.0.0.1:1", &envelopeContentExample{}, nil, nil)
+	assert.True(t, client.retryable(req, nil, err))
+	assert.False(t, client.retryable(req, nil, &StatusError{StatusCode: http.StatusBadGateway}))
+	req.MarkIdempotent()
+	assert.True(t, client.retryable(req, nil, &StatusError{StatusCode: http.StatusBadGateway}))
+	assert.True(t, client.retryable(req, nil, &ThrottledError{StatusCode: http.StatusTooManyRequests}))
+	assert.False(t, client.retryable(req, nil, ErrUnsupportedContentType))
+}
+
+func TestClientRetryPolicyHeaders(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Header><HeaderExample attr1="1">failed</HeaderExample></s:Header><s:Body><s:Fault><faultcode>s:Unavailable</faultcode></s:Fault></s:Body></s:Envelope>`, soapEnvNS)
+			return
+		}
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><ContentExample attr1="1"></ContentExample></s:Body></s:Envelope>`, soapEnvNS)
+	}))
+	defer ts.Close()
+
+	var header headerExample
+	req := NewRequest("action", ts.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil)
+	req.MarkIdempotent()
+	req.OnHeader(xml.Name{Local: "HeaderExample"}, &header)
+
+	client := NewClient(nil, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, FaultCodes: []string{"Unavailable"}}))
+	_, err := client.Do(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	// The header decoded by the failed attempt doesn't remain.
+	assert.Equal(t, headerExample{}, header)
+}
+
+func TestClientRetryPolicyAllAttemptsFailed(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Header><HeaderExample attr1="1">failed</HeaderExample></s:Header><s:Body><s:Fault><faultcode>s:Unavailable</faultcode></s:Fault></s:Body></s:Envelope>`, soapEnvNS)
+			return
+		}
+		fmt.Fprint(w, `<s:Envelope`)
+	}))
+	defer ts.Close()
+
+	var header headerExample
+	req := NewRequest("action", ts.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil)
+	req.MarkIdempotent()
+	req.OnHeader(xml.Name{Local: "HeaderExample"}, &header)
+
+	client := NewClient(nil, WithRetryPolicy(RetryPolicy{MaxAttempts: 2, FaultCodes: []string{"Unavailable"}}))
+	_, err := client.Do(context.Background(), req)
+	assert.NotNil(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	// Nothing decoded by the first attempt remains, although no attempt succeeded.
+	assert.Equal(t, headerExample{}, header)
+}
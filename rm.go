@@ -0,0 +1,316 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Implements the subset of WS-ReliableMessaging (February 2005), as used by .NET WCF reliable sessions, needed to
+// exchange request-reply messages over a sequence.
+
+const (
+	wsrmNS = "http://schemas.xmlsoap.org/ws/2005/02/rm"
+
+	wsrmCreateSequenceAction    = wsrmNS + "/CreateSequence"
+	wsrmLastMessageAction       = wsrmNS + "/LastMessage"
+	wsrmTerminateSequenceAction = wsrmNS + "/TerminateSequence"
+)
+
+var (
+	// ErrSequenceClosed is returned if a request is made on a reliable messaging sequence after it was closed.
+	ErrSequenceClosed = errors.New("reliable messaging sequence is closed")
+	// ErrSequenceNotCreated is returned if the service didn't accept the creation of a reliable messaging sequence.
+	ErrSequenceNotCreated = errors.New("reliable messaging sequence was not created")
+)
+
+var (
+	sequenceName                = xml.Name{Space: wsrmNS, Local: "Sequence"}
+	sequenceAcknowledgementName = xml.Name{Space: wsrmNS, Local: "SequenceAcknowledgement"}
+)
+
+// AcknowledgementRange is a range of message numbers acknowledged by the receiver of a sequence.
+type AcknowledgementRange struct {
+	Lower uint64 `xml:"Lower,attr"`
+	Upper uint64 `xml:"Upper,attr"`
+}
+
+type createSequence struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/ws/2005/02/rm CreateSequence"`
+
+	AcksTo endpointReference `xml:"AcksTo"`
+	Offer  sequenceOffer     `xml:"Offer"`
+}
+
+type endpointReference struct {
+	Address string `xml:"http://www.w3.org/2005/08/addressing Address"`
+}
+
+// sequenceOffer offers the service a sequence for its responses, as required by WCF for request-reply sessions.
+type sequenceOffer struct {
+	Identifier string `xml:"Identifier"`
+}
+
+type createSequenceResponse struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/ws/2005/02/rm CreateSequenceResponse"`
+
+	Identifier string `xml:"Identifier"`
+}
+
+type terminateSequence struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/ws/2005/02/rm TerminateSequence"`
+
+	Identifier string `xml:"Identifier"`
+}
+
+// lastMessage is the response to the message closing a sequence, whose body is empty.
+type lastMessage struct{}
+
+// sequenceHeader is the wsrm:Sequence header, numbering a message within its sequence.
+type sequenceHeader struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/ws/2005/02/rm Sequence"`
+
+	// XMLNSWsu and ID are set when the request is signed, so the header can be referenced by the signature.
+	XMLNSWsu string `xml:"xmlns:wsu,attr,omitempty"`
+	ID       string `xml:"wsu:Id,attr,omitempty"`
+
+	Identifier    string    `xml:"Identifier"`
+	MessageNumber uint64    `xml:"MessageNumber"`
+	LastMessage   *struct{} `xml:"LastMessage"`
+}
+
+// sequenceAcknowledgementHeader is the wsrm:SequenceAcknowledgement header, listing the messages of a sequence
+// received so far.
+type sequenceAcknowledgementHeader struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/ws/2005/02/rm SequenceAcknowledgement"`
+
+	XMLNSWsu string `xml:"xmlns:wsu,attr,omitempty"`
+	ID       string `xml:"wsu:Id,attr,omitempty"`
+
+	Identifier string                 `xml:"Identifier"`
+	Ranges     []AcknowledgementRange `xml:"AcknowledgementRange"`
+}
+
+// Sequence is a WS-ReliableMessaging sequence, through which requests are sent to a service in order, as with a
+// WCF reliable session. The service responds on a sequence offered by the client, whose messages are acknowledged
+// on each following request.
+// A Sequence is safe for concurrent use, though requests made concurrently may be numbered in any order.
+type Sequence struct {
+	client *Client
+	url    string
+	// prototype holds the headers and signing credentials used by the messages managing the sequence.
+	prototype *Request
+
+	id      string
+	offerID string
+
+	mu       sync.Mutex
+	number   uint64
+	closed   bool
+	acked    []AcknowledgementRange
+	received []AcknowledgementRange
+}
+
+// CreateSequence creates a reliable messaging sequence with the service at url, for requests to be sent with
+// Sequence.Do. The settings of prototype, if set, such as its headers and signing credentials, are used for the
+// messages creating, closing and terminating the sequence.
+func (c *Client) CreateSequence(ctx context.Context, url string, prototype *Request) (*Sequence, error) {
+	offerID, err := newMessageID()
+	if err != nil {
+		return nil, err
+	}
+	if prototype == nil {
+		prototype = &Request{}
+	}
+
+	s := &Sequence{
+		client:    c,
+		url:       url,
+		prototype: prototype,
+		offerID:   offerID,
+	}
+
+	body := &createSequence{
+		AcksTo: endpointReference{Address: wsaAnonymous},
+		Offer:  sequenceOffer{Identifier: offerID},
+	}
+	resp, err := c.Do(ctx, s.controlRequest(wsrmCreateSequenceAction, body, &createSequenceResponse{}))
+	if err != nil {
+		return nil, err
+	}
+	if resp.Fault() != nil {
+		return nil, resp.Fault()
+	}
+
+	created := resp.Body().(*createSequenceResponse)
+	if created.Identifier == "" {
+		return nil, ErrSequenceNotCreated
+	}
+	s.id = created.Identifier
+
+	return s, nil
+}
+
+// ID returns the identifier assigned to the sequence by the service.
+func (s *Sequence) ID() string {
+	return s.id
+}
+
+// Acknowledged returns the ranges of message numbers the service last acknowledged receiving.
+func (s *Sequence) Acknowledged() []AcknowledgementRange {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]AcknowledgementRange(nil), s.acked...)
+}
+
+// Do sends the request as the next message of the sequence, as with Client.Do. The request isn't modified: a clone
+// of it is sent, with the WS-Addressing headers and the reliable messaging headers numbering the message and
+// acknowledging the responses received so far.
+func (s *Sequence) Do(ctx context.Context, req *Request) (*Response, error) {
+	return s.send(ctx, req.Clone(req.body, req.resp, req.fault), false)
+}
+
+// Close closes the sequence, sending the last message and terminating the sequence with the service.
+// No more requests can be sent on the sequence once it is closed, even if an error is returned.
+func (s *Sequence) Close(ctx context.Context) error {
+	resp, err := s.send(ctx, s.controlRequest(wsrmLastMessageAction, RawXML{}, &lastMessage{}), true)
+	if err != nil {
+		return err
+	}
+	if resp.Fault() != nil {
+		return resp.Fault()
+	}
+
+	req := s.controlRequest(wsrmTerminateSequenceAction, &terminateSequence{Identifier: s.id}, &terminateSequence{})
+	s.mu.Lock()
+	ack := s.acknowledgement()
+	s.mu.Unlock()
+	if ack != nil {
+		if err := addSequenceHeaders(req, ack); err != nil {
+			return err
+		}
+	}
+
+	resp, err = s.client.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+	if resp.Fault() != nil {
+		return resp.Fault()
+	}
+	return nil
+}
+
+// controlRequest returns a request managing the sequence, with the settings of the prototype request.
+func (s *Sequence) controlRequest(action string, body interface{}, respType interface{}) *Request {
+	req := s.prototype.Clone(body, respType, nil)
+	req.action = action
+	req.url = s.url
+	req.UseAddressing()
+	return req
+}
+
+// send numbers the request and sends it. If last is set, the sequence is closed by the request.
+func (s *Sequence) send(ctx context.Context, req *Request, last bool) (*Response, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrSequenceClosed
+	}
+	s.number++
+	header := &sequenceHeader{Identifier: s.id, MessageNumber: s.number}
+	if last {
+		header.LastMessage = &struct{}{}
+		s.closed = true
+	}
+	headers := []interface{}{header}
+	if ack := s.acknowledgement(); ack != nil {
+		headers = append(headers, ack)
+	}
+	s.mu.Unlock()
+
+	if err := addSequenceHeaders(req, headers...); err != nil {
+		return nil, err
+	}
+	req.UseAddressing()
+
+	received := &sequenceHeader{}
+	ack := &sequenceAcknowledgementHeader{}
+	req.decodeHeader(sequenceName, received)
+	req.decodeHeader(sequenceAcknowledgementName, ack)
+
+	resp, err := s.client.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ack.Identifier == s.id {
+		s.acked = ack.Ranges
+	}
+	if received.Identifier == s.offerID && received.MessageNumber > 0 {
+		s.received = addAcknowledgement(s.received, received.MessageNumber)
+	}
+
+	return resp, nil
+}
+
+// acknowledgement returns the header acknowledging the responses received so far, or nil if there are none.
+// It must be called with the lock held.
+func (s *Sequence) acknowledgement() *sequenceAcknowledgementHeader {
+	if len(s.received) == 0 {
+		return nil
+	}
+
+	return &sequenceAcknowledgementHeader{
+		Identifier: s.offerID,
+		Ranges:     append([]AcknowledgementRange(nil), s.received...),
+	}
+}
+
+// addSequenceHeaders adds the reliable messaging headers to req. If the request is signed, each header is given a
+// wsu:Id attribute so that it is included in the signature.
+func addSequenceHeaders(req *Request, headers ...interface{}) error {
+	for _, header := range headers {
+		if req.wsseInfo != nil {
+			id, err := generateWSUID("ReliableMessaging")
+			if err != nil {
+				return err
+			}
+
+			switch h := header.(type) {
+			case *sequenceHeader:
+				h.XMLNSWsu, h.ID = wsuNS, id
+			case *sequenceAcknowledgementHeader:
+				h.XMLNSWsu, h.ID = wsuNS, id
+			}
+		}
+		req.AddHeader(header)
+	}
+	return nil
+}
+
+// addAcknowledgement adds the message number n to the sorted ranges, merging the ranges it joins.
+func addAcknowledgement(ranges []AcknowledgementRange, n uint64) []AcknowledgementRange {
+	ranges = append(ranges, AcknowledgementRange{Lower: n, Upper: n})
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Lower < ranges[j].Lower
+	})
+
+	merged := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &merged[len(merged)-1]
+		if r.Lower <= last.Upper+1 {
+			if r.Upper > last.Upper {
+				last.Upper = r.Upper
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
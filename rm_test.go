@@ -0,0 +1,190 @@
+package soap
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+// reliableSessionServer emulates a WCF reliable session endpoint, recording the requests it receives.
+type reliableSessionServer struct {
+	mu       sync.Mutex
+	requests []*etree.Document
+	offerID  string
+	replies  uint64
+}
+
+func (s *reliableSessionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data, _ := ioutil.ReadAll(r.Body)
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, doc)
+
+	action := doc.FindElement("Envelope/Header/Action").Text()
+	if action == wsrmTerminateSequenceAction {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var header, body string
+	if action == wsrmCreateSequenceAction {
+		s.offerID = doc.FindElement("Envelope/Body/CreateSequence/Offer/Identifier").Text()
+		body = `<CreateSequenceResponse xmlns="` + wsrmNS + `"><Identifier>urn:uuid:sequence</Identifier></CreateSequenceResponse>`
+	} else {
+		number := doc.FindElement("Envelope/Header/Sequence/MessageNumber").Text()
+		s.replies++
+		header = fmt.Sprintf(`<r:Sequence xmlns:r="%s"><r:Identifier>%s</r:Identifier><r:MessageNumber>%d</r:MessageNumber></r:Sequence>`, wsrmNS, s.offerID, s.replies) +
+			fmt.Sprintf(`<r:SequenceAcknowledgement xmlns:r="%s"><r:Identifier>urn:uuid:sequence</r:Identifier><r:AcknowledgementRange Lower="1" Upper="%s"/></r:SequenceAcknowledgement>`, wsrmNS, number)
+		if action != wsrmLastMessageAction {
+			body = `<ContentExample attr1="` + number + `"></ContentExample>`
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Header>%s</s:Header><s:Body>%s</s:Body></s:Envelope>`, soapEnvNS, header, body)
+}
+
+func TestSequence(t *testing.T) {
+	server := &reliableSessionServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	client := NewClient(nil)
+	ctx := context.Background()
+
+	seq, err := client.CreateSequence(ctx, ts.URL, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Equal(t, "urn:uuid:sequence", seq.ID())
+	assert.Empty(t, seq.Acknowledged())
+
+	for i := 1; i <= 2; i++ {
+		content := &envelopeContentExample{}
+		req := NewRequest("http://example.com/Service/Operation", ts.URL, &envelopeContentExample{}, content, nil)
+		_, err := seq.Do(ctx, req)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(i), content.Attr1)
+		assert.Equal(t, []AcknowledgementRange{{Lower: 1, Upper: uint64(i)}}, seq.Acknowledged())
+		assert.Empty(t, req.headers, "request modified")
+	}
+
+	assert.Nil(t, seq.Close(ctx))
+	_, err = seq.Do(ctx, NewRequest("http://example.com/Service/Operation", ts.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil))
+	assert.Equal(t, ErrSequenceClosed, err)
+
+	if !assert.Len(t, server.requests, 5) {
+		return
+	}
+
+	var actions []string
+	for _, doc := range server.requests {
+		actions = append(actions, doc.FindElement("Envelope/Header/Action").Text())
+	}
+	assert.Equal(t, []string{
+		wsrmCreateSequenceAction,
+		"http://example.com/Service/Operation",
+		"http://example.com/Service/Operation",
+		wsrmLastMessageAction,
+		wsrmTerminateSequenceAction,
+	}, actions)
+
+	for i, doc := range server.requests[1:4] {
+		sequence := doc.FindElement("Envelope/Header/Sequence")
+		assert.Equal(t, "urn:uuid:sequence", sequence.SelectElement("Identifier").Text())
+		assert.Equal(t, fmt.Sprint(i+1), sequence.SelectElement("MessageNumber").Text())
+		assert.Equal(t, i == 2, sequence.SelectElement("LastMessage") != nil)
+	}
+	assert.Len(t, server.requests[3].FindElements("Envelope/Body/*"), 0)
+	assert.Equal(t, "urn:uuid:sequence", server.requests[4].FindElement("Envelope/Body/TerminateSequence/Identifier").Text())
+
+	// The responses received are acknowledged on the following requests.
+	assert.Nil(t, server.requests[1].FindElement("Envelope/Header/SequenceAcknowledgement"))
+	for i, doc := range server.requests[2:] {
+		ack := doc.FindElement("Envelope/Header/SequenceAcknowledgement")
+		if !assert.NotNil(t, ack) {
+			continue
+		}
+		assert.Equal(t, server.offerID, ack.SelectElement("Identifier").Text())
+		assert.Equal(t, fmt.Sprint(i+1), ack.SelectElement("AcknowledgementRange").SelectAttrValue("Upper", ""))
+	}
+}
+
+func TestSequenceSigned(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	server := &reliableSessionServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	prototype := &Request{}
+	prototype.SignWith(wsseInfo)
+
+	client := NewClient(nil, WithWCFCompatibility())
+	ctx := context.Background()
+
+	seq, err := client.CreateSequence(ctx, ts.URL, prototype)
+	if !assert.Nil(t, err) {
+		return
+	}
+	for i := 0; i < 2; i++ {
+		req := prototype.Clone(&envelopeContentExample{}, &envelopeContentExample{}, nil)
+		req.url = ts.URL
+		_, err = seq.Do(ctx, req)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, seq.Close(ctx))
+
+	for _, doc := range server.requests {
+		var referenced []string
+		for _, ref := range doc.FindElements("//SignedInfo/Reference") {
+			referenced = append(referenced, ref.SelectAttrValue("URI", ""))
+		}
+		for _, entry := range doc.FindElement("Envelope/Header").ChildElements() {
+			if entry.Tag == "Security" {
+				continue
+			}
+			id := entry.SelectAttrValue("wsu:Id", "")
+			assert.NotEmpty(t, id, entry.Tag)
+			assert.Contains(t, referenced, "#"+id, entry.Tag)
+		}
+	}
+}
+
+func TestAddAcknowledgement(t *testing.T) {
+	var tests = []struct {
+		name    string
+		numbers []uint64
+		want    []AcknowledgementRange
+	}{
+		{name: "single", numbers: []uint64{1}, want: []AcknowledgementRange{{1, 1}}},
+		{name: "consecutive", numbers: []uint64{1, 2, 3}, want: []AcknowledgementRange{{1, 3}}},
+		{name: "gap", numbers: []uint64{1, 3}, want: []AcknowledgementRange{{1, 1}, {3, 3}}},
+		{name: "gap filled", numbers: []uint64{3, 1, 2}, want: []AcknowledgementRange{{1, 3}}},
+		{name: "duplicate", numbers: []uint64{2, 2}, want: []AcknowledgementRange{{2, 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ranges []AcknowledgementRange
+			for _, n := range tt.numbers {
+				ranges = addAcknowledgement(ranges, n)
+			}
+			assert.Equal(t, tt.want, ranges)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package soap
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Implements the generation of sample envelopes from the Go types of message bodies.
+
+// SamplePlaceholder is the value of the string and byte slice fields of sample bodies.
+const SamplePlaceholder = "?"
+
+// sampleTime is the value of the time fields of a sample body.
+var sampleTime = time.Date(2006, time.January, 2, 15, 4, 5, 0, time.UTC)
+
+// SampleEnvelope returns a sample envelope for bodies of the type of body, indented as by Envelope.MarshalIndent, to
+// share with the vendors of services or include in contract documentation.
+// Every element and attribute of the body is present, including optional ones: pointers are allocated, slices hold a
+// single element, strings hold SamplePlaceholder, numbers are 1, booleans are true and times are
+// 2006-01-02T15:04:05Z. Types marshalling themselves, other than time.Time and Date, and interface and map fields are left as they are. Recursive types are expanded once.
+// The body itself is not modified, and is typically the zero value of its type.
+func SampleEnvelope(body interface{}) ([]byte, error) {
+	sample := reflect.New(reflect.TypeOf(body)).Elem()
+	populateSample(sample, map[reflect.Type]bool{})
+
+	return NewEnvelope(sample.Interface()).MarshalIndent()
+}
+
+// populateSample sets v to a sample value of its type. The types being populated are tracked in active, so that the
+// fields of recursive types are only expanded once.
+func populateSample(v reflect.Value, active map[reflect.Type]bool) {
+	switch {
+	case v.Type() == timeType:
+		v.Set(reflect.ValueOf(sampleTime))
+		return
+	case v.Type() == dateType:
+		v.Set(reflect.ValueOf(Date{Time: sampleTime}))
+		return
+	case v.Kind() != reflect.Ptr && marshalsItself(v.Type()):
+		return
+	case v.Kind() != reflect.Ptr && v.CanAddr() && marshalsItself(reflect.PtrTo(v.Type())):
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(SamplePlaceholder)
+	case reflect.Bool:
+		v.SetBool(true)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		v.SetUint(1)
+	case reflect.Float32, reflect.Float64:
+		v.SetFloat(1)
+	case reflect.Ptr:
+		if active[v.Type().Elem()] {
+			return
+		}
+		elem := reflect.New(v.Type().Elem())
+		populateSample(elem.Elem(), active)
+		v.Set(elem)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			v.SetBytes([]byte(SamplePlaceholder))
+			return
+		}
+		if active[v.Type().Elem()] {
+			return
+		}
+		elems := reflect.MakeSlice(v.Type(), 1, 1)
+		populateSample(elems.Index(0), active)
+		v.Set(elems)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			populateSample(v.Index(i), active)
+		}
+	case reflect.Struct:
+		active[v.Type()] = true
+		defer delete(active, v.Type())
+
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" && !field.Anonymous || !sampleField(field) {
+				continue
+			}
+			populateSample(v.Field(i), active)
+		}
+	}
+}
+
+// marshalsItself checks whether values of the type implement their own XML or text marshalling.
+func marshalsItself(t reflect.Type) bool {
+	return t.Implements(marshalerType) || t.Implements(textMarshalerType)
+}
+
+// sampleField checks whether the struct field is part of the XML of its struct, rather than being its name, raw
+// content or a comment.
+func sampleField(field reflect.StructField) bool {
+	if field.Type == reflect.TypeOf(xml.Name{}) {
+		return false
+	}
+
+	tag := field.Tag.Get("xml")
+	if tag == "-" {
+		return false
+	}
+	for _, flag := range strings.Split(tag, ",")[1:] {
+		if flag == "innerxml" || flag == "comment" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,84 @@
+package soap
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sampleOrder struct {
+	XMLName  xml.Name          `xml:"urn:orders PlaceOrder"`
+	ID       int64             `xml:"id,attr"`
+	Urgent   *bool             `xml:"urgent,attr,omitempty"`
+	Customer *sampleCustomer   `xml:"Customer,omitempty"`
+	Lines    []sampleOrderLine `xml:"Line"`
+	Placed   time.Time         `xml:"Placed"`
+	Extra    RawXML            `xml:",innerxml"`
+	Note     string            `xml:",comment"`
+	internal string
+}
+
+type sampleCustomer struct {
+	Name     string          `xml:"Name"`
+	Referrer *sampleCustomer `xml:"Referrer,omitempty"`
+}
+
+type sampleOrderLine struct {
+	SKU      string  `xml:"SKU"`
+	Quantity uint    `xml:"Quantity"`
+	Price    float64 `xml:"Price,omitempty"`
+	Notes    []byte  `xml:"Notes,omitempty"`
+}
+
+func TestSampleEnvelope(t *testing.T) {
+	var tests = []struct {
+		name string
+		body interface{}
+		out  string
+	}{
+		{
+			name: "struct",
+			body: sampleOrder{},
+			out: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Body xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+    <PlaceOrder xmlns="urn:orders" id="1" urgent="true">
+      <Customer>
+        <Name>?</Name>
+      </Customer>
+      <Line>
+        <SKU>?</SKU>
+        <Quantity>1</Quantity>
+        <Price>1</Price>
+        <Notes>?</Notes>
+      </Line>
+      <Placed>2006-01-02T15:04:05Z</Placed>
+    </PlaceOrder>
+  </Body>
+</Envelope>
+`,
+		},
+		{
+			name: "pointer",
+			body: &sampleCustomer{Name: "ignored"},
+			out: `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Body xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+    <Content>
+      <Name>?</Name>
+    </Content>
+  </Body>
+</Envelope>
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := SampleEnvelope(tt.body)
+			if assert.Nil(t, err) {
+				assert.Equal(t, tt.out, string(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package soap
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Implements the server side helpers used when answering SOAP requests.
+
+// fault12 is the SOAP 1.2 serialized representation of a Fault.
+// The 1.2 fault structure differs from the 1.1 structure modeled by Fault, so we convert when writing.
+type fault12 struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Fault"`
+
+	Code   fault12Code   `xml:"http://www.w3.org/2003/05/soap-envelope Code"`
+	Reason fault12Reason `xml:"http://www.w3.org/2003/05/soap-envelope Reason"`
+	Role   string        `xml:"http://www.w3.org/2003/05/soap-envelope Role,omitempty"`
+
+	Detail *faultDetail `xml:"http://www.w3.org/2003/05/soap-envelope Detail,omitempty"`
+}
+
+type fault12Code struct {
+	Value string `xml:"http://www.w3.org/2003/05/soap-envelope Value"`
+}
+
+type fault12Reason struct {
+	Text fault12Text `xml:"http://www.w3.org/2003/05/soap-envelope Text"`
+}
+
+type fault12Text struct {
+	Lang  string `xml:"xml:lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+type body12 struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Body"`
+
+	Fault *fault12
+}
+
+type envelope12 struct {
+	XMLName xml.Name `xml:"http://www.w3.org/2003/05/soap-envelope Envelope"`
+
+	// XMLNSEnv binds the 'env' prefix so the QName in the fault code value resolves.
+	XMLNSEnv string `xml:"xmlns:env,attr"`
+
+	Body body12
+}
+
+// soap12FaultCodes maps the SOAP 1.1 fault code local names to their SOAP 1.2 equivalents.
+var soap12FaultCodes = map[string]string{
+	"VersionMismatch":     "VersionMismatch",
+	"MustUnderstand":      "MustUnderstand",
+	"DataEncodingUnknown": "DataEncodingUnknown",
+	"Client":              "Sender",
+	"Sender":              "Sender",
+	"Server":              "Receiver",
+	"Receiver":            "Receiver",
+}
+
+// faultCodeLocalName strips the namespace prefix (if any) from a fault code.
+func faultCodeLocalName(code string) string {
+	if idx := strings.LastIndex(code, ":"); idx >= 0 {
+		return code[idx+1:]
+	}
+	return code
+}
+
+// soap12FaultCode returns the SOAP 1.2 fault code local name for the supplied fault code.
+// Codes that are not recognized are reported as a Receiver fault.
+func soap12FaultCode(code string) string {
+	if mapped, ok := soap12FaultCodes[faultCodeLocalName(code)]; ok {
+		return mapped
+	}
+	return "Receiver"
+}
+
+// faultStatusCode returns the HTTP status code to use when sending the fault using the specified SOAP version.
+// SOAP 1.1 always uses 500, while SOAP 1.2 reports Sender faults as 400 and everything else as 500.
+func faultStatusCode(fault *Fault, version Version) int {
+	if version == SOAP12 && soap12FaultCode(fault.Code) == "Sender" {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// marshalFault serializes the fault argument into a complete SOAP envelope of the specified version.
+func marshalFault(fault *Fault, version Version) ([]byte, error) {
+	if version != SOAP12 {
+		envelope := &Envelope{
+			Body: &Body{
+				Fault: fault,
+			},
+		}
+		return xml.Marshal(envelope)
+	}
+
+	f := &fault12{
+		Code: fault12Code{
+			Value: "env:" + soap12FaultCode(fault.Code),
+		},
+		Reason: fault12Reason{
+			Text: fault12Text{
+				Lang:  "en",
+				Value: fault.String,
+			},
+		},
+		Role: fault.Actor,
+	}
+	if fault.Detail() != nil {
+		f.Detail = fault.DetailInternal
+	}
+
+	envelope := &envelope12{
+		XMLNSEnv: soap12EnvNS,
+		Body: body12{
+			Fault: f,
+		},
+	}
+	return xml.Marshal(envelope)
+}
+
+// WriteFault serializes the supplied fault into a SOAP envelope of the specified version and writes it to w.
+// The Content-Type header and HTTP status code are set as required by the SOAP HTTP binding of the version;
+// SOAP 1.1 faults are always sent with a 500 status, while SOAP 1.2 uses 400 for Sender faults and 500 otherwise.
+// SOAP 1.1 fault codes are mapped to their SOAP 1.2 equivalent (e.g. Client to Sender) as needed.
+// The fault is serialized before anything is written, so if an error is returned the response is untouched.
+func WriteFault(w http.ResponseWriter, fault *Fault, version Version) error {
+	faultEnc, err := marshalFault(fault, version)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", version.ContentType())
+	w.WriteHeader(faultStatusCode(fault, version))
+
+	_, err = w.Write(faultEnc)
+	return err
+}
+
+const (
+	wsdlSoapNS   = "http://schemas.xmlsoap.org/wsdl/soap/"
+	wsdlSoap12NS = "http://schemas.xmlsoap.org/wsdl/soap12/"
+)
+
+// WSDLProvider returns the WSDL document describing a service.
+// It is invoked each time the WSDL is requested, allowing the document to be generated on demand.
+type WSDLProvider func() ([]byte, error)
+
+// StaticWSDL returns a WSDLProvider which always supplies the wsdl argument.
+func StaticWSDL(wsdl []byte) WSDLProvider {
+	return func() ([]byte, error) {
+		return wsdl, nil
+	}
+}
+
+type wsdlHandler struct {
+	provider WSDLProvider
+	next     http.Handler
+}
+
+// NewWSDLHandler wraps the next handler, responding to GET requests with a 'wsdl' query parameter (i.e. GET /endpoint?wsdl)
+// with the WSDL document supplied by provider. All other requests are passed through to next.
+// The location of every SOAP address element in the served document is rewritten to point to the endpoint
+// the WSDL was requested from, so clients generated from the document will call this server.
+func NewWSDLHandler(provider WSDLProvider, next http.Handler) http.Handler {
+	return &wsdlHandler{
+		provider: provider,
+		next:     next,
+	}
+}
+
+// ServeHTTP satisfies the http.Handler interface.
+func (h *wsdlHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !isWSDLRequest(r) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	wsdl, err := h.provider()
+	if err != nil {
+		http.Error(w, "unable to retrieve wsdl", http.StatusInternalServerError)
+		return
+	}
+
+	wsdl, err = rewriteWSDLAddress(wsdl, requestEndpoint(r))
+	if err != nil {
+		http.Error(w, "unable to rewrite wsdl", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/xml; charset=\"utf-8\"")
+	w.WriteHeader(http.StatusOK)
+	w.Write(wsdl)
+}
+
+// isWSDLRequest checks whether the request is a GET with a 'wsdl' query parameter, ignoring case.
+func isWSDLRequest(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+
+	for key := range r.URL.Query() {
+		if strings.EqualFold(key, "wsdl") {
+			return true
+		}
+	}
+	return false
+}
+
+// requestEndpoint reconstructs the absolute URL (without query) the request was sent to.
+func requestEndpoint(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// rewriteWSDLAddress replaces the location attribute of every SOAP 1.1 and 1.2 address element in the WSDL with location.
+func rewriteWSDLAddress(wsdl []byte, location string) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(wsdl); err != nil {
+		return nil, err
+	}
+
+	for _, elem := range doc.FindElements("//address") {
+		ns := elementNamespace(elem)
+		if ns != wsdlSoapNS && ns != wsdlSoap12NS {
+			continue
+		}
+
+		elem.CreateAttr("location", location)
+	}
+
+	return doc.WriteToBytes()
+}
+
+// elementNamespace resolves the namespace URI of the element by searching it and its parents for the matching declaration.
+func elementNamespace(elem *etree.Element) string {
+	return resolvePrefix(elem, elem.Space)
+}
+
+// resolvePrefix resolves the namespace URI of the prefix in scope at the element, or of the default namespace if the
+// prefix is empty.
+func resolvePrefix(elem *etree.Element, prefix string) string {
+	key := "xmlns"
+	if prefix != "" {
+		key = "xmlns:" + prefix
+	}
+
+	for e := elem; e != nil; e = e.Parent() {
+		if attr := e.SelectAttr(key); attr != nil {
+			return attr.Value
+		}
+	}
+	return ""
+}
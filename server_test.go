@@ -0,0 +1,174 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type writeFaultTest struct {
+	name        string
+	fault       *Fault
+	version     Version
+	statusCode  int
+	contentType string
+	res         string
+}
+
+var writeFaultTests = []writeFaultTest{
+	{
+		name: "soap 1.1 server fault",
+		fault: &Fault{
+			Code:   "soap:Server",
+			String: "Internal failure",
+		},
+		version:     SOAP11,
+		statusCode:  http.StatusInternalServerError,
+		contentType: "text/xml; charset=\"utf-8\"",
+		res:         `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Fault xmlns="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>soap:Server</faultcode><faultstring>Internal failure</faultstring></Fault></Body></Envelope>`,
+	},
+	{
+		name: "soap 1.1 client fault",
+		fault: &Fault{
+			Code:   "soap:Client",
+			String: "Bad input",
+		},
+		version:     SOAP11,
+		statusCode:  http.StatusInternalServerError,
+		contentType: "text/xml; charset=\"utf-8\"",
+		res:         `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Fault xmlns="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>soap:Client</faultcode><faultstring>Bad input</faultstring></Fault></Body></Envelope>`,
+	},
+	{
+		name: "soap 1.2 client fault",
+		fault: &Fault{
+			Code:   "soap:Client",
+			String: "Bad input",
+		},
+		version:     SOAP12,
+		statusCode:  http.StatusBadRequest,
+		contentType: "application/soap+xml; charset=utf-8",
+		res:         `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope" xmlns:env="http://www.w3.org/2003/05/soap-envelope"><Body xmlns="http://www.w3.org/2003/05/soap-envelope"><Fault xmlns="http://www.w3.org/2003/05/soap-envelope"><Code xmlns="http://www.w3.org/2003/05/soap-envelope"><Value xmlns="http://www.w3.org/2003/05/soap-envelope">env:Sender</Value></Code><Reason xmlns="http://www.w3.org/2003/05/soap-envelope"><Text xmlns="http://www.w3.org/2003/05/soap-envelope" xml:lang="en">Bad input</Text></Reason></Fault></Body></Envelope>`,
+	},
+	{
+		name: "soap 1.2 unknown code fault",
+		fault: &Fault{
+			Code:   "ns2:InvalidInput",
+			String: "Bad input",
+			Actor:  "http://example.com/actor",
+		},
+		version:     SOAP12,
+		statusCode:  http.StatusInternalServerError,
+		contentType: "application/soap+xml; charset=utf-8",
+		res:         `<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope" xmlns:env="http://www.w3.org/2003/05/soap-envelope"><Body xmlns="http://www.w3.org/2003/05/soap-envelope"><Fault xmlns="http://www.w3.org/2003/05/soap-envelope"><Code xmlns="http://www.w3.org/2003/05/soap-envelope"><Value xmlns="http://www.w3.org/2003/05/soap-envelope">env:Receiver</Value></Code><Reason xmlns="http://www.w3.org/2003/05/soap-envelope"><Text xmlns="http://www.w3.org/2003/05/soap-envelope" xml:lang="en">Bad input</Text></Reason><Role xmlns="http://www.w3.org/2003/05/soap-envelope">http://example.com/actor</Role></Fault></Body></Envelope>`,
+	},
+}
+
+func TestWriteFault(t *testing.T) {
+	for _, tt := range writeFaultTests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			err := WriteFault(w, tt.fault, tt.version)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.statusCode, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tt.res, w.Body.String())
+		})
+	}
+}
+
+func TestWriteFaultWithDetailRoundTrip(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	fault := NewFaultWithDetail(&faultDetailExample{
+		Attr1: 10,
+		Field1: faultDetailExampleField{
+			Attr1: "test",
+			Attr2: 11,
+			Value: "This is a test string",
+		},
+	})
+	fault.Code = "soap:Server"
+	fault.String = "Internal failure"
+
+	err := WriteFault(w, fault, SOAP11)
+	assert.Nil(t, err)
+
+	detail := &faultDetailExample{}
+	envelope := NewEnvelopeWithFault(&envelopeContentExample{}, detail)
+	err = xml.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(envelope)
+	assert.Nil(t, err)
+	assert.NotNil(t, envelope.Body.Fault)
+	assert.Equal(t, "soap:Server", envelope.Body.Fault.Code)
+	assert.Equal(t, "Internal failure", envelope.Body.Fault.String)
+	assert.Equal(t, int32(10), detail.Attr1)
+	assert.Equal(t, "This is a test string", detail.Field1.Value)
+}
+
+const testWSDL = `<?xml version="1.0" encoding="UTF-8"?>
+<definitions xmlns="http://schemas.xmlsoap.org/wsdl/" xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/" xmlns:soap12="http://schemas.xmlsoap.org/wsdl/soap12/" xmlns:http="http://schemas.xmlsoap.org/wsdl/http/">
+	<service name="ExampleService">
+		<port name="ExamplePort" binding="tns:ExampleBinding">
+			<soap:address location="http://internal.example.com:8080/service"/>
+		</port>
+		<port name="ExamplePort12" binding="tns:ExampleBinding12">
+			<soap12:address location="http://internal.example.com:8080/service"/>
+		</port>
+		<port name="ExampleHTTPPort" binding="tns:ExampleHTTPBinding">
+			<http:address location="http://internal.example.com:8080/http"/>
+		</port>
+	</service>
+</definitions>`
+
+func TestWSDLHandler(t *testing.T) {
+	var passedThrough bool
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		passedThrough = true
+	})
+
+	handler := NewWSDLHandler(StaticWSDL([]byte(testWSDL)), next)
+
+	t.Run("wsdl request", func(t *testing.T) {
+		passedThrough = false
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://public.example.com/soap/service?WSDL", nil))
+
+		assert.False(t, passedThrough)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `<soap:address location="http://public.example.com/soap/service"/>`)
+		assert.Contains(t, w.Body.String(), `<soap12:address location="http://public.example.com/soap/service"/>`)
+		assert.Contains(t, w.Body.String(), `<http:address location="http://internal.example.com:8080/http"/>`)
+	})
+
+	t.Run("forwarded proto", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "http://public.example.com/soap/service?wsdl", nil)
+		r.Header.Set("X-Forwarded-Proto", "https")
+		handler.ServeHTTP(w, r)
+
+		assert.Contains(t, w.Body.String(), `<soap:address location="https://public.example.com/soap/service"/>`)
+	})
+
+	t.Run("soap request", func(t *testing.T) {
+		passedThrough = false
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://public.example.com/soap/service?wsdl", nil))
+
+		assert.True(t, passedThrough)
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		errHandler := NewWSDLHandler(func() ([]byte, error) {
+			return nil, ErrUnsupportedContentType
+		}, next)
+
+		w := httptest.NewRecorder()
+		errHandler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://public.example.com/soap/service?wsdl", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
@@ -0,0 +1,130 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// Implements the decoding of SOAP encoding base64 content, still sent by some legacy rpc/encoded services in place of
+// xsd:base64Binary.
+
+// isSOAPEncBase64 returns whether the element holds SOAP encoding base64 content: it is a soapenc:base64 element, or
+// its xsi:type is soapenc:base64 or soapenc:base64Binary. The prefix of the type is resolved against scope, the
+// namespace declarations in scope for the element, followed by those of the element itself.
+func isSOAPEncBase64(elem xml.StartElement, scope []xml.Attr) bool {
+	if elem.Name.Space == soapEncNS && elem.Name.Local == "base64" {
+		return true
+	}
+
+	for _, attr := range elem.Attr {
+		if attr.Name.Space == xsiNS && attr.Name.Local == "type" {
+			typ := resolveQName(attr.Value, append(scope, elem.Attr...))
+			return typ.Space == soapEncNS && (typ.Local == "base64" || typ.Local == "base64Binary")
+		}
+	}
+	return false
+}
+
+// soapEncBase64Reader is a token reader which decodes the content of SOAP encoding base64 elements, so that it is
+// decoded into []byte fields as the binary content rather than its base64 encoding, as it would be from an XOP part.
+// encoding/xml copies the character data of elements into []byte fields as it is, whatever their type.
+type soapEncBase64Reader struct {
+	r xml.TokenReader
+	// scopes holds the namespace declarations of each open element, starting with the root element.
+	scopes [][]xml.Attr
+
+	// base64 is the base64 element just started, whose content is read next, if any.
+	base64 *xml.StartElement
+	// end is the end of the base64 element, read ahead of its decoded content.
+	end *xml.EndElement
+}
+
+// Token satisfies the xml.TokenReader interface.
+func (r *soapEncBase64Reader) Token() (xml.Token, error) {
+	if r.end != nil {
+		end := *r.end
+		r.end = nil
+		r.scopes = r.scopes[:len(r.scopes)-1]
+		return end, nil
+	}
+	if r.base64 != nil {
+		start := *r.base64
+		r.base64 = nil
+		return r.decodeContent(start)
+	}
+
+	token, err := r.r.Token()
+	if err != nil {
+		return token, err
+	}
+
+	switch elem := token.(type) {
+	case xml.StartElement:
+		var scope []xml.Attr
+		for _, decls := range r.scopes {
+			scope = append(scope, decls...)
+		}
+		if isSOAPEncBase64(elem, scope) {
+			r.base64 = &elem
+		}
+
+		var decls []xml.Attr
+		for _, attr := range elem.Attr {
+			if isNamespaceDecl(attr) {
+				decls = append(decls, attr)
+			}
+		}
+		r.scopes = append(r.scopes, decls)
+	case xml.EndElement:
+		if len(r.scopes) > 0 {
+			r.scopes = r.scopes[:len(r.scopes)-1]
+		}
+	}
+
+	return token, nil
+}
+
+// decodeContent reads the content of the base64 element up to its end, returning it decoded as character data.
+func (r *soapEncBase64Reader) decodeContent(start xml.StartElement) (xml.Token, error) {
+	var text []byte
+	for {
+		token, err := r.r.Token()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.CharData:
+			text = append(text, t...)
+		case xml.StartElement:
+			return nil, fmt.Errorf("unexpected element %s in base64 content of %s", qualifiedName(t.Name), qualifiedName(start.Name))
+		case xml.EndElement:
+			content, err := decodeBase64Text(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 content of %s: %w", qualifiedName(start.Name), err)
+			}
+			r.end = &t
+			return xml.CharData(content), nil
+		}
+	}
+}
+
+// decodeBase64Text decodes base64 text, ignoring whitespace.
+func decodeBase64Text(text []byte) ([]byte, error) {
+	compact := make([]byte, 0, len(text))
+	for _, field := range bytes.Fields(text) {
+		compact = append(compact, field...)
+	}
+
+	content := make([]byte, base64.StdEncoding.DecodedLen(len(compact)))
+	n, err := base64.StdEncoding.Decode(content, compact)
+	if err != nil {
+		return nil, err
+	}
+	return content[:n], nil
+}
@@ -0,0 +1,106 @@
+package soap
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type soapEncBase64Example struct {
+	XMLName xml.Name `xml:"urn:example getDocumentResponse"`
+	Name    string   `xml:"name"`
+	Content []byte   `xml:"content"`
+}
+
+func TestDecodeSOAPEncBase64(t *testing.T) {
+	var tests = []struct {
+		name     string
+		content  string
+		expected []byte
+		err      bool
+	}{
+		{
+			name:     "base64 type",
+			content:  `<content xsi:type="soapenc:base64">AAEC/w==</content>`,
+			expected: []byte{0, 1, 2, 255},
+		},
+		{
+			name:     "base64Binary type",
+			content:  `<content xsi:type="soapenc:base64Binary">AAEC/w==</content>`,
+			expected: []byte{0, 1, 2, 255},
+		},
+		{
+			name:     "type prefix declared on the element",
+			content:  `<content xmlns:enc="http://schemas.xmlsoap.org/soap/encoding/" xsi:type="enc:base64">AAEC/w==</content>`,
+			expected: []byte{0, 1, 2, 255},
+		},
+		{
+			name:     "wrapped lines",
+			content:  "<content xsi:type=\"soapenc:base64\">\r\n  AAEC\r\n  /w==\r\n</content>",
+			expected: []byte{0, 1, 2, 255},
+		},
+		{
+			name:     "empty",
+			content:  `<content xsi:type="soapenc:base64"/>`,
+			expected: []byte{},
+		},
+		{
+			name:     "xsd type",
+			content:  `<content xsi:type="xsd:base64Binary">AAEC/w==</content>`,
+			expected: []byte("AAEC/w=="),
+		},
+		{
+			name:     "untyped",
+			content:  `<content>AAEC/w==</content>`,
+			expected: []byte("AAEC/w=="),
+		},
+		{
+			name:    "invalid",
+			content: `<content xsi:type="soapenc:base64">AA*C</content>`,
+			err:     true,
+		},
+		{
+			name:    "element content",
+			content: `<content xsi:type="soapenc:base64"><part>AAEC</part></content>`,
+			err:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := `<soapenv:Envelope xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/"` +
+				` xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/"` +
+				` xmlns:xsd="http://www.w3.org/2001/XMLSchema" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+				`<soapenv:Body><ns1:getDocumentResponse xmlns:ns1="urn:example">` +
+				`<name xsi:type="xsd:string">report.pdf</name>` + tt.content +
+				`</ns1:getDocumentResponse></soapenv:Body></soapenv:Envelope>`
+
+			content := &soapEncBase64Example{}
+			_, err := DecodeEnvelope([]byte(data), content, nil)
+			if tt.err {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, "report.pdf", content.Name)
+			assert.Equal(t, tt.expected, append([]byte{}, content.Content...))
+		})
+	}
+}
+
+func TestDecodeSOAPEncBase64Element(t *testing.T) {
+	type document struct {
+		XMLName xml.Name `xml:"urn:example document"`
+		Content []byte   `xml:"http://schemas.xmlsoap.org/soap/encoding/ base64"`
+	}
+
+	data := `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>` +
+		`<document xmlns="urn:example"><soapenc:base64 xmlns:soapenc="http://schemas.xmlsoap.org/soap/encoding/">aGVsbG8=</soapenc:base64></document>` +
+		`</Body></Envelope>`
+
+	content := &document{}
+	_, err := DecodeEnvelope([]byte(data), content, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("hello"), content.Content)
+}
@@ -0,0 +1,21 @@
+package soaptest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Enflick/gosoap"
+)
+
+// NewClient starts an httptest.Server serving handler, and returns a soap.Client wired to it along with the
+// server's base URL for use as the request endpoint.
+// The server is shut down automatically when the test (or benchmark) t completes.
+func NewClient(t testing.TB, handler http.HandlerFunc) (*soap.Client, string) {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return soap.NewClient(server.Client()), server.URL
+}
@@ -0,0 +1,27 @@
+package soaptest
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Enflick/gosoap"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClient(t *testing.T) {
+	var action string
+	client, url := NewClient(t, func(w http.ResponseWriter, r *http.Request) {
+		action = r.Header.Get("SOAPAction")
+
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><GetQuoteResponse xmlns="http://example.com/quotes"><Price>7</Price></GetQuoteResponse></Body></Envelope>`))
+	})
+
+	resp := &quoteResponse{}
+	soapResp, err := client.Do(context.Background(), soap.NewRequest("GetQuote", url, &quoteRequest{Symbol: "TN"}, resp, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, soapResp.StatusCode)
+	assert.Equal(t, "GetQuote", action)
+	assert.Equal(t, int32(7), resp.Price)
+}
@@ -0,0 +1,240 @@
+package soaptest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Implements the semantic comparison of XML documents, such as envelopes.
+// Unlike NormalizeXML, names are compared by namespace rather than by prefix, so documents which only differ in the
+// prefixes they declare are equal.
+
+// DifferenceKind is the kind of a difference found by DiffXML.
+type DifferenceKind int
+
+const (
+	// ElementDifference is an element whose name differs, or which is missing or unexpected.
+	ElementDifference DifferenceKind = iota
+	// AttributeDifference is an attribute whose value differs, or which is missing or unexpected.
+	AttributeDifference
+	// TextDifference is an element whose text content differs.
+	TextDifference
+)
+
+// String returns the name of the kind of difference.
+func (k DifferenceKind) String() string {
+	switch k {
+	case ElementDifference:
+		return "element"
+	case AttributeDifference:
+		return "attribute"
+	case TextDifference:
+		return "text"
+	}
+	return "DifferenceKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Difference is a difference between two XML documents.
+type Difference struct {
+	Kind DifferenceKind
+	// Path locates the difference, as the local names of the elements from the root, each followed by its position
+	// among its siblings of the same name if there are several, and of the attribute for attribute differences:
+	// /Envelope/Body/GetQuote/Symbol[2]/@currency.
+	Path string
+	// Want and Got are the name of the element, the value of the attribute or the text, in each document. The names are
+	// in the {namespace}local form. Either is empty if the element or attribute is missing from that document.
+	Want string
+	Got  string
+}
+
+// String returns a description of the difference.
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s differs: want %q, got %q", d.Path, d.Kind, d.Want, d.Got)
+}
+
+// xmlNode is an element of a document being compared, with its namespace declarations and insignificant whitespace
+// removed.
+type xmlNode struct {
+	name     xml.Name
+	attrs    []xml.Attr
+	text     string
+	children []*xmlNode
+}
+
+// EqualXML reports whether the XML documents a and b are semantically equal, as described in DiffXML.
+func EqualXML(a, b []byte) (bool, error) {
+	diffs, err := DiffXML(a, b)
+	return len(diffs) == 0, err
+}
+
+// DiffXML compares the XML documents want and got, and returns their differences, in document order.
+// The documents are compared semantically: element and attribute names by namespace and local name, whatever the
+// prefixes bound to the namespaces, attributes regardless of their order, and text with leading and trailing
+// whitespace trimmed, whitespace between elements being insignificant. Namespace declarations, comments and processing
+// instructions are ignored. Prefixes appearing in text or attribute values, as in xsi:type, are compared as is.
+// Child elements are compared in order; once an element differs in name, its content isn't compared.
+func DiffXML(want, got []byte) ([]Difference, error) {
+	wantRoot, err := parseXMLNode(want)
+	if err != nil {
+		return nil, fmt.Errorf("soaptest: unable to parse want document: %s", err.Error())
+	}
+	gotRoot, err := parseXMLNode(got)
+	if err != nil {
+		return nil, fmt.Errorf("soaptest: unable to parse got document: %s", err.Error())
+	}
+
+	var diffs []Difference
+	diffNodes(&diffs, "/"+wantRoot.name.Local, wantRoot, gotRoot)
+	return diffs, nil
+}
+
+// AssertEqualXML compares the XML documents want and got with DiffXML, and fails the test with their differences if
+// they aren't equal.
+func AssertEqualXML(t testing.TB, want, got []byte) bool {
+	t.Helper()
+
+	diffs, err := DiffXML(want, got)
+	if err != nil {
+		t.Errorf("%s", err.Error())
+		return false
+	}
+	if len(diffs) == 0 {
+		return true
+	}
+
+	var msg strings.Builder
+	for _, diff := range diffs {
+		msg.WriteString(diff.String() + "\n")
+	}
+	t.Errorf("soaptest: documents differ:\n%s", msg.String())
+	return false
+}
+
+// parseXMLNode parses the document in data into the tree of its root element.
+func parseXMLNode(data []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root *xmlNode
+	var stack []*xmlNode
+	var text []*strings.Builder
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: token.Name}
+			for _, attr := range token.Attr {
+				if attr.Name.Space == "xmlns" || attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+					continue
+				}
+				node.attrs = append(node.attrs, attr)
+			}
+			sort.Slice(node.attrs, func(i, j int) bool {
+				return xmlName(node.attrs[i].Name) < xmlName(node.attrs[j].Name)
+			})
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root != nil {
+				return nil, fmt.Errorf("document has several root elements")
+			} else {
+				root = node
+			}
+			stack = append(stack, node)
+			text = append(text, &strings.Builder{})
+		case xml.EndElement:
+			stack[len(stack)-1].text = strings.TrimSpace(text[len(text)-1].String())
+			stack, text = stack[:len(stack)-1], text[:len(text)-1]
+		case xml.CharData:
+			if len(text) > 0 {
+				text[len(text)-1].Write(token)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, fmt.Errorf("document has no root element")
+	}
+	return root, nil
+}
+
+// diffNodes appends the differences between the elements want and got, and between their children, to diffs.
+func diffNodes(diffs *[]Difference, path string, want, got *xmlNode) {
+	if want.name != got.name {
+		*diffs = append(*diffs, Difference{Kind: ElementDifference, Path: path, Want: xmlName(want.name), Got: xmlName(got.name)})
+		return
+	}
+
+	i, j := 0, 0
+	for i < len(want.attrs) || j < len(got.attrs) {
+		switch {
+		case j == len(got.attrs) || i < len(want.attrs) && xmlName(want.attrs[i].Name) < xmlName(got.attrs[j].Name):
+			*diffs = append(*diffs, Difference{Kind: AttributeDifference, Path: path + "/@" + want.attrs[i].Name.Local, Want: want.attrs[i].Value})
+			i++
+		case i == len(want.attrs) || xmlName(got.attrs[j].Name) < xmlName(want.attrs[i].Name):
+			*diffs = append(*diffs, Difference{Kind: AttributeDifference, Path: path + "/@" + got.attrs[j].Name.Local, Got: got.attrs[j].Value})
+			j++
+		default:
+			if want.attrs[i].Value != got.attrs[j].Value {
+				*diffs = append(*diffs, Difference{Kind: AttributeDifference, Path: path + "/@" + want.attrs[i].Name.Local, Want: want.attrs[i].Value, Got: got.attrs[j].Value})
+			}
+			i++
+			j++
+		}
+	}
+
+	if want.text != got.text {
+		*diffs = append(*diffs, Difference{Kind: TextDifference, Path: path, Want: want.text, Got: got.text})
+	}
+
+	wantPaths, gotPaths := childPaths(path, want.children), childPaths(path, got.children)
+	for k := 0; k < len(want.children) || k < len(got.children); k++ {
+		switch {
+		case k >= len(got.children):
+			*diffs = append(*diffs, Difference{Kind: ElementDifference, Path: wantPaths[k], Want: xmlName(want.children[k].name)})
+		case k >= len(want.children):
+			*diffs = append(*diffs, Difference{Kind: ElementDifference, Path: gotPaths[k], Got: xmlName(got.children[k].name)})
+		default:
+			diffNodes(diffs, wantPaths[k], want.children[k], got.children[k])
+		}
+	}
+}
+
+// childPaths returns the paths of the children of the element at path.
+func childPaths(path string, children []*xmlNode) []string {
+	counts := map[string]int{}
+	for _, child := range children {
+		counts[child.name.Local]++
+	}
+
+	paths := make([]string, len(children))
+	positions := map[string]int{}
+	for k, child := range children {
+		paths[k] = path + "/" + child.name.Local
+		if counts[child.name.Local] > 1 {
+			positions[child.name.Local]++
+			paths[k] += "[" + strconv.Itoa(positions[child.name.Local]) + "]"
+		}
+	}
+	return paths
+}
+
+// xmlName returns the name in the {namespace}local form, or just local if it has no namespace.
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return "{" + name.Space + "}" + name.Local
+}
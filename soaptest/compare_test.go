@@ -0,0 +1,79 @@
+package soaptest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffXML(t *testing.T) {
+	const want = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><q:GetQuote xmlns:q="http://example.com/quotes" a="1" b="2"><q:Symbol>TN</q:Symbol></q:GetQuote></soap:Body></soap:Envelope>`
+
+	tests := []struct {
+		name  string
+		got   string
+		diffs []Difference
+	}{
+		{
+			"equivalent",
+			"<Envelope xmlns=\"http://schemas.xmlsoap.org/soap/envelope/\">\n  <Body>\n    <!-- quote -->\n    <GetQuote xmlns=\"http://example.com/quotes\" b=\"2\" a=\"1\">\n      <Symbol> TN </Symbol>\n    </GetQuote>\n  </Body>\n</Envelope>",
+			nil,
+		},
+		{
+			"text",
+			`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><GetQuote xmlns="http://example.com/quotes" a="1" b="2"><Symbol>GOOG</Symbol></GetQuote></Body></Envelope>`,
+			[]Difference{{Kind: TextDifference, Path: "/Envelope/Body/GetQuote/Symbol", Want: "TN", Got: "GOOG"}},
+		},
+		{
+			"attributes",
+			`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><GetQuote xmlns="http://example.com/quotes" b="3" c="4"><Symbol>TN</Symbol></GetQuote></Body></Envelope>`,
+			[]Difference{
+				{Kind: AttributeDifference, Path: "/Envelope/Body/GetQuote/@a", Want: "1"},
+				{Kind: AttributeDifference, Path: "/Envelope/Body/GetQuote/@b", Want: "2", Got: "3"},
+				{Kind: AttributeDifference, Path: "/Envelope/Body/GetQuote/@c", Got: "4"},
+			},
+		},
+		{
+			"namespace",
+			`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><GetQuote xmlns="http://example.com/other" a="1" b="2"><Symbol>TN</Symbol></GetQuote></Body></Envelope>`,
+			[]Difference{{Kind: ElementDifference, Path: "/Envelope/Body/GetQuote", Want: "{http://example.com/quotes}GetQuote", Got: "{http://example.com/other}GetQuote"}},
+		},
+		{
+			"children",
+			`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body><GetQuote xmlns="http://example.com/quotes" a="1" b="2"><Symbol>TN</Symbol><Symbol>GOOG</Symbol></GetQuote></Body></Envelope>`,
+			[]Difference{{Kind: ElementDifference, Path: "/Envelope/Body/GetQuote/Symbol[2]", Got: "{http://example.com/quotes}Symbol"}},
+		},
+		{
+			"missing",
+			`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body/></Envelope>`,
+			[]Difference{{Kind: ElementDifference, Path: "/Envelope/Body/GetQuote", Want: "{http://example.com/quotes}GetQuote"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diffs, err := DiffXML([]byte(want), []byte(test.got))
+			assert.Nil(t, err)
+			assert.Equal(t, test.diffs, diffs)
+
+			equal, err := EqualXML([]byte(want), []byte(test.got))
+			assert.Nil(t, err)
+			assert.Equal(t, test.diffs == nil, equal)
+		})
+	}
+
+	_, err := DiffXML([]byte(want), []byte("no xml here"))
+	assert.NotNil(t, err)
+	_, err = DiffXML([]byte("<a/><b/>"), []byte(want))
+	assert.NotNil(t, err)
+}
+
+func TestAssertEqualXML(t *testing.T) {
+	assert.True(t, AssertEqualXML(t, []byte(`<a xmlns="urn:x"><b/></a>`), []byte(`<x:a xmlns:x="urn:x"><x:b></x:b></x:a>`)))
+
+	tb := &recordingTB{TB: t}
+	assert.False(t, AssertEqualXML(tb, []byte(`<a><b/></a>`), []byte(`<a><c/></a>`)))
+	assert.Len(t, tb.errors, 1)
+
+	assert.Equal(t, `/a/b: element differs: want "b", got "c"`, Difference{Kind: ElementDifference, Path: "/a/b", Want: "b", Got: "c"}.String())
+}
@@ -0,0 +1,21 @@
+/*
+Package soaptest provides utilities for testing code which uses the soap package.
+
+The Server type is an in-memory SOAP service which responds to each SOAP action with a canned response or fault,
+and records every envelope it receives so tests can make assertions about what was sent:
+
+	server := soaptest.NewServer()
+	defer server.Close()
+
+	server.HandleResponse("GetQuote", &GetQuoteResponse{Price: 12})
+
+	soapReq := soap.NewRequest("GetQuote", server.URL, &GetQuote{Symbol: "TN"}, &GetQuoteResponse{}, nil)
+	soapResp, err := soap.NewClient(&http.Client{}).Do(context.Background(), soapReq)
+
+	sent := &GetQuote{}
+	server.Requests()[0].Decode(sent)
+
+DiffXML compares two documents semantically, regardless of attribute order, namespace prefixes and whitespace between
+elements, and AssertEqualXML fails a test with the differences found.
+*/
+package soaptest
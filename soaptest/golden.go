@@ -0,0 +1,192 @@
+package soaptest
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+)
+
+// Implements golden file comparison of serialized SOAP envelopes.
+// Envelopes are normalized before comparison so that formatting and generated values do not cause spurious failures.
+
+var updateGolden = flag.Bool("soaptest.update", false, "update the golden files used by soaptest.AssertGolden")
+
+// maskedElements is the set of elements whose text content is generated on each request, keyed by local name.
+var maskedElements = map[string]bool{
+	"DigestValue":    true,
+	"SignatureValue": true,
+}
+
+const maskedValue = "MASKED"
+
+// NormalizeXML returns a canonical, indented representation of the supplied XML document suitable for comparisons.
+// Whitespace between elements is removed, attributes are sorted, and values generated during serialization
+// are replaced with stable placeholders: every 'Id' attribute (in any namespace) is renumbered in document order,
+// '#id' references to them are rewritten to match, and the content of the DigestValue and SignatureValue elements is masked.
+func NormalizeXML(data []byte) ([]byte, error) {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return nil, err
+	}
+
+	root := doc.Root()
+	if root == nil {
+		return nil, fmt.Errorf("soaptest: document has no root element")
+	}
+
+	normalized := etree.NewDocument()
+	normalized.SetRoot(root.Copy())
+
+	ids := map[string]string{}
+	collectIDs(normalized.Root(), ids)
+	normalizeElement(normalized.Root(), ids)
+
+	normalized.Indent(2)
+	return normalized.WriteToBytes()
+}
+
+// collectIDs assigns a placeholder to every Id attribute value, in document order.
+func collectIDs(elem *etree.Element, ids map[string]string) {
+	for _, attr := range elem.Attr {
+		if attr.Key == "Id" {
+			if _, ok := ids[attr.Value]; !ok {
+				ids[attr.Value] = fmt.Sprintf("ID-%d", len(ids)+1)
+			}
+		}
+	}
+
+	for _, child := range elem.ChildElements() {
+		collectIDs(child, ids)
+	}
+}
+
+// normalizeElement strips insignificant whitespace, sorts attributes, and masks generated values on elem and its children.
+func normalizeElement(elem *etree.Element, ids map[string]string) {
+	for i, attr := range elem.Attr {
+		if attr.Key == "Id" {
+			elem.Attr[i].Value = ids[attr.Value]
+		} else if strings.HasPrefix(attr.Value, "#") {
+			if id, ok := ids[attr.Value[1:]]; ok {
+				elem.Attr[i].Value = "#" + id
+			}
+		}
+	}
+
+	sort.SliceStable(elem.Attr, func(i, j int) bool {
+		if elem.Attr[i].Space != elem.Attr[j].Space {
+			return elem.Attr[i].Space < elem.Attr[j].Space
+		}
+		return elem.Attr[i].Key < elem.Attr[j].Key
+	})
+
+	if maskedElements[elem.Tag] {
+		elem.SetText(maskedValue)
+		return
+	}
+
+	for _, token := range append([]etree.Token(nil), elem.Child...) {
+		switch token := token.(type) {
+		case *etree.CharData:
+			if strings.TrimSpace(token.Data) == "" {
+				elem.RemoveChild(token)
+			} else {
+				token.Data = strings.TrimSpace(token.Data)
+			}
+		case *etree.Comment:
+			elem.RemoveChild(token)
+		case *etree.Element:
+			normalizeElement(token, ids)
+		}
+	}
+}
+
+// AssertGolden compares the serialized envelope got against the contents of the golden file at path, after normalizing
+// both with NormalizeXML. If they differ, the test is failed with a line diff of the normalized documents.
+// If the test binary is run with the -soaptest.update flag, the golden file is (re)written with the normalized
+// form of got instead.
+func AssertGolden(t testing.TB, got []byte, path string) {
+	t.Helper()
+
+	normalizedGot, err := NormalizeXML(got)
+	if err != nil {
+		t.Errorf("soaptest: unable to normalize envelope: %s", err.Error())
+		return
+	}
+
+	if *updateGolden {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Errorf("soaptest: unable to create golden file directory: %s", err.Error())
+			return
+		}
+		if err := ioutil.WriteFile(path, normalizedGot, 0644); err != nil {
+			t.Errorf("soaptest: unable to update golden file: %s", err.Error())
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("soaptest: unable to read golden file (run with -soaptest.update to create it): %s", err.Error())
+		return
+	}
+
+	normalizedWant, err := NormalizeXML(want)
+	if err != nil {
+		t.Errorf("soaptest: unable to normalize golden file %s: %s", path, err.Error())
+		return
+	}
+
+	if string(normalizedGot) != string(normalizedWant) {
+		t.Errorf("soaptest: envelope does not match golden file %s (-want +got):\n%s", path, lineDiff(string(normalizedWant), string(normalizedGot)))
+	}
+}
+
+// lineDiff produces a minimal line based diff between a and b. Removed lines are prefixed with '-', added lines with '+',
+// and unchanged lines with a space.
+func lineDiff(a, b string) string {
+	aLines := strings.Split(a, "\n")
+	bLines := strings.Split(b, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of aLines[i:] and bLines[j:].
+	lcs := make([][]int, len(aLines)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(bLines)+1)
+	}
+	for i := len(aLines) - 1; i >= 0; i-- {
+		for j := len(bLines) - 1; j >= 0; j-- {
+			if aLines[i] == bLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(aLines) || j < len(bLines) {
+		switch {
+		case i < len(aLines) && j < len(bLines) && aLines[i] == bLines[j]:
+			diff.WriteString("  " + aLines[i] + "\n")
+			i++
+			j++
+		case i < len(aLines) && (j == len(bLines) || lcs[i+1][j] >= lcs[i][j+1]):
+			diff.WriteString("- " + aLines[i] + "\n")
+			i++
+		default:
+			diff.WriteString("+ " + bLines[j] + "\n")
+			j++
+		}
+	}
+
+	return diff.String()
+}
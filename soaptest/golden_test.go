@@ -0,0 +1,70 @@
+package soaptest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSignedEnvelope = `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:xsd="http://www.w3.org/2001/XMLSchema"><Header xmlns="http://schemas.xmlsoap.org/soap/envelope/"><wsse:Security xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"><wsse:BinarySecurityToken xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd" wsu:Id="SecurityToken-%s" EncodingType="enc" ValueType="val">TOKEN</wsse:BinarySecurityToken><Signature xmlns="http://www.w3.org/2000/09/xmldsig#"><SignedInfo xmlns="http://www.w3.org/2000/09/xmldsig#"><Reference URI="#Body-%s"><DigestValue>%s</DigestValue></Reference></SignedInfo><SignatureValue>%s</SignatureValue><KeyInfo><wsse:SecurityTokenReference><wsse:Reference URI="#SecurityToken-%s"></wsse:Reference></wsse:SecurityTokenReference></KeyInfo></Signature></wsse:Security></Header><Body xmlns="http://schemas.xmlsoap.org/soap/envelope/" xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd" wsu:Id="Body-%s"><GetQuote xmlns="http://example.com/quotes"><Symbol>%s</Symbol></GetQuote></Body></Envelope>`
+
+func signedEnvelope(id string, digest string, symbol string) []byte {
+	return []byte(strings.NewReplacer(
+		"SecurityToken-%s", "SecurityToken-"+id,
+		"Body-%s", "Body-"+id,
+		"<DigestValue>%s", "<DigestValue>"+digest,
+		"<SignatureValue>%s", "<SignatureValue>"+digest,
+		"<Symbol>%s", "<Symbol>"+symbol,
+	).Replace(testSignedEnvelope))
+}
+
+func TestNormalizeXML(t *testing.T) {
+	first, err := NormalizeXML(signedEnvelope("abc123", "digest1", "TN"))
+	assert.Nil(t, err)
+	second, err := NormalizeXML(signedEnvelope("def456", "digest2", "TN"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, string(first), string(second))
+	assert.Contains(t, string(first), `<Reference URI="#ID-2">`)
+	assert.Contains(t, string(first), `<DigestValue>MASKED</DigestValue>`)
+
+	reordered, err := NormalizeXML([]byte("<a z=\"1\"  y=\"2\">\n  <b>  text </b>\n</a>"))
+	assert.Nil(t, err)
+	assert.Equal(t, "<a y=\"2\" z=\"1\">\n  <b>text</b>\n</a>\n", string(reordered))
+
+	_, err = NormalizeXML([]byte("no xml here"))
+	assert.NotNil(t, err)
+}
+
+// recordingTB captures test failures rather than failing the test it wraps.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, format)
+}
+
+func TestAssertGolden(t *testing.T) {
+	AssertGolden(t, signedEnvelope("abc123", "digest1", "TN"), "testdata/signed.golden")
+	if *updateGolden {
+		return
+	}
+
+	tb := &recordingTB{TB: t}
+	AssertGolden(tb, signedEnvelope("abc123", "digest1", "GOOG"), "testdata/signed.golden")
+	assert.Len(t, tb.errors, 1)
+
+	tb = &recordingTB{TB: t}
+	AssertGolden(tb, signedEnvelope("abc123", "digest1", "TN"), "testdata/missing.golden")
+	assert.Len(t, tb.errors, 1)
+}
+
+func TestLineDiff(t *testing.T) {
+	assert.Equal(t, "  a\n- b\n+ c\n  d\n", lineDiff("a\nb\nd", "a\nc\nd"))
+	assert.Equal(t, "  a\n+ b\n", lineDiff("a", "a\nb"))
+}
@@ -0,0 +1,142 @@
+package soaptest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/Enflick/gosoap"
+)
+
+// Request is a SOAP request received by the Server.
+type Request struct {
+	// Action is the SOAPAction the request was sent with, with any surrounding quotes removed.
+	Action string
+	// Header contains the HTTP headers the request was sent with.
+	Header http.Header
+	// Envelope is the serialized SOAP envelope received.
+	Envelope []byte
+}
+
+// Decode deserializes the body of the received envelope into the content argument.
+func (r *Request) Decode(content interface{}) error {
+	return xml.NewDecoder(bytes.NewReader(r.Envelope)).Decode(soap.NewEnvelope(content))
+}
+
+// response is a canned reply to a SOAP action.
+type response struct {
+	body  interface{}
+	fault *soap.Fault
+}
+
+// Server is an in-memory SOAP service listening on a local loopback address.
+// Canned responses and faults are registered per SOAP action; requests for actions without a registered
+// response are answered with a Client fault.
+// All methods are safe for concurrent use.
+type Server struct {
+	// URL is the endpoint of the server, suitable for passing to soap.NewRequest.
+	URL string
+
+	server *httptest.Server
+
+	mu        sync.Mutex
+	responses map[string]response
+	requests  []*Request
+}
+
+// NewServer creates and starts a new Server. The caller should call Close when finished to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		responses: make(map[string]response),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveSOAP))
+	s.URL = s.server.URL
+
+	return s
+}
+
+// Close shuts down the server, blocking until all outstanding requests have completed.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// HandleResponse registers body as the SOAP body sent in response to requests for the specified action.
+// Any previously registered response or fault for the action is replaced.
+func (s *Server) HandleResponse(action string, body interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses[action] = response{body: body}
+}
+
+// HandleFault registers fault as the SOAP fault sent in response to requests for the specified action.
+// Any previously registered response or fault for the action is replaced.
+func (s *Server) HandleFault(action string, fault *soap.Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses[action] = response{fault: fault}
+}
+
+// Requests returns the requests received by the server, in the order they arrived.
+func (s *Server) Requests() []*Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*Request(nil), s.requests...)
+}
+
+// Reset clears the received requests.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = nil
+}
+
+func (s *Server) serveSOAP(w http.ResponseWriter, r *http.Request) {
+	envelope, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &Request{
+		Action:   strings.Trim(r.Header.Get("SOAPAction"), `"`),
+		Header:   r.Header,
+		Envelope: envelope,
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	resp, ok := s.responses[req.Action]
+	s.mu.Unlock()
+
+	if !ok {
+		soap.WriteFault(w, &soap.Fault{
+			Code:   "Client",
+			String: "no response registered for action '" + req.Action + "'",
+		}, soap.SOAP11)
+		return
+	} else if resp.fault != nil {
+		soap.WriteFault(w, resp.fault, soap.SOAP11)
+		return
+	}
+
+	respEnc, err := xml.Marshal(soap.NewEnvelope(resp.body))
+	if err != nil {
+		soap.WriteFault(w, &soap.Fault{
+			Code:   "Server",
+			String: err.Error(),
+		}, soap.SOAP11)
+		return
+	}
+
+	w.Header().Set("Content-Type", soap.SOAP11.ContentType())
+	w.WriteHeader(http.StatusOK)
+	w.Write(respEnc)
+}
@@ -0,0 +1,77 @@
+package soaptest
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"testing"
+
+	"github.com/Enflick/gosoap"
+	"github.com/stretchr/testify/assert"
+)
+
+type quoteRequest struct {
+	XMLName xml.Name `xml:"http://example.com/quotes GetQuote"`
+	Symbol  string   `xml:"Symbol"`
+}
+
+type quoteResponse struct {
+	XMLName xml.Name `xml:"http://example.com/quotes GetQuoteResponse"`
+	Price   int32    `xml:"Price"`
+}
+
+func TestServerResponse(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.HandleResponse("GetQuote", &quoteResponse{Price: 12})
+
+	resp := &quoteResponse{}
+	soapReq := soap.NewRequest("GetQuote", server.URL, &quoteRequest{Symbol: "TN"}, resp, nil)
+	soapResp, err := soap.NewClient(&http.Client{}).Do(context.Background(), soapReq)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, soapResp.StatusCode)
+	assert.Nil(t, soapResp.Fault())
+	assert.Equal(t, int32(12), resp.Price)
+
+	requests := server.Requests()
+	assert.Len(t, requests, 1)
+	assert.Equal(t, "GetQuote", requests[0].Action)
+
+	sent := &quoteRequest{}
+	assert.Nil(t, requests[0].Decode(sent))
+	assert.Equal(t, "TN", sent.Symbol)
+
+	server.Reset()
+	assert.Empty(t, server.Requests())
+}
+
+func TestServerFault(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	server.HandleFault("GetQuote", &soap.Fault{
+		Code:   "soap:Client",
+		String: "unknown symbol",
+	})
+
+	soapReq := soap.NewRequest("GetQuote", server.URL, &quoteRequest{Symbol: "TN"}, &quoteResponse{}, nil)
+	soapResp, err := soap.NewClient(&http.Client{}).Do(context.Background(), soapReq)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusInternalServerError, soapResp.StatusCode)
+	assert.NotNil(t, soapResp.Fault())
+	assert.Equal(t, "soap:Client", soapResp.Fault().Code)
+	assert.Equal(t, "unknown symbol", soapResp.Fault().String)
+}
+
+func TestServerUnregisteredAction(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	soapReq := soap.NewRequest("GetQuote", server.URL, &quoteRequest{Symbol: "TN"}, &quoteResponse{}, nil)
+	soapResp, err := soap.NewClient(&http.Client{}).Do(context.Background(), soapReq)
+	assert.Nil(t, err)
+	assert.NotNil(t, soapResp.Fault())
+	assert.Equal(t, "Client", soapResp.Fault().Code)
+	assert.Len(t, server.Requests(), 1)
+}
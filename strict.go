@@ -0,0 +1,104 @@
+package soap
+
+import (
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Implements the strict checking of the namespaces of the elements decoded into the content of responses.
+
+// WithStrictNamespaces makes the client check the namespaces of the elements of response bodies against those
+// declared by the xml tags of the response type, rather than decoding elements of any namespace into fields whose tags
+// don't name one. The body element must be in the namespace of the XMLName field of the response type, if it names
+// one, or the response fails with an UnexpectedResponseError. So do responses holding elements within the body element
+// in any namespace other than that of the body element, those named by the tags of the response type and the types
+// of its fields, and no namespace, as for the local elements of schemas whose elementFormDefault is unqualified.
+// Elements decoded by custom unmarshalers or into fields tagged `xml:",any"`, such as RawXML, are checked in the same
+// way, so the namespaces of their content must be named by a tag too. Faults and header entries aren't checked.
+func WithStrictNamespaces() ClientOption {
+	return func(c *Client) {
+		c.strictNamespaces = true
+	}
+}
+
+// decodeStrict decodes the element started by start from d into v, checking the namespaces of its elements as
+// described for WithStrictNamespaces.
+func decodeStrict(d *xml.Decoder, v interface{}, start xml.StartElement) error {
+	if expected := elementName(v); expected.Space != "" && expected.Space != start.Name.Space {
+		return &UnexpectedResponseError{Expected: expected, Name: start.Name}
+	}
+
+	allowed := map[string]bool{"": true, start.Name.Space: true}
+	typeNamespaces(reflect.TypeOf(v), allowed, map[reflect.Type]bool{})
+
+	// The element is decoded from a decoder of its own, which starts with it and ends with its end element.
+	r := &namespaceCheckReader{d: d, start: &start, allowed: allowed, namespace: start.Name.Space}
+	return xml.NewTokenDecoder(r).Decode(v)
+}
+
+// typeNamespaces adds the namespaces named by the xml tags of the fields of the type, and of their types, to
+// namespaces. The types in seen are skipped.
+func typeNamespaces(t reflect.Type, namespaces map[string]bool, seen map[reflect.Type]bool) {
+	for t != nil && (t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("xml"), ",")[0]
+		if idx := strings.Index(name, " "); idx >= 0 {
+			namespaces[name[:idx]] = true
+		}
+		typeNamespaces(field.Type, namespaces, seen)
+	}
+}
+
+// namespaceCheckReader is a token reader reading an element from a decoder, which fails at the first element within
+// it that isn't in one of the allowed namespaces.
+type namespaceCheckReader struct {
+	d *xml.Decoder
+	// start is the start of the element, which is read first.
+	start   *xml.StartElement
+	allowed map[string]bool
+	// namespace is the namespace of the element, which the elements within it are expected to be in.
+	namespace string
+	depth     int
+}
+
+// Token satisfies the xml.TokenReader interface.
+func (r *namespaceCheckReader) Token() (xml.Token, error) {
+	if r.start != nil {
+		start := *r.start
+		r.start = nil
+		r.depth++
+		return start, nil
+	}
+	if r.depth == 0 {
+		return nil, io.EOF
+	}
+
+	token, err := r.d.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case xml.StartElement:
+		if !r.allowed[t.Name.Space] {
+			return nil, &UnexpectedResponseError{Expected: xml.Name{Space: r.namespace, Local: t.Name.Local}, Name: t.Name}
+		}
+		r.depth++
+	case xml.EndElement:
+		r.depth--
+	}
+	return xml.CopyToken(token), nil
+}
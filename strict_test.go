@@ -0,0 +1,93 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type strictTestQuote struct {
+	XMLName xml.Name          `xml:"urn:quotes GetQuoteResponse"`
+	Price   string            `xml:"Price"`
+	Market  *strictTestMarket `xml:"urn:markets Market"`
+}
+
+type strictTestMarket struct {
+	Name string `xml:"Name"`
+}
+
+func TestClientStrictNamespaces(t *testing.T) {
+	var tests = []struct {
+		name     string
+		strict   bool
+		response string
+		want     *strictTestQuote
+		err      *UnexpectedResponseError
+	}{
+		{
+			name:     "qualified",
+			strict:   true,
+			response: `<q:GetQuoteResponse xmlns:q="urn:quotes"><q:Price>10</q:Price><m:Market xmlns:m="urn:markets"><m:Name>TSX</m:Name></m:Market></q:GetQuoteResponse>`,
+			want:     &strictTestQuote{Price: "10", Market: &strictTestMarket{Name: "TSX"}},
+		},
+		{
+			name:     "unqualified",
+			strict:   true,
+			response: `<q:GetQuoteResponse xmlns:q="urn:quotes"><Price>10</Price></q:GetQuoteResponse>`,
+			want:     &strictTestQuote{Price: "10"},
+		},
+		{
+			name:     "wrong body namespace",
+			strict:   true,
+			response: `<GetQuoteResponse xmlns="urn:other"><Price>10</Price></GetQuoteResponse>`,
+			err:      &UnexpectedResponseError{Expected: xml.Name{Space: "urn:quotes", Local: "GetQuoteResponse"}, Name: xml.Name{Space: "urn:other", Local: "GetQuoteResponse"}},
+		},
+		{
+			name:     "wrong child namespace",
+			strict:   true,
+			response: `<q:GetQuoteResponse xmlns:q="urn:quotes"><o:Price xmlns:o="urn:other">10</o:Price></q:GetQuoteResponse>`,
+			err:      &UnexpectedResponseError{Expected: xml.Name{Space: "urn:quotes", Local: "Price"}, Name: xml.Name{Space: "urn:other", Local: "Price"}},
+		},
+		{
+			name:     "wrong child namespace without checking",
+			response: `<q:GetQuoteResponse xmlns:q="urn:quotes"><o:Price xmlns:o="urn:other">10</o:Price></q:GetQuoteResponse>`,
+			want:     &strictTestQuote{Price: "10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` + tt.response + `</soap:Body></soap:Envelope>`))
+			}))
+			defer server.Close()
+
+			var opts []ClientOption
+			if tt.strict {
+				opts = append(opts, WithStrictNamespaces())
+			}
+			quote := &strictTestQuote{}
+			_, err := NewClient(nil, opts...).Do(context.Background(), NewRequest("GetQuote", server.URL, &headerExample{}, quote, nil))
+
+			if tt.err != nil {
+				var unexpected *UnexpectedResponseError
+				if assert.True(t, errors.As(err, &unexpected), "%v", err) {
+					assert.Equal(t, tt.err, unexpected)
+				}
+				assert.True(t, errors.Is(err, ErrDecode))
+				return
+			}
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want.Price, quote.Price)
+			assert.Equal(t, tt.want.Market, quote.Market)
+		})
+	}
+}
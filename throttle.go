@@ -0,0 +1,52 @@
+package soap
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Implements the recognition of requests the service rejected because it is throttling them, which are retried by a
+// RetryPolicy with RetryThrottled set.
+
+// ThrottledError is returned when the service responds with a 429 Too Many Requests or 503 Service Unavailable status
+// to a request made by a Client whose RetryPolicy retries throttled requests, and no attempts remain.
+type ThrottledError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// RetryAfter is the delay the service asked for in its Retry-After header, or 0 if it didn't.
+	RetryAfter time.Duration
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("request throttled by the service: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Unwrap returns the category of the error, ErrTransport.
+func (e *ThrottledError) Unwrap() error {
+	return ErrTransport
+}
+
+// isThrottleStatus checks whether the HTTP status code is one services use to throttle requests.
+func isThrottleStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either a number of seconds or an HTTP date, into the
+// delay from now it indicates. It returns 0 if the value is missing or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
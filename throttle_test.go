@@ -0,0 +1,197 @@
+package soap
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientThrottleRetries(t *testing.T) {
+	var tests = []struct {
+		name       string
+		opts       []ClientOption
+		throttle   func(w http.ResponseWriter)
+		throttled  int32
+		attempts   int32
+		statusCode int
+		faultCode  string
+	}{
+		{
+			name: "too many requests",
+			opts: []ClientOption{WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, RetryThrottled: true})},
+			throttle: func(w http.ResponseWriter) {
+				http.Error(w, "slow down", http.StatusTooManyRequests)
+			},
+			throttled: 2,
+			attempts:  3,
+		},
+		{
+			name: "service unavailable with retry-after",
+			opts: []ClientOption{WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Hour, RetryThrottled: true})},
+			throttle: func(w http.ResponseWriter) {
+				w.Header().Set("Retry-After", "1")
+				http.Error(w, "slow down", http.StatusServiceUnavailable)
+			},
+			throttled: 1,
+			attempts:  2,
+		},
+		{
+			name: "attempts exhausted",
+			opts: []ClientOption{WithRetryPolicy(RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond, RetryThrottled: true})},
+			throttle: func(w http.ResponseWriter) {
+				http.Error(w, "slow down", http.StatusTooManyRequests)
+			},
+			throttled:  5,
+			attempts:   2,
+			statusCode: http.StatusTooManyRequests,
+		},
+		{
+			name: "throttle fault",
+			opts: []ClientOption{WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, RetryThrottled: true, ThrottleFaultCodes: []string{"Throttled"}})},
+			throttle: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><s:Fault><faultcode xmlns:q="urn:quota">q:Throttled</faultcode><faultstring>Quota exceeded</faultstring></s:Fault></s:Body></s:Envelope>`, soapEnvNS)
+			},
+			throttled: 1,
+			attempts:  2,
+		},
+		{
+			name: "throttle fault with retry-after",
+			opts: []ClientOption{WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Hour, RetryThrottled: true, ThrottleFaultCodes: []string{"Throttled"}})},
+			throttle: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><s:Fault><faultcode xmlns:q="urn:quota">q:Throttled</faultcode><faultstring>Quota exceeded</faultstring></s:Fault></s:Body></s:Envelope>`, soapEnvNS)
+			},
+			throttled: 1,
+			attempts:  2,
+		},
+		{
+			name: "other fault",
+			opts: []ClientOption{WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, RetryThrottled: true, ThrottleFaultCodes: []string{"q:Throttled"}})},
+			throttle: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><s:Fault><faultcode>s:Server</faultcode></s:Fault></s:Body></s:Envelope>`, soapEnvNS)
+			},
+			throttled: 1,
+			attempts:  1,
+			faultCode: "s:Server",
+		},
+		{
+			name: "disabled",
+			throttle: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><s:Fault><faultcode>s:Server</faultcode></s:Fault></s:Body></s:Envelope>`, soapEnvNS)
+			},
+			throttled: 1,
+			attempts:  1,
+			faultCode: "s:Server",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) <= tt.throttled {
+					tt.throttle(w)
+					return
+				}
+				w.Header().Set("Content-Type", "text/xml")
+				fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><ContentExample attr1="1"></ContentExample></s:Body></s:Envelope>`, soapEnvNS)
+			}))
+			defer ts.Close()
+
+			content := &envelopeContentExample{}
+			resp, err := NewClient(nil, tt.opts...).Do(context.Background(), NewRequest("action", ts.URL, &envelopeContentExample{}, content, nil))
+			assert.Equal(t, tt.attempts, atomic.LoadInt32(&attempts))
+
+			switch {
+			case tt.statusCode != 0:
+				assert.Equal(t, &ThrottledError{StatusCode: tt.statusCode}, err)
+			case tt.faultCode != "":
+				if assert.Nil(t, err) && assert.NotNil(t, resp.Fault()) {
+					assert.Equal(t, tt.faultCode, resp.Fault().Code)
+				}
+			default:
+				if assert.Nil(t, err) {
+					assert.Nil(t, resp.Fault())
+					assert.Equal(t, int32(1), content.Attr1)
+				}
+			}
+		})
+	}
+}
+
+func TestClientThrottleRetriesPastDeadline(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Retry-After", "3600")
+		http.Error(w, "slow down", http.StatusTooManyRequests)
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := NewClient(nil, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, RetryThrottled: true}))
+	_, err := client.Do(ctx, NewRequest("action", ts.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil))
+	assert.Equal(t, &ThrottledError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	var tests = []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "missing", value: "", want: 0},
+		{name: "seconds", value: "120", want: 2 * time.Minute},
+		{name: "negative", value: "-5", want: 0},
+		{name: "date", value: "Sun, 01 Mar 2020 12:00:30 GMT", want: 30 * time.Second},
+		{name: "past date", value: "Sun, 01 Mar 2020 11:00:00 GMT", want: 0},
+		{name: "invalid", value: "soon", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseRetryAfter(tt.value, now))
+		})
+	}
+}
+
+func TestClientThrottleRetriesWithParts(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			http.Error(w, "slow down", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Body><ContentExample attr1="1"></ContentExample></s:Body></s:Envelope>`, soapEnvNS)
+	}))
+	defer ts.Close()
+
+	req := NewRequest("action", ts.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil)
+	req.AddPart(&MIMEPart{Reader: strings.NewReader("data"), ContentID: "data@example.com"})
+
+	// The part can't be sent again, so the request isn't retried.
+	_, err := NewClient(nil, WithRetryPolicy(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond, RetryThrottled: true})).Do(context.Background(), req)
+	assert.Equal(t, &ThrottledError{StatusCode: http.StatusServiceUnavailable}, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+}
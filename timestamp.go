@@ -0,0 +1,110 @@
+package soap
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// Implements the verification of the freshness of responses from their WS-Security timestamp.
+
+var (
+	// ErrTimestampMissing is returned if timestamp verification is enabled and a response other than a fault has no
+	// wsu:Timestamp in its security header.
+	ErrTimestampMissing = newCategoryError(ErrSecurity, "response has no security timestamp")
+	// ErrTimestampInvalid is returned if the creation or expiry time of the timestamp of a response can't be parsed.
+	ErrTimestampInvalid = newCategoryError(ErrSecurity, "response security timestamp is invalid")
+	// ErrTimestampStale is returned if a response has expired, or was created longer ago than the maximum age.
+	ErrTimestampStale = newCategoryError(ErrSecurity, "response security timestamp is stale")
+	// ErrTimestampFuture is returned if a response was created in the future, beyond the allowed clock skew.
+	ErrTimestampFuture = newCategoryError(ErrSecurity, "response security timestamp is in the future")
+	// ErrTimestampUnsigned is returned if the signature of a response is verified, and its timestamp isn't covered by
+	// the signature.
+	ErrTimestampUnsigned = newCategoryError(ErrSecurity, "response security timestamp is not signed")
+)
+
+var securityName = xml.Name{Space: wsseNS, Local: "Security"}
+
+// securityTimestampHeader is the part of the wsse:Security header of a response holding its timestamp.
+type securityTimestampHeader struct {
+	XMLName   xml.Name           `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd Security"`
+	Timestamp *securityTimestamp `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Timestamp"`
+}
+
+type securityTimestamp struct {
+	Created string `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Created"`
+	Expires string `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd Expires"`
+}
+
+// WithTimestampVerification makes the client check the wsu:Timestamp in the security header of responses against
+// the local time, rejecting responses which have expired, were created more than maxAge ago, or were created in the
+// future. The times are compared allowing for a clock skew of up to skew either way. A maxAge of 0 sets no maximum
+// age, leaving only the expiry time of the response.
+// Responses other than faults without a timestamp are rejected; faults are only checked if they have one, as many
+// services don't secure them.
+// If signatures are verified too (see WithSignatureVerification), the timestamp must be covered by the signature, or
+// the response is rejected with ErrTimestampUnsigned. Otherwise, the timestamp is only checked for staleness, and is
+// no more trustworthy than the connection the response was received over.
+func WithTimestampVerification(skew time.Duration, maxAge time.Duration) ClientOption {
+	return func(c *Client) {
+		c.verifyTimestamps = true
+		c.timestampSkew = skew
+		c.timestampMaxAge = maxAge
+	}
+}
+
+// responseTimestamp decodes the security header of the response from its captured header entries, rather than
+// registering a value for it to be decoded into, which would take the place of any registered by the request.
+func responseTimestamp(resp *Response) (*securityTimestampHeader, error) {
+	header := &securityTimestampHeader{}
+	for _, entry := range resp.Headers() {
+		if entry.Name == securityName {
+			if err := xml.Unmarshal(entry.Raw, header); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	return header, nil
+}
+
+// verifyTimestamp checks the timestamp decoded from the response against the current time.
+func (c *Client) verifyTimestamp(resp *Response, header *securityTimestampHeader, now time.Time) error {
+	if header.Timestamp == nil {
+		if resp.Fault() != nil {
+			return nil
+		}
+		return ErrTimestampMissing
+	}
+
+	created, err := parseTimestamp(header.Timestamp.Created)
+	if err != nil {
+		return err
+	}
+	if created.After(now.Add(c.timestampSkew)) {
+		return ErrTimestampFuture
+	}
+	if c.timestampMaxAge > 0 && now.Sub(created) > c.timestampMaxAge+c.timestampSkew {
+		return ErrTimestampStale
+	}
+
+	if header.Timestamp.Expires != "" {
+		expires, err := parseTimestamp(header.Timestamp.Expires)
+		if err != nil {
+			return err
+		}
+		if now.Add(-c.timestampSkew).After(expires) {
+			return ErrTimestampStale
+		}
+	}
+
+	return nil
+}
+
+// parseTimestamp parses a time of a timestamp, which must have a time zone.
+func parseTimestamp(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, ErrTimestampInvalid
+	}
+	return t, nil
+}
@@ -0,0 +1,169 @@
+package soap
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyTimestamp(t *testing.T) {
+	now := time.Date(2020, time.March, 1, 12, 0, 0, 0, time.UTC)
+	client := NewClient(nil, WithTimestampVerification(time.Minute, 5*time.Minute))
+
+	var tests = []struct {
+		name      string
+		timestamp *securityTimestamp
+		fault     bool
+		err       error
+	}{
+		{name: "fresh", timestamp: &securityTimestamp{Created: "2020-03-01T11:59:00Z", Expires: "2020-03-01T12:04:00Z"}},
+		{name: "fractional seconds", timestamp: &securityTimestamp{Created: "2020-03-01T11:59:00.123Z"}},
+		{name: "time zone", timestamp: &securityTimestamp{Created: "2020-03-01T13:59:00+02:00"}},
+		{name: "within skew", timestamp: &securityTimestamp{Created: "2020-03-01T12:00:30Z", Expires: "2020-03-01T11:59:30Z"}},
+		{name: "future", timestamp: &securityTimestamp{Created: "2020-03-01T12:02:00Z"}, err: ErrTimestampFuture},
+		{name: "expired", timestamp: &securityTimestamp{Created: "2020-03-01T11:55:00Z", Expires: "2020-03-01T11:58:00Z"}, err: ErrTimestampStale},
+		{name: "too old", timestamp: &securityTimestamp{Created: "2020-03-01T11:53:00Z"}, err: ErrTimestampStale},
+		{name: "invalid created", timestamp: &securityTimestamp{Created: "yesterday"}, err: ErrTimestampInvalid},
+		{name: "missing created", timestamp: &securityTimestamp{}, err: ErrTimestampInvalid},
+		{name: "no time zone", timestamp: &securityTimestamp{Created: "2020-03-01T12:00:00"}, err: ErrTimestampInvalid},
+		{name: "invalid expires", timestamp: &securityTimestamp{Created: "2020-03-01T12:00:00Z", Expires: "soon"}, err: ErrTimestampInvalid},
+		{name: "missing", err: ErrTimestampMissing},
+		{name: "missing on fault", fault: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &Response{}
+			if tt.fault {
+				resp.fault = NewFault()
+			}
+			err := client.verifyTimestamp(resp, &securityTimestampHeader{Timestamp: tt.timestamp}, now)
+			assert.Equal(t, tt.err, err)
+		})
+	}
+}
+
+func TestClientTimestampVerification(t *testing.T) {
+	var tests = []struct {
+		name    string
+		created time.Time
+		err     error
+	}{
+		{name: "fresh", created: time.Now()},
+		{name: "stale", created: time.Now().Add(-time.Hour), err: ErrTimestampStale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Header><wsse:Security xmlns:wsse="%s" xmlns:wsu="%s"><wsu:Timestamp><wsu:Created>%s</wsu:Created></wsu:Timestamp></wsse:Security></s:Header><s:Body><ContentExample attr1="1"></ContentExample></s:Body></s:Envelope>`,
+					soapEnvNS, wsseNS, wsuNS, tt.created.UTC().Format(time.RFC3339))
+			}))
+			defer ts.Close()
+
+			client := NewClient(nil, WithTimestampVerification(time.Minute, 5*time.Minute))
+			content := &envelopeContentExample{}
+			_, err := client.Do(context.Background(), NewRequest("action", ts.URL, &envelopeContentExample{}, content, nil))
+			assert.Equal(t, tt.err, err)
+			if tt.err == nil {
+				assert.Equal(t, int32(1), content.Attr1)
+			}
+		})
+	}
+}
+
+// withUnsignedTimestamp adds a timestamp created at the time to the security header of the signed envelope, which the
+// signature doesn't cover.
+func withUnsignedTimestamp(signed []byte, created time.Time) string {
+	timestamp := fmt.Sprintf(`<wsu:Timestamp xmlns:wsu="%s"><wsu:Created>%s</wsu:Created></wsu:Timestamp>`, wsuNS, created.UTC().Format(time.RFC3339))
+	return strings.Replace(string(signed), "</wsse:Security>", timestamp+"</wsse:Security>", 1)
+}
+
+func TestVerifyEnvelopeSignedTimestamp(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+	signed, err := NewEnvelope(&envelopeContentExample{Attr1: 10}).Sign(wsseInfo)
+	assert.Nil(t, err)
+	// The timestamp of the response signed by another implementation is covered by a reference of its own.
+	otherSigned, err := ioutil.ReadFile("./testdata/signed_response.xml")
+	assert.Nil(t, err)
+	trusted := func(cert *x509.Certificate) error { return nil }
+
+	var tests = []struct {
+		name            string
+		envelope        string
+		signedTimestamp bool
+		err             error
+	}{
+		{name: "signed timestamp", envelope: string(otherSigned), signedTimestamp: true},
+		{name: "unsigned timestamp", envelope: withUnsignedTimestamp(signed, time.Now()), signedTimestamp: true, err: ErrTimestampUnsigned},
+		{name: "unsigned timestamp allowed", envelope: withUnsignedTimestamp(signed, time.Now())},
+		{name: "no timestamp", envelope: string(signed), signedTimestamp: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.err, verifyEnvelope([]byte(tt.envelope), trusted, tt.signedTimestamp))
+		})
+	}
+}
+
+func TestClientTimestampVerificationSigned(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+	signed, err := NewEnvelope(&envelopeContentExample{Attr1: 10}).Sign(wsseInfo)
+	assert.Nil(t, err)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, withUnsignedTimestamp(signed, time.Now()))
+	}))
+	defer ts.Close()
+
+	trusted := func(cert *x509.Certificate) error { return nil }
+	req := NewRequest("action", ts.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil)
+
+	// The timestamp is fresh, but anyone could have added it to the signed response.
+	client := NewClient(nil, WithSignatureVerification(trusted), WithTimestampVerification(time.Minute, 5*time.Minute))
+	_, err = client.Do(context.Background(), req)
+	assert.Equal(t, ErrTimestampUnsigned, err)
+
+	client = NewClient(nil, WithTimestampVerification(time.Minute, 5*time.Minute))
+	_, err = client.Do(context.Background(), req)
+	assert.Nil(t, err)
+}
+
+func TestClientTimestampVerificationOnHeader(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="%s"><s:Header><wsse:Security xmlns:wsse="%s" xmlns:wsu="%s"><wsu:Timestamp><wsu:Created>%s</wsu:Created></wsu:Timestamp></wsse:Security></s:Header><s:Body><ContentExample attr1="1"></ContentExample></s:Body></s:Envelope>`,
+			soapEnvNS, wsseNS, wsuNS, time.Now().UTC().Format(time.RFC3339))
+	}))
+	defer ts.Close()
+
+	client := NewClient(nil, WithTimestampVerification(time.Minute, 5*time.Minute))
+
+	// The security header is decoded into the values registered by the request, whether by its name or by its local
+	// name alone, as well as being verified.
+	for _, name := range []xml.Name{securityName, {Local: "Security"}} {
+		security := &securityTimestampHeader{}
+		req := NewRequest("action", ts.URL, &envelopeContentExample{}, &envelopeContentExample{}, nil)
+		req.OnHeader(name, security)
+
+		_, err := client.Do(context.Background(), req)
+		assert.Nil(t, err)
+		if assert.NotNil(t, security.Timestamp, "%v", name) {
+			assert.NotEmpty(t, security.Timestamp.Created)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package soap
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Implements the tuning of the HTTP transport used by a Client.
+
+// These are the defaults applied when a Client would otherwise use the shared http.DefaultTransport.
+// SOAP services tend to be called at a high rate against a small number of hosts, so more idle connections are kept
+// per host than the net/http default of 2, and every phase of the exchange before the response is bounded.
+// HTTP/2 is attempted for TLS connections, even when a custom TLS configuration is set.
+const (
+	DefaultDialTimeout           = 30 * time.Second
+	DefaultKeepAlive             = 30 * time.Second
+	DefaultMaxIdleConnsPerHost   = 16
+	DefaultIdleConnTimeout       = 90 * time.Second
+	DefaultTLSHandshakeTimeout   = 10 * time.Second
+	DefaultResponseHeaderTimeout = 60 * time.Second
+	DefaultExpectContinueTimeout = 1 * time.Second
+)
+
+// WithDialTimeout sets the maximum time to wait for a connection to be established.
+func WithDialTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.DialContext = newDialer(d).DialContext
+	})
+}
+
+// WithDialContext sets the function used to establish connections, i.e. to connect through a SOCKS proxy or from a
+// specific network interface. It replaces the default dialer, so WithDialTimeout has no effect if supplied before it.
+func WithDialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.DialContext = dial
+	})
+}
+
+// WithTLSConfig sets the TLS configuration used for connections, i.e. to supply client certificates or root CAs.
+func WithTLSConfig(config *tls.Config) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.TLSClientConfig = config
+	})
+}
+
+// WithTLSRenegotiation sets whether the server may request a TLS renegotiation, which some older SOAP appliances do
+// to ask for a client certificate. Renegotiation is never supported by default.
+// It applies on top of the configuration set by WithTLSConfig, if any, which is copied rather than modified.
+func WithTLSRenegotiation(support tls.RenegotiationSupport) ClientOption {
+	return withTLSSetting(func(config *tls.Config) {
+		config.Renegotiation = support
+	})
+}
+
+// WithTLSSessionCache sets the cache of TLS sessions used to resume sessions with servers, saving a full handshake
+// on new connections. A nil cache disables session resumption, which some servers fail to handle.
+// It applies on top of the configuration set by WithTLSConfig, if any, which is copied rather than modified.
+func WithTLSSessionCache(cache tls.ClientSessionCache) ClientOption {
+	return withTLSSetting(func(config *tls.Config) {
+		config.ClientSessionCache = cache
+		config.SessionTicketsDisabled = cache == nil
+	})
+}
+
+// WithHTTP2 enables or disables the use of HTTP/2 for TLS connections. Some SOAP stacks misbehave over HTTP/2,
+// in which case it can be disabled so that HTTP/1.1 is always used.
+func WithHTTP2(enabled bool) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.ForceAttemptHTTP2 = enabled
+		if !enabled {
+			// A non-nil, empty map prevents the transport from negotiating HTTP/2.
+			t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		} else {
+			t.TLSNextProto = nil
+		}
+	})
+}
+
+// WithMaxIdleConnsPerHost sets the maximum number of idle keep-alive connections kept per host.
+func WithMaxIdleConnsPerHost(n int) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.MaxIdleConnsPerHost = n
+	})
+}
+
+// WithIdleConnTimeout sets how long idle keep-alive connections are kept before being closed.
+func WithIdleConnTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.IdleConnTimeout = d
+	})
+}
+
+// WithTLSHandshakeTimeout sets the maximum time to wait for a TLS handshake.
+func WithTLSHandshakeTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.TLSHandshakeTimeout = d
+	})
+}
+
+// WithResponseHeaderTimeout sets the maximum time to wait for the response headers once the request has been sent.
+func WithResponseHeaderTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.ResponseHeaderTimeout = d
+	})
+}
+
+// WithExpectContinueTimeout sets the maximum time to wait for a 100-continue response when the request
+// has an "Expect: 100-continue" header.
+func WithExpectContinueTimeout(d time.Duration) ClientOption {
+	return withTransport(func(t *http.Transport) {
+		t.ExpectContinueTimeout = d
+	})
+}
+
+func withTransport(opt func(*http.Transport)) ClientOption {
+	return func(c *Client) {
+		c.transportOpts = append(c.transportOpts, opt)
+	}
+}
+
+func withTLSSetting(opt func(*tls.Config)) ClientOption {
+	return func(c *Client) {
+		c.tlsOpts = append(c.tlsOpts, opt)
+	}
+}
+
+// configureHTTPClient returns the HTTP client to use for requests, given the one supplied to NewClient.
+// Clients using the shared default transport get a dedicated transport with the defaults above, so that tuning one
+// Client never affects other users of http.DefaultTransport. Clients with their own *http.Transport keep its settings,
+// unless transport options were supplied, in which case they are applied to a copy.
+// The TLS settings are applied last, to a copy of the resulting TLS configuration.
+// Any other http.RoundTripper is used as is.
+func configureHTTPClient(client *http.Client, opts []func(*http.Transport), tlsOpts []func(*tls.Config)) *http.Client {
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	var transport *http.Transport
+	switch t := client.Transport.(type) {
+	case nil:
+		transport = defaultTransport()
+	case *http.Transport:
+		if t == http.DefaultTransport {
+			transport = defaultTransport()
+		} else if len(opts) > 0 || len(tlsOpts) > 0 {
+			transport = t.Clone()
+		}
+	}
+
+	if transport == nil {
+		return client
+	}
+
+	for _, opt := range opts {
+		opt(transport)
+	}
+	if len(tlsOpts) > 0 {
+		config := &tls.Config{}
+		if transport.TLSClientConfig != nil {
+			config = transport.TLSClientConfig.Clone()
+		}
+		for _, opt := range tlsOpts {
+			opt(config)
+		}
+		transport.TLSClientConfig = config
+	}
+
+	configured := *client
+	configured.Transport = transport
+	return &configured
+}
+
+// defaultTransport returns a copy of http.DefaultTransport with the SOAP defaults applied.
+func defaultTransport() *http.Transport {
+	var transport *http.Transport
+	if t, ok := http.DefaultTransport.(*http.Transport); ok {
+		transport = t.Clone()
+	} else {
+		transport = &http.Transport{Proxy: http.ProxyFromEnvironment}
+	}
+
+	transport.DialContext = newDialer(DefaultDialTimeout).DialContext
+	transport.ForceAttemptHTTP2 = true
+	transport.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	transport.IdleConnTimeout = DefaultIdleConnTimeout
+	transport.TLSHandshakeTimeout = DefaultTLSHandshakeTimeout
+	transport.ResponseHeaderTimeout = DefaultResponseHeaderTimeout
+	transport.ExpectContinueTimeout = DefaultExpectContinueTimeout
+
+	return transport
+}
+
+// newDialer returns a dialer with the timeout and the default keep-alive period.
+func newDialer(timeout time.Duration) *net.Dialer {
+	return &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: DefaultKeepAlive,
+	}
+}
@@ -0,0 +1,207 @@
+package soap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestConfigureHTTPClient(t *testing.T) {
+	custom := &http.Transport{MaxIdleConnsPerHost: 3, IdleConnTimeout: time.Minute}
+	roundTripper := roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, nil })
+
+	var tests = []struct {
+		name      string
+		client    *http.Client
+		opts      []ClientOption
+		same      bool
+		idlePer   int
+		idle      time.Duration
+		tls       time.Duration
+		header    time.Duration
+		expect100 time.Duration
+	}{
+		{
+			name:      "nil client",
+			idlePer:   DefaultMaxIdleConnsPerHost,
+			idle:      DefaultIdleConnTimeout,
+			tls:       DefaultTLSHandshakeTimeout,
+			header:    DefaultResponseHeaderTimeout,
+			expect100: DefaultExpectContinueTimeout,
+		},
+		{
+			name:      "default client",
+			client:    http.DefaultClient,
+			opts:      []ClientOption{WithResponseHeaderTimeout(5 * time.Second)},
+			idlePer:   DefaultMaxIdleConnsPerHost,
+			idle:      DefaultIdleConnTimeout,
+			tls:       DefaultTLSHandshakeTimeout,
+			header:    5 * time.Second,
+			expect100: DefaultExpectContinueTimeout,
+		},
+		{
+			name:   "custom transport without options",
+			client: &http.Client{Transport: custom},
+			same:   true,
+		},
+		{
+			name:   "custom transport with options",
+			client: &http.Client{Transport: custom, Timeout: time.Second},
+			opts: []ClientOption{
+				WithMaxIdleConnsPerHost(8),
+				WithIdleConnTimeout(time.Second),
+				WithTLSHandshakeTimeout(2 * time.Second),
+				WithResponseHeaderTimeout(3 * time.Second),
+				WithExpectContinueTimeout(4 * time.Second),
+			},
+			idlePer:   8,
+			idle:      time.Second,
+			tls:       2 * time.Second,
+			header:    3 * time.Second,
+			expect100: 4 * time.Second,
+		},
+		{
+			name:   "custom round tripper",
+			client: &http.Client{Transport: roundTripper},
+			opts:   []ClientOption{WithMaxIdleConnsPerHost(8)},
+			same:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(tt.client, tt.opts...)
+
+			if tt.same {
+				assert.True(t, c.http == tt.client)
+				return
+			}
+			assert.False(t, c.http == tt.client)
+			if tt.client != nil {
+				assert.Equal(t, tt.client.Timeout, c.http.Timeout)
+			}
+
+			transport, ok := c.http.Transport.(*http.Transport)
+			if !assert.True(t, ok) {
+				return
+			}
+			assert.False(t, transport == http.DefaultTransport)
+			assert.Equal(t, tt.idlePer, transport.MaxIdleConnsPerHost)
+			assert.Equal(t, tt.idle, transport.IdleConnTimeout)
+			assert.Equal(t, tt.tls, transport.TLSHandshakeTimeout)
+			assert.Equal(t, tt.header, transport.ResponseHeaderTimeout)
+			assert.Equal(t, tt.expect100, transport.ExpectContinueTimeout)
+		})
+	}
+
+	// The supplied transports are never modified.
+	assert.Equal(t, 3, custom.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Minute, custom.IdleConnTimeout)
+	assert.Nil(t, http.DefaultClient.Transport)
+	assert.Equal(t, 0, http.DefaultTransport.(*http.Transport).MaxIdleConnsPerHost)
+}
+
+func TestTransportOptions(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "soap.example.com"}
+
+	var tests = []struct {
+		name      string
+		opts      []ClientOption
+		http2     bool
+		noHTTP2   bool
+		tlsConfig *tls.Config
+	}{
+		{
+			name:  "defaults",
+			http2: true,
+		},
+		{
+			name:      "tls config",
+			opts:      []ClientOption{WithTLSConfig(tlsConfig), WithDialTimeout(time.Second)},
+			http2:     true,
+			tlsConfig: tlsConfig,
+		},
+		{
+			name:    "http2 disabled",
+			opts:    []ClientOption{WithHTTP2(false)},
+			noHTTP2: true,
+		},
+		{
+			name:  "http2 enabled again",
+			opts:  []ClientOption{WithHTTP2(false), WithHTTP2(true)},
+			http2: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(nil, tt.opts...)
+
+			transport, ok := c.http.Transport.(*http.Transport)
+			if !assert.True(t, ok) {
+				return
+			}
+			assert.NotNil(t, transport.DialContext)
+			assert.Equal(t, tt.http2, transport.ForceAttemptHTTP2)
+			assert.Equal(t, tt.noHTTP2, transport.TLSNextProto != nil && len(transport.TLSNextProto) == 0)
+			if tt.tlsConfig != nil {
+				assert.True(t, tt.tlsConfig == transport.TLSClientConfig)
+			}
+		})
+	}
+}
+
+func TestTLSSettings(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "soap.example.com"}
+	cache := tls.NewLRUClientSessionCache(4)
+
+	c := NewClient(nil, WithTLSRenegotiation(tls.RenegotiateOnceAsClient), WithTLSSessionCache(cache), WithTLSConfig(tlsConfig))
+	transport := c.http.Transport.(*http.Transport)
+	if !assert.NotNil(t, transport.TLSClientConfig) {
+		return
+	}
+	assert.False(t, transport.TLSClientConfig == tlsConfig)
+	assert.Equal(t, "soap.example.com", transport.TLSClientConfig.ServerName)
+	assert.Equal(t, tls.RenegotiateOnceAsClient, transport.TLSClientConfig.Renegotiation)
+	assert.True(t, transport.TLSClientConfig.ClientSessionCache == cache)
+	assert.False(t, transport.TLSClientConfig.SessionTicketsDisabled)
+
+	// The supplied configuration is never modified.
+	assert.Equal(t, tls.RenegotiateNever, tlsConfig.Renegotiation)
+	assert.Nil(t, tlsConfig.ClientSessionCache)
+
+	c = NewClient(nil, WithTLSSessionCache(nil))
+	assert.True(t, c.http.Transport.(*http.Transport).TLSClientConfig.SessionTicketsDisabled)
+
+	custom := &http.Transport{TLSClientConfig: &tls.Config{}}
+	c = NewClient(&http.Client{Transport: custom}, WithTLSRenegotiation(tls.RenegotiateFreelyAsClient))
+	assert.False(t, c.http.Transport == custom)
+	assert.Equal(t, tls.RenegotiateFreelyAsClient, c.http.Transport.(*http.Transport).TLSClientConfig.Renegotiation)
+	assert.Equal(t, tls.RenegotiateNever, custom.TLSClientConfig.Renegotiation)
+}
+
+func TestDialContext(t *testing.T) {
+	errDial := errors.New("dial refused")
+	var dialed string
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		dialed = addr
+		return nil, errDial
+	}
+
+	c := NewClient(nil, WithDialTimeout(time.Second), WithDialContext(dial))
+	_, err := c.Do(context.Background(), NewRequest("action", "http://soap.example.com:8080/service", &envelopeContentExample{}, &envelopeContentExample{}, nil))
+	assert.True(t, errors.Is(err, errDial))
+	assert.Equal(t, "soap.example.com:8080", dialed)
+}
@@ -0,0 +1,399 @@
+package soap
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/beevik/etree"
+)
+
+// Implements the verification of the WS-Security signatures of inbound messages.
+
+var (
+	// ErrSignatureMissing is returned if a message whose signature is verified isn't signed.
+	ErrSignatureMissing = newCategoryError(ErrSecurity, "message is not signed")
+	// ErrSignatureInvalid is returned if the signature of a message doesn't match its content, doesn't cover its
+	// body, or can't be verified, i.e. as it uses algorithms which aren't supported or the envelope has several
+	// headers or bodies, or elements other than them.
+	ErrSignatureInvalid = newCategoryError(ErrSecurity, "message signature is invalid")
+)
+
+// SignatureMismatchError is returned if the signature of a message doesn't match its content: the digest of a signed
+// element doesn't match the DigestValue of its reference, or the SignedInfo doesn't match the SignatureValue. It is
+// an ErrSignatureInvalid.
+type SignatureMismatchError struct {
+	// Element is the element which doesn't match: DigestValue or SignatureValue.
+	Element string
+	// Reference is the URI of the reference whose DigestValue doesn't match, which is empty for the whole envelope.
+	Reference string
+}
+
+func (e *SignatureMismatchError) Error() string {
+	if e.Element == "DigestValue" {
+		return fmt.Sprintf("%s: DigestValue of reference %q doesn't match", ErrSignatureInvalid.Error(), e.Reference)
+	}
+	return fmt.Sprintf("%s: %s doesn't match", ErrSignatureInvalid.Error(), e.Element)
+}
+
+// Unwrap returns ErrSignatureInvalid.
+func (e *SignatureMismatchError) Unwrap() error {
+	return ErrSignatureInvalid
+}
+
+// WithSignatureVerification makes the client verify the WS-Security signature of responses, which must cover their
+// body and be made with the key of a binary security token holding a certificate trusted by verifyCert, such as a
+// CertPoolVerifier. Responses whose signature doesn't match their content are rejected with a SignatureMismatchError,
+// and those which can't be verified otherwise with ErrSignatureInvalid. Responses other than faults which aren't
+// signed are rejected with ErrSignatureMissing; faults are only verified if they are signed, as many services don't
+// secure them.
+// Responses are read in full before being decoded, in order to verify them. The signature of a multipart response is
+// verified over its root part as received, so the signed content must not have been optimized with XOP. The signed
+// elements and the SignedInfo must be canonicalized with Exclusive C14N, without comments.
+func WithSignatureVerification(verifyCert CertificateVerifier) ClientOption {
+	return func(c *Client) {
+		c.verifyCert = verifyCert
+	}
+}
+
+// CertificateVerifier checks whether the certificate a message was signed with is trusted, returning an error if it
+// isn't.
+type CertificateVerifier func(cert *x509.Certificate) error
+
+// CertPoolVerifier returns a CertificateVerifier trusting the certificates which chain up to one of the roots.
+func CertPoolVerifier(roots *x509.CertPool) CertificateVerifier {
+	return func(cert *x509.Certificate) error {
+		_, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}})
+		return err
+	}
+}
+
+// verifyEnvelope verifies the signature of the serialized envelope of a response, as verifySignature does, accepting
+// faults which aren't signed. If signedTimestamp is set, the timestamp in the security header, if any, must be signed
+// too, or ErrTimestampUnsigned is returned.
+func verifyEnvelope(data []byte, verifyCert CertificateVerifier, signedTimestamp bool) error {
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(data); err != nil {
+		return err
+	}
+
+	signed, err := verifySignedElements(doc, verifyCert)
+	if err == ErrSignatureMissing && doc.Root() != nil {
+		envNS := elementNamespace(doc.Root())
+		if childElement(childElement(doc.Root(), envNS, "Body"), envNS, "Fault") != nil {
+			return nil
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if signedTimestamp {
+		// The envelope is signed, so it has a header holding the signature; each of its security headers is checked,
+		// as any could be the one decoded.
+		root := doc.Root()
+		header := childElement(root, elementNamespace(root), "Header")
+		for _, security := range header.ChildElements() {
+			if security.Tag != "Security" || elementNamespace(security) != wsseNS {
+				continue
+			}
+			for _, timestamp := range security.ChildElements() {
+				if timestamp.Tag == "Timestamp" && elementNamespace(timestamp) == wsuNS && !isSigned(timestamp, signed) {
+					return ErrTimestampUnsigned
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// envelopeChildren returns the header of the envelope, if any, and its body, checking that it has at most one of
+// each, the header coming first, and no other children.
+func envelopeChildren(root *etree.Element) (header *etree.Element, body *etree.Element, ok bool) {
+	envNS := elementNamespace(root)
+	for _, child := range root.ChildElements() {
+		switch {
+		case elementNamespace(child) != envNS:
+			return nil, nil, false
+		case child.Tag == "Header" && header == nil && body == nil:
+			header = child
+		case child.Tag == "Body" && body == nil:
+			body = child
+		default:
+			return nil, nil, false
+		}
+	}
+	return header, body, true
+}
+
+// verifySignature verifies the signature in the security header of the envelope, which must cover its body and be
+// made with the key of a binary security token holding a certificate trusted by verifyCert.
+// The SignedInfo and the signed elements must be canonicalized with Exclusive C14N without comments, the only
+// transform supported along with the enveloped signature transform; signatures using others are rejected with
+// ErrSignatureInvalid.
+func verifySignature(doc *etree.Document, verifyCert CertificateVerifier) error {
+	_, err := verifySignedElements(doc, verifyCert)
+	return err
+}
+
+// verifySignedElements verifies the signature of the envelope as verifySignature does, returning the elements
+// referenced by the signature.
+func verifySignedElements(doc *etree.Document, verifyCert CertificateVerifier) ([]*etree.Element, error) {
+	root := doc.Root()
+	if root == nil {
+		return nil, ErrSignatureMissing
+	}
+	// An envelope with several headers or bodies could have one of them signed and another decoded.
+	header, body, ok := envelopeChildren(root)
+	if !ok {
+		return nil, ErrSignatureInvalid
+	}
+	security := childElement(header, wsseNS, "Security")
+	signature := childElement(security, dsigNS, "Signature")
+	if signature == nil {
+		return nil, ErrSignatureMissing
+	}
+	signedInfo := childElement(signature, dsigNS, "SignedInfo")
+	if body == nil || signedInfo == nil {
+		return nil, ErrSignatureInvalid
+	}
+
+	c14n := childElement(signedInfo, dsigNS, "CanonicalizationMethod")
+	if c14n == nil || c14n.SelectAttrValue("Algorithm", "") != canonicalizationExclusiveC14N {
+		return nil, ErrSignatureInvalid
+	}
+	signedInfoPrefixes := inclusivePrefixes(c14n)
+	suite, ok := signatureSuite(childElement(signedInfo, dsigNS, "SignatureMethod"))
+	if !ok {
+		return nil, ErrSignatureInvalid
+	}
+
+	cert, err := signingCertificate(root, security, signature)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyCert(cert); err != nil {
+		return nil, classify(ErrSecurity, err)
+	}
+
+	var signed []*etree.Element
+	for _, reference := range signedInfo.ChildElements() {
+		if reference.Tag != "Reference" || elementNamespace(reference) != dsigNS {
+			continue
+		}
+		target, err := referencedElement(root, reference)
+		if err != nil {
+			return nil, err
+		}
+		if err := verifyDigest(target, reference, signature); err != nil {
+			return nil, err
+		}
+		signed = append(signed, target)
+	}
+	if !isSigned(body, signed) {
+		return nil, ErrSignatureInvalid
+	}
+
+	signedInfoEnc := serializeElement(signedInfo, signedInfoPrefixes, nil)
+	signatureValueElem := childElement(signature, dsigNS, "SignatureValue")
+	if signatureValueElem == nil {
+		return nil, ErrSignatureInvalid
+	}
+	signatureValue, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(signatureValueElem.Text()), ""))
+	if err != nil {
+		return nil, ErrSignatureInvalid
+	}
+	if !suite.verifyValue(cert.PublicKey, signedInfoEnc, signatureValue) {
+		return nil, &SignatureMismatchError{Element: "SignatureValue"}
+	}
+	return signed, nil
+}
+
+// isSigned checks whether the element is covered by the signature of the elements signed, i.e. it or one of its
+// ancestors is signed. A reference to the whole envelope covers every element.
+func isSigned(elem *etree.Element, signed []*etree.Element) bool {
+	for e := elem; e != nil; e = e.Parent() {
+		for _, s := range signed {
+			if e == s {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// signatureSuite returns the algorithm suite signing with the signature method.
+func signatureSuite(method *etree.Element) (AlgorithmSuite, bool) {
+	if method == nil {
+		return 0, false
+	}
+	switch method.SelectAttrValue("Algorithm", "") {
+	case rsaSha256Sig:
+		return RSASHA256, true
+	case rsaSha1Sig:
+		return LegacyRSASHA1, true
+	case rsaSha512Sig:
+		return RSASHA512, true
+	case ecdsaSha256Sig:
+		return ECDSASHA256, true
+	case ecdsaSha512Sig:
+		return ECDSASHA512, true
+	}
+	return 0, false
+}
+
+// digestSuite returns the algorithm suite digesting with the digest method.
+func digestSuite(method *etree.Element) (AlgorithmSuite, bool) {
+	if method == nil {
+		return 0, false
+	}
+	switch method.SelectAttrValue("Algorithm", "") {
+	case sha256Sig:
+		return RSASHA256, true
+	case sha1Sig:
+		return LegacyRSASHA1, true
+	case sha512Sig:
+		return RSASHA512, true
+	}
+	return 0, false
+}
+
+// signingCertificate returns the certificate held by the binary security token of the security header referenced by
+// the key info of the signature.
+func signingCertificate(root *etree.Element, security *etree.Element, signature *etree.Element) (*x509.Certificate, error) {
+	tokenReference := childElement(childElement(childElement(signature, dsigNS, "KeyInfo"), wsseNS, "SecurityTokenReference"), wsseNS, "Reference")
+	if tokenReference == nil {
+		return nil, ErrSignatureInvalid
+	}
+	uri := tokenReference.SelectAttrValue("URI", "")
+	if !strings.HasPrefix(uri, "#") {
+		return nil, ErrSignatureInvalid
+	}
+
+	tokens := elementsWithID(root, uri[1:])
+	if len(tokens) != 1 || tokens[0].Parent() != security || tokens[0].Tag != "BinarySecurityToken" {
+		return nil, ErrSignatureInvalid
+	}
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(tokens[0].Text()), ""))
+	if err != nil {
+		return nil, ErrSignatureInvalid
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, classify(ErrSecurity, err)
+	}
+	return cert, nil
+}
+
+// referencedElement returns the element referenced by the signature reference: the element with the ID, or the
+// envelope if the reference is to the whole envelope, with the enveloped signature transform. IDs must be unique, so
+// that the element verified is the one which is used.
+func referencedElement(root *etree.Element, reference *etree.Element) (*etree.Element, error) {
+	uri := reference.SelectAttrValue("URI", "")
+	if strings.HasPrefix(uri, "#") {
+		elems := elementsWithID(root, uri[1:])
+		if len(elems) != 1 {
+			return nil, ErrSignatureInvalid
+		}
+		return elems[0], nil
+	}
+
+	if uri != "" || !hasTransform(reference, envelopedSignatureTransform) {
+		return nil, ErrSignatureInvalid
+	}
+	return root, nil
+}
+
+// hasTransform checks whether the signature reference has a transform with the algorithm.
+func hasTransform(reference *etree.Element, algorithm string) bool {
+	for _, transform := range childElement(reference, dsigNS, "Transforms").ChildElements() {
+		if transform.SelectAttrValue("Algorithm", "") == algorithm {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceTransforms returns the prefixes of the inclusive namespaces of the Exclusive C14N transform of the
+// signature reference, which must be its last, and the element the enveloped signature transform removes, if the
+// reference has one: the signature. References with other transforms are rejected.
+func referenceTransforms(reference *etree.Element, signature *etree.Element) ([]string, *etree.Element, error) {
+	transforms := childElement(reference, dsigNS, "Transforms").ChildElements()
+	if len(transforms) == 0 || transforms[len(transforms)-1].SelectAttrValue("Algorithm", "") != canonicalizationExclusiveC14N {
+		return nil, nil, ErrSignatureInvalid
+	}
+
+	var exclude *etree.Element
+	for _, transform := range transforms[:len(transforms)-1] {
+		if transform.SelectAttrValue("Algorithm", "") != envelopedSignatureTransform {
+			return nil, nil, ErrSignatureInvalid
+		}
+		exclude = signature
+	}
+	return inclusivePrefixes(transforms[len(transforms)-1]), exclude, nil
+}
+
+// inclusivePrefixes returns the prefixes of the PrefixList of the InclusiveNamespaces of an Exclusive C14N transform
+// or canonicalization method, if any.
+func inclusivePrefixes(method *etree.Element) []string {
+	inclusive := childElement(method, canonicalizationExclusiveC14N, "InclusiveNamespaces")
+	if inclusive == nil {
+		return nil
+	}
+	return strings.Fields(inclusive.SelectAttrValue("PrefixList", ""))
+}
+
+// verifyDigest checks the digest of the element, transformed as by the signature reference, against the reference.
+func verifyDigest(elem *etree.Element, reference *etree.Element, signature *etree.Element) error {
+	suite, ok := digestSuite(childElement(reference, dsigNS, "DigestMethod"))
+	if !ok {
+		return ErrSignatureInvalid
+	}
+	digestValue := childElement(reference, dsigNS, "DigestValue")
+	if digestValue == nil {
+		return ErrSignatureInvalid
+	}
+	want, err := base64.StdEncoding.DecodeString(strings.TrimSpace(digestValue.Text()))
+	if err != nil {
+		return ErrSignatureInvalid
+	}
+	prefixes, exclude, err := referenceTransforms(reference, signature)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.Equal(suite.digest(serializeElement(elem, prefixes, exclude)), want) {
+		return &SignatureMismatchError{Element: "DigestValue", Reference: reference.SelectAttrValue("URI", "")}
+	}
+	return nil
+}
+
+// childElement returns the first child of the element with the namespace and local name, or nil if there is none or
+// the element is nil.
+func childElement(elem *etree.Element, space string, local string) *etree.Element {
+	if elem == nil {
+		return nil
+	}
+	for _, child := range elem.ChildElements() {
+		if child.Tag == local && elementNamespace(child) == space {
+			return child
+		}
+	}
+	return nil
+}
+
+// elementsWithID returns the elements within root, including root itself, with a wsu:Id attribute of id.
+func elementsWithID(root *etree.Element, id string) []*etree.Element {
+	var elems []*etree.Element
+	for _, elem := range append([]*etree.Element{root}, root.FindElements("//*")...) {
+		for _, attr := range elem.Attr {
+			if attr.Key == "Id" && attr.Value == id && attr.Space != "" && resolvePrefix(elem, attr.Space) == wsuNS {
+				elems = append(elems, elem)
+				break
+			}
+		}
+	}
+	return elems
+}
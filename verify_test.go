@@ -0,0 +1,306 @@
+package soap
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beevik/etree"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifySignature(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+	legacyInfo, err := NewWSSEAuthInfoWithSuite("./testdata/cert.pem", "./testdata/key.pem", LegacyRSASHA1)
+	assert.Nil(t, err)
+	sha512Info, err := NewWSSEAuthInfoWithSuite("./testdata/cert.pem", "./testdata/key.pem", RSASHA512)
+	assert.Nil(t, err)
+	ecdsaInfo, err := NewWSSEAuthInfo("./testdata/eccert.pem", "./testdata/eckey.pem")
+	assert.Nil(t, err)
+	ecdsaSHA512Info, err := NewWSSEAuthInfoWithSuite("./testdata/eccert.pem", "./testdata/eckey.pem", ECDSASHA512)
+	assert.Nil(t, err)
+
+	trusted := func(cert *x509.Certificate) error { return nil }
+	errUntrusted := errors.New("untrusted")
+
+	var tests = []struct {
+		name   string
+		info   *WSSEAuthInfo
+		scope  SigningScope
+		unsign bool
+		tamper func(data string) string
+		verify CertificateVerifier
+		err    error
+		// mismatch is the SignatureMismatchError expected, if any.
+		mismatch *SignatureMismatchError
+	}{
+		{name: "body", info: wsseInfo, verify: trusted},
+		{name: "envelope", info: wsseInfo, scope: SignEnvelope, verify: trusted},
+		{name: "legacy suite", info: legacyInfo, verify: trusted},
+		{name: "sha512 suite", info: sha512Info, verify: trusted},
+		{name: "ecdsa suite", info: ecdsaInfo, verify: trusted},
+		{name: "ecdsa sha512 suite", info: ecdsaSHA512Info, scope: SignEnvelope, verify: trusted},
+		{
+			name:     "tampered ecdsa signature",
+			info:     ecdsaInfo,
+			tamper:   func(data string) string { return strings.Replace(data, "<SignatureValue>", "<SignatureValue>AAAA", 1) },
+			verify:   trusted,
+			err:      ErrSignatureInvalid,
+			mismatch: &SignatureMismatchError{Element: "SignatureValue"},
+		},
+		{
+			name: "suite not matching key",
+			info: ecdsaInfo,
+			tamper: func(data string) string {
+				return strings.Replace(data, "xmldsig-more#ecdsa-sha256", "xmldsig-more#rsa-sha256", 1)
+			},
+			verify:   trusted,
+			err:      ErrSignatureInvalid,
+			mismatch: &SignatureMismatchError{Element: "SignatureValue"},
+		},
+		{name: "unsigned", unsign: true, verify: trusted, err: ErrSignatureMissing},
+		{
+			name:     "tampered body",
+			info:     wsseInfo,
+			tamper:   func(data string) string { return strings.Replace(data, `attr1="10"`, `attr1="11"`, 1) },
+			verify:   trusted,
+			err:      ErrSignatureInvalid,
+			mismatch: &SignatureMismatchError{Element: "DigestValue", Reference: "#Body-1"},
+		},
+		{
+			name:   "tampered envelope",
+			info:   wsseInfo,
+			scope:  SignEnvelope,
+			tamper: func(data string) string { return strings.Replace(data, `attr1="15"`, `attr1="16"`, 1) },
+			verify: trusted,
+			err:    ErrSignatureInvalid,
+		},
+		{
+			name:     "tampered signature",
+			info:     wsseInfo,
+			tamper:   func(data string) string { return strings.Replace(data, "<SignatureValue>", "<SignatureValue>AAAA", 1) },
+			verify:   trusted,
+			err:      ErrSignatureInvalid,
+			mismatch: &SignatureMismatchError{Element: "SignatureValue"},
+		},
+		{
+			name: "duplicate body ID",
+			info: wsseInfo,
+			tamper: func(data string) string {
+				return strings.Replace(data, "<HeaderExample", `<Wrapper xmlns:wsu="`+wsuNS+`" wsu:Id="Body-1"></Wrapper><HeaderExample`, 1)
+			},
+			verify: trusted,
+			err:    ErrSignatureInvalid,
+		},
+		{
+			name: "second body",
+			info: wsseInfo,
+			tamper: func(data string) string {
+				return strings.Replace(data, "</Envelope>", `<Body><ContentExample attr1="11"></ContentExample></Body></Envelope>`, 1)
+			},
+			verify: trusted,
+			err:    ErrSignatureInvalid,
+		},
+		{
+			name: "second header",
+			info: wsseInfo,
+			tamper: func(data string) string {
+				return strings.Replace(data, "<Body", `<Header></Header><Body`, 1)
+			},
+			verify: trusted,
+			err:    ErrSignatureInvalid,
+		},
+		{name: "untrusted", info: wsseInfo, verify: func(cert *x509.Certificate) error { return errUntrusted }, err: errUntrusted},
+		{name: "not in pool", info: wsseInfo, verify: CertPoolVerifier(x509.NewCertPool()), err: ErrSecurity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope := NewEnvelope(&envelopeContentExample{Attr1: 10})
+			envelope.AddHeaders(headerExample{Attr1: 15, Value: "test header value"})
+
+			var data []byte
+			if tt.unsign {
+				data, err = envelope.MarshalIndent()
+			} else {
+				data, err = envelope.Sign(tt.info, WithSigningIDs(NewWSSEAuthIDs("SecurityToken-1", "Body-1")), WithSigningScope(tt.scope))
+			}
+			if !assert.Nil(t, err) {
+				return
+			}
+			if tt.tamper != nil {
+				data = []byte(tt.tamper(string(data)))
+			}
+
+			doc := etree.NewDocument()
+			assert.Nil(t, doc.ReadFromBytes(data))
+
+			err := verifySignature(doc, tt.verify)
+			if tt.err == nil {
+				assert.Nil(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, tt.err), "%v is not %v", err, tt.err)
+			assert.True(t, errors.Is(err, ErrSecurity), "%v is not a security error", err)
+
+			var mismatch *SignatureMismatchError
+			if tt.mismatch != nil && assert.True(t, errors.As(err, &mismatch), "%v is not a mismatch", err) {
+				assert.Equal(t, tt.mismatch, mismatch)
+			}
+		})
+	}
+}
+
+func TestClientSignatureVerification(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+	trusted := func(cert *x509.Certificate) error { return nil }
+
+	signed, err := NewEnvelope(&envelopeContentExample{Attr1: 10}).Sign(wsseInfo, WithSigningIDs(NewWSSEAuthIDs("SecurityToken-1", "Body-1")))
+	assert.Nil(t, err)
+	unsigned, err := NewEnvelope(&envelopeContentExample{Attr1: 10}).MarshalIndent()
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name     string
+		response string
+		verify   CertificateVerifier
+		fault    bool
+		err      error
+	}{
+		{name: "signed", response: string(signed), verify: trusted},
+		{name: "unsigned", response: string(unsigned), verify: trusted, err: ErrSignatureMissing},
+		{name: "unsigned fault", response: loggerTestFault, verify: trusted, fault: true},
+		{
+			name:     "tampered",
+			response: strings.Replace(string(signed), `attr1="10"`, `attr1="11"`, 1),
+			verify:   trusted,
+			err:      &SignatureMismatchError{Element: "DigestValue", Reference: "#Body-1"},
+		},
+		{name: "untrusted", response: string(signed), verify: CertPoolVerifier(x509.NewCertPool()), err: ErrSecurity},
+		{
+			// An unsigned body appended to a signed envelope mustn't be decoded in place of the signed one.
+			name:     "wrapped",
+			response: strings.Replace(string(signed), "</Envelope>", `<Body><ContentExample attr1="11"></ContentExample></Body></Envelope>`, 1),
+			verify:   trusted,
+			err:      ErrSignatureInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/xml")
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			client := NewClient(nil, WithSignatureVerification(tt.verify))
+			content := &envelopeContentExample{}
+			resp, err := client.Do(context.Background(), NewRequest("action", server.URL, &envelopeContentExample{}, content, nil))
+			if tt.err == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tt.fault, resp.Fault() != nil)
+				if !tt.fault {
+					assert.Equal(t, int32(10), content.Attr1)
+				}
+				return
+			}
+
+			assert.Nil(t, resp)
+			if _, ok := tt.err.(*SignatureMismatchError); ok {
+				assert.Equal(t, tt.err, err)
+			} else {
+				assert.True(t, errors.Is(err, tt.err), "%v is not %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVerifySignatureOtherImplementation(t *testing.T) {
+	// The response is signed as by other implementations: its prefixes are declared on the envelope, its elements are
+	// indented, its attributes aren't in canonical order, and the canonicalization of the body and of the SignedInfo
+	// includes namespaces by their PrefixList.
+	signed, err := ioutil.ReadFile("./testdata/signed_response.xml")
+	if !assert.Nil(t, err) {
+		return
+	}
+	trusted := func(cert *x509.Certificate) error { return nil }
+
+	var tests = []struct {
+		name   string
+		tamper func(data string) string
+		err    error
+		// mismatch is the SignatureMismatchError expected, if any.
+		mismatch *SignatureMismatchError
+	}{
+		{name: "signed"},
+		{
+			name: "equivalent form",
+			tamper: func(data string) string {
+				data = strings.Replace(data, `<q:Note/>`, `<q:Note></q:Note>`, 1)
+				return strings.Replace(data, `It&apos;s`, `It's`, 1)
+			},
+		},
+		{
+			name:     "tampered body",
+			tamper:   func(data string) string { return strings.Replace(data, "rising", "falling", 1) },
+			err:      ErrSignatureInvalid,
+			mismatch: &SignatureMismatchError{Element: "DigestValue", Reference: "#id-body"},
+		},
+		{
+			name: "namespace excluded from the body",
+			tamper: func(data string) string {
+				return strings.Replace(data, `<ec:InclusiveNamespaces PrefixList="q"/>`, `<ec:InclusiveNamespaces PrefixList=""/>`, 1)
+			},
+			err:      ErrSignatureInvalid,
+			mismatch: &SignatureMismatchError{Element: "DigestValue", Reference: "#id-body"},
+		},
+		{
+			name: "inclusive canonicalization",
+			tamper: func(data string) string {
+				return strings.Replace(data, `<ds:Transform Algorithm="`+canonicalizationExclusiveC14N+`"/>`, `<ds:Transform Algorithm="http://www.w3.org/TR/2001/REC-xml-c14n-20010315"/>`, 1)
+			},
+			err: ErrSignatureInvalid,
+		},
+		{
+			name: "canonicalization with comments",
+			tamper: func(data string) string {
+				return strings.Replace(data, `<ds:CanonicalizationMethod Algorithm="`+canonicalizationExclusiveC14N+`">`, `<ds:CanonicalizationMethod Algorithm="`+canonicalizationExclusiveC14N+`WithComments">`, 1)
+			},
+			err: ErrSignatureInvalid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := string(signed)
+			if tt.tamper != nil {
+				data = tt.tamper(data)
+			}
+
+			doc := etree.NewDocument()
+			assert.Nil(t, doc.ReadFromString(data))
+
+			err := verifySignature(doc, trusted)
+			if tt.err == nil {
+				assert.Nil(t, err)
+				return
+			}
+			assert.True(t, errors.Is(err, tt.err), "%v is not %v", err, tt.err)
+
+			var mismatch *SignatureMismatchError
+			if errors.As(err, &mismatch) {
+				assert.Equal(t, tt.mismatch, mismatch)
+			} else {
+				assert.Nil(t, tt.mismatch)
+			}
+		})
+	}
+}
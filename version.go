@@ -0,0 +1,37 @@
+package soap
+
+const soap12EnvNS = "http://www.w3.org/2003/05/soap-envelope"
+
+// Version identifies the revision of the SOAP protocol a message is framed with.
+type Version int
+
+const (
+	// SOAP11 is the SOAP 1.1 protocol. This is the version used by the client.
+	SOAP11 Version = iota
+	// SOAP12 is the SOAP 1.2 protocol.
+	SOAP12
+)
+
+// Namespace returns the envelope namespace URI used by this version of the protocol.
+func (v Version) Namespace() string {
+	if v == SOAP12 {
+		return soap12EnvNS
+	}
+	return soapEnvNS
+}
+
+// ContentType returns the HTTP Content-Type header value used when sending messages of this version.
+func (v Version) ContentType() string {
+	if v == SOAP12 {
+		return "application/soap+xml; charset=utf-8"
+	}
+	return "text/xml; charset=\"utf-8\""
+}
+
+// String returns a human readable version of the protocol version.
+func (v Version) String() string {
+	if v == SOAP12 {
+		return "SOAP 1.2"
+	}
+	return "SOAP 1.1"
+}
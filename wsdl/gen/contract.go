@@ -0,0 +1,230 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Enflick/gosoap/wsdl"
+)
+
+// Implements the generation of contract tests, which exercise the generated types against the WSDL document.
+
+// importPath is the import path of the soap package, as used by the generated tests.
+const importPath = "github.com/Enflick/gosoap"
+
+// maxSampleDepth limits how deep sample values are populated, as recursive types would otherwise never terminate.
+const maxSampleDepth = 8
+
+// builtinSamples are the sample values used for the built-in XML schema types; other types use the name of the element.
+var builtinSamples = map[string]string{
+	"boolean":            "true",
+	"byte":               "1",
+	"short":              "1",
+	"int":                "1",
+	"long":               "1",
+	"integer":            "1",
+	"negativeInteger":    "-1",
+	"nonPositiveInteger": "-1",
+	"unsignedByte":       "1",
+	"unsignedShort":      "1",
+	"unsignedInt":        "1",
+	"unsignedLong":       "1",
+	"positiveInteger":    "1",
+	"nonNegativeInteger": "1",
+	"float":              "1.5",
+	"double":             "1.5",
+	"decimal":            "1.5",
+	"base64Binary":       `[]byte("Z29zb2Fw")`,
+	"dateTime":           `"2006-01-02T15:04:05Z"`,
+	"date":               `"2006-01-02"`,
+	"time":               `"15:04:05"`,
+	"duration":           `"P1D"`,
+	"anyURI":             `"http://example.com/"`,
+}
+
+// contractCase is a single entry in the generated test table.
+type contractCase struct {
+	name   string
+	target *structType
+}
+
+// GenerateContractTests generates a table-driven test with an entry for each message of every operation in the document.
+// Each entry populates the generated type of the message with sample values, then checks that:
+//   - the marshalled content is valid according to the schemas in the document,
+//   - it can be unmarshalled from a SOAP envelope, and
+//   - the unmarshalled value marshals back to the same content.
+//
+// The test loads the document from Options.WSDLPath, so changes to it are picked up without regenerating the test.
+// Only messages made of element parts, as used by document/literal operations, are included.
+func GenerateContractTests(defs *wsdl.Definitions, opts Options) ([]byte, error) {
+	g, err := newGenerator(defs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cases := g.contractCases()
+	helpers := map[string]string{}
+
+	var table bytes.Buffer
+	for _, tc := range cases {
+		fmt.Fprintf(&table, "{\nname: %s,\n", strconv.Quote(tc.name))
+		fmt.Fprintf(&table, "value: %s,\n", g.structSample(tc.target, true, 0, helpers))
+		fmt.Fprintf(&table, "empty: func() interface{} { return &%s{} },\n},\n", tc.target.name)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	fmt.Fprintf(&buf, "package %s\n\n", opts.Package)
+	fmt.Fprintf(&buf, "import (\n\"bytes\"\n\"encoding/xml\"\n\"testing\"\n\nsoap %s\n%s\n)\n\n", strconv.Quote(importPath), strconv.Quote(importPath+"/wsdl"))
+	buf.WriteString("var contractTests = []struct {\nname string\nvalue interface{}\nempty func() interface{}\n}{\n")
+	buf.Write(table.Bytes())
+	buf.WriteString("}\n\n")
+	fmt.Fprintf(&buf, contractTestFunc, strconv.Quote(opts.WSDLPath))
+
+	names := make([]string, 0, len(helpers))
+	for name := range helpers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&buf, "\nfunc %s(v %s) *%s {\nreturn &v\n}\n", name, helpers[name], helpers[name])
+	}
+
+	return formatSource(buf.Bytes())
+}
+
+const contractTestFunc = `func TestContract(t *testing.T) {
+	defs, err := wsdl.ParseFile(%s)
+	if err != nil {
+		t.Fatalf("unable to parse WSDL: %%v", err)
+	}
+
+	for _, tt := range contractTests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := xml.Marshal(tt.value)
+			if err != nil {
+				t.Fatalf("unable to marshal content: %%v", err)
+			}
+			if err := defs.Validate(content); err != nil {
+				t.Fatalf("content does not match the schema: %%v\n%%s", err, content)
+			}
+
+			data, err := xml.Marshal(soap.NewEnvelope(tt.value))
+			if err != nil {
+				t.Fatalf("unable to marshal envelope: %%v", err)
+			}
+
+			decoded := tt.empty()
+			if _, err := soap.DecodeEnvelope(data, decoded, nil); err != nil {
+				t.Fatalf("unable to unmarshal envelope: %%v", err)
+			}
+
+			roundTrip, err := xml.Marshal(decoded)
+			if err != nil {
+				t.Fatalf("unable to marshal decoded content: %%v", err)
+			}
+			if !bytes.Equal(content, roundTrip) {
+				t.Errorf("content changed after round trip:\nwant: %%s\ngot:  %%s", content, roundTrip)
+			}
+		})
+	}
+}
+`
+
+// contractCases lists the input, output and fault messages of every operation, skipping operations bound more than once.
+func (g *generator) contractCases() []contractCase {
+	var cases []contractCase
+	seen := map[string]bool{}
+
+	add := func(name string, msg *wsdl.Message) {
+		if msg == nil {
+			return
+		}
+		for _, part := range msg.Parts {
+			elem := g.defs.Element(part.Element)
+			if elem == nil {
+				continue
+			}
+
+			caseName := name
+			if len(msg.Parts) > 1 {
+				caseName += "/" + part.Name
+			}
+			if seen[caseName] {
+				continue
+			}
+			seen[caseName] = true
+			cases = append(cases, contractCase{name: caseName, target: g.elements[elem]})
+		}
+	}
+
+	for _, op := range g.defs.AllOperations() {
+		add(op.Name+"/input", op.Input)
+		add(op.Name+"/output", op.Output)
+		for _, fault := range op.Faults {
+			add(op.Name+"/fault/"+fault.Name, fault)
+		}
+	}
+
+	return cases
+}
+
+// structSample returns a composite literal populating every field of the struct with sample values.
+// Only the first element of a choice is populated, and optional struct fields are left out past maxSampleDepth.
+func (g *generator) structSample(st *structType, addr bool, depth int, helpers map[string]string) string {
+	var b strings.Builder
+	if addr {
+		b.WriteString("&")
+	}
+	b.WriteString(st.name + "{\n")
+
+	if st.embed != nil {
+		fmt.Fprintf(&b, "%s: %s,\n", st.embed.name, g.structSample(st.embed, false, depth+1, helpers))
+	}
+	if st.value != nil {
+		fmt.Fprintf(&b, "Value: %s,\n", g.valueSample(*st.value, st.name))
+	}
+	for _, f := range st.attrs {
+		fmt.Fprintf(&b, "%s: %s,\n", f.name, g.valueSample(f.ref, f.name))
+	}
+	for _, f := range st.fields {
+		if f.alternative || (f.ref.structType != nil && f.optional && depth >= maxSampleDepth) {
+			continue
+		}
+
+		var value string
+		if f.ref.structType != nil {
+			value = g.structSample(f.ref.structType, true, depth+1, helpers)
+		} else {
+			value = g.valueSample(f.ref, f.name)
+		}
+
+		switch {
+		case f.list:
+			value = fmt.Sprintf("%s{%s}", f.goType(), value)
+		case f.pointer():
+			helper := "contractPtr" + GoName(strings.Replace(f.ref.goName, "[]", "Slice", -1))
+			helpers[helper] = f.ref.goName
+			value = fmt.Sprintf("%s(%s)", helper, value)
+		}
+		fmt.Fprintf(&b, "%s: %s,\n", f.name, value)
+	}
+
+	b.WriteString("}")
+	return b.String()
+}
+
+// valueSample returns a literal for a simple value: the first constant of enumerations, and a value matching
+// the lexical space of the built-in type otherwise.
+func (g *generator) valueSample(ref typeRef, name string) string {
+	if ref.enum != "" {
+		return ref.enum
+	}
+	if sample, ok := builtinSamples[ref.builtin]; ok {
+		return sample
+	}
+	return strconv.Quote(name)
+}
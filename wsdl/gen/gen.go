@@ -0,0 +1,504 @@
+/*
+Package gen generates Go code from WSDL documents parsed by the wsdl package.
+
+Generate produces the types used to marshal and unmarshal the messages exchanged by the operations of the document,
+and GenerateContractTests produces a table-driven test which checks that those types round-trip through
+a SOAP envelope and that the XML they produce is valid according to the schemas in the document.
+GenerateMocks optionally produces an interface for each port type, implemented by a client for each binding and by a
+mock recording calls and returning canned responses or faults, for unit testing code calling the service.
+All return gofmt formatted source, ready to be written to a file of the target package.
+*/
+package gen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/Enflick/gosoap/wsdl"
+)
+
+// header is the comment marking the generated files, as recognized by the go tool.
+const header = "// Code generated by gosoap wsdl/gen. DO NOT EDIT.\n\n"
+
+var (
+	// ErrNoPackage is returned if the options don't specify the package of the generated code.
+	ErrNoPackage = errors.New("gen: package name not specified")
+)
+
+// Options controls the generation of code.
+type Options struct {
+	// Package is the name of the package the generated code belongs to.
+	Package string
+	// WSDLPath is the path of the WSDL document loaded by the contract tests, relative to the directory of the package.
+	WSDLPath string
+}
+
+// builtinTypes maps the built-in XML schema types to the Go types used to represent them.
+// Types which aren't listed, such as the date and time types, are represented as strings.
+var builtinTypes = map[string]string{
+	"boolean":            "bool",
+	"byte":               "int8",
+	"short":              "int16",
+	"int":                "int32",
+	"long":               "int64",
+	"integer":            "int64",
+	"negativeInteger":    "int64",
+	"nonPositiveInteger": "int64",
+	"unsignedByte":       "uint8",
+	"unsignedShort":      "uint16",
+	"unsignedInt":        "uint32",
+	"unsignedLong":       "uint64",
+	"positiveInteger":    "uint64",
+	"nonNegativeInteger": "uint64",
+	"float":              "float32",
+	"double":             "float64",
+	"decimal":            "float64",
+	"base64Binary":       "[]byte",
+}
+
+// typeRef describes the Go type used for a value in a message.
+type typeRef struct {
+	// goName is the name of the Go type.
+	goName string
+	// builtin is the built-in XML schema type the value ultimately derives from.
+	builtin string
+	// structType is set if the value is represented by a generated struct.
+	structType *structType
+	// enum is the name of the first constant of an enumerated type.
+	enum string
+}
+
+// structType is a generated struct.
+type structType struct {
+	name string
+	// xmlName is the name of the element, for structs generated for global elements.
+	xmlName *wsdl.QName
+	// embed is the struct representing the base type the struct is derived from, if any.
+	embed *structType
+	// value is the type of the character data of structs with simple content.
+	value  *typeRef
+	fields []*field
+	attrs  []*field
+}
+
+// field is an element or attribute of a generated struct.
+type field struct {
+	name string
+	ref  typeRef
+	tag  string
+	// list is set if the element may occur more than once.
+	list bool
+	// optional is set if the element or attribute may be omitted.
+	optional bool
+	// alternative is set for the elements of a choice other than the first one.
+	alternative bool
+}
+
+// goType returns the declared type of the field.
+func (f *field) goType() string {
+	switch {
+	case f.list && f.ref.structType != nil:
+		return "[]*" + f.ref.goName
+	case f.list:
+		return "[]" + f.ref.goName
+	case f.ref.structType != nil:
+		return "*" + f.ref.goName
+	case f.pointer():
+		return "*" + f.ref.goName
+	}
+	return f.ref.goName
+}
+
+// pointer checks whether an optional simple value is declared as a pointer, so that it can be omitted.
+func (f *field) pointer() bool {
+	return f.optional && !f.list && f.ref.structType == nil && f.ref.goName != "[]byte"
+}
+
+// simpleType is a generated named simple type.
+type simpleType struct {
+	name   string
+	goType string
+	values []string
+	consts []string
+}
+
+type generator struct {
+	defs *wsdl.Definitions
+	opts Options
+
+	names    map[string]bool
+	elements map[*wsdl.Element]*structType
+	complex  map[*wsdl.ComplexType]*structType
+	simple   map[*wsdl.SimpleType]*simpleType
+
+	structs []*structType
+	simples []*simpleType
+}
+
+func newGenerator(defs *wsdl.Definitions, opts Options) (*generator, error) {
+	if opts.Package == "" {
+		return nil, ErrNoPackage
+	}
+
+	g := &generator{
+		defs:     defs,
+		opts:     opts,
+		names:    map[string]bool{},
+		elements: map[*wsdl.Element]*structType{},
+		complex:  map[*wsdl.ComplexType]*structType{},
+		simple:   map[*wsdl.SimpleType]*simpleType{},
+	}
+
+	// Names are assigned up front, so that types can reference each other regardless of declaration order.
+	// Global elements take precedence over types with the same name.
+	for _, schema := range defs.Types.Schemas {
+		for _, elem := range schema.Elements {
+			qname := elem.QName()
+			st := &structType{name: g.unique(GoName(elem.Name), ""), xmlName: &qname}
+			g.elements[elem] = st
+			g.structs = append(g.structs, st)
+		}
+	}
+	for _, schema := range defs.Types.Schemas {
+		for _, ct := range schema.ComplexTypes {
+			st := &structType{name: g.unique(GoName(ct.Name), "Type")}
+			g.complex[ct] = st
+			g.structs = append(g.structs, st)
+		}
+		for _, simple := range schema.SimpleTypes {
+			st := &simpleType{name: g.unique(GoName(simple.Name), "Type")}
+			g.simple[simple] = st
+			g.simples = append(g.simples, st)
+		}
+	}
+
+	for _, schema := range defs.Types.Schemas {
+		for _, simple := range schema.SimpleTypes {
+			g.buildSimple(g.simple[simple], simple)
+		}
+	}
+	for _, schema := range defs.Types.Schemas {
+		for _, elem := range schema.Elements {
+			g.buildElement(g.elements[elem], elem)
+		}
+		for _, ct := range schema.ComplexTypes {
+			g.buildComplex(g.complex[ct], ct)
+		}
+	}
+
+	return g, nil
+}
+
+// unique returns name, or name with suffix (and a counter if needed) if it is already in use.
+func (g *generator) unique(name string, suffix string) string {
+	candidate := name
+	for i := 1; g.names[candidate]; i++ {
+		candidate = name + suffix
+		if i > 1 || suffix == "" {
+			candidate += strconv.Itoa(i)
+		}
+	}
+	g.names[candidate] = true
+	return candidate
+}
+
+func (g *generator) buildSimple(st *simpleType, simple *wsdl.SimpleType) {
+	ref := g.simpleRef(simple, 0)
+	st.goType = ref.goName
+
+	if simple.Restriction == nil {
+		return
+	}
+	for _, enum := range simple.Restriction.Enumerations {
+		st.values = append(st.values, enum.Value)
+		st.consts = append(st.consts, g.unique(st.name+GoName(enum.Value), ""))
+	}
+}
+
+// simpleRef resolves the Go type of an anonymous or named simple type to that of the built-in type it derives from.
+func (g *generator) simpleRef(simple *wsdl.SimpleType, depth int) typeRef {
+	if simple.Restriction != nil && depth < 32 {
+		return g.typeRef(simple.Restriction.Base, depth+1)
+	}
+	// Lists and unions are kept in their lexical form.
+	return typeRef{goName: "string", builtin: "string"}
+}
+
+// typeRef resolves a reference to a built-in, simple or complex type.
+func (g *generator) typeRef(name wsdl.QName, depth int) typeRef {
+	if name.IsZero() || wsdl.IsBuiltin(name) {
+		builtin := name.Local
+		if builtin == "" || builtin == "anyType" || builtin == "anySimpleType" {
+			builtin = "string"
+		}
+		goName, ok := builtinTypes[builtin]
+		if !ok {
+			goName = "string"
+		}
+		return typeRef{goName: goName, builtin: builtin}
+	}
+
+	if ct := g.defs.ComplexType(name); ct != nil {
+		st := g.complex[ct]
+		return typeRef{goName: st.name, structType: st}
+	}
+
+	if simple := g.defs.SimpleType(name); simple != nil {
+		ref := g.simpleRef(simple, depth)
+		st := g.simple[simple]
+		ref.goName = st.name
+		ref.enum = ""
+		if len(st.consts) > 0 {
+			ref.enum = st.consts[0]
+		}
+		return ref
+	}
+
+	return typeRef{goName: "string", builtin: "string"}
+}
+
+func (g *generator) buildElement(st *structType, elem *wsdl.Element) {
+	switch {
+	case elem.ComplexType != nil:
+		g.buildComplex(st, elem.ComplexType)
+	case elem.SimpleType != nil:
+		ref := g.simpleRef(elem.SimpleType, 0)
+		st.value = &ref
+	default:
+		ref := g.typeRef(elem.Type, 0)
+		if ref.structType != nil {
+			st.embed = ref.structType
+		} else {
+			st.value = &ref
+		}
+	}
+}
+
+func (g *generator) buildComplex(st *structType, ct *wsdl.ComplexType) {
+	if derivation := ct.Derivation(); derivation != nil {
+		base := g.typeRef(derivation.Base, 0)
+		switch {
+		case ct.SimpleContent != nil && base.structType != nil:
+			st.embed = base.structType
+		case ct.SimpleContent != nil:
+			st.value = &base
+		case ct.ComplexContent.Extension != nil && base.structType != nil:
+			st.embed = base.structType
+		}
+
+		if group := derivation.Group(); group != nil {
+			g.addGroup(st, group, false, false)
+		}
+		g.addAttributes(st, derivation.Attributes)
+	}
+
+	if group := ct.Group(); group != nil {
+		g.addGroup(st, group, false, false)
+	}
+	g.addAttributes(st, ct.Attributes)
+}
+
+// addGroup adds a field to st for every element in the group, in document order.
+// Elements inherit being optional or repeated from the groups containing them.
+func (g *generator) addGroup(st *structType, group *wsdl.Group, optional bool, list bool) {
+	optional = optional || group.Min() == 0
+	list = list || group.Max() != 1
+
+	for i, particle := range group.Particles {
+		alternative := group.Kind == "choice" && i > 0
+		switch {
+		case particle.Element != nil:
+			f := g.elementField(st, particle.Element)
+			f.optional = f.optional || optional || group.Kind == "choice"
+			f.list = f.list || list
+			f.alternative = alternative
+			st.fields = append(st.fields, f)
+		case particle.Group != nil:
+			start := len(st.fields)
+			g.addGroup(st, particle.Group, optional || group.Kind == "choice", list)
+			for _, f := range st.fields[start:] {
+				f.alternative = f.alternative || alternative
+			}
+		}
+	}
+}
+
+func (g *generator) elementField(st *structType, elem *wsdl.Element) *field {
+	qname := elem.QName()
+	f := &field{
+		name:     st.fieldName(GoName(qname.Local)),
+		list:     elem.IsList(),
+		optional: elem.Min() == 0,
+	}
+
+	switch {
+	case !elem.Ref.IsZero():
+		if ref := g.defs.Element(elem.Ref); ref != nil {
+			target := g.elements[ref]
+			f.ref = typeRef{goName: target.name, structType: target}
+		} else {
+			f.ref = typeRef{goName: "string", builtin: "string"}
+		}
+	case elem.ComplexType != nil:
+		nested := &structType{name: g.unique(st.name+GoName(elem.Name), "Type")}
+		g.structs = append(g.structs, nested)
+		g.buildComplex(nested, elem.ComplexType)
+		f.ref = typeRef{goName: nested.name, structType: nested}
+	case elem.SimpleType != nil:
+		f.ref = g.simpleRef(elem.SimpleType, 0)
+	default:
+		f.ref = g.typeRef(elem.Type, 0)
+	}
+
+	f.tag = qname.Local
+	if qname.Space != "" {
+		f.tag = qname.Space + " " + qname.Local
+	}
+	return f
+}
+
+func (g *generator) addAttributes(st *structType, attrs []*wsdl.Attribute) {
+	for _, attr := range attrs {
+		name := attr.Name
+		if !attr.Ref.IsZero() {
+			name = attr.Ref.Local
+		}
+
+		var ref typeRef
+		if attr.SimpleType != nil {
+			ref = g.simpleRef(attr.SimpleType, 0)
+		} else {
+			ref = g.typeRef(attr.Type, 0)
+		}
+
+		f := &field{
+			name:     st.fieldName(GoName(name)),
+			ref:      ref,
+			optional: attr.Use != "required",
+			tag:      name + ",attr",
+		}
+		if f.optional {
+			f.tag += ",omitempty"
+		}
+		st.attrs = append(st.attrs, f)
+	}
+}
+
+// fieldName returns a name for a new field of the struct which doesn't clash with its existing fields.
+func (st *structType) fieldName(name string) string {
+	used := map[string]bool{"XMLName": true, "Value": st.value != nil}
+	if st.embed != nil {
+		used[st.embed.name] = true
+	}
+	for _, f := range st.fields {
+		used[f.name] = true
+	}
+	for _, f := range st.attrs {
+		used[f.name] = true
+	}
+
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = name + strconv.Itoa(i)
+	}
+	return candidate
+}
+
+// Generate generates the Go types for the elements and types declared in the schemas of the document.
+// Every global element is represented by a struct with an XMLName, so it can be used directly as the content
+// of a request or response. Optional elements are pointers and repeated elements are slices.
+func Generate(defs *wsdl.Definitions, opts Options) ([]byte, error) {
+	g, err := newGenerator(defs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(header)
+	fmt.Fprintf(&buf, "package %s\n\n", opts.Package)
+	if len(g.elements) > 0 {
+		buf.WriteString("import \"encoding/xml\"\n\n")
+	}
+
+	for _, st := range g.simples {
+		g.writeSimple(&buf, st)
+	}
+	for _, st := range g.structs {
+		g.writeStruct(&buf, st)
+	}
+
+	return formatSource(buf.Bytes())
+}
+
+func (g *generator) writeSimple(buf *bytes.Buffer, st *simpleType) {
+	fmt.Fprintf(buf, "type %s %s\n\n", st.name, st.goType)
+	if len(st.consts) == 0 {
+		return
+	}
+
+	buf.WriteString("const (\n")
+	for i, name := range st.consts {
+		fmt.Fprintf(buf, "%s %s = %s\n", name, st.name, strconv.Quote(st.values[i]))
+	}
+	buf.WriteString(")\n\n")
+}
+
+func (g *generator) writeStruct(buf *bytes.Buffer, st *structType) {
+	fmt.Fprintf(buf, "type %s struct {\n", st.name)
+	if st.xmlName != nil {
+		fmt.Fprintf(buf, "XMLName xml.Name `xml:\"%s\"`\n", strings.TrimSpace(st.xmlName.Space+" "+st.xmlName.Local))
+	}
+	if st.embed != nil {
+		fmt.Fprintf(buf, "%s\n", st.embed.name)
+	}
+	if st.value != nil {
+		fmt.Fprintf(buf, "Value %s `xml:\",chardata\"`\n", st.value.goName)
+	}
+	for _, f := range st.attrs {
+		fmt.Fprintf(buf, "%s %s `xml:\"%s\"`\n", f.name, f.goType(), f.tag)
+	}
+	for _, f := range st.fields {
+		tag := f.tag
+		if f.optional && !f.pointer() && !f.list && f.ref.structType == nil {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(buf, "%s %s `xml:\"%s\"`\n", f.name, f.goType(), tag)
+	}
+	buf.WriteString("}\n\n")
+}
+
+func formatSource(src []byte) ([]byte, error) {
+	formatted, err := format.Source(src)
+	if err != nil {
+		return nil, fmt.Errorf("gen: unable to format generated source: %v", err)
+	}
+	return formatted, nil
+}
+
+// GoName converts an XML name into an exported Go identifier, i.e. get-quote_request becomes GetQuoteRequest.
+func GoName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+
+	ident := b.String()
+	if ident == "" || unicode.IsDigit([]rune(ident)[0]) {
+		ident = "X" + ident
+	}
+	return ident
+}
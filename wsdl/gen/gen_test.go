@@ -0,0 +1,95 @@
+package gen
+
+import (
+	"flag"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Enflick/gosoap/wsdl"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "update the golden files of the generated code")
+
+func assertGenerated(t *testing.T, src []byte, path string) {
+	_, err := parser.ParseFile(token.NewFileSet(), path, src, 0)
+	assert.Nil(t, err)
+
+	if *update {
+		assert.Nil(t, ioutil.WriteFile(path, src, 0644))
+		return
+	}
+
+	golden, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, string(golden), string(src))
+}
+
+func TestGenerate(t *testing.T) {
+	defs, err := wsdl.ParseFile("../testdata/quotes.wsdl")
+	assert.Nil(t, err)
+
+	src, err := Generate(defs, Options{Package: "quotes"})
+	assert.Nil(t, err)
+	assertGenerated(t, src, "testdata/quotes.types.golden")
+}
+
+func TestGenerateContractTests(t *testing.T) {
+	defs, err := wsdl.ParseFile("../testdata/quotes.wsdl")
+	assert.Nil(t, err)
+
+	src, err := GenerateContractTests(defs, Options{Package: "quotes", WSDLPath: "quotes.wsdl"})
+	assert.Nil(t, err)
+	assertGenerated(t, src, "testdata/quotes.contract.golden")
+}
+
+func TestGenerateNoPackage(t *testing.T) {
+	_, err := Generate(&wsdl.Definitions{}, Options{})
+	assert.Equal(t, ErrNoPackage, err)
+
+	_, err = GenerateContractTests(&wsdl.Definitions{}, Options{})
+	assert.Equal(t, ErrNoPackage, err)
+}
+
+func TestGoName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "GetQuote", want: "GetQuote"},
+		{name: "getQuote", want: "GetQuote"},
+		{name: "get-quote_request", want: "GetQuoteRequest"},
+		{name: "quote.v2", want: "QuoteV2"},
+		{name: "2fa", want: "X2fa"},
+		{name: "", want: "X"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, GoName(tt.name))
+		})
+	}
+}
+
+func TestGenerateMocks(t *testing.T) {
+	defs, err := wsdl.ParseFile("../testdata/quotes.wsdl")
+	assert.Nil(t, err)
+
+	src, err := GenerateMocks(defs, Options{Package: "quotes"})
+	assert.Nil(t, err)
+	assertGenerated(t, src, "testdata/quotes.mocks.golden")
+
+	_, err = GenerateMocks(&wsdl.Definitions{}, Options{})
+	assert.Equal(t, ErrNoPackage, err)
+}
+
+func TestGenerateMocksBare(t *testing.T) {
+	defs, err := wsdl.ParseFile("testdata/bare.wsdl")
+	assert.Nil(t, err)
+
+	src, err := GenerateMocks(defs, Options{Package: "orders"})
+	assert.Nil(t, err)
+	assertGenerated(t, src, "testdata/bare.mocks.golden")
+}
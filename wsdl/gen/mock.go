@@ -0,0 +1,312 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Enflick/gosoap/wsdl"
+)
+
+// Implements the generation of interfaces for the port types of a document, along with clients and mocks
+// implementing them.
+
+// portMethod is a method of a generated interface, for an operation of a port type.
+type portMethod struct {
+	name string
+	// operation is the name of the operation, and input and output the types of its messages, if it has them.
+	operation string
+	input     *messageType
+	output    *messageType
+}
+
+// messageType is the Go type of a message: the struct of its element, or a struct holding its parts if it has several,
+// as in non-wrapped ("bare") document/literal operations.
+type messageType struct {
+	name    string
+	message string
+	// parts are the fields of the struct holding the parts, nil if the message has a single part.
+	parts []messageField
+}
+
+// messageField is a field of the struct holding the parts of a message.
+type messageField struct {
+	name   string
+	target *structType
+}
+
+// body returns the expression of the body of a request or response with the value of the message type.
+func (m *messageType) body(value string) string {
+	if m.parts != nil {
+		return value + ".BareParts()"
+	}
+	return value
+}
+
+// literal returns the expression of a new value of the message type, ready to be unmarshalled into.
+func (m *messageType) literal() string {
+	if m.parts == nil {
+		return "&" + m.name + "{}"
+	}
+	var b strings.Builder
+	b.WriteString("&" + m.name + "{")
+	for i, f := range m.parts {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s: &%s{}", f.name, f.target.name)
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// signature returns the parameters and results of the method.
+func (m *portMethod) signature() string {
+	params := "ctx context.Context"
+	if m.input != nil {
+		params += ", request *" + m.input.name
+	}
+	if m.output != nil {
+		return fmt.Sprintf("(%s) (*%s, error)", params, m.output.name)
+	}
+	return fmt.Sprintf("(%s) error", params)
+}
+
+// request returns the argument passed for the request of the method.
+func (m *portMethod) request() string {
+	if m.input != nil {
+		return m.input.body("request")
+	}
+	return "nil"
+}
+
+// portInterface is a generated interface, for a port type.
+type portInterface struct {
+	name    string
+	mock    string
+	methods []*portMethod
+}
+
+// GenerateMocks generates an interface for each port type of the document, with a method for each operation, so that
+// code calling the service can depend on the interface rather than on a client. For each binding of the port type,
+// a client implementing the interface calls the service with a soap.Client; for each port type, a mock implementing
+// it records the calls it receives and returns the responses, or errors such as faults, set on it, so that code using
+// the interface can be unit tested without a service or an HTTP server.
+// Only operations whose messages are made of element parts, as used by document/literal operations, are included.
+// Messages of several parts, as used by non-wrapped ("bare") operations, are represented by a struct holding a field
+// for each part, sent and received as soap.BareParts. The generated code uses the types generated by Generate.
+func GenerateMocks(defs *wsdl.Definitions, opts Options) ([]byte, error) {
+	g, err := newGenerator(defs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	interfaces := map[*wsdl.PortType]*portInterface{}
+	messages := map[*wsdl.Message]*messageType{}
+	var bare []*messageType
+	var buf bytes.Buffer
+	buf.WriteString(mockCallType)
+
+	for _, portType := range defs.PortTypes {
+		iface := &portInterface{name: g.unique(GoName(portType.Name), "Service")}
+		iface.mock = g.unique(iface.name+"Mock", "")
+		for _, op := range portType.Operations {
+			if method := g.portMethod(op, messages, &bare); method != nil {
+				iface.methods = append(iface.methods, method)
+			}
+		}
+		interfaces[portType] = iface
+
+		fmt.Fprintf(&buf, "// %s is the interface of the %s port type.\n", iface.name, portType.Name)
+		fmt.Fprintf(&buf, "type %s interface {\n", iface.name)
+		for _, method := range iface.methods {
+			fmt.Fprintf(&buf, "%s%s\n", method.name, method.signature())
+		}
+		buf.WriteString("}\n\n")
+	}
+
+	for _, msg := range bare {
+		writeBareMessage(&buf, msg)
+	}
+
+	for _, binding := range defs.Bindings {
+		portType := defs.PortType(binding.Type)
+		if portType == nil {
+			continue
+		}
+		g.writeClient(&buf, binding, interfaces[portType])
+	}
+
+	methods, clients := false, false
+	for _, portType := range defs.PortTypes {
+		g.writeMock(&buf, interfaces[portType])
+		methods = methods || len(interfaces[portType].methods) > 0
+	}
+	for _, binding := range defs.Bindings {
+		clients = clients || interfaces[defs.PortType(binding.Type)] != nil
+	}
+	clients = clients || len(bare) > 0
+
+	// The imports are only those the generated code uses, as it doesn't compile otherwise.
+	var src bytes.Buffer
+	src.WriteString(header)
+	fmt.Fprintf(&src, "package %s\n\nimport (\n", opts.Package)
+	if methods {
+		src.WriteString("\"context\"\n")
+	}
+	src.WriteString("\"sync\"\n")
+	if clients {
+		fmt.Fprintf(&src, "\nsoap %s\n", strconv.Quote(importPath))
+	}
+	src.WriteString(")\n\n")
+	src.Write(buf.Bytes())
+
+	return formatSource(src.Bytes())
+}
+
+// mockCallType is the type of the calls recorded by the generated mocks.
+const mockCallType = `// MockCall is a call received by a mock: the operation called and its request, nil if it has none.
+type MockCall struct {
+	Operation string
+	Request   interface{}
+}
+
+`
+
+// portMethod returns the method of the interface for the operation, or nil if its messages aren't made of elements.
+// The types of the messages are recorded in messages, and those of messages of several parts added to bare.
+func (g *generator) portMethod(op *wsdl.Operation, messages map[*wsdl.Message]*messageType, bare *[]*messageType) *portMethod {
+	method := &portMethod{name: GoName(op.Name), operation: op.Name}
+
+	var ok bool
+	if op.Input != nil {
+		if method.input, ok = g.messageType(op.Input.Message, messages, bare); !ok {
+			return nil
+		}
+	}
+	if op.Output != nil {
+		if method.output, ok = g.messageType(op.Output.Message, messages, bare); !ok {
+			return nil
+		}
+	}
+	return method
+}
+
+// messageType returns the type of the message: the struct generated for its element if it has a single part, or
+// a new struct holding its parts if it has several, all of which must be elements.
+func (g *generator) messageType(name wsdl.QName, messages map[*wsdl.Message]*messageType, bare *[]*messageType) (*messageType, bool) {
+	msg := g.defs.Message(name)
+	if msg == nil || len(msg.Parts) == 0 {
+		return nil, false
+	}
+	if mt, ok := messages[msg]; ok {
+		return mt, mt != nil
+	}
+
+	var fields []messageField
+	for _, part := range msg.Parts {
+		elem := g.defs.Element(part.Element)
+		if elem == nil {
+			messages[msg] = nil
+			return nil, false
+		}
+		fields = append(fields, messageField{name: GoName(part.Name), target: g.elements[elem]})
+	}
+
+	mt := &messageType{name: fields[0].target.name, message: msg.Name}
+	if len(fields) > 1 {
+		mt.name = g.unique(GoName(msg.Name)+"Parts", "")
+		mt.parts = fields
+		*bare = append(*bare, mt)
+	}
+	messages[msg] = mt
+	return mt, true
+}
+
+// writeBareMessage writes the struct holding the parts of a message of several parts, which are marshalled and
+// unmarshalled as soap.BareParts.
+func writeBareMessage(buf *bytes.Buffer, msg *messageType) {
+	fmt.Fprintf(buf, "// %s holds the parts of the %s message, each bound to an element of the body.\n", msg.name, msg.message)
+	fmt.Fprintf(buf, "type %s struct {\n", msg.name)
+	for _, f := range msg.parts {
+		fmt.Fprintf(buf, "%s *%s\n", f.name, f.target.name)
+	}
+	buf.WriteString("}\n\n")
+
+	buf.WriteString("// BareParts returns the parts of the message, as the body of a request or the response it is decoded into.\n")
+	fmt.Fprintf(buf, "func (m *%s) BareParts() soap.BareParts {\nreturn soap.BareParts{", msg.name)
+	for i, f := range msg.parts {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		buf.WriteString("m." + f.name)
+	}
+	buf.WriteString("}\n}\n\n")
+}
+
+// writeClient writes the client implementing the interface by calling the service through the binding.
+func (g *generator) writeClient(buf *bytes.Buffer, binding *wsdl.Binding, iface *portInterface) {
+	name := g.unique(GoName(binding.Name)+"Client", "")
+	actions := map[string]string{}
+	for _, op := range g.defs.Operations(binding) {
+		actions[op.Name] = op.SOAPAction
+	}
+
+	fmt.Fprintf(buf, "// %s implements %s by calling the service bound with %s at URL.\n", name, iface.name, binding.Name)
+	fmt.Fprintf(buf, "type %s struct {\nClient *soap.Client\nURL string\n}\n\n", name)
+
+	for _, method := range iface.methods {
+		action := strconv.Quote(actions[method.operation])
+		fmt.Fprintf(buf, "func (c *%s) %s%s {\n", name, method.name, method.signature())
+		if method.output == nil {
+			fmt.Fprintf(buf, "_, err := c.Client.DoInto(ctx, %s, c.URL, %s, nil)\nreturn err\n}\n\n", action, method.request())
+			continue
+		}
+		fmt.Fprintf(buf, "response := %s\n", method.output.literal())
+		fmt.Fprintf(buf, "if _, err := c.Client.DoInto(ctx, %s, c.URL, %s, %s); err != nil {\nreturn nil, err\n}\n", action, method.request(), method.output.body("response"))
+		buf.WriteString("return response, nil\n}\n\n")
+	}
+
+	fmt.Fprintf(buf, "var _ %s = (*%s)(nil)\n\n", iface.name, name)
+}
+
+// writeMock writes the mock implementing the interface.
+func (g *generator) writeMock(buf *bytes.Buffer, iface *portInterface) {
+	fmt.Fprintf(buf, "// %s is a mock of %s, which records the calls it receives. Each method calls its Func field if\n", iface.mock, iface.name)
+	buf.WriteString("// set, and otherwise returns its Result and Err fields; Err may be a *soap.Fault to simulate a fault.\n")
+	fmt.Fprintf(buf, "type %s struct {\n", iface.mock)
+	for _, method := range iface.methods {
+		fmt.Fprintf(buf, "%sFunc func%s\n", method.name, method.signature())
+		if method.output != nil {
+			fmt.Fprintf(buf, "%sResult *%s\n", method.name, method.output.name)
+		}
+		fmt.Fprintf(buf, "%sErr error\n\n", method.name)
+	}
+	buf.WriteString("mu sync.Mutex\ncalls []MockCall\n}\n\n")
+
+	for _, method := range iface.methods {
+		args := "ctx"
+		if method.input != nil {
+			args += ", request"
+		}
+		fmt.Fprintf(buf, "func (m *%s) %s%s {\n", iface.mock, method.name, method.signature())
+		request := "nil"
+		if method.input != nil {
+			request = "request"
+		}
+		fmt.Fprintf(buf, "m.record(%s, %s)\n", strconv.Quote(method.operation), request)
+		fmt.Fprintf(buf, "if m.%sFunc != nil {\nreturn m.%sFunc(%s)\n}\n", method.name, method.name, args)
+		if method.output != nil {
+			fmt.Fprintf(buf, "return m.%sResult, m.%sErr\n}\n\n", method.name, method.name)
+		} else {
+			fmt.Fprintf(buf, "return m.%sErr\n}\n\n", method.name)
+		}
+	}
+
+	fmt.Fprintf(buf, "// Calls returns the calls received by the mock, in order.\nfunc (m *%s) Calls() []MockCall {\n", iface.mock)
+	buf.WriteString("m.mu.Lock()\ndefer m.mu.Unlock()\nreturn append([]MockCall(nil), m.calls...)\n}\n\n")
+	fmt.Fprintf(buf, "func (m *%s) record(operation string, request interface{}) {\n", iface.mock)
+	buf.WriteString("m.mu.Lock()\ndefer m.mu.Unlock()\nm.calls = append(m.calls, MockCall{Operation: operation, Request: request})\n}\n\n")
+	fmt.Fprintf(buf, "var _ %s = (*%s)(nil)\n\n", iface.name, iface.mock)
+}
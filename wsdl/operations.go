@@ -0,0 +1,112 @@
+package wsdl
+
+// BoundOperation combines an abstract operation with the details of how it is bound to SOAP, resolving all
+// the references between the sections of the WSDL document.
+type BoundOperation struct {
+	// Name is the name of the operation.
+	Name string
+	// SOAPAction is the SOAPAction to send with requests for the operation.
+	SOAPAction string
+	// Style is the binding style of the operation: document or rpc.
+	Style string
+	// SOAP12 is set if the operation is bound to SOAP 1.2 rather than SOAP 1.1.
+	SOAP12 bool
+
+	// Input is the message sent to invoke the operation, or nil if it has none.
+	Input *Message
+	// Output is the message returned by the operation, or nil if it has none.
+	Output *Message
+	// Faults are the messages sent as the detail of the faults the operation may return.
+	Faults []*Message
+
+	Binding          *Binding
+	BindingOperation *BindingOperation
+	PortType         *PortType
+	Operation        *Operation
+}
+
+// Operations resolves all the operations of the binding.
+// Operations which aren't declared in the port type of the binding are skipped.
+func (d *Definitions) Operations(binding *Binding) []*BoundOperation {
+	portType := d.PortType(binding.Type)
+	if portType == nil {
+		return nil
+	}
+
+	style := "document"
+	soap12 := false
+
+	soapBinding := binding.SOAPBinding
+	if soapBinding == nil && binding.SOAP12Binding != nil {
+		soapBinding = binding.SOAP12Binding
+		soap12 = true
+	}
+	if soapBinding != nil && soapBinding.Style != "" {
+		style = soapBinding.Style
+	}
+
+	var ops []*BoundOperation
+	for _, bindingOp := range binding.Operations {
+		op := portType.Operation(bindingOp.Name)
+		if op == nil {
+			continue
+		}
+
+		bound := &BoundOperation{
+			Name:             op.Name,
+			Style:            style,
+			SOAP12:           soap12,
+			Binding:          binding,
+			BindingOperation: bindingOp,
+			PortType:         portType,
+			Operation:        op,
+		}
+
+		soapOp := bindingOp.SOAPOperation
+		if soapOp == nil {
+			soapOp = bindingOp.SOAP12Operation
+		}
+		if soapOp != nil {
+			bound.SOAPAction = soapOp.SOAPAction
+			if soapOp.Style != "" {
+				bound.Style = soapOp.Style
+			}
+		}
+
+		if op.Input != nil {
+			bound.Input = d.Message(op.Input.Message)
+		}
+		if op.Output != nil {
+			bound.Output = d.Message(op.Output.Message)
+		}
+		for _, fault := range op.Faults {
+			if msg := d.Message(fault.Message); msg != nil {
+				bound.Faults = append(bound.Faults, msg)
+			}
+		}
+
+		ops = append(ops, bound)
+	}
+
+	return ops
+}
+
+// AllOperations resolves the operations of every binding in the document.
+func (d *Definitions) AllOperations() []*BoundOperation {
+	var ops []*BoundOperation
+	for _, binding := range d.Bindings {
+		ops = append(ops, d.Operations(binding)...)
+	}
+	return ops
+}
+
+// Address returns the location of the port, whichever SOAP version it is bound to.
+func (p *Port) Address() string {
+	if p.SOAPAddress != nil {
+		return p.SOAPAddress.Location
+	}
+	if p.SOAP12Address != nil {
+		return p.SOAP12Address.Location
+	}
+	return ""
+}
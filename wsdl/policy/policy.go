@@ -0,0 +1,445 @@
+/*
+Package policy parses the WS-Policy attachments of WSDL 1.1 documents into a normalized model.
+
+Policies may be attached to the ports, bindings and port types of a document, to their operations and to the
+input and output messages of the operations, either inline or by reference to policies declared elsewhere in the
+document, and may combine their assertions with the ExactlyOne and All operators. The effective policy of an
+endpoint, operation or message merges the policies attached to each of the elements describing it, and is returned
+in the normal form defined by WS-Policy: a set of alternatives, each holding the assertions a requester must all
+satisfy, so that callers such as the security and addressing features of the client only need to pick an
+alternative they support.
+
+Both WS-Policy 1.5 and the 2004/09 submission are supported. Policies are only resolved within the document; a
+reference to an external policy fails with a ReferenceError.
+*/
+package policy
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// Namespace is the WS-Policy 1.5 namespace.
+	Namespace = "http://www.w3.org/ns/ws-policy"
+	// SubmissionNamespace is the namespace of the WS-Policy 2004/09 submission, still used by many services.
+	SubmissionNamespace = "http://schemas.xmlsoap.org/ws/2004/09/policy"
+
+	// SecurityPolicyNamespace is the WS-SecurityPolicy 1.2 namespace.
+	SecurityPolicyNamespace = "http://docs.oasis-open.org/ws-sx/ws-securitypolicy/200702"
+	// AddressingMetadataNamespace is the namespace of the WS-Addressing 1.0 Metadata assertions.
+	AddressingMetadataNamespace = "http://www.w3.org/2007/05/addressing/metadata"
+
+	wsdlNamespace = "http://schemas.xmlsoap.org/wsdl/"
+	wsuNamespace  = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+	xmlNamespace  = "http://www.w3.org/XML/1998/namespace"
+)
+
+// The names of well-known assertions.
+var (
+	// AddressingAssertion requires WS-Addressing headers.
+	AddressingAssertion = xml.Name{Space: AddressingMetadataNamespace, Local: "Addressing"}
+	// TransportBindingAssertion requires the messages to be protected by the transport, i.e. HTTPS.
+	TransportBindingAssertion = xml.Name{Space: SecurityPolicyNamespace, Local: "TransportBinding"}
+	// AsymmetricBindingAssertion requires the messages to be signed with X.509 certificates.
+	AsymmetricBindingAssertion = xml.Name{Space: SecurityPolicyNamespace, Local: "AsymmetricBinding"}
+	// SymmetricBindingAssertion requires the messages to be protected with a key shared by the parties.
+	SymmetricBindingAssertion = xml.Name{Space: SecurityPolicyNamespace, Local: "SymmetricBinding"}
+	// UsernameTokenAssertion requires a username token.
+	UsernameTokenAssertion = xml.Name{Space: SecurityPolicyNamespace, Local: "UsernameToken"}
+	// X509TokenAssertion requires an X.509 certificate token.
+	X509TokenAssertion = xml.Name{Space: SecurityPolicyNamespace, Local: "X509Token"}
+)
+
+var (
+	// ErrNotWSDL is returned if the document parsed is not a WSDL 1.1 definitions document.
+	ErrNotWSDL = errors.New("document is not a WSDL 1.1 definitions document")
+	// ErrNoSubject is returned if the element of the document a policy is requested for isn't declared.
+	ErrNoSubject = errors.New("policy subject not found in the document")
+	// ErrCircularReference is returned if a policy references itself, directly or not.
+	ErrCircularReference = errors.New("circular policy reference")
+)
+
+// ReferenceError is returned if a policy reference can't be resolved within the document.
+type ReferenceError struct {
+	// URI is the URI of the policy referenced.
+	URI string
+}
+
+func (e *ReferenceError) Error() string {
+	return "unresolved policy reference: " + e.URI
+}
+
+// Policy is a policy in normal form.
+type Policy struct {
+	// Alternatives are the policy alternatives, any one of which satisfies the policy. A policy with a single empty
+	// alternative has no requirements, while one without alternatives can't be satisfied.
+	Alternatives []Alternative
+}
+
+// Alternative is a policy alternative, a set of assertions which must all be satisfied.
+type Alternative []*Assertion
+
+// Assertion is a policy assertion, a requirement or capability such as the use of WS-Addressing.
+type Assertion struct {
+	// Name is the name of the assertion element.
+	Name xml.Name
+	// Attrs are the attributes of the assertion element, other than the WS-Policy ones.
+	Attrs []xml.Attr
+	// Ignorable is set if the assertion is marked as ignorable, and so may be ignored by requesters which don't
+	// understand it.
+	Ignorable bool
+	// Policy is the nested policy of the assertion, qualifying it, or nil if it has none.
+	Policy *Policy
+}
+
+// Attr returns the value of the attribute of the assertion with the name, or an empty string if it has none.
+func (a *Assertion) Attr(name xml.Name) string {
+	for _, attr := range a.Attrs {
+		if attr.Name == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Assertion returns the first assertion of the alternative with the name, or nil if it has none.
+func (a Alternative) Assertion(name xml.Name) *Assertion {
+	for _, assertion := range a {
+		if assertion.Name == name {
+			return assertion
+		}
+	}
+	return nil
+}
+
+// Direction selects the input or output message of an operation.
+type Direction int
+
+const (
+	// Input is the message sent to invoke an operation.
+	Input Direction = iota
+	// Output is the message returned by an operation.
+	Output
+)
+
+// Document holds the elements of a WSDL document which policies are attached to.
+type Document struct {
+	root *element
+	// policies are the policies declared in the document, by the URIs referencing them: the fragment of their
+	// wsu:Id or xml:id, and their name.
+	policies map[string]*element
+}
+
+// element is a generic XML element, as policies and their assertions may contain any element.
+type element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []*element `xml:",any"`
+}
+
+// Parse reads the policies of the WSDL document from r.
+func Parse(r io.Reader) (*Document, error) {
+	root := &element{}
+	if err := xml.NewDecoder(r).Decode(root); err != nil {
+		return nil, err
+	}
+	if root.XMLName.Space != wsdlNamespace || root.XMLName.Local != "definitions" {
+		return nil, ErrNotWSDL
+	}
+
+	doc := &Document{root: root, policies: map[string]*element{}}
+	doc.collectPolicies(root)
+	return doc, nil
+}
+
+// ParseFile reads the policies of the WSDL document at path.
+func ParseFile(path string) (*Document, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// collectPolicies records the policies declared within elem, by the URIs referencing them.
+func (d *Document) collectPolicies(elem *element) {
+	if isPolicyElement(elem, "Policy") {
+		for _, attr := range elem.Attrs {
+			switch {
+			case attr.Name.Local == "Id" && attr.Name.Space == wsuNamespace,
+				attr.Name.Local == "id" && attr.Name.Space == xmlNamespace:
+				d.policies["#"+attr.Value] = elem
+			case attr.Name.Local == "Name" && attr.Name.Space == "":
+				d.policies[attr.Value] = elem
+			}
+		}
+	}
+
+	for _, child := range elem.Children {
+		d.collectPolicies(child)
+	}
+}
+
+// EndpointPolicy returns the effective policy of the port of the service, merging the policies attached to the port,
+// its binding and the port type of the binding.
+func (d *Document) EndpointPolicy(service string, port string) (*Policy, error) {
+	portElem := d.root.child("service", service).child("port", port)
+	if portElem == nil {
+		return nil, ErrNoSubject
+	}
+	binding := d.root.child("binding", localName(portElem.attr("binding")))
+	if binding == nil {
+		return nil, ErrNoSubject
+	}
+	portType := d.root.child("portType", localName(binding.attr("type")))
+
+	return d.effectivePolicy(portElem, binding, portType)
+}
+
+// OperationPolicy returns the effective policy of the operation of the binding, merging the policies attached to the
+// operation in the binding and in its port type.
+func (d *Document) OperationPolicy(binding string, operation string) (*Policy, error) {
+	bindingOp, portTypeOp, err := d.operation(binding, operation)
+	if err != nil {
+		return nil, err
+	}
+	return d.effectivePolicy(bindingOp, portTypeOp)
+}
+
+// MessagePolicy returns the effective policy of the input or output message of the operation of the binding, merging
+// the policies attached to the message in the binding, in its port type, and to the message it references.
+func (d *Document) MessagePolicy(binding string, operation string, direction Direction) (*Policy, error) {
+	bindingOp, portTypeOp, err := d.operation(binding, operation)
+	if err != nil {
+		return nil, err
+	}
+
+	local := "input"
+	if direction == Output {
+		local = "output"
+	}
+	bindingIO := bindingOp.child(local, "")
+	portTypeIO := portTypeOp.child(local, "")
+	var message *element
+	if portTypeIO != nil {
+		message = d.root.child("message", localName(portTypeIO.attr("message")))
+	}
+
+	return d.effectivePolicy(bindingIO, portTypeIO, message)
+}
+
+// operation returns the operation of the binding, and the operation of its port type.
+func (d *Document) operation(binding string, operation string) (*element, *element, error) {
+	bindingElem := d.root.child("binding", binding)
+	bindingOp := bindingElem.child("operation", operation)
+	if bindingOp == nil {
+		return nil, nil, ErrNoSubject
+	}
+	portType := d.root.child("portType", localName(bindingElem.attr("type")))
+	return bindingOp, portType.child("operation", operation), nil
+}
+
+// effectivePolicy merges the policies attached to the elements, which may be nil, into their normal form.
+func (d *Document) effectivePolicy(elems ...*element) (*Policy, error) {
+	alternatives := []Alternative{{}}
+	for _, elem := range elems {
+		if elem == nil {
+			continue
+		}
+
+		attached, err := d.attachedAlternatives(elem)
+		if err != nil {
+			return nil, err
+		}
+		alternatives = merge(alternatives, attached)
+	}
+
+	return &Policy{Alternatives: alternatives}, nil
+}
+
+// attachedAlternatives returns the alternatives of the policies attached to the element: the policies and references
+// it contains, and those referenced by its PolicyURIs attribute.
+func (d *Document) attachedAlternatives(elem *element) ([]Alternative, error) {
+	alternatives := []Alternative{{}}
+	for _, attr := range elem.Attrs {
+		if attr.Name.Local != "PolicyURIs" || !isPolicyNamespace(attr.Name.Space) {
+			continue
+		}
+		for _, uri := range strings.Fields(attr.Value) {
+			referenced, err := d.reference(uri, nil)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = merge(alternatives, referenced)
+		}
+	}
+
+	for _, child := range elem.Children {
+		if !isPolicyElement(child, "Policy") && !isPolicyElement(child, "PolicyReference") {
+			continue
+		}
+		attached, err := d.normalize(child, nil)
+		if err != nil {
+			return nil, err
+		}
+		alternatives = merge(alternatives, attached)
+	}
+
+	return alternatives, nil
+}
+
+// normalize returns the alternatives of the policy expression elem, having resolved the references it contains.
+// resolving are the policies whose references are being resolved, to detect circular references.
+func (d *Document) normalize(elem *element, resolving []*element) ([]Alternative, error) {
+	switch {
+	case isPolicyElement(elem, "Policy"), isPolicyElement(elem, "All"):
+		alternatives := []Alternative{{}}
+		for _, child := range elem.Children {
+			childAlternatives, err := d.normalize(child, resolving)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = merge(alternatives, childAlternatives)
+		}
+		return alternatives, nil
+
+	case isPolicyElement(elem, "ExactlyOne"):
+		var alternatives []Alternative
+		for _, child := range elem.Children {
+			childAlternatives, err := d.normalize(child, resolving)
+			if err != nil {
+				return nil, err
+			}
+			alternatives = append(alternatives, childAlternatives...)
+		}
+		return alternatives, nil
+
+	case isPolicyElement(elem, "PolicyReference"):
+		return d.reference(elem.attr("URI"), resolving)
+
+	case isPolicyNamespace(elem.XMLName.Space):
+		// Other elements of the WS-Policy namespace, such as wsp:PolicyAttachment, aren't assertions.
+		return []Alternative{{}}, nil
+	}
+
+	return d.assertion(elem, resolving)
+}
+
+// assertion returns the alternatives of the assertion elem: the assertion alone, or either the assertion or nothing
+// if it is optional.
+func (d *Document) assertion(elem *element, resolving []*element) ([]Alternative, error) {
+	assertion := &Assertion{Name: elem.XMLName}
+	optional := false
+	for _, attr := range elem.Attrs {
+		switch {
+		case isPolicyNamespace(attr.Name.Space) && attr.Name.Local == "Optional":
+			optional = isTrue(attr.Value)
+		case isPolicyNamespace(attr.Name.Space) && attr.Name.Local == "Ignorable":
+			assertion.Ignorable = isTrue(attr.Value)
+		case attr.Name.Space == "xmlns", attr.Name.Space == "" && attr.Name.Local == "xmlns":
+		default:
+			assertion.Attrs = append(assertion.Attrs, attr)
+		}
+	}
+
+	for _, child := range elem.Children {
+		if !isPolicyElement(child, "Policy") && !isPolicyElement(child, "PolicyReference") {
+			continue
+		}
+		nested, err := d.normalize(child, resolving)
+		if err != nil {
+			return nil, err
+		}
+		if assertion.Policy == nil {
+			assertion.Policy = &Policy{Alternatives: []Alternative{{}}}
+		}
+		assertion.Policy.Alternatives = merge(assertion.Policy.Alternatives, nested)
+	}
+
+	if optional {
+		return []Alternative{{assertion}, {}}, nil
+	}
+	return []Alternative{{assertion}}, nil
+}
+
+// reference returns the alternatives of the policy referenced by the URI.
+func (d *Document) reference(uri string, resolving []*element) ([]Alternative, error) {
+	referenced, ok := d.policies[uri]
+	if !ok {
+		return nil, &ReferenceError{URI: uri}
+	}
+	for _, policy := range resolving {
+		if policy == referenced {
+			return nil, ErrCircularReference
+		}
+	}
+	return d.normalize(referenced, append(resolving, referenced))
+}
+
+// merge returns the cross product of the alternatives: every combination of one alternative of each, whose
+// assertions must all be satisfied.
+func merge(a []Alternative, b []Alternative) []Alternative {
+	merged := make([]Alternative, 0, len(a)*len(b))
+	for _, x := range a {
+		for _, y := range b {
+			alternative := make(Alternative, 0, len(x)+len(y))
+			merged = append(merged, append(append(alternative, x...), y...))
+		}
+	}
+	return merged
+}
+
+// child returns the first WSDL child element of elem with the local name and, if name isn't empty, name attribute,
+// or nil if there is none or elem is nil.
+func (e *element) child(local string, name string) *element {
+	if e == nil {
+		return nil
+	}
+	for _, child := range e.Children {
+		if child.XMLName.Space == wsdlNamespace && child.XMLName.Local == local && (name == "" || child.attr("name") == name) {
+			return child
+		}
+	}
+	return nil
+}
+
+// attr returns the value of the unqualified attribute of the element with the local name.
+func (e *element) attr(local string) string {
+	for _, attr := range e.Attrs {
+		if attr.Name.Space == "" && attr.Name.Local == local {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// isPolicyElement checks whether elem is the WS-Policy element with the local name.
+func isPolicyElement(elem *element, local string) bool {
+	return elem.XMLName.Local == local && isPolicyNamespace(elem.XMLName.Space)
+}
+
+// isPolicyNamespace checks whether the namespace is one of the supported versions of WS-Policy.
+func isPolicyNamespace(space string) bool {
+	return space == Namespace || space == SubmissionNamespace
+}
+
+// localName returns the local part of a QName, such as the binding of a port. WSDL elements are matched by local
+// name, as in the wsdl package.
+func localName(qname string) string {
+	if idx := strings.Index(qname, ":"); idx >= 0 {
+		return qname[idx+1:]
+	}
+	return qname
+}
+
+// isTrue checks whether the xs:boolean value is true.
+func isTrue(value string) bool {
+	value = strings.TrimSpace(value)
+	return value == "true" || value == "1"
+}
@@ -0,0 +1,133 @@
+package policy
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// names returns the names of the assertions of each alternative of the policy.
+func names(policy *Policy) [][]string {
+	var alternatives [][]string
+	for _, alternative := range policy.Alternatives {
+		assertions := []string{}
+		for _, assertion := range alternative {
+			assertions = append(assertions, assertion.Name.Local)
+		}
+		alternatives = append(alternatives, assertions)
+	}
+	return alternatives
+}
+
+func TestEndpointPolicy(t *testing.T) {
+	doc, err := ParseFile("testdata/secured.wsdl")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	policy, err := doc.EndpointPolicy("QuoteService", "QuotePort")
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"TransportBinding", "UsernameToken"}, {"AsymmetricBinding"}}, names(policy))
+
+	transport := policy.Alternatives[0].Assertion(TransportBindingAssertion)
+	if assert.NotNil(t, transport) && assert.NotNil(t, transport.Policy) {
+		assert.Equal(t, [][]string{{"IncludeTimestamp"}}, names(transport.Policy))
+	}
+	token := policy.Alternatives[0].Assertion(UsernameTokenAssertion)
+	if assert.NotNil(t, token) {
+		assert.Equal(t, "http://docs.oasis-open.org/ws-sx/ws-securitypolicy/200702/IncludeToken/AlwaysToRecipient", token.Attr(xml.Name{Space: SecurityPolicyNamespace, Local: "IncludeToken"}))
+		assert.Nil(t, token.Policy)
+	}
+	assert.Nil(t, policy.Alternatives[1].Assertion(UsernameTokenAssertion))
+
+	_, err = doc.EndpointPolicy("QuoteService", "OtherPort")
+	assert.Equal(t, ErrNoSubject, err)
+}
+
+func TestOperationPolicy(t *testing.T) {
+	doc, err := ParseFile("testdata/secured.wsdl")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	var tests = []struct {
+		operation string
+		names     [][]string
+		err       error
+	}{
+		{operation: "GetQuote", names: [][]string{{"SignedParts"}}},
+		{operation: "Loop", err: ErrCircularReference},
+		{operation: "External", err: &ReferenceError{URI: "http://example.com/policies/external"}},
+		{operation: "Missing", err: ErrNoSubject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.operation, func(t *testing.T) {
+			policy, err := doc.OperationPolicy("QuoteBinding", tt.operation)
+			assert.Equal(t, tt.err, err)
+			if err == nil {
+				assert.Equal(t, tt.names, names(policy))
+				assert.True(t, policy.Alternatives[0][0].Ignorable)
+			}
+		})
+	}
+}
+
+func TestMessagePolicy(t *testing.T) {
+	doc, err := ParseFile("testdata/secured.wsdl")
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	// The optional assertion makes for an alternative with it, and one without.
+	input, err := doc.MessagePolicy("QuoteBinding", "GetQuote", Input)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"Addressing"}, {}}, names(input))
+	assert.NotNil(t, input.Alternatives[0].Assertion(AddressingAssertion))
+	assert.Empty(t, input.Alternatives[0][0].Attrs)
+
+	output, err := doc.MessagePolicy("QuoteBinding", "GetQuote", Output)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{}}, names(output))
+}
+
+func TestNormalize(t *testing.T) {
+	var tests = []struct {
+		name   string
+		policy string
+		names  [][]string
+	}{
+		{name: "empty", policy: `<wsp:Policy/>`, names: [][]string{{}}},
+		{name: "all", policy: `<wsp:Policy><a:A/><a:B/></wsp:Policy>`, names: [][]string{{"A", "B"}}},
+		{name: "exactly one", policy: `<wsp:Policy><wsp:ExactlyOne><a:A/><a:B/></wsp:ExactlyOne></wsp:Policy>`, names: [][]string{{"A"}, {"B"}}},
+		{name: "empty exactly one", policy: `<wsp:Policy><wsp:ExactlyOne/></wsp:Policy>`, names: nil},
+		{
+			name:   "cross product",
+			policy: `<wsp:Policy><wsp:ExactlyOne><a:A/><a:B/></wsp:ExactlyOne><wsp:ExactlyOne><a:C/><a:D/></wsp:ExactlyOne></wsp:Policy>`,
+			names:  [][]string{{"A", "C"}, {"A", "D"}, {"B", "C"}, {"B", "D"}},
+		},
+		{name: "optional", policy: `<wsp:Policy><a:A wsp:Optional="1"/><a:B/></wsp:Policy>`, names: [][]string{{"A", "B"}, {"B"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wsdl := `<definitions xmlns="http://schemas.xmlsoap.org/wsdl/" xmlns:wsp="http://schemas.xmlsoap.org/ws/2004/09/policy" xmlns:a="urn:a">` +
+				`<binding name="B"><operation name="O">` + tt.policy + `</operation></binding></definitions>`
+			doc, err := Parse(strings.NewReader(wsdl))
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			policy, err := doc.OperationPolicy("B", "O")
+			assert.Nil(t, err)
+			assert.Equal(t, tt.names, names(policy))
+		})
+	}
+}
+
+func TestParseNotWSDL(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<schema xmlns="http://www.w3.org/2001/XMLSchema"/>`))
+	assert.Equal(t, ErrNotWSDL, err)
+}
@@ -0,0 +1,126 @@
+package wsdl
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// QName is a namespace qualified name, such as the value of a 'type' or 'element' attribute.
+type QName struct {
+	Space string
+	Local string
+}
+
+// String returns the QName in {namespace}local form.
+func (q QName) String() string {
+	if q.Space == "" {
+		return q.Local
+	}
+	return "{" + q.Space + "}" + q.Local
+}
+
+// IsZero checks whether the QName has been set.
+func (q QName) IsZero() bool {
+	return q.Local == ""
+}
+
+// ParseQName parses a name in the {namespace}local form produced by QName.String.
+func ParseQName(s string) QName {
+	if strings.HasPrefix(s, "{") {
+		if idx := strings.Index(s, "}"); idx > 0 {
+			return QName{Space: s[1:idx], Local: s[idx+1:]}
+		}
+	}
+	return QName{Local: s}
+}
+
+// UnmarshalXMLAttr satisfies the xml.UnmarshalerAttr interface.
+// By the time the attribute reaches us its prefix has already been resolved by the qnameResolver.
+func (q *QName) UnmarshalXMLAttr(attr xml.Attr) error {
+	*q = ParseQName(attr.Value)
+	return nil
+}
+
+// qnameAttrs are the unqualified attributes whose values are QNames in WSDL and XML schema documents.
+var qnameAttrs = map[string]bool{
+	"base":              true,
+	"binding":           true,
+	"element":           true,
+	"itemType":          true,
+	"message":           true,
+	"ref":               true,
+	"substitutionGroup": true,
+	"type":              true,
+}
+
+// qnameResolver is a token reader which rewrites the prefixed values of QName attributes (i.e. type="tns:Foo")
+// into the {namespace}local form, using the namespace declarations in scope at that point of the document.
+// Without this the prefix information is lost once encoding/xml decodes the document into structs.
+type qnameResolver struct {
+	d      *xml.Decoder
+	scopes []map[string]string
+}
+
+func newQNameResolver(d *xml.Decoder) *qnameResolver {
+	return &qnameResolver{
+		d: d,
+	}
+}
+
+// Token satisfies the xml.TokenReader interface.
+func (r *qnameResolver) Token() (xml.Token, error) {
+	token, err := r.d.Token()
+	if err != nil {
+		return token, err
+	}
+
+	switch elem := token.(type) {
+	case xml.StartElement:
+		scope := map[string]string{}
+		for _, attr := range elem.Attr {
+			if attr.Name.Space == "xmlns" {
+				scope[attr.Name.Local] = attr.Value
+			} else if attr.Name.Space == "" && attr.Name.Local == "xmlns" {
+				scope[""] = attr.Value
+			}
+		}
+		r.scopes = append(r.scopes, scope)
+
+		attrs := make([]xml.Attr, len(elem.Attr))
+		for i, attr := range elem.Attr {
+			if attr.Name.Space == "" && qnameAttrs[attr.Name.Local] {
+				attr.Value = r.resolve(attr.Value).String()
+			}
+			attrs[i] = attr
+		}
+		elem.Attr = attrs
+		return elem, nil
+	case xml.EndElement:
+		if len(r.scopes) > 0 {
+			r.scopes = r.scopes[:len(r.scopes)-1]
+		}
+	}
+
+	return token, nil
+}
+
+// resolve converts a prefix:local value into a QName using the innermost matching namespace declaration.
+func (r *qnameResolver) resolve(value string) QName {
+	value = strings.TrimSpace(value)
+
+	prefix, local := "", value
+	if idx := strings.Index(value, ":"); idx >= 0 {
+		prefix, local = value[:idx], value[idx+1:]
+	}
+
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if ns, ok := r.scopes[i][prefix]; ok {
+			return QName{Space: ns, Local: local}
+		}
+	}
+
+	if prefix == "xml" {
+		return QName{Space: "http://www.w3.org/XML/1998/namespace", Local: local}
+	}
+	return QName{Local: local}
+}
@@ -0,0 +1,603 @@
+package wsdl
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Implements validation of instance documents against the schemas declared in a WSDL document.
+// This supports the subset of XML schema modeled by this package; identity constraints, substitution groups,
+// and most facets are not checked.
+
+const xsiNamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+// ValidationError is returned if an instance document does not conform to the schema.
+type ValidationError struct {
+	// Path is the slash separated path to the offending element.
+	Path string
+	// Msg describes the problem.
+	Msg string
+}
+
+// Error satisfies the Error() interface allowing us to return a validation failure as an error.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("wsdl: invalid document at %s: %s", e.Path, e.Msg)
+}
+
+// node is an element of a parsed instance document.
+type node struct {
+	name     QName
+	attrs    []xml.Attr
+	children []*node
+	text     string
+}
+
+func parseNodes(data []byte) (*node, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+
+	var root *node
+	var stack []*node
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			n := &node{
+				name:  QName{Space: elem.Name.Space, Local: elem.Name.Local},
+				attrs: elem.Attr,
+			}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else {
+				root = n
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(elem)
+			}
+		}
+	}
+
+	if root == nil {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return root, nil
+}
+
+// Validate checks that the XML document in data is a valid instance of the global element declaration with the same
+// name as its root element. A *ValidationError is returned if it is not.
+func (d *Definitions) Validate(data []byte) error {
+	root, err := parseNodes(data)
+	if err != nil {
+		return err
+	}
+
+	decl := d.Element(root.name)
+	if decl == nil {
+		return &ValidationError{Path: "/" + root.name.Local, Msg: "no global element declaration for " + root.name.String()}
+	}
+
+	return d.validateElement(root, decl, "/"+root.name.Local)
+}
+
+func (d *Definitions) validateElement(n *node, decl *Element, path string) error {
+	if !decl.Ref.IsZero() {
+		ref := d.Element(decl.Ref)
+		if ref == nil {
+			return &ValidationError{Path: path, Msg: "reference to undeclared element " + decl.Ref.String()}
+		}
+		decl = ref
+	}
+
+	if decl.Nillable {
+		for _, attr := range n.attrs {
+			if attr.Name.Space == xsiNamespace && attr.Name.Local == "nil" && attr.Value == "true" {
+				return nil
+			}
+		}
+	}
+
+	switch {
+	case decl.ComplexType != nil:
+		return d.validateComplex(n, decl.ComplexType, path)
+	case decl.SimpleType != nil:
+		return d.validateSimpleElement(n, path, func(value string) error {
+			return d.validateSimpleType(value, decl.SimpleType)
+		})
+	case decl.Type.IsZero():
+		// An element without a type is xsd:anyType, and anything goes.
+		return nil
+	}
+
+	return d.validateTyped(n, decl.Type, path)
+}
+
+// validateTyped validates the element n against the named type.
+func (d *Definitions) validateTyped(n *node, typeName QName, path string) error {
+	if IsBuiltin(typeName) {
+		if typeName.Local == "anyType" {
+			return nil
+		}
+		return d.validateSimpleElement(n, path, func(value string) error {
+			return validateBuiltin(value, typeName.Local)
+		})
+	}
+
+	if ct := d.ComplexType(typeName); ct != nil {
+		return d.validateComplex(n, ct, path)
+	}
+	if st := d.SimpleType(typeName); st != nil {
+		return d.validateSimpleElement(n, path, func(value string) error {
+			return d.validateSimpleType(value, st)
+		})
+	}
+
+	return &ValidationError{Path: path, Msg: "reference to undeclared type " + typeName.String()}
+}
+
+func (d *Definitions) validateSimpleElement(n *node, path string, validate func(string) error) error {
+	if len(n.children) > 0 {
+		return &ValidationError{Path: path, Msg: "unexpected element " + n.children[0].name.String() + " in simple content"}
+	}
+	if err := validate(n.text); err != nil {
+		return &ValidationError{Path: path, Msg: err.Error()}
+	}
+	return nil
+}
+
+// complexContent collects the groups and attributes making up the content of the complex type, including those
+// inherited from its base types. Simple content types report the type of their content instead.
+func (d *Definitions) complexContent(ct *ComplexType, depth int) (groups []*Group, attrs []*Attribute, simpleBase QName, err error) {
+	if depth > 32 {
+		return nil, nil, QName{}, fmt.Errorf("type derivation too deep")
+	}
+
+	attrs = append(attrs, ct.Attributes...)
+
+	derivation := ct.Derivation()
+	if derivation == nil {
+		if group := ct.Group(); group != nil {
+			groups = append(groups, group)
+		}
+		return groups, attrs, QName{}, nil
+	}
+
+	attrs = append(attrs, derivation.Attributes...)
+
+	if ct.SimpleContent != nil {
+		base := derivation.Base
+		if baseCT := d.ComplexType(base); baseCT != nil {
+			_, baseAttrs, baseSimple, err := d.complexContent(baseCT, depth+1)
+			if err != nil {
+				return nil, nil, QName{}, err
+			}
+			attrs = append(attrs, baseAttrs...)
+			base = baseSimple
+		}
+		return nil, attrs, base, nil
+	}
+
+	// Restrictions restate the content they keep, whereas extensions append to the content of the base type.
+	if ct.ComplexContent.Extension != nil {
+		if baseCT := d.ComplexType(derivation.Base); baseCT != nil {
+			baseGroups, baseAttrs, _, err := d.complexContent(baseCT, depth+1)
+			if err != nil {
+				return nil, nil, QName{}, err
+			}
+			groups = append(groups, baseGroups...)
+			attrs = append(attrs, baseAttrs...)
+		} else if !IsBuiltin(derivation.Base) {
+			return nil, nil, QName{}, fmt.Errorf("reference to undeclared type %s", derivation.Base.String())
+		}
+	}
+
+	if group := derivation.Group(); group != nil {
+		groups = append(groups, group)
+	}
+	return groups, attrs, QName{}, nil
+}
+
+func (d *Definitions) validateComplex(n *node, ct *ComplexType, path string) error {
+	groups, attrs, simpleBase, err := d.complexContent(ct, 0)
+	if err != nil {
+		return &ValidationError{Path: path, Msg: err.Error()}
+	}
+
+	if err := d.validateAttributes(n, attrs, path); err != nil {
+		return err
+	}
+
+	if !simpleBase.IsZero() {
+		if len(n.children) > 0 {
+			return &ValidationError{Path: path, Msg: "unexpected element " + n.children[0].name.String() + " in simple content"}
+		}
+		if IsBuiltin(simpleBase) {
+			err = validateBuiltin(n.text, simpleBase.Local)
+		} else if st := d.SimpleType(simpleBase); st != nil {
+			err = d.validateSimpleType(n.text, st)
+		}
+		if err != nil {
+			return &ValidationError{Path: path, Msg: err.Error()}
+		}
+		return nil
+	}
+
+	if !ct.Mixed && strings.TrimSpace(n.text) != "" {
+		return &ValidationError{Path: path, Msg: "unexpected character data in element only content"}
+	}
+
+	pos := 0
+	for _, group := range groups {
+		if pos, err = d.matchGroup(group, n.children, pos, path); err != nil {
+			return err
+		}
+	}
+
+	if pos < len(n.children) {
+		return &ValidationError{Path: path, Msg: "unexpected element " + n.children[pos].name.String()}
+	}
+	return nil
+}
+
+func (d *Definitions) validateAttributes(n *node, decls []*Attribute, path string) error {
+	declared := map[string]*Attribute{}
+	for _, decl := range decls {
+		name := decl.Name
+		if !decl.Ref.IsZero() {
+			name = decl.Ref.Local
+		}
+		declared[name] = decl
+
+		if decl.Use != "required" {
+			continue
+		}
+
+		found := false
+		for _, attr := range n.attrs {
+			if attr.Name.Local == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &ValidationError{Path: path, Msg: "missing required attribute " + name}
+		}
+	}
+
+	for _, attr := range n.attrs {
+		if attr.Name.Space == "xmlns" || (attr.Name.Space == "" && attr.Name.Local == "xmlns") || attr.Name.Space == xsiNamespace {
+			continue
+		}
+
+		decl, ok := declared[attr.Name.Local]
+		if !ok {
+			if attr.Name.Space != "" {
+				// Qualified attributes from other vocabularies are allowed to pass through.
+				continue
+			}
+			return &ValidationError{Path: path, Msg: "unexpected attribute " + attr.Name.Local}
+		}
+
+		var err error
+		if decl.SimpleType != nil {
+			err = d.validateSimpleType(attr.Value, decl.SimpleType)
+		} else if IsBuiltin(decl.Type) {
+			err = validateBuiltin(attr.Value, decl.Type.Local)
+		} else if st := d.SimpleType(decl.Type); st != nil {
+			err = d.validateSimpleType(attr.Value, st)
+		}
+		if err != nil {
+			return &ValidationError{Path: path + "/@" + attr.Name.Local, Msg: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// matchGroup matches the children of an element, starting at pos, against the model group.
+// It returns the position of the first child not consumed by the group.
+func (d *Definitions) matchGroup(group *Group, children []*node, pos int, path string) (int, error) {
+	max := group.Max()
+
+	count := 0
+	for max < 0 || count < max {
+		next, matched, err := d.matchGroupOnce(group, children, pos, path)
+		if err != nil {
+			if count >= group.Min() {
+				break
+			}
+			return pos, err
+		}
+		if !matched || next == pos {
+			break
+		}
+		pos = next
+		count++
+	}
+
+	if count < group.Min() && !d.groupEmptiable(group) {
+		return pos, &ValidationError{Path: path, Msg: "missing content: " + d.describeGroup(group)}
+	}
+	return pos, nil
+}
+
+// matchGroupOnce matches a single occurrence of the group. The matched return value is false if the group did not
+// consume anything and isn't required to.
+func (d *Definitions) matchGroupOnce(group *Group, children []*node, pos int, path string) (int, bool, error) {
+	start := pos
+
+	switch group.Kind {
+	case "choice":
+		for _, particle := range group.Particles {
+			next, err := d.matchParticle(particle, children, pos, path)
+			if err == nil && next > pos {
+				return next, true, nil
+			}
+		}
+		for _, particle := range group.Particles {
+			if d.particleEmptiable(particle) {
+				return pos, false, nil
+			}
+		}
+		if len(group.Particles) == 0 {
+			return pos, false, nil
+		}
+		found := "end of content"
+		if pos < len(children) {
+			found = children[pos].name.String()
+		}
+		return pos, false, &ValidationError{Path: path, Msg: "expected one of " + d.describeGroup(group) + ", found " + found}
+	case "all":
+		seen := map[*Particle]bool{}
+		for pos < len(children) {
+			matched := false
+			for _, particle := range group.Particles {
+				if seen[particle] || particle.Element == nil || !d.elementMatches(particle.Element, children[pos]) {
+					continue
+				}
+				if err := d.validateElement(children[pos], particle.Element, path+"/"+children[pos].name.Local); err != nil {
+					return pos, false, err
+				}
+				seen[particle] = true
+				matched = true
+				pos++
+				break
+			}
+			if !matched {
+				break
+			}
+		}
+		for _, particle := range group.Particles {
+			if !seen[particle] && !d.particleEmptiable(particle) {
+				return pos, false, &ValidationError{Path: path, Msg: "missing element " + particle.Element.QName().String()}
+			}
+		}
+		return pos, pos > start, nil
+	}
+
+	for _, particle := range group.Particles {
+		next, err := d.matchParticle(particle, children, pos, path)
+		if err != nil {
+			return start, false, err
+		}
+		pos = next
+	}
+	return pos, pos > start, nil
+}
+
+func (d *Definitions) matchParticle(particle *Particle, children []*node, pos int, path string) (int, error) {
+	switch {
+	case particle.Group != nil:
+		return d.matchGroup(particle.Group, children, pos, path)
+	case particle.Any != nil:
+		min := parseOccurs(particle.Any.MinOccurs, 1)
+		max := parseOccurs(particle.Any.MaxOccurs, 1)
+		if particle.Any.MaxOccurs == "unbounded" {
+			max = -1
+		}
+
+		count := 0
+		for pos < len(children) && (max < 0 || count < max) {
+			pos++
+			count++
+		}
+		if count < min {
+			return pos, &ValidationError{Path: path, Msg: "missing wildcard content"}
+		}
+		return pos, nil
+	}
+
+	elem := particle.Element
+	max := elem.Max()
+
+	count := 0
+	for pos < len(children) && (max < 0 || count < max) && d.elementMatches(elem, children[pos]) {
+		if err := d.validateElement(children[pos], elem, path+"/"+children[pos].name.Local); err != nil {
+			return pos, err
+		}
+		pos++
+		count++
+	}
+
+	if count < elem.Min() {
+		found := "end of content"
+		if pos < len(children) {
+			found = children[pos].name.String()
+		}
+		return pos, &ValidationError{Path: path, Msg: "expected element " + elem.QName().String() + ", found " + found}
+	}
+	return pos, nil
+}
+
+func (d *Definitions) elementMatches(decl *Element, n *node) bool {
+	return decl.QName() == n.name
+}
+
+func (d *Definitions) particleEmptiable(particle *Particle) bool {
+	switch {
+	case particle.Element != nil:
+		return particle.Element.Min() == 0
+	case particle.Any != nil:
+		return parseOccurs(particle.Any.MinOccurs, 1) == 0
+	case particle.Group != nil:
+		return particle.Group.Min() == 0 || d.groupEmptiable(particle.Group)
+	}
+	return true
+}
+
+// groupEmptiable checks whether a single occurrence of the group may match no content.
+func (d *Definitions) groupEmptiable(group *Group) bool {
+	if group.Kind == "choice" {
+		for _, particle := range group.Particles {
+			if d.particleEmptiable(particle) {
+				return true
+			}
+		}
+		return len(group.Particles) == 0
+	}
+
+	for _, particle := range group.Particles {
+		if !d.particleEmptiable(particle) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *Definitions) describeGroup(group *Group) string {
+	var names []string
+	for _, elem := range group.Elements() {
+		names = append(names, elem.QName().String())
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
+
+func (d *Definitions) validateSimpleType(value string, st *SimpleType) error {
+	return d.validateSimpleTypeDepth(value, st, 0)
+}
+
+func (d *Definitions) validateSimpleTypeDepth(value string, st *SimpleType, depth int) error {
+	if depth > 32 {
+		return fmt.Errorf("type derivation too deep")
+	}
+
+	switch {
+	case st.Restriction != nil:
+		if len(st.Restriction.Enumerations) > 0 {
+			valid := false
+			for _, enum := range st.Restriction.Enumerations {
+				if enum.Value == strings.TrimSpace(value) {
+					valid = true
+					break
+				}
+			}
+			if !valid {
+				return fmt.Errorf("value %q is not one of the enumerated values", value)
+			}
+		}
+
+		base := st.Restriction.Base
+		if IsBuiltin(base) {
+			return validateBuiltin(value, base.Local)
+		} else if baseST := d.SimpleType(base); baseST != nil {
+			return d.validateSimpleTypeDepth(value, baseST, depth+1)
+		}
+	case st.List != nil:
+		for _, item := range strings.Fields(value) {
+			if IsBuiltin(st.List.ItemType) {
+				if err := validateBuiltin(item, st.List.ItemType.Local); err != nil {
+					return err
+				}
+			} else if itemST := d.SimpleType(st.List.ItemType); itemST != nil {
+				if err := d.validateSimpleTypeDepth(item, itemST, depth+1); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// integerRanges are the bounds of the built-in integer types.
+var integerRanges = map[string][2]float64{
+	"byte":          {math.MinInt8, math.MaxInt8},
+	"short":         {math.MinInt16, math.MaxInt16},
+	"int":           {math.MinInt32, math.MaxInt32},
+	"long":          {math.MinInt64, math.MaxInt64},
+	"unsignedByte":  {0, math.MaxUint8},
+	"unsignedShort": {0, math.MaxUint16},
+	"unsignedInt":   {0, math.MaxUint32},
+	"unsignedLong":  {0, math.MaxUint64},
+}
+
+// dateTimeLayouts are the accepted lexical forms of the built-in date and time types.
+var dateTimeLayouts = map[string][]string{
+	"dateTime": {"2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04:05", "2006-01-02T15:04:05.999999999"},
+	"date":     {"2006-01-02", "2006-01-02Z07:00"},
+	"time":     {"15:04:05", "15:04:05Z07:00", "15:04:05.999999999", "15:04:05.999999999Z07:00"},
+}
+
+// validateBuiltin checks the lexical form of the value against the built-in XML schema type.
+// Types which aren't explicitly handled accept any value.
+func validateBuiltin(value string, typeName string) error {
+	value = strings.TrimSpace(value)
+
+	if bounds, ok := integerRanges[typeName]; ok {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed != math.Trunc(parsed) || parsed < bounds[0] || parsed > bounds[1] {
+			return fmt.Errorf("value %q is not a valid %s", value, typeName)
+		}
+		return nil
+	}
+
+	if layouts, ok := dateTimeLayouts[typeName]; ok {
+		for _, layout := range layouts {
+			if _, err := time.Parse(layout, value); err == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("value %q is not a valid %s", value, typeName)
+	}
+
+	var err error
+	switch typeName {
+	case "boolean":
+		if value != "true" && value != "false" && value != "1" && value != "0" {
+			err = fmt.Errorf("value %q is not a valid boolean", value)
+		}
+	case "integer", "nonNegativeInteger", "positiveInteger", "nonPositiveInteger", "negativeInteger":
+		if _, perr := strconv.ParseInt(value, 10, 64); perr != nil {
+			err = fmt.Errorf("value %q is not a valid %s", value, typeName)
+		}
+	case "decimal", "float", "double":
+		if value == "INF" || value == "-INF" || value == "NaN" {
+			break
+		}
+		if _, perr := strconv.ParseFloat(value, 64); perr != nil {
+			err = fmt.Errorf("value %q is not a valid %s", value, typeName)
+		}
+	case "base64Binary":
+		if _, perr := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(value), "")); perr != nil {
+			err = fmt.Errorf("value is not valid base64Binary")
+		}
+	}
+
+	return err
+}
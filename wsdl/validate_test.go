@@ -0,0 +1,103 @@
+package wsdl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type validateTest struct {
+	name string
+	doc  string
+	err  string
+}
+
+var validateTests = []validateTest{
+	{
+		name: "valid request",
+		doc:  `<GetQuote xmlns="http://example.com/quotes"><Symbol>TN</Symbol><Symbol>GOOG</Symbol><Exchange>NYSE</Exchange><Summary>true</Summary></GetQuote>`,
+	},
+	{
+		name: "valid request without optional elements",
+		doc:  `<GetQuote xmlns="http://example.com/quotes"><Symbol>TN</Symbol><Detailed>1</Detailed></GetQuote>`,
+	},
+	{
+		name: "valid response with extension",
+		doc:  `<GetQuoteResponse xmlns="http://example.com/quotes"><Quote currency="USD"><Symbol>TN</Symbol><Price>1.5</Price><Traded>2019-08-19T10:20:59Z</Traded><Volume>100</Volume></Quote></GetQuoteResponse>`,
+	},
+	{
+		name: "valid empty response",
+		doc:  `<GetQuoteResponse xmlns="http://example.com/quotes"/>`,
+	},
+	{
+		name: "unknown root element",
+		doc:  `<GetPrice xmlns="http://example.com/quotes"/>`,
+		err:  "wsdl: invalid document at /GetPrice: no global element declaration for {http://example.com/quotes}GetPrice",
+	},
+	{
+		name: "missing required element",
+		doc:  `<GetQuote xmlns="http://example.com/quotes"><Exchange>NYSE</Exchange><Summary>true</Summary></GetQuote>`,
+		err:  "wsdl: invalid document at /GetQuote: expected element {http://example.com/quotes}Symbol, found {http://example.com/quotes}Exchange",
+	},
+	{
+		name: "invalid enumeration",
+		doc:  `<GetQuote xmlns="http://example.com/quotes"><Symbol>TN</Symbol><Exchange>LSE</Exchange><Summary>true</Summary></GetQuote>`,
+		err:  `wsdl: invalid document at /GetQuote/Exchange: value "LSE" is not one of the enumerated values`,
+	},
+	{
+		name: "missing choice",
+		doc:  `<GetQuote xmlns="http://example.com/quotes"><Symbol>TN</Symbol></GetQuote>`,
+		err:  "wsdl: invalid document at /GetQuote: expected one of [{http://example.com/quotes}Detailed, {http://example.com/quotes}Summary], found end of content",
+	},
+	{
+		name: "unexpected element",
+		doc:  `<GetQuote xmlns="http://example.com/quotes"><Symbol>TN</Symbol><Summary>true</Summary><Extra/></GetQuote>`,
+		err:  "wsdl: invalid document at /GetQuote: unexpected element {http://example.com/quotes}Extra",
+	},
+	{
+		name: "unqualified element",
+		doc:  `<GetQuote xmlns="http://example.com/quotes"><Symbol xmlns="">TN</Symbol><Summary>true</Summary></GetQuote>`,
+		err:  "wsdl: invalid document at /GetQuote: expected element {http://example.com/quotes}Symbol, found Symbol",
+	},
+	{
+		name: "invalid builtin value",
+		doc:  `<GetQuoteResponse xmlns="http://example.com/quotes"><Quote currency="USD"><Symbol>TN</Symbol><Price>cheap</Price><Volume>100</Volume></Quote></GetQuoteResponse>`,
+		err:  `wsdl: invalid document at /GetQuoteResponse/Quote/Price: value "cheap" is not a valid decimal`,
+	},
+	{
+		name: "missing extension element",
+		doc:  `<GetQuoteResponse xmlns="http://example.com/quotes"><Quote currency="USD"><Symbol>TN</Symbol><Price>1</Price></Quote></GetQuoteResponse>`,
+		err:  "wsdl: invalid document at /GetQuoteResponse/Quote: expected element {http://example.com/quotes}Volume, found end of content",
+	},
+	{
+		name: "missing required attribute",
+		doc:  `<GetQuoteResponse xmlns="http://example.com/quotes"><Quote><Symbol>TN</Symbol><Price>1</Price><Volume>100</Volume></Quote></GetQuoteResponse>`,
+		err:  "wsdl: invalid document at /GetQuoteResponse/Quote: missing required attribute currency",
+	},
+	{
+		name: "unexpected attribute",
+		doc:  `<GetQuoteResponse xmlns="http://example.com/quotes"><Quote currency="USD" exchange="NYSE"><Symbol>TN</Symbol><Price>1</Price><Volume>100</Volume></Quote></GetQuoteResponse>`,
+		err:  "wsdl: invalid document at /GetQuoteResponse/Quote: unexpected attribute exchange",
+	},
+	{
+		name: "integer out of range",
+		doc:  `<GetQuoteResponse xmlns="http://example.com/quotes"><Quote currency="USD"><Symbol>TN</Symbol><Price>1</Price><Volume>1.5</Volume></Quote></GetQuoteResponse>`,
+		err:  `wsdl: invalid document at /GetQuoteResponse/Quote/Volume: value "1.5" is not a valid long`,
+	},
+}
+
+func TestValidate(t *testing.T) {
+	defs, err := ParseFile("testdata/quotes.wsdl")
+	assert.Nil(t, err)
+
+	for _, tt := range validateTests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := defs.Validate([]byte(tt.doc))
+			if tt.err == "" {
+				assert.Nil(t, err)
+			} else if assert.NotNil(t, err) {
+				assert.Equal(t, tt.err, err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Package wsdl parses WSDL 1.1 documents, along with the XML schema types embedded in them.
+
+The model mirrors the structure of the document: messages, port types, bindings and services, plus the schemas
+declared in the types section. All QName valued attributes (i.e. element="tns:Foo") are resolved against the
+namespace declarations in scope, so callers never need to deal with the prefixes used by a particular document.
+*/
+package wsdl
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"os"
+)
+
+const (
+	// Namespace is the WSDL 1.1 namespace.
+	Namespace = "http://schemas.xmlsoap.org/wsdl/"
+	// SOAPNamespace is the namespace of the WSDL 1.1 SOAP 1.1 binding extensions.
+	SOAPNamespace = "http://schemas.xmlsoap.org/wsdl/soap/"
+	// SOAP12Namespace is the namespace of the WSDL 1.1 SOAP 1.2 binding extensions.
+	SOAP12Namespace = "http://schemas.xmlsoap.org/wsdl/soap12/"
+)
+
+var (
+	// ErrNotWSDL is returned if the document parsed is not a WSDL 1.1 definitions document.
+	ErrNotWSDL = errors.New("document is not a WSDL 1.1 definitions document")
+)
+
+// Definitions is the root of a WSDL document.
+type Definitions struct {
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/wsdl/ definitions"`
+
+	Name            string `xml:"name,attr"`
+	TargetNamespace string `xml:"targetNamespace,attr"`
+
+	Types     Types       `xml:"http://schemas.xmlsoap.org/wsdl/ types"`
+	Messages  []*Message  `xml:"http://schemas.xmlsoap.org/wsdl/ message"`
+	PortTypes []*PortType `xml:"http://schemas.xmlsoap.org/wsdl/ portType"`
+	Bindings  []*Binding  `xml:"http://schemas.xmlsoap.org/wsdl/ binding"`
+	Services  []*Service  `xml:"http://schemas.xmlsoap.org/wsdl/ service"`
+}
+
+// Types contains the schemas declared in the WSDL document.
+type Types struct {
+	Schemas []*Schema `xml:"http://www.w3.org/2001/XMLSchema schema"`
+}
+
+// Message is an abstract message exchanged by an operation.
+type Message struct {
+	Name  string  `xml:"name,attr"`
+	Parts []*Part `xml:"http://schemas.xmlsoap.org/wsdl/ part"`
+}
+
+// Part is a single part of a message. Document style messages reference an element, while RPC style messages reference a type.
+type Part struct {
+	Name    string `xml:"name,attr"`
+	Element QName  `xml:"element,attr"`
+	Type    QName  `xml:"type,attr"`
+}
+
+// PortType is an abstract set of operations.
+type PortType struct {
+	Name       string       `xml:"name,attr"`
+	Operations []*Operation `xml:"http://schemas.xmlsoap.org/wsdl/ operation"`
+}
+
+// Operation is an abstract operation, described by the messages it exchanges.
+type Operation struct {
+	Name   string         `xml:"name,attr"`
+	Input  *OperationIO   `xml:"http://schemas.xmlsoap.org/wsdl/ input"`
+	Output *OperationIO   `xml:"http://schemas.xmlsoap.org/wsdl/ output"`
+	Faults []*OperationIO `xml:"http://schemas.xmlsoap.org/wsdl/ fault"`
+}
+
+// OperationIO references the message used as the input, output or fault of an operation.
+type OperationIO struct {
+	Name    string `xml:"name,attr"`
+	Message QName  `xml:"message,attr"`
+}
+
+// Binding describes the concrete protocol used for the operations of a port type.
+type Binding struct {
+	Name string `xml:"name,attr"`
+	Type QName  `xml:"type,attr"`
+
+	SOAPBinding   *SOAPBinding `xml:"http://schemas.xmlsoap.org/wsdl/soap/ binding"`
+	SOAP12Binding *SOAPBinding `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ binding"`
+
+	Operations []*BindingOperation `xml:"http://schemas.xmlsoap.org/wsdl/ operation"`
+}
+
+// SOAPBinding is the soap:binding extension element.
+type SOAPBinding struct {
+	Style     string `xml:"style,attr"`
+	Transport string `xml:"transport,attr"`
+}
+
+// BindingOperation describes the concrete protocol used by a single operation.
+type BindingOperation struct {
+	Name string `xml:"name,attr"`
+
+	SOAPOperation   *SOAPOperation `xml:"http://schemas.xmlsoap.org/wsdl/soap/ operation"`
+	SOAP12Operation *SOAPOperation `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ operation"`
+
+	Input  *BindingIO   `xml:"http://schemas.xmlsoap.org/wsdl/ input"`
+	Output *BindingIO   `xml:"http://schemas.xmlsoap.org/wsdl/ output"`
+	Faults []*BindingIO `xml:"http://schemas.xmlsoap.org/wsdl/ fault"`
+}
+
+// SOAPOperation is the soap:operation extension element.
+type SOAPOperation struct {
+	SOAPAction string `xml:"soapAction,attr"`
+	Style      string `xml:"style,attr"`
+}
+
+// BindingIO describes how the input, output or fault message of an operation is encoded.
+type BindingIO struct {
+	Name string `xml:"name,attr"`
+
+	SOAPBody   *SOAPBody `xml:"http://schemas.xmlsoap.org/wsdl/soap/ body"`
+	SOAP12Body *SOAPBody `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ body"`
+}
+
+// SOAPBody is the soap:body extension element.
+type SOAPBody struct {
+	Use           string `xml:"use,attr"`
+	Parts         string `xml:"parts,attr"`
+	Namespace     string `xml:"namespace,attr"`
+	EncodingStyle string `xml:"encodingStyle,attr"`
+}
+
+// Service is a collection of ports.
+type Service struct {
+	Name  string  `xml:"name,attr"`
+	Ports []*Port `xml:"http://schemas.xmlsoap.org/wsdl/ port"`
+}
+
+// Port is a single endpoint, implementing a binding at an address.
+type Port struct {
+	Name    string `xml:"name,attr"`
+	Binding QName  `xml:"binding,attr"`
+
+	SOAPAddress   *SOAPAddress `xml:"http://schemas.xmlsoap.org/wsdl/soap/ address"`
+	SOAP12Address *SOAPAddress `xml:"http://schemas.xmlsoap.org/wsdl/soap12/ address"`
+}
+
+// SOAPAddress is the soap:address extension element.
+type SOAPAddress struct {
+	Location string `xml:"location,attr"`
+}
+
+// Parse reads and parses the WSDL document from r.
+func Parse(r io.Reader) (*Definitions, error) {
+	defs := &Definitions{}
+
+	d := xml.NewTokenDecoder(newQNameResolver(xml.NewDecoder(r)))
+	if err := d.Decode(defs); err != nil {
+		if _, ok := err.(xml.UnmarshalError); ok {
+			return nil, ErrNotWSDL
+		}
+		return nil, err
+	}
+
+	for _, schema := range defs.Types.Schemas {
+		schema.link()
+	}
+
+	return defs, nil
+}
+
+// ParseFile reads and parses the WSDL document at path.
+func ParseFile(path string) (*Definitions, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Message returns the message with the specified name, or nil if it isn't declared.
+func (d *Definitions) Message(name QName) *Message {
+	for _, msg := range d.Messages {
+		if msg.Name == name.Local {
+			return msg
+		}
+	}
+	return nil
+}
+
+// PortType returns the port type with the specified name, or nil if it isn't declared.
+func (d *Definitions) PortType(name QName) *PortType {
+	for _, portType := range d.PortTypes {
+		if portType.Name == name.Local {
+			return portType
+		}
+	}
+	return nil
+}
+
+// Binding returns the binding with the specified name, or nil if it isn't declared.
+func (d *Definitions) Binding(name QName) *Binding {
+	for _, binding := range d.Bindings {
+		if binding.Name == name.Local {
+			return binding
+		}
+	}
+	return nil
+}
+
+// Operation returns the operation with the specified name, or nil if it isn't part of the port type.
+func (p *PortType) Operation(name string) *Operation {
+	for _, op := range p.Operations {
+		if op.Name == name {
+			return op
+		}
+	}
+	return nil
+}
+
+// Operation returns the binding of the operation with the specified name, or nil if it isn't part of the binding.
+func (b *Binding) Operation(name string) *BindingOperation {
+	for _, op := range b.Operations {
+		if op.Name == name {
+			return op
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package wsdl
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const quotesNS = "http://example.com/quotes"
+
+func TestParseFile(t *testing.T) {
+	defs, err := ParseFile("testdata/quotes.wsdl")
+	assert.Nil(t, err)
+
+	assert.Equal(t, "Quotes", defs.Name)
+	assert.Equal(t, "http://example.com/quotes/wsdl", defs.TargetNamespace)
+	assert.Len(t, defs.Types.Schemas, 1)
+	assert.Len(t, defs.Messages, 3)
+
+	assert.Equal(t, QName{Space: quotesNS, Local: "GetQuote"}, defs.Messages[0].Parts[0].Element)
+	assert.Equal(t, QName{Space: "http://example.com/quotes/wsdl", Local: "QuotePortType"}, defs.Bindings[0].Type)
+
+	elem := defs.Element(QName{Space: quotesNS, Local: "GetQuote"})
+	assert.NotNil(t, elem)
+	assert.Equal(t, QName{Space: quotesNS, Local: "GetQuote"}, elem.QName())
+
+	fields := elem.ComplexType.Group().Elements()
+	assert.Len(t, fields, 4)
+	assert.Equal(t, QName{Space: quotesNS, Local: "Symbol"}, fields[0].QName())
+	assert.Equal(t, QName{Space: XSDNamespace, Local: "string"}, fields[0].Type)
+	assert.True(t, fields[0].IsList())
+	assert.Equal(t, 0, fields[1].Min())
+	assert.Equal(t, QName{Space: quotesNS, Local: "Exchange"}, fields[1].Type)
+
+	assert.NotNil(t, defs.ComplexType(QName{Space: quotesNS, Local: "DetailedQuote"}).Derivation())
+	assert.NotNil(t, defs.SimpleType(QName{Space: quotesNS, Local: "Exchange"}))
+	assert.Nil(t, defs.Element(QName{Space: "urn:other", Local: "GetQuote"}))
+
+	assert.Equal(t, "http://example.com/quotes/service", defs.Services[0].Ports[0].Address())
+}
+
+func TestOperations(t *testing.T) {
+	defs, err := ParseFile("testdata/quotes.wsdl")
+	assert.Nil(t, err)
+
+	ops := defs.AllOperations()
+	assert.Len(t, ops, 1)
+	assert.Equal(t, "GetQuote", ops[0].Name)
+	assert.Equal(t, "http://example.com/quotes/GetQuote", ops[0].SOAPAction)
+	assert.Equal(t, "document", ops[0].Style)
+	assert.False(t, ops[0].SOAP12)
+	assert.Equal(t, "GetQuoteRequest", ops[0].Input.Name)
+	assert.Equal(t, "GetQuoteResponse", ops[0].Output.Name)
+	assert.Len(t, ops[0].Faults, 1)
+}
+
+func TestParseNotWSDL(t *testing.T) {
+	_, err := Parse(strings.NewReader(`<definitions xmlns="urn:other"/>`))
+	assert.Equal(t, ErrNotWSDL, err)
+
+	_, err = Parse(strings.NewReader(`<definitions`))
+	assert.NotNil(t, err)
+}
+
+func TestQName(t *testing.T) {
+	assert.Equal(t, QName{Space: quotesNS, Local: "Quote"}, ParseQName("{http://example.com/quotes}Quote"))
+	assert.Equal(t, QName{Local: "Quote"}, ParseQName("Quote"))
+	assert.Equal(t, "{http://example.com/quotes}Quote", QName{Space: quotesNS, Local: "Quote"}.String())
+	assert.Equal(t, "Quote", QName{Local: "Quote"}.String())
+}
@@ -0,0 +1,427 @@
+package wsdl
+
+import (
+	"encoding/xml"
+	"strconv"
+)
+
+// Implements the subset of XML schema used to describe message content in WSDL documents.
+
+// XSDNamespace is the XML schema namespace.
+const XSDNamespace = "http://www.w3.org/2001/XMLSchema"
+
+// Schema is an XML schema.
+type Schema struct {
+	TargetNamespace      string `xml:"targetNamespace,attr"`
+	ElementFormDefault   string `xml:"elementFormDefault,attr"`
+	AttributeFormDefault string `xml:"attributeFormDefault,attr"`
+
+	Imports      []*Import      `xml:"http://www.w3.org/2001/XMLSchema import"`
+	Elements     []*Element     `xml:"http://www.w3.org/2001/XMLSchema element"`
+	ComplexTypes []*ComplexType `xml:"http://www.w3.org/2001/XMLSchema complexType"`
+	SimpleTypes  []*SimpleType  `xml:"http://www.w3.org/2001/XMLSchema simpleType"`
+}
+
+// Import is a schema import.
+type Import struct {
+	Namespace      string `xml:"namespace,attr"`
+	SchemaLocation string `xml:"schemaLocation,attr"`
+}
+
+// Element is an element declaration, either global or local to a complex type.
+type Element struct {
+	Name      string `xml:"name,attr"`
+	Type      QName  `xml:"type,attr"`
+	Ref       QName  `xml:"ref,attr"`
+	MinOccurs string `xml:"minOccurs,attr"`
+	MaxOccurs string `xml:"maxOccurs,attr"`
+	Nillable  bool   `xml:"nillable,attr"`
+	Form      string `xml:"form,attr"`
+
+	ComplexType *ComplexType `xml:"http://www.w3.org/2001/XMLSchema complexType"`
+	SimpleType  *SimpleType  `xml:"http://www.w3.org/2001/XMLSchema simpleType"`
+
+	schema *Schema
+	global bool
+}
+
+// QName returns the name of the element as it appears in instance documents.
+// Global elements are always in the target namespace of their schema, while local elements are only
+// if they are qualified, either explicitly or through the elementFormDefault of the schema.
+// References to global elements report the name of the referenced element.
+func (e *Element) QName() QName {
+	if !e.Ref.IsZero() {
+		return e.Ref
+	}
+	if e.schema == nil {
+		return QName{Local: e.Name}
+	}
+
+	qualified := e.global || e.Form == "qualified" || (e.Form == "" && e.schema.ElementFormDefault == "qualified")
+	if !qualified {
+		return QName{Local: e.Name}
+	}
+	return QName{Space: e.schema.TargetNamespace, Local: e.Name}
+}
+
+// Min returns the minimum number of occurrences of the element; the default is 1.
+func (e *Element) Min() int {
+	return parseOccurs(e.MinOccurs, 1)
+}
+
+// Max returns the maximum number of occurrences of the element; the default is 1, and 'unbounded' is reported as -1.
+func (e *Element) Max() int {
+	if e.MaxOccurs == "unbounded" {
+		return -1
+	}
+	return parseOccurs(e.MaxOccurs, 1)
+}
+
+// IsList checks whether the element may occur more than once.
+func (e *Element) IsList() bool {
+	max := e.Max()
+	return max < 0 || max > 1
+}
+
+// ComplexType is a complex type definition, either named or anonymous.
+type ComplexType struct {
+	Name  string `xml:"name,attr"`
+	Mixed bool   `xml:"mixed,attr"`
+
+	Sequence       *Group        `xml:"http://www.w3.org/2001/XMLSchema sequence"`
+	All            *Group        `xml:"http://www.w3.org/2001/XMLSchema all"`
+	Choice         *Group        `xml:"http://www.w3.org/2001/XMLSchema choice"`
+	ComplexContent *ContentModel `xml:"http://www.w3.org/2001/XMLSchema complexContent"`
+	SimpleContent  *ContentModel `xml:"http://www.w3.org/2001/XMLSchema simpleContent"`
+	Attributes     []*Attribute  `xml:"http://www.w3.org/2001/XMLSchema attribute"`
+}
+
+// Group returns the model group making up the content of the type, or nil if it has none.
+// Content derived from a base type is not included; see ComplexContent.
+func (c *ComplexType) Group() *Group {
+	return firstGroup(c.Sequence, c.All, c.Choice)
+}
+
+// Derivation returns the extension or restriction of the complex or simple content of the type, or nil if it isn't derived.
+func (c *ComplexType) Derivation() *Derivation {
+	for _, content := range []*ContentModel{c.ComplexContent, c.SimpleContent} {
+		if content == nil {
+			continue
+		}
+		if content.Extension != nil {
+			return content.Extension
+		}
+		if content.Restriction != nil {
+			return content.Restriction
+		}
+	}
+	return nil
+}
+
+func firstGroup(groups ...*Group) *Group {
+	for _, group := range groups {
+		if group != nil {
+			return group
+		}
+	}
+	return nil
+}
+
+// Group is a model group (sequence, all, or choice) of particles.
+type Group struct {
+	// Kind is the type of the group: sequence, all, or choice.
+	Kind string
+
+	MinOccurs string
+	MaxOccurs string
+
+	// Particles contains the content of the group, in document order.
+	Particles []*Particle
+}
+
+// Particle is a single entry in a model group. Exactly one of the fields is set.
+type Particle struct {
+	Element *Element
+	Group   *Group
+	Any     *Any
+}
+
+// Min returns the minimum number of occurrences of the group; the default is 1.
+func (g *Group) Min() int {
+	return parseOccurs(g.MinOccurs, 1)
+}
+
+// Max returns the maximum number of occurrences of the group; the default is 1, and 'unbounded' is reported as -1.
+func (g *Group) Max() int {
+	if g.MaxOccurs == "unbounded" {
+		return -1
+	}
+	return parseOccurs(g.MaxOccurs, 1)
+}
+
+// Elements returns all the element declarations in the group and its nested groups, in document order.
+func (g *Group) Elements() []*Element {
+	var elems []*Element
+	for _, particle := range g.Particles {
+		if particle.Element != nil {
+			elems = append(elems, particle.Element)
+		} else if particle.Group != nil {
+			elems = append(elems, particle.Group.Elements()...)
+		}
+	}
+	return elems
+}
+
+// UnmarshalXML is an overridden deserialization routine used to decode a model group.
+// This is needed to preserve the relative order of the different kinds of particles in the group.
+func (g *Group) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	g.Kind = start.Name.Local
+	for _, attr := range start.Attr {
+		switch attr.Name.Local {
+		case "minOccurs":
+			g.MinOccurs = attr.Value
+		case "maxOccurs":
+			g.MaxOccurs = attr.Value
+		}
+	}
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			if elem.Name.Space != XSDNamespace {
+				if err := d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+
+			particle := &Particle{}
+			switch elem.Name.Local {
+			case "element":
+				particle.Element = &Element{}
+				err = d.DecodeElement(particle.Element, &elem)
+			case "sequence", "choice", "all":
+				particle.Group = &Group{}
+				err = d.DecodeElement(particle.Group, &elem)
+			case "any":
+				particle.Any = &Any{}
+				err = d.DecodeElement(particle.Any, &elem)
+			default:
+				particle = nil
+				err = d.Skip()
+			}
+			if err != nil {
+				return err
+			}
+
+			if particle != nil {
+				g.Particles = append(g.Particles, particle)
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// Any is an element wildcard.
+type Any struct {
+	Namespace       string `xml:"namespace,attr"`
+	ProcessContents string `xml:"processContents,attr"`
+	MinOccurs       string `xml:"minOccurs,attr"`
+	MaxOccurs       string `xml:"maxOccurs,attr"`
+}
+
+// ContentModel is the complexContent or simpleContent of a complex type, which derives from a base type.
+type ContentModel struct {
+	Extension   *Derivation `xml:"http://www.w3.org/2001/XMLSchema extension"`
+	Restriction *Derivation `xml:"http://www.w3.org/2001/XMLSchema restriction"`
+}
+
+// Derivation is an extension or restriction of a base type.
+type Derivation struct {
+	Base QName `xml:"base,attr"`
+
+	Sequence   *Group       `xml:"http://www.w3.org/2001/XMLSchema sequence"`
+	All        *Group       `xml:"http://www.w3.org/2001/XMLSchema all"`
+	Choice     *Group       `xml:"http://www.w3.org/2001/XMLSchema choice"`
+	Attributes []*Attribute `xml:"http://www.w3.org/2001/XMLSchema attribute"`
+}
+
+// Group returns the model group added by the derivation, or nil if it has none.
+func (d *Derivation) Group() *Group {
+	return firstGroup(d.Sequence, d.All, d.Choice)
+}
+
+// Attribute is an attribute declaration.
+type Attribute struct {
+	Name string `xml:"name,attr"`
+	Type QName  `xml:"type,attr"`
+	Ref  QName  `xml:"ref,attr"`
+	Use  string `xml:"use,attr"`
+
+	SimpleType *SimpleType `xml:"http://www.w3.org/2001/XMLSchema simpleType"`
+}
+
+// SimpleType is a simple type definition, either named or anonymous.
+type SimpleType struct {
+	Name string `xml:"name,attr"`
+
+	Restriction *Restriction `xml:"http://www.w3.org/2001/XMLSchema restriction"`
+	List        *List        `xml:"http://www.w3.org/2001/XMLSchema list"`
+	Union       *Union       `xml:"http://www.w3.org/2001/XMLSchema union"`
+}
+
+// Restriction restricts a base simple type, i.e. to a set of enumerated values.
+type Restriction struct {
+	Base QName `xml:"base,attr"`
+
+	Enumerations []*Facet `xml:"http://www.w3.org/2001/XMLSchema enumeration"`
+	Pattern      *Facet   `xml:"http://www.w3.org/2001/XMLSchema pattern"`
+	MinLength    *Facet   `xml:"http://www.w3.org/2001/XMLSchema minLength"`
+	MaxLength    *Facet   `xml:"http://www.w3.org/2001/XMLSchema maxLength"`
+}
+
+// Facet is a constraining facet of a simple type restriction.
+type Facet struct {
+	Value string `xml:"value,attr"`
+}
+
+// List is a whitespace separated list of simple values.
+type List struct {
+	ItemType QName `xml:"itemType,attr"`
+}
+
+// Union is a value which may match any of several simple types.
+type Union struct {
+	MemberTypes string `xml:"memberTypes,attr"`
+}
+
+// link records the schema each element is declared in, which is needed to determine the names of local elements.
+func (s *Schema) link() {
+	for _, elem := range s.Elements {
+		elem.global = true
+		s.linkElement(elem)
+	}
+	for _, ct := range s.ComplexTypes {
+		s.linkComplexType(ct)
+	}
+}
+
+func (s *Schema) linkElement(elem *Element) {
+	elem.schema = s
+	s.linkComplexType(elem.ComplexType)
+}
+
+func (s *Schema) linkComplexType(ct *ComplexType) {
+	if ct == nil {
+		return
+	}
+
+	s.linkGroup(ct.Sequence)
+	s.linkGroup(ct.All)
+	s.linkGroup(ct.Choice)
+	for _, content := range []*ContentModel{ct.ComplexContent, ct.SimpleContent} {
+		if content == nil {
+			continue
+		}
+		for _, derivation := range []*Derivation{content.Extension, content.Restriction} {
+			if derivation == nil {
+				continue
+			}
+			s.linkGroup(derivation.Sequence)
+			s.linkGroup(derivation.All)
+			s.linkGroup(derivation.Choice)
+		}
+	}
+}
+
+func (s *Schema) linkGroup(group *Group) {
+	if group == nil {
+		return
+	}
+
+	for _, particle := range group.Particles {
+		if particle.Element != nil {
+			s.linkElement(particle.Element)
+		} else if particle.Group != nil {
+			s.linkGroup(particle.Group)
+		}
+	}
+}
+
+func parseOccurs(value string, dflt int) int {
+	if value == "" {
+		return dflt
+	}
+
+	occurs, err := strconv.Atoi(value)
+	if err != nil {
+		return dflt
+	}
+	return occurs
+}
+
+// Schema returns the schema with the specified target namespace, or nil if none is declared.
+func (d *Definitions) Schema(namespace string) *Schema {
+	for _, schema := range d.Types.Schemas {
+		if schema.TargetNamespace == namespace {
+			return schema
+		}
+	}
+	return nil
+}
+
+// Element returns the global element declaration with the specified name, or nil if it isn't declared.
+func (d *Definitions) Element(name QName) *Element {
+	for _, schema := range d.Types.Schemas {
+		if schema.TargetNamespace != name.Space {
+			continue
+		}
+		for _, elem := range schema.Elements {
+			if elem.Name == name.Local {
+				return elem
+			}
+		}
+	}
+	return nil
+}
+
+// ComplexType returns the named complex type with the specified name, or nil if it isn't declared.
+func (d *Definitions) ComplexType(name QName) *ComplexType {
+	for _, schema := range d.Types.Schemas {
+		if schema.TargetNamespace != name.Space {
+			continue
+		}
+		for _, ct := range schema.ComplexTypes {
+			if ct.Name == name.Local {
+				return ct
+			}
+		}
+	}
+	return nil
+}
+
+// SimpleType returns the named simple type with the specified name, or nil if it isn't declared.
+func (d *Definitions) SimpleType(name QName) *SimpleType {
+	for _, schema := range d.Types.Schemas {
+		if schema.TargetNamespace != name.Space {
+			continue
+		}
+		for _, st := range schema.SimpleTypes {
+			if st.Name == name.Local {
+				return st
+			}
+		}
+	}
+	return nil
+}
+
+// IsBuiltin checks whether the name refers to one of the built-in XML schema types.
+func IsBuiltin(name QName) bool {
+	return name.Space == XSDNamespace
+}
@@ -2,6 +2,7 @@ package soap
 
 import (
 	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha1"
@@ -11,9 +12,12 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
+	"math/big"
 	"regexp"
 	"strings"
 	"time"
+
+	"github.com/beevik/etree"
 )
 
 // Implements the WS-Security standard using X.509 certificate signatures.
@@ -28,31 +32,226 @@ const (
 	valTypeX509Token = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-x509-token-profile-1.0#X509v3"
 
 	canonicalizationExclusiveC14N = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	envelopedSignatureTransform   = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
 	rsaSha1Sig                    = "http://www.w3.org/2000/09/xmldsig#rsa-sha1"
 	sha1Sig                       = "http://www.w3.org/2000/09/xmldsig#sha1"
+	rsaSha256Sig                  = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"
+	sha256Sig                     = "http://www.w3.org/2001/04/xmlenc#sha256"
+	rsaSha512Sig                  = "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512"
+	sha512Sig                     = "http://www.w3.org/2001/04/xmlenc#sha512"
+	ecdsaSha256Sig                = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256"
+	ecdsaSha512Sig                = "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512"
+)
+
+// ErrAlgorithmSuiteMismatch is returned when signing with an algorithm suite which doesn't match the type of the
+// signing key, such as an RSA suite with an ECDSA key.
+var ErrAlgorithmSuiteMismatch = newCategoryError(ErrSecurity, "algorithm suite doesn't match the signing key")
+
+// AlgorithmSuite is the set of algorithms requests are signed with. RSA suites sign with RSA keys, and ECDSA suites
+// with ECDSA keys.
+type AlgorithmSuite int
+
+const (
+	// RSASHA256 signs with RSA-SHA256 and digests with SHA-256. This is the default for RSA keys.
+	RSASHA256 AlgorithmSuite = iota
+	// LegacyRSASHA1 signs with RSA-SHA1 and digests with SHA-1, for services which don't support SHA-256.
+	// SHA-1 is deprecated and should only be used where it is still required; see WithDeprecatedAlgorithmHandler to
+	// track its use.
+	LegacyRSASHA1
+	// RSASHA512 signs with RSA-SHA512 and digests with SHA-512.
+	RSASHA512
+	// ECDSASHA256 signs with ECDSA-SHA256 and digests with SHA-256. This is the default for ECDSA keys.
+	ECDSASHA256
+	// ECDSASHA512 signs with ECDSA-SHA512 and digests with SHA-512.
+	ECDSASHA512
 )
 
+// SignatureMethod returns the URI of the signature algorithm of the suite.
+func (s AlgorithmSuite) SignatureMethod() string {
+	switch s {
+	case LegacyRSASHA1:
+		return rsaSha1Sig
+	case RSASHA512:
+		return rsaSha512Sig
+	case ECDSASHA256:
+		return ecdsaSha256Sig
+	case ECDSASHA512:
+		return ecdsaSha512Sig
+	}
+	return rsaSha256Sig
+}
+
+// DigestMethod returns the URI of the digest algorithm of the suite.
+func (s AlgorithmSuite) DigestMethod() string {
+	switch s.hash() {
+	case crypto.SHA1:
+		return sha1Sig
+	case crypto.SHA512:
+		return sha512Sig
+	}
+	return sha256Sig
+}
+
+// Deprecated checks whether the suite uses deprecated algorithms.
+func (s AlgorithmSuite) Deprecated() bool {
+	return s == LegacyRSASHA1
+}
+
+// hash returns the hash function used both for digests and signatures.
+func (s AlgorithmSuite) hash() crypto.Hash {
+	switch s {
+	case LegacyRSASHA1:
+		return crypto.SHA1
+	case RSASHA512, ECDSASHA512:
+		return crypto.SHA512
+	}
+	return crypto.SHA256
+}
+
+// ecdsa checks whether the suite signs with ECDSA keys rather than RSA keys.
+func (s AlgorithmSuite) ecdsa() bool {
+	return s == ECDSASHA256 || s == ECDSASHA512
+}
+
+// matches checks whether the suite signs with keys of the type of the key.
+func (s AlgorithmSuite) matches(key crypto.Signer) bool {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return !s.ecdsa()
+	case *ecdsa.PrivateKey:
+		return s.ecdsa()
+	}
+	return false
+}
+
+// digest returns the digest of data.
+func (s AlgorithmSuite) digest(data []byte) []byte {
+	h := s.hash().New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// signValue returns the signature value of data signed with the key, which must be of the type of the suite.
+// ECDSA signatures are the concatenation of their r and s values, each padded to the size of the curve, as specified
+// by RFC 4051 rather than the ASN.1 encoding used elsewhere.
+func (s AlgorithmSuite) signValue(key crypto.Signer, data []byte) ([]byte, error) {
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if !s.ecdsa() {
+			return rsa.SignPKCS1v15(rand.Reader, key, s.hash(), s.digest(data))
+		}
+	case *ecdsa.PrivateKey:
+		if s.ecdsa() {
+			r, sigS, err := ecdsa.Sign(rand.Reader, key, s.digest(data))
+			if err != nil {
+				return nil, err
+			}
+			size := (key.Curve.Params().BitSize + 7) / 8
+			value := make([]byte, 2*size)
+			r.FillBytes(value[:size])
+			sigS.FillBytes(value[size:])
+			return value, nil
+		}
+	}
+	return nil, ErrAlgorithmSuiteMismatch
+}
+
+// verifyValue checks whether value is the signature of data by the public key, which must be of the type of the
+// suite.
+func (s AlgorithmSuite) verifyValue(key crypto.PublicKey, data []byte, value []byte) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return !s.ecdsa() && rsa.VerifyPKCS1v15(key, s.hash(), s.digest(data), value) == nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if !s.ecdsa() || len(value) != 2*size {
+			return false
+		}
+		r, sigS := new(big.Int).SetBytes(value[:size]), new(big.Int).SetBytes(value[size:])
+		return ecdsa.Verify(key, s.digest(data), r, sigS)
+	}
+	return false
+}
+
 // WSSEAuthInfo contains the information required to use WS-Security X.509 signing.
 type WSSEAuthInfo struct {
 	certDER string
-	key     *rsa.PrivateKey
+	key     crypto.Signer
+	suite   AlgorithmSuite
+
+	// security is the security header holding the certificate, encoded once and copied for each signed request.
+	security *etree.Element
 }
 
-// WSSEAuthIDs contains generated IDs used in WS-Security X.509 signing.
+// SetAlgorithmSuite sets the algorithms requests are signed with, which are RSA-SHA256 and SHA-256 by default, or
+// ECDSA-SHA256 and SHA-256 for ECDSA keys. The suite must match the type of the key, or signing fails with
+// ErrAlgorithmSuiteMismatch. It must be set before the credentials are used.
+//
+// Deprecated: Use NewWSSEAuthInfoWithSuite, which rejects a suite not matching the key when the credentials are
+// loaded rather than when signing.
+func (w *WSSEAuthInfo) SetAlgorithmSuite(suite AlgorithmSuite) {
+	w.suite = suite
+}
+
+// AlgorithmSuite returns the algorithms requests are signed with.
+func (w *WSSEAuthInfo) AlgorithmSuite() AlgorithmSuite {
+	return w.suite
+}
+
+// WSSEAuthIDs contains the IDs used in WS-Security X.509 signing. They are generated for each request unless set
+// with Request.SignWithIDs.
 type WSSEAuthIDs struct {
 	securityTokenID string
 	bodyID          string
 }
 
+// NewWSSEAuthIDs returns the IDs to use for the wsu:Id attributes of the binary security token and the body of a
+// signed request. Either may be empty, to have it generated.
+func NewWSSEAuthIDs(securityTokenID string, bodyID string) *WSSEAuthIDs {
+	return &WSSEAuthIDs{
+		securityTokenID: securityTokenID,
+		bodyID:          bodyID,
+	}
+}
+
 // NewWSSEAuthInfo retrieves the supplied certificate path and key path for signing SOAP requests.
 // These requests will be secured using the WS-Security X.509 security standard.
 // If the supplied certificate path does not point to a DER-encoded X.509 certificate, or
-// if the supplied key path does not point to a PEM-encoded X.509 certificate, an error will be returned.
+// if the supplied key path does not point to a PEM-encoded RSA or ECDSA key, either PKCS #8, PKCS #1 for RSA keys or
+// SEC 1 for ECDSA keys, an error will be returned.
+// The algorithm suite is the default for the type of the key: RSASHA256 for RSA keys and ECDSASHA256 for ECDSA keys.
 func NewWSSEAuthInfo(certPath string, keyPath string) (*WSSEAuthInfo, error) {
-	certFileContents, err := ioutil.ReadFile(certPath)
+	info, err := loadWSSEAuthInfo(certPath, keyPath)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := info.key.(*ecdsa.PrivateKey); ok {
+		info.suite = ECDSASHA256
+	}
+	return info, nil
+}
+
+// NewWSSEAuthInfoWithSuite retrieves the certificate and key as NewWSSEAuthInfo does, for signing SOAP requests with
+// the algorithm suite, which must match the type of the key: ErrAlgorithmSuiteMismatch is returned otherwise.
+func NewWSSEAuthInfoWithSuite(certPath string, keyPath string, suite AlgorithmSuite) (*WSSEAuthInfo, error) {
+	info, err := loadWSSEAuthInfo(certPath, keyPath)
 	if err != nil {
 		return nil, err
 	}
+	if !suite.matches(info.key) {
+		return nil, ErrAlgorithmSuiteMismatch
+	}
+	info.suite = suite
+	return info, nil
+}
+
+// loadWSSEAuthInfo retrieves the certificate and key for signing SOAP requests, as described by NewWSSEAuthInfo,
+// leaving the algorithm suite unset.
+func loadWSSEAuthInfo(certPath string, keyPath string) (*WSSEAuthInfo, error) {
+	certFileContents, err := ioutil.ReadFile(certPath)
+	if err != nil {
+		return nil, classify(ErrSecurity, err)
+	}
 
 	certDer := string(certFileContents)
 
@@ -64,29 +263,83 @@ func NewWSSEAuthInfo(certPath string, keyPath string) (*WSSEAuthInfo, error) {
 
 	keyFileContents, err := ioutil.ReadFile(keyPath)
 	if err != nil {
-		return nil, err
+		return nil, classify(ErrSecurity, err)
 	}
 
 	keyPemBlock, _ := pem.Decode(keyFileContents)
 
-	if keyPemBlock == nil || keyPemBlock.Type != "RSA PRIVATE KEY" {
+	if keyPemBlock == nil || keyPemBlock.Type != "RSA PRIVATE KEY" && keyPemBlock.Type != "EC PRIVATE KEY" && keyPemBlock.Type != "PRIVATE KEY" {
 		return nil, ErrInvalidPEMFileSpecified
 	} else if x509.IsEncryptedPEMBlock(keyPemBlock) {
 		return nil, ErrEncryptedPEMFileSpecified
 	}
 
-	key, err := x509.ParsePKCS1PrivateKey(keyPemBlock.Bytes)
+	info := &WSSEAuthInfo{
+		certDER: certDer,
+	}
+	switch keyPemBlock.Type {
+	case "EC PRIVATE KEY":
+		info.key, err = x509.ParseECPrivateKey(keyPemBlock.Bytes)
+	case "RSA PRIVATE KEY":
+		info.key, err = x509.ParsePKCS1PrivateKey(keyPemBlock.Bytes)
+	default:
+		var key interface{}
+		if key, err = x509.ParsePKCS8PrivateKey(keyPemBlock.Bytes); err != nil {
+			break
+		}
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			info.key = key
+		case *ecdsa.PrivateKey:
+			info.key = key
+		default:
+			return nil, ErrInvalidPEMFileSpecified
+		}
+	}
 	if err != nil {
-		return nil, err
+		return nil, classify(ErrSecurity, err)
+	}
+	if info.security, err = info.encodeSecurityHeader(); err != nil {
+		return nil, classify(ErrSecurity, err)
 	}
 
-	return &WSSEAuthInfo{
-		certDER: certDer,
-		key:     key,
-	}, nil
+	return info, nil
+}
+
+// Namespaces of the elements of WS-Security headers, for building them with the types below.
+const (
+	// WSSENamespace is the namespace of the WS-Security header and tokens, declared by the wsse prefix.
+	WSSENamespace = wsseNS
+	// WSUNamespace is the namespace of the WS-Security utility attributes, such as wsu:Id, declared by the wsu prefix.
+	WSUNamespace = wsuNS
+	// DSigNamespace is the namespace of XML signatures.
+	DSigNamespace = dsigNS
+)
+
+// Security is the wsse:Security header of a signed request. The library creates it when signing a request; it is
+// exported, along with the types it consists of, so that security headers the library doesn't create, i.e. with
+// other token types, can be built or post-processed and added to requests with AddHeader.
+// The zero value has no namespace declarations; see NewSecurity.
+type Security struct {
+	XMLName xml.Name `xml:"wsse:Security"`
+	XMLNS   string   `xml:"xmlns:wsse,attr"`
+
+	BinarySecurityToken *BinarySecurityToken
+	// Tokens are any other security tokens, marshalled after the binary security token.
+	Tokens    []interface{}
+	Signature *Signature
 }
 
-type binarySecurityToken struct {
+// NewSecurity returns a security header declaring the wsse prefix, with the tokens.
+func NewSecurity(tokens ...interface{}) *Security {
+	return &Security{
+		XMLNS:  wsseNS,
+		Tokens: tokens,
+	}
+}
+
+// BinarySecurityToken is a wsse:BinarySecurityToken, such as an X.509 certificate.
+type BinarySecurityToken struct {
 	XMLName xml.Name `xml:"wsse:BinarySecurityToken"`
 	XMLNS   string   `xml:"xmlns:wsu,attr"`
 
@@ -98,89 +351,93 @@ type binarySecurityToken struct {
 	Value string `xml:",chardata"`
 }
 
-type canonicalizationMethod struct {
+// CanonicalizationMethod is the algorithm the signed info is canonicalized with.
+type CanonicalizationMethod struct {
 	XMLName   xml.Name `xml:"CanonicalizationMethod"`
 	Algorithm string   `xml:"Algorithm,attr"`
 }
 
-type signatureMethod struct {
+// SignatureMethod is the algorithm the signed info is signed with.
+type SignatureMethod struct {
 	XMLName   xml.Name `xml:"SignatureMethod"`
 	Algorithm string   `xml:"Algorithm,attr"`
 }
 
-type digestMethod struct {
+// DigestMethod is the algorithm a referenced element is digested with.
+type DigestMethod struct {
 	XMLName   xml.Name `xml:"DigestMethod"`
 	Algorithm string   `xml:"Algorithm,attr"`
 }
 
-type digestValue struct {
+// DigestValue is the base64 encoded digest of a referenced element.
+type DigestValue struct {
 	XMLName xml.Name `xml:"DigestValue"`
 	Value   string   `xml:",chardata"`
 }
 
-type transform struct {
+// Transform is a transformation applied to a referenced element before it is digested.
+type Transform struct {
 	XMLName   xml.Name `xml:"Transform"`
 	Algorithm string   `xml:"Algorithm,attr"`
 }
 
-type transforms struct {
+// Transforms lists the transformations applied to a referenced element, in order.
+type Transforms struct {
 	XMLName   xml.Name `xml:"Transforms"`
-	Transform transform
+	Transform []Transform
 }
 
-type signatureReference struct {
+// SignatureReference references an element covered by a signature, by its ID, along with its digest.
+type SignatureReference struct {
 	XMLName xml.Name `xml:"Reference"`
 	URI     string   `xml:"URI,attr"`
 
-	Transforms transforms
+	Transforms Transforms
 
-	DigestMethod digestMethod
-	DigestValue  digestValue
+	DigestMethod DigestMethod
+	DigestValue  DigestValue
 }
 
-type signedInfo struct {
+// SignedInfo is the part of a signature which is signed, referencing the elements covered by the signature.
+type SignedInfo struct {
 	XMLName xml.Name `xml:"SignedInfo"`
 	XMLNS   string   `xml:"xmlns,attr"`
 
-	CanonicalizationMethod canonicalizationMethod
-	SignatureMethod        signatureMethod
-	Reference              signatureReference
+	CanonicalizationMethod CanonicalizationMethod
+	SignatureMethod        SignatureMethod
+	References             []SignatureReference
 }
 
-type strReference struct {
+// TokenReference is the wsse:Reference of a security token reference, to a token by its URI.
+type TokenReference struct {
 	XMLName   xml.Name `xml:"wsse:Reference"`
 	ValueType string   `xml:"ValueType,attr"`
 	URI       string   `xml:"URI,attr"`
 }
 
-type securityTokenReference struct {
+// SecurityTokenReference is a wsse:SecurityTokenReference, identifying the token holding the signing key.
+type SecurityTokenReference struct {
 	XMLName xml.Name `xml:"wsse:SecurityTokenReference"`
 	XMLNS   string   `xml:"xmlns:wsu,attr"`
 
-	Reference strReference
+	Reference TokenReference
 }
 
-type keyInfo struct {
+// KeyInfo identifies the key a signature was made with.
+type KeyInfo struct {
 	XMLName xml.Name `xml:"KeyInfo"`
 
-	SecurityTokenReference securityTokenReference
+	SecurityTokenReference SecurityTokenReference
 }
 
-type signature struct {
+// Signature is an XML signature.
+type Signature struct {
 	XMLName xml.Name `xml:"Signature"`
 	XMLNS   string   `xml:"xmlns,attr"`
 
-	SignedInfo     signedInfo
+	SignedInfo     SignedInfo
 	SignatureValue string `xml:"SignatureValue"`
-	KeyInfo        keyInfo
-}
-
-type security struct {
-	XMLName xml.Name `xml:"wsse:Security"`
-	XMLNS   string   `xml:"xmlns:wsse,attr"`
-
-	BinarySecurityToken binarySecurityToken
-	Signature           signature
+	KeyInfo        KeyInfo
 }
 
 func (w *WSSEAuthIDs) generateToken() ([]byte, error) {
@@ -201,112 +458,153 @@ func (w *WSSEAuthIDs) generateToken() ([]byte, error) {
 	return tokenHex, nil
 }
 
-func generateWSSEAuthIDs() (*WSSEAuthIDs, error) {
-	w := &WSSEAuthIDs{}
-
-	securityTokenHex, err := w.generateToken()
+// generateWSUID generates a unique wsu:Id attribute value, starting with prefix.
+func generateWSUID(prefix string) (string, error) {
+	token, err := (&WSSEAuthIDs{}).generateToken()
 	if err != nil {
-		return nil, err
+		return "", err
+	}
+	return fmt.Sprintf("%s-%x", prefix, token), nil
+}
+
+// generateWSSEAuthIDs returns the IDs set in preset, which may be nil, generating those which aren't set.
+func generateWSSEAuthIDs(preset *WSSEAuthIDs) (*WSSEAuthIDs, error) {
+	w := &WSSEAuthIDs{}
+	if preset != nil {
+		*w = *preset
 	}
 
-	w.securityTokenID = fmt.Sprintf("SecurityToken-%x", securityTokenHex)
+	if w.securityTokenID == "" {
+		securityTokenHex, err := w.generateToken()
+		if err != nil {
+			return nil, err
+		}
 
-	bodyTokenHex, err := w.generateToken()
-	if err != nil {
-		return nil, err
+		w.securityTokenID = fmt.Sprintf("SecurityToken-%x", securityTokenHex)
 	}
 
-	w.bodyID = fmt.Sprintf("Body-%x", bodyTokenHex)
+	if w.bodyID == "" {
+		bodyTokenHex, err := w.generateToken()
+		if err != nil {
+			return nil, err
+		}
+
+		w.bodyID = fmt.Sprintf("Body-%x", bodyTokenHex)
+	}
 	return w, nil
 }
 
-func (w *WSSEAuthInfo) sign(body Body, ids *WSSEAuthIDs) (security, error) {
-	// 0. We create the body_id and security_token_id values
-	body.ID = ids.bodyID
+// SigningScope is the part of a request covered by its signature.
+type SigningScope int
 
-	// 1. We create the DigestValue of the body.
+const (
+	// SignBody signs the body, along with the header entries carrying a wsu:Id attribute. This is the default.
+	SignBody SigningScope = iota
+	// SignEnvelope signs the whole envelope, with a single reference to it using the enveloped signature transform,
+	// as required by some profiles. The security header, but for the signature itself, is signed along with the rest.
+	SignEnvelope
+)
 
-	// We make some changes to canonicalize things.
-	// Since we have a copy, this is ok
-	bodyEnc, err := xml.Marshal(body)
+// encodeSecurityHeader encodes the security header for messages signed with the credentials, holding the
+// certificate as a binary security token, whose ID is set for each message.
+func (w *WSSEAuthInfo) encodeSecurityHeader() (*etree.Element, error) {
+	securityEnc, err := xml.Marshal(&Security{
+		XMLNS: wsseNS,
+		BinarySecurityToken: &BinarySecurityToken{
+			XMLNS:        wsuNS,
+			EncodingType: encTypeBinary,
+			ValueType:    valTypeX509Token,
+			Value:        w.certDER,
+		},
+	})
 	if err != nil {
-		return security{}, err
+		return nil, err
 	}
 
-	canonBodyEnc, err := canonicalize(bodyEnc, "Body")
-	if err != nil {
-		return security{}, err
+	securityDoc := etree.NewDocument()
+	if err := securityDoc.ReadFromBytes(securityEnc); err != nil {
+		return nil, err
 	}
+	return securityDoc.Root(), nil
+}
 
-	bodyHasher := sha1.New()
-	bodyHasher.Write(canonBodyEnc)
-	encodedBodyDigest := base64.StdEncoding.EncodeToString(bodyHasher.Sum(nil))
+// securityHeader returns the security header for a message, a copy of the encoded header with the ID of the token
+// from ids. The signature is added once the message has been digested.
+func (w *WSSEAuthInfo) securityHeader(ids *WSSEAuthIDs) *etree.Element {
+	security := w.security.Copy()
+	security.SelectElement("BinarySecurityToken").CreateAttr("wsu:Id", ids.securityTokenID)
+	return security
+}
 
-	// 2. Set the DigestValue then sign the 'SignedInfo' struct
-	signedInfo := signedInfo{
+// sign creates the signature of the references, referring to the security token from ids for the signing key.
+func (w *WSSEAuthInfo) sign(ids *WSSEAuthIDs, references []SignatureReference) (*Signature, error) {
+	signedInfo := SignedInfo{
 		XMLNS: dsigNS,
-		CanonicalizationMethod: canonicalizationMethod{
+		CanonicalizationMethod: CanonicalizationMethod{
 			Algorithm: canonicalizationExclusiveC14N,
 		},
-		SignatureMethod: signatureMethod{
-			Algorithm: rsaSha1Sig,
-		},
-		Reference: signatureReference{
-			URI: "#" + ids.bodyID,
-			Transforms: transforms{
-				Transform: transform{
-					Algorithm: canonicalizationExclusiveC14N,
-				},
-			},
-			DigestMethod: digestMethod{
-				Algorithm: sha1Sig,
-			},
-			DigestValue: digestValue{
-				Value: encodedBodyDigest,
-			},
+		SignatureMethod: SignatureMethod{
+			Algorithm: w.suite.SignatureMethod(),
 		},
+		References: references,
 	}
 
 	signedInfoEnc, err := xml.Marshal(signedInfo)
 	if err != nil {
-		return security{}, err
+		return nil, err
+	}
+	signedInfoDoc := etree.NewDocument()
+	if err := signedInfoDoc.ReadFromBytes(signedInfoEnc); err != nil {
+		return nil, err
 	}
 
-	signedInfoHasher := sha1.New()
-	signedInfoHasher.Write(signedInfoEnc)
-	signedInfoDigest := signedInfoHasher.Sum(nil)
-
-	signatureValue, err := rsa.SignPKCS1v15(rand.Reader, w.key, crypto.SHA1, signedInfoDigest)
+	signatureValue, err := w.suite.signValue(w.key, serializeElement(signedInfoDoc.Root(), nil, nil))
 	if err != nil {
-		return security{}, err
+		return nil, err
 	}
 
-	encodedSignatureValue := base64.StdEncoding.EncodeToString(signatureValue)
-
-	secHeader := security{
-		XMLNS: wsseNS,
-		BinarySecurityToken: binarySecurityToken{
-			XMLNS:        wsuNS,
-			WsuID:        ids.securityTokenID,
-			EncodingType: encTypeBinary,
-			ValueType:    valTypeX509Token,
-			Value:        w.certDER,
-		},
-		Signature: signature{
-			XMLNS:          dsigNS,
-			SignedInfo:     signedInfo,
-			SignatureValue: encodedSignatureValue,
-			KeyInfo: keyInfo{
-				SecurityTokenReference: securityTokenReference{
-					XMLNS: wsuNS,
-					Reference: strReference{
-						ValueType: valTypeX509Token,
-						URI:       "#" + ids.securityTokenID,
-					},
+	return &Signature{
+		XMLNS:          dsigNS,
+		SignedInfo:     signedInfo,
+		SignatureValue: base64.StdEncoding.EncodeToString(signatureValue),
+		KeyInfo: KeyInfo{
+			SecurityTokenReference: SecurityTokenReference{
+				XMLNS: wsuNS,
+				Reference: TokenReference{
+					ValueType: valTypeX509Token,
+					URI:       "#" + ids.securityTokenID,
 				},
 			},
 		},
+	}, nil
+}
+
+// newSignatureReference creates the reference to the element with the ID, whose canonical form is canon.
+func (s AlgorithmSuite) newSignatureReference(id string, canon []byte) SignatureReference {
+	return s.newReference("#"+id, canon, canonicalizationExclusiveC14N)
+}
+
+// newEnvelopeReference creates the reference to the whole envelope, whose canonical form without the signature is
+// canon.
+func (s AlgorithmSuite) newEnvelopeReference(canon []byte) SignatureReference {
+	return s.newReference("", canon, envelopedSignatureTransform, canonicalizationExclusiveC14N)
+}
+
+// newReference creates the reference to the URI, whose content once transformed by the algorithms is canon.
+func (s AlgorithmSuite) newReference(uri string, canon []byte, algorithms ...string) SignatureReference {
+	var transforms []Transform
+	for _, algorithm := range algorithms {
+		transforms = append(transforms, Transform{Algorithm: algorithm})
 	}
 
-	return secHeader, nil
+	return SignatureReference{
+		URI:        uri,
+		Transforms: Transforms{Transform: transforms},
+		DigestMethod: DigestMethod{
+			Algorithm: s.DigestMethod(),
+		},
+		DigestValue: DigestValue{
+			Value: base64.StdEncoding.EncodeToString(s.digest(canon)),
+		},
+	}
 }
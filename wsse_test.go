@@ -1,8 +1,17 @@
 package soap
 
 import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"io/ioutil"
 	"testing"
 
+	"github.com/beevik/etree"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -10,6 +19,7 @@ type newWsseAuthInfoTest struct {
 	name       string
 	inCertPath string
 	inKeyPath  string
+	suite      AlgorithmSuite
 	err        error
 }
 
@@ -20,10 +30,30 @@ var newWsseAuthInfoTests = []newWsseAuthInfoTest{
 		inKeyPath:  "./testdata/key.pem",
 		err:        nil,
 	},
+	{
+		name:       "ecdsa key",
+		inCertPath: "./testdata/eccert.pem",
+		inKeyPath:  "./testdata/eckey.pem",
+		suite:      ECDSASHA256,
+		err:        nil,
+	},
+	{
+		name:       "pkcs8 key",
+		inCertPath: "./testdata/cert.pem",
+		inKeyPath:  "./testdata/pkcs8key.pem",
+		err:        nil,
+	},
+	{
+		name:       "pkcs8 ecdsa key",
+		inCertPath: "./testdata/eccert.pem",
+		inKeyPath:  "./testdata/pkcs8eckey.pem",
+		suite:      ECDSASHA256,
+		err:        nil,
+	},
 	{
 		name:       "invalid key file case",
 		inCertPath: "./testdata/cert.pem",
-		inKeyPath:  "./testdata/badkey.pem",
+		inKeyPath:  "./testdata/cert.pem",
 		err:        ErrInvalidPEMFileSpecified,
 	},
 }
@@ -33,9 +63,405 @@ func TestNewWSSEAuthInfo(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			wsseInfo, err := NewWSSEAuthInfo(tt.inCertPath, tt.inKeyPath)
 			assert.Equal(t, tt.err, err)
-			if tt.err == nil {
-				assert.NotNil(t, wsseInfo)
+			if tt.err == nil && assert.NotNil(t, wsseInfo) {
+				assert.Equal(t, tt.suite, wsseInfo.AlgorithmSuite())
+			}
+		})
+	}
+}
+
+type signWithWSSEInfoTest struct {
+	name    string
+	headers []interface{}
+	content interface{}
+	err     error
+}
+
+var signWithWSSEInfoTests = []signWithWSSEInfoTest{
+	{
+		name:    "without headers",
+		content: &envelopeContentExample{Attr1: 10, Field1: envelopeExampleField{Value: "This is a test string"}},
+	},
+	{
+		name:    "with headers",
+		headers: []interface{}{headerExample{Attr1: 15, Value: "test header value"}},
+		content: &envelopeContentExample{Attr1: 10, Field1: envelopeExampleField{Value: "This is a test string"}},
+	},
+	{
+		name: "empty envelope",
+		err:  ErrUnableToSignEmptyEnvelope,
+	},
+}
+
+func TestSignWithWSSEInfo(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	for _, tt := range signWithWSSEInfoTests {
+		t.Run(tt.name, func(t *testing.T) {
+			envelope := NewEnvelope(tt.content)
+			if len(tt.headers) > 0 {
+				envelope.AddHeaders(tt.headers...)
+			}
+
+			enc, err := envelope.signWithWSSEInfo(wsseInfo, nil, SignBody, nil, nil)
+			assert.Equal(t, tt.err, err)
+			if tt.err != nil {
+				return
 			}
+
+			doc := etree.NewDocument()
+			assert.Nil(t, doc.ReadFromBytes(enc))
+
+			header := doc.FindElement("Envelope/Header")
+			if !assert.NotNil(t, header) {
+				return
+			}
+			children := header.ChildElements()
+			assert.Len(t, children, len(tt.headers)+1)
+			assert.Equal(t, "Security", children[len(children)-1].Tag)
+
+			// The digest must be of the body exactly as it appears in the serialized envelope.
+			start := bytes.Index(enc, []byte("<Body "))
+			end := bytes.Index(enc, []byte("</Body>")) + len("</Body>")
+			digest := sha256.Sum256(enc[start:end])
+
+			digestValue := doc.FindElement("//DigestValue")
+			if assert.NotNil(t, digestValue) {
+				assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), digestValue.Text())
+			}
+		})
+	}
+}
+
+func TestRequestSignWithIDs(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name    string
+		ids     *WSSEAuthIDs
+		tokenID string
+		bodyID  string
+	}{
+		{name: "both", ids: NewWSSEAuthIDs("SecurityToken-1", "Body-1"), tokenID: "SecurityToken-1", bodyID: "Body-1"},
+		{name: "body only", ids: NewWSSEAuthIDs("", "Body-1"), bodyID: "Body-1"},
+		{name: "token only", ids: NewWSSEAuthIDs("SecurityToken-1", ""), tokenID: "SecurityToken-1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := NewRequest("action", "http://localhost", &envelopeContentExample{Attr1: 10}, nil, nil)
+			req.SignWith(wsseInfo)
+			req.SignWithIDs(tt.ids)
+
+			r, err := req.serialize(serializeOptions{})
+			assert.Nil(t, err)
+			data, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+
+			doc := etree.NewDocument()
+			if !assert.Nil(t, doc.ReadFromBytes(data)) {
+				return
+			}
+
+			tokenID := doc.FindElement("//BinarySecurityToken").SelectAttrValue("wsu:Id", "")
+			bodyID := doc.FindElement("Envelope/Body").SelectAttrValue("wsu:Id", "")
+			if tt.tokenID != "" {
+				assert.Equal(t, tt.tokenID, tokenID)
+			} else {
+				assert.Regexp(t, "^SecurityToken-[0-9a-f]+$", tokenID)
+			}
+			if tt.bodyID != "" {
+				assert.Equal(t, tt.bodyID, bodyID)
+			} else {
+				assert.Regexp(t, "^Body-[0-9a-f]+$", bodyID)
+			}
+
+			assert.Equal(t, "#"+bodyID, doc.FindElement("//SignedInfo/Reference").SelectAttrValue("URI", ""))
+			assert.Equal(t, "#"+tokenID, doc.FindElement("//SecurityTokenReference/Reference").SelectAttrValue("URI", ""))
+		})
+	}
+}
+
+func TestEnvelopeSign(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name  string
+		scope SigningScope
+		order []xml.Name
+	}{
+		{name: "body"},
+		{name: "envelope", scope: SignEnvelope},
+		{name: "ordered headers", order: []xml.Name{{Space: WSSENamespace, Local: "Security"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ids := NewWSSEAuthIDs("SecurityToken-1", "Body-1")
+
+			envelope := NewEnvelope(&envelopeContentExample{Attr1: 10})
+			envelope.AddHeaders(headerExample{Attr1: 15, Value: "test header value"})
+			signed, err := envelope.Sign(wsseInfo, WithSigningIDs(ids), WithSigningScope(tt.scope), WithSignedHeaderOrder(tt.order...))
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			// The envelope is signed as the same request would be.
+			req := NewRequest("action", "http://localhost", &envelopeContentExample{Attr1: 10}, nil, nil)
+			req.AddHeader(headerExample{Attr1: 15, Value: "test header value"})
+			req.SignWith(wsseInfo)
+			req.SignWithIDs(ids)
+			req.SignScope(tt.scope)
+			req.OrderHeaders(tt.order...)
+
+			r, err := req.serialize(serializeOptions{})
+			assert.Nil(t, err)
+			data, err := ioutil.ReadAll(r)
+			assert.Nil(t, err)
+
+			// Signatures with RSA PKCS #1 v1.5 are deterministic, so the serialized envelopes are identical.
+			assert.Equal(t, string(data), string(signed))
+		})
+	}
+
+	_, err = NewEnvelope(nil).Sign(wsseInfo)
+	assert.Equal(t, ErrUnableToSignEmptyEnvelope, err)
+}
+
+type usernameTokenExample struct {
+	XMLName  xml.Name `xml:"wsse:UsernameToken"`
+	Username string   `xml:"wsse:Username"`
+}
+
+func TestSecurityHeader(t *testing.T) {
+	var tests = []struct {
+		name     string
+		security *Security
+		want     string
+	}{
+		{
+			name:     "extra token",
+			security: NewSecurity(&usernameTokenExample{Username: "user"}),
+			want:     `<wsse:Security xmlns:wsse="` + WSSENamespace + `"><wsse:UsernameToken><wsse:Username>user</wsse:Username></wsse:UsernameToken></wsse:Security>`,
+		},
+		{
+			name: "binary token",
+			security: &Security{
+				XMLNS: WSSENamespace,
+				BinarySecurityToken: &BinarySecurityToken{
+					XMLNS:        WSUNamespace,
+					WsuID:        "token",
+					EncodingType: encTypeBinary,
+					ValueType:    valTypeX509Token,
+					Value:        "MIIC",
+				},
+			},
+			want: `<wsse:Security xmlns:wsse="` + WSSENamespace + `"><wsse:BinarySecurityToken xmlns:wsu="` + WSUNamespace + `" wsu:Id="token" EncodingType="` + encTypeBinary + `" ValueType="` + valTypeX509Token + `">MIIC</wsse:BinarySecurityToken></wsse:Security>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := xml.Marshal(tt.security)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.want, string(data))
+		})
+	}
+}
+
+func TestRequestSecurityHeader(t *testing.T) {
+	req := NewRequest("action", "http://localhost", &envelopeContentExample{}, nil, nil)
+	req.AddHeader(NewSecurity(&usernameTokenExample{Username: "user"}))
+
+	r, err := req.serialize(serializeOptions{})
+	assert.Nil(t, err)
+	data, err := ioutil.ReadAll(r)
+	assert.Nil(t, err)
+
+	doc := etree.NewDocument()
+	assert.Nil(t, doc.ReadFromBytes(data))
+	username := doc.FindElement("Envelope/Header/Security/UsernameToken/Username")
+	if assert.NotNil(t, username) {
+		assert.Equal(t, "user", username.Text())
+	}
+}
+
+func TestSignWithWSSEInfoEnvelopeScope(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	envelope := NewEnvelope(&envelopeContentExample{Field1: envelopeExampleField{Value: "value"}})
+	envelope.AddHeaders(&headerExample{})
+	enc, err := envelope.signWithWSSEInfo(wsseInfo, nil, SignEnvelope, nil, nil)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	doc := etree.NewDocument()
+	assert.Nil(t, doc.ReadFromBytes(enc))
+
+	references := doc.FindElements("//SignedInfo/Reference")
+	if !assert.Len(t, references, 1) {
+		return
+	}
+	assert.Equal(t, "", references[0].SelectAttrValue("URI", "missing"))
+	var algorithms []string
+	for _, transform := range references[0].FindElements("Transforms/Transform") {
+		algorithms = append(algorithms, transform.SelectAttrValue("Algorithm", ""))
+	}
+	assert.Equal(t, []string{envelopedSignatureTransform, canonicalizationExclusiveC14N}, algorithms)
+	assert.NotNil(t, doc.FindElement("Envelope/Header/Security/BinarySecurityToken"))
+
+	// The digest must be of the canonical form of the envelope as it is sent, but for the signature.
+	start := bytes.Index(enc, []byte("<Signature "))
+	end := bytes.Index(enc, []byte("</Signature>")) + len("</Signature>")
+	unsigned := etree.NewDocument()
+	assert.Nil(t, unsigned.ReadFromBytes(append(append([]byte(nil), enc[:start]...), enc[end:]...)))
+	digest := sha256.Sum256(serializeElement(unsigned.Root(), nil, nil))
+	assert.Equal(t, base64.StdEncoding.EncodeToString(digest[:]), references[0].SelectElement("DigestValue").Text())
+}
+
+func TestWSSEAuthInfoSecurityHeader(t *testing.T) {
+	wsseInfo, err := NewWSSEAuthInfo("./testdata/cert.pem", "./testdata/key.pem")
+	assert.Nil(t, err)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		enc, err := NewEnvelope(&envelopeContentExample{}).signWithWSSEInfo(wsseInfo, nil, SignBody, nil, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+
+		doc := etree.NewDocument()
+		assert.Nil(t, doc.ReadFromBytes(enc))
+		token := doc.FindElement("Envelope/Header/Security/BinarySecurityToken")
+		if !assert.NotNil(t, token) {
+			return
+		}
+		assert.Equal(t, wsseInfo.certDER, token.Text())
+		ids = append(ids, token.SelectAttrValue("wsu:Id", ""))
+
+		reference := doc.FindElement("//SecurityTokenReference/Reference")
+		if assert.NotNil(t, reference) {
+			assert.Equal(t, "#"+ids[i], reference.SelectAttrValue("URI", ""))
+		}
+	}
+
+	// Each request has its own token ID, and the encoded header shared by requests is left unchanged.
+	assert.NotEmpty(t, ids[0])
+	assert.NotEqual(t, ids[0], ids[1])
+	assert.Equal(t, "", wsseInfo.security.SelectElement("BinarySecurityToken").SelectAttrValue("wsu:Id", "missing"))
+}
+
+func TestSignWithWSSEInfoAlgorithmSuite(t *testing.T) {
+	var tests = []struct {
+		name      string
+		suite     AlgorithmSuite
+		signature string
+		digest    string
+		sum       func([]byte) []byte
+		// ecdsa signs with the ECDSA key rather than the RSA key.
+		ecdsa bool
+	}{
+		{
+			name:      "default",
+			suite:     RSASHA256,
+			signature: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha256",
+			digest:    "http://www.w3.org/2001/04/xmlenc#sha256",
+			sum:       func(data []byte) []byte { sum := sha256.Sum256(data); return sum[:] },
+		},
+		{
+			name:      "legacy",
+			suite:     LegacyRSASHA1,
+			signature: "http://www.w3.org/2000/09/xmldsig#rsa-sha1",
+			digest:    "http://www.w3.org/2000/09/xmldsig#sha1",
+			sum:       func(data []byte) []byte { sum := sha1.Sum(data); return sum[:] },
+		},
+		{
+			name:      "sha512",
+			suite:     RSASHA512,
+			signature: "http://www.w3.org/2001/04/xmldsig-more#rsa-sha512",
+			digest:    "http://www.w3.org/2001/04/xmlenc#sha512",
+			sum:       func(data []byte) []byte { sum := sha512.Sum512(data); return sum[:] },
+		},
+		{
+			name:      "ecdsa",
+			suite:     ECDSASHA256,
+			signature: "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha256",
+			digest:    "http://www.w3.org/2001/04/xmlenc#sha256",
+			sum:       func(data []byte) []byte { sum := sha256.Sum256(data); return sum[:] },
+			ecdsa:     true,
+		},
+		{
+			name:      "ecdsa sha512",
+			suite:     ECDSASHA512,
+			signature: "http://www.w3.org/2001/04/xmldsig-more#ecdsa-sha512",
+			digest:    "http://www.w3.org/2001/04/xmlenc#sha512",
+			sum:       func(data []byte) []byte { sum := sha512.Sum512(data); return sum[:] },
+			ecdsa:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certPath, keyPath, defaultSuite := "./testdata/cert.pem", "./testdata/key.pem", RSASHA256
+			if tt.ecdsa {
+				certPath, keyPath, defaultSuite = "./testdata/eccert.pem", "./testdata/eckey.pem", ECDSASHA256
+			}
+			wsseInfo, err := NewWSSEAuthInfo(certPath, keyPath)
+			assert.Nil(t, err)
+			assert.Equal(t, defaultSuite, wsseInfo.AlgorithmSuite())
+			wsseInfo, err = NewWSSEAuthInfoWithSuite(certPath, keyPath, tt.suite)
+			if !assert.Nil(t, err) {
+				return
+			}
+			assert.Equal(t, tt.suite, wsseInfo.AlgorithmSuite())
+			assert.Equal(t, tt.suite == LegacyRSASHA1, tt.suite.Deprecated())
+
+			enc, err := NewEnvelope(&envelopeContentExample{}).signWithWSSEInfo(wsseInfo, nil, SignBody, nil, nil)
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			doc := etree.NewDocument()
+			assert.Nil(t, doc.ReadFromBytes(enc))
+			assert.Equal(t, tt.signature, doc.FindElement("//SignedInfo/SignatureMethod").SelectAttrValue("Algorithm", ""))
+			assert.Equal(t, tt.digest, doc.FindElement("//SignedInfo/Reference/DigestMethod").SelectAttrValue("Algorithm", ""))
+
+			start := bytes.Index(enc, []byte("<Body "))
+			end := bytes.Index(enc, []byte("</Body>")) + len("</Body>")
+			assert.Equal(t, base64.StdEncoding.EncodeToString(tt.sum(enc[start:end])), doc.FindElement("//DigestValue").Text())
+		})
+	}
+}
+
+func TestSignWithWSSEInfoAlgorithmSuiteMismatch(t *testing.T) {
+	var tests = []struct {
+		name     string
+		certPath string
+		keyPath  string
+		suite    AlgorithmSuite
+	}{
+		{name: "rsa key", certPath: "./testdata/cert.pem", keyPath: "./testdata/key.pem", suite: ECDSASHA256},
+		{name: "ecdsa key", certPath: "./testdata/eccert.pem", keyPath: "./testdata/eckey.pem", suite: RSASHA256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewWSSEAuthInfoWithSuite(tt.certPath, tt.keyPath, tt.suite)
+			assert.Equal(t, ErrAlgorithmSuiteMismatch, err)
+
+			// A suite set afterwards is only checked when signing.
+			wsseInfo, err := NewWSSEAuthInfo(tt.certPath, tt.keyPath)
+			assert.Nil(t, err)
+			wsseInfo.SetAlgorithmSuite(tt.suite)
+
+			_, err = NewEnvelope(&envelopeContentExample{}).Sign(wsseInfo)
+			assert.True(t, errors.Is(err, ErrAlgorithmSuiteMismatch), "%v", err)
+			assert.True(t, errors.Is(err, ErrSecurity), "%v", err)
 		})
 	}
 }
@@ -0,0 +1,404 @@
+package soap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Implements the filtering of characters which are illegal in XML 1.0 out of requests and responses.
+
+// InvalidCharMode is how characters which are illegal in XML 1.0, such as most ASCII control characters, are
+// filtered out of requests and responses; see WithInvalidCharFilter.
+type InvalidCharMode int
+
+const (
+	// StripInvalidChars removes illegal characters.
+	StripInvalidChars InvalidCharMode = iota + 1
+	// ReplaceInvalidChars replaces illegal characters with U+FFFD, the Unicode replacement character, so that where
+	// they were remains visible.
+	ReplaceInvalidChars
+)
+
+// WithInvalidCharFilter makes the client filter characters which are illegal in XML 1.0 out of requests and
+// responses, as set by mode. Without it, encoding/xml replaces illegal characters in the text and attributes of
+// requests with U+FFFD, but writes those in CDATA sections and comments as they are, which services then fail to
+// parse; responses holding illegal characters, either as they are or as character references such as &#11;, fail to
+// decode with a syntax error.
+// With the filter, the strings and byte slices of the body and header values of requests are filtered before they are
+// encoded, without modifying the values themselves; character references within RawXML content are left as they are.
+// XML responses, and the root part of multipart responses, are filtered before they are decoded, along with character
+// references to illegal characters, even within CDATA sections. Responses are assumed to be encoded in UTF-8, as
+// encoding/xml requires.
+func WithInvalidCharFilter(mode InvalidCharMode) ClientOption {
+	return func(c *Client) {
+		c.invalidChars = mode
+	}
+}
+
+// isXMLChar returns whether r is a character allowed in XML 1.0 documents.
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		r >= 0x20 && r <= 0xD7FF ||
+		r >= 0xE000 && r <= 0xFFFD ||
+		r >= 0x10000 && r <= utf8.MaxRune
+}
+
+// replacement returns what illegal characters are replaced with in the mode.
+func (m InvalidCharMode) replacement() string {
+	if m == ReplaceInvalidChars {
+		return string(utf8.RuneError)
+	}
+	return ""
+}
+
+// filterString returns s with the illegal characters, and bytes which aren't valid UTF-8, filtered as set by mode.
+// The string itself is returned if there are none.
+func filterString(s string, mode InvalidCharMode) string {
+	var buf []byte
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if isXMLChar(r) && (r != utf8.RuneError || size > 1) {
+			if buf != nil {
+				buf = append(buf, s[i:i+size]...)
+			}
+		} else {
+			if buf == nil {
+				buf = append(make([]byte, 0, len(s)), s[:i]...)
+			}
+			buf = append(buf, mode.replacement()...)
+		}
+		i += size
+	}
+
+	if buf == nil {
+		return s
+	}
+	return string(buf)
+}
+
+// filterInvalidChars returns v with the illegal characters of its strings and byte slices filtered as set by mode.
+// The values holding them are copied rather than modified, so v itself is returned if there are none.
+func filterInvalidChars(v interface{}, mode InvalidCharMode) interface{} {
+	if v == nil {
+		return nil
+	}
+	if filtered, changed := filterValue(reflect.ValueOf(v), mode); changed {
+		return filtered.Interface()
+	}
+	return v
+}
+
+// filterValue returns a copy of v with the illegal characters of its strings and byte slices filtered, and whether
+// there were any; v itself is returned otherwise. Only the exported fields of structs are filtered.
+func filterValue(v reflect.Value, mode InvalidCharMode) (reflect.Value, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		s := filterString(v.String(), mode)
+		if s == v.String() {
+			return v, false
+		}
+		filtered := reflect.New(v.Type()).Elem()
+		filtered.SetString(s)
+		return filtered, true
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		elem, changed := filterValue(v.Elem(), mode)
+		if !changed {
+			return v, false
+		}
+		if v.Kind() == reflect.Ptr {
+			filtered := reflect.New(v.Type().Elem())
+			filtered.Elem().Set(elem)
+			return filtered, true
+		}
+		filtered := reflect.New(v.Type()).Elem()
+		filtered.Set(elem)
+		return filtered, true
+	case reflect.Slice:
+		if v.IsNil() {
+			return v, false
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			s := string(v.Bytes())
+			filteredString := filterString(s, mode)
+			if filteredString == s {
+				return v, false
+			}
+			filtered := reflect.New(v.Type()).Elem()
+			filtered.SetBytes([]byte(filteredString))
+			return filtered, true
+		}
+		var filtered reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			elem, changed := filterValue(v.Index(i), mode)
+			if !changed {
+				continue
+			}
+			if !filtered.IsValid() {
+				filtered = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+				reflect.Copy(filtered, v)
+			}
+			filtered.Index(i).Set(elem)
+		}
+		return filteredOr(v, filtered)
+	case reflect.Array:
+		var filtered reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			elem, changed := filterValue(v.Index(i), mode)
+			if !changed {
+				continue
+			}
+			if !filtered.IsValid() {
+				filtered = reflect.New(v.Type()).Elem()
+				filtered.Set(v)
+			}
+			filtered.Index(i).Set(elem)
+		}
+		return filteredOr(v, filtered)
+	case reflect.Struct:
+		var filtered reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath != "" {
+				continue
+			}
+			field, changed := filterValue(v.Field(i), mode)
+			if !changed {
+				continue
+			}
+			if !filtered.IsValid() {
+				filtered = reflect.New(v.Type()).Elem()
+				filtered.Set(v)
+			}
+			filtered.Field(i).Set(field)
+		}
+		return filteredOr(v, filtered)
+	}
+	return v, false
+}
+
+// filteredOr returns filtered and true if it is set, or v and false otherwise.
+func filteredOr(v reflect.Value, filtered reflect.Value) (reflect.Value, bool) {
+	if filtered.IsValid() {
+		return filtered, true
+	}
+	return v, false
+}
+
+// maxCharRefLen is the length of the longest character reference recognized by invalidCharReader, after the
+// ampersand, allowing for some leading zeros.
+const maxCharRefLen = 16
+
+// invalidCharReader is a reader filtering illegal characters out of an XML document encoded in UTF-8, both those
+// written as they are and character references to them.
+type invalidCharReader struct {
+	r           *bufio.Reader
+	replacement []byte
+	// pending is the replacement of an illegal character not read yet.
+	pending []byte
+}
+
+func newInvalidCharReader(r io.Reader, mode InvalidCharMode) *invalidCharReader {
+	return &invalidCharReader{r: bufio.NewReader(r), replacement: []byte(mode.replacement())}
+}
+
+// Read satisfies the io.Reader interface. An illegal character, or a reference to one, is replaced as it is read. Once
+// p holds anything, Read stops at the end of the buffered input instead of blocking for more, so that a response is
+// decoded chunk by chunk as it arrives.
+func (r *invalidCharReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.pending) > 0 {
+			copied := copy(p[n:], r.pending)
+			r.pending = r.pending[copied:]
+			n += copied
+			continue
+		}
+		if n > 0 && r.r.Buffered() == 0 {
+			break
+		}
+
+		b, err := r.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		var skip int
+		switch {
+		case b < 0x20 && b != '\t' && b != '\n' && b != '\r':
+		case b == 0xEF:
+			// U+FFFE and U+FFFF are encoded as EF BF BE and EF BF BF.
+			if next, _ := r.r.Peek(2); len(next) == 2 && next[0] == 0xBF && next[1] >= 0xBE {
+				skip = 2
+				break
+			}
+			p[n] = b
+			n++
+			continue
+		case b == '&':
+			if skip = invalidCharRef(r.r); skip > 0 {
+				break
+			}
+			p[n] = b
+			n++
+			continue
+		default:
+			p[n] = b
+			n++
+			continue
+		}
+
+		r.r.Discard(skip)
+		r.pending = r.replacement
+	}
+	return n, nil
+}
+
+// invalidCharRef returns the length of the character reference, after its ampersand, that r is at if it references
+// an illegal character, or 0 otherwise.
+func invalidCharRef(r *bufio.Reader) int {
+	ref, _ := r.Peek(maxCharRefLen)
+	end := bytes.IndexByte(ref, ';')
+	if len(ref) < 3 || ref[0] != '#' || end < 0 {
+		return 0
+	}
+
+	digits, base := ref[1:end], 10
+	if len(digits) > 0 && digits[0] == 'x' {
+		digits, base = digits[1:], 16
+	}
+	code, err := strconv.ParseUint(string(digits), base, 32)
+	if err != nil || isXMLChar(rune(code)) {
+		return 0
+	}
+	return end + 1
+}
+
+// utf8Reader is a reader replacing the bytes of a document which aren't valid UTF-8 with U+FFFD, counting them.
+type utf8Reader struct {
+	r *bufio.Reader
+	// replaced is incremented for each invalid byte replaced.
+	replaced *int
+	pending  []byte
+	buf      [utf8.UTFMax]byte
+}
+
+func newUTF8Reader(r io.Reader, replaced *int) *utf8Reader {
+	return &utf8Reader{r: bufio.NewReader(r), replaced: replaced}
+}
+
+// Read satisfies the io.Reader interface. Each invalid byte becomes U+FFFD on its own and is counted as one
+// replacement. Read returns a short count rather than waiting for a slow response to fill p.
+func (r *utf8Reader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.pending) > 0 {
+			copied := copy(p[n:], r.pending)
+			r.pending = r.pending[copied:]
+			n += copied
+			continue
+		}
+		if n > 0 && r.r.Buffered() == 0 {
+			break
+		}
+
+		c, size, err := r.r.ReadRune()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if c == utf8.RuneError && size == 1 {
+			*r.replaced++
+		}
+		r.pending = r.buf[:utf8.EncodeRune(r.buf[:], c)]
+	}
+	return n, nil
+}
+
+// predefinedEntities are the entities predefined by XML, which are always left to the decoder.
+var predefinedEntities = map[string]bool{"amp": true, "lt": true, "gt": true, "apos": true, "quot": true}
+
+// entityReader is a reader replacing entity references with their escaped values.
+type entityReader struct {
+	r        *bufio.Reader
+	entities map[string]string
+	// maxLen is the length of the longest entity reference, after its ampersand.
+	maxLen  int
+	pending []byte
+}
+
+func newEntityReader(r io.Reader, entities map[string]string) *entityReader {
+	maxLen := 0
+	for name := range entities {
+		if len(name)+1 > maxLen {
+			maxLen = len(name) + 1
+		}
+	}
+	return &entityReader{r: bufio.NewReader(r), entities: entities, maxLen: maxLen}
+}
+
+// Read satisfies the io.Reader interface. The value of an entity is escaped as text where its reference was, so that
+// it can't introduce markup. A partial p is returned as soon as the buffered input is used up.
+func (r *entityReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.pending) > 0 {
+			copied := copy(p[n:], r.pending)
+			r.pending = r.pending[copied:]
+			n += copied
+			continue
+		}
+		if n > 0 && r.r.Buffered() == 0 {
+			break
+		}
+
+		b, err := r.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+
+		if b == '&' {
+			if size, value, ok := r.entity(); ok {
+				r.r.Discard(size)
+				var buf bytes.Buffer
+				xml.EscapeText(&buf, []byte(value))
+				r.pending = buf.Bytes()
+				continue
+			}
+		}
+		p[n] = b
+		n++
+	}
+	return n, nil
+}
+
+// entity returns the length and value of the entity reference, after its ampersand, that r is at if it is one of the
+// entities.
+func (r *entityReader) entity() (int, string, bool) {
+	ref, _ := r.r.Peek(r.maxLen)
+	end := bytes.IndexByte(ref, ';')
+	if end < 0 {
+		return 0, "", false
+	}
+
+	name := string(ref[:end])
+	value, ok := r.entities[name]
+	if !ok || predefinedEntities[name] {
+		return 0, "", false
+	}
+	return end + 1, value, true
+}
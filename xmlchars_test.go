@@ -0,0 +1,234 @@
+package soap
+
+import (
+	"context"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterString(t *testing.T) {
+	var tests = []struct {
+		name     string
+		in       string
+		stripped string
+		replaced string
+	}{
+		{name: "valid", in: "tab\tnewline\nreturn\r é 😀", stripped: "tab\tnewline\nreturn\r é 😀", replaced: "tab\tnewline\nreturn\r é 😀"},
+		{name: "control characters", in: "a\x0bb\x00c\x1f", stripped: "abc", replaced: "a�b�c�"},
+		{name: "non-characters", in: "a￾b￿", stripped: "ab", replaced: "a�b�"},
+		{name: "invalid UTF-8", in: "a\xffb", stripped: "ab", replaced: "a�b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.stripped, filterString(tt.in, StripInvalidChars))
+			assert.Equal(t, tt.replaced, filterString(tt.in, ReplaceInvalidChars))
+		})
+	}
+}
+
+type invalidCharsExample struct {
+	XMLName xml.Name `xml:"urn:example Customer"`
+	ID      string   `xml:"id,attr"`
+	Name    string   `xml:"Name"`
+	Notes   []string `xml:"Note"`
+	Raw     []byte   `xml:"Raw"`
+	Comment string   `xml:",comment"`
+	Address *struct {
+		Street string `xml:",cdata"`
+	} `xml:"Address"`
+	private string
+}
+
+func TestFilterInvalidChars(t *testing.T) {
+	v := &invalidCharsExample{
+		ID:      "1\x0b",
+		Name:    "Jane\x0bDoe",
+		Notes:   []string{"first", "sec\x01ond"},
+		Raw:     []byte("r\x02aw"),
+		Comment: "comment\x0c",
+		private: "private\x0b",
+	}
+	v.Address = &struct {
+		Street string `xml:",cdata"`
+	}{Street: "Main\x0bStreet"}
+
+	filtered, ok := filterInvalidChars(v, StripInvalidChars).(*invalidCharsExample)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "1", filtered.ID)
+	assert.Equal(t, "JaneDoe", filtered.Name)
+	assert.Equal(t, []string{"first", "second"}, filtered.Notes)
+	assert.Equal(t, []byte("raw"), filtered.Raw)
+	assert.Equal(t, "comment", filtered.Comment)
+	assert.Equal(t, "MainStreet", filtered.Address.Street)
+	assert.Equal(t, "private\x0b", filtered.private)
+
+	// The original value is left as it was.
+	assert.Equal(t, "Jane\x0bDoe", v.Name)
+	assert.Equal(t, []string{"first", "sec\x01ond"}, v.Notes)
+	assert.Equal(t, []byte("r\x02aw"), v.Raw)
+	assert.Equal(t, "Main\x0bStreet", v.Address.Street)
+
+	valid := &invalidCharsExample{Name: "Jane Doe", Notes: []string{"first"}}
+	assert.True(t, filterInvalidChars(valid, StripInvalidChars) == valid)
+	assert.Nil(t, filterInvalidChars(nil, StripInvalidChars))
+}
+
+func TestInvalidCharReader(t *testing.T) {
+	var tests = []struct {
+		name     string
+		in       string
+		stripped string
+		replaced string
+	}{
+		{name: "valid", in: "<a b=\"&amp;&#9;&#xA;\">&lt;é&#233;</a>", stripped: "<a b=\"&amp;&#9;&#xA;\">&lt;é&#233;</a>", replaced: "<a b=\"&amp;&#9;&#xA;\">&lt;é&#233;</a>"},
+		{name: "control characters", in: "<a>x\x0by\x00</a>", stripped: "<a>xy</a>", replaced: "<a>x�y�</a>"},
+		{name: "character references", in: "<a b=\"&#11;\">&#11;&#x0b;&#x000B;&#0;</a>", stripped: "<a b=\"\"></a>", replaced: "<a b=\"�\">����</a>"},
+		{name: "non-characters", in: "<a>x￾y&#xFFFF;</a>", stripped: "<a>xy</a>", replaced: "<a>x�y�</a>"},
+		{name: "incomplete references", in: "<a>&#11</a>&#", stripped: "<a>&#11</a>&#", replaced: "<a>&#11</a>&#"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stripped, err := ioutil.ReadAll(newInvalidCharReader(iotest.OneByteReader(strings.NewReader(tt.in)), StripInvalidChars))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.stripped, string(stripped))
+
+			replaced, err := ioutil.ReadAll(newInvalidCharReader(strings.NewReader(tt.in), ReplaceInvalidChars))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.replaced, string(replaced))
+		})
+	}
+}
+
+func TestClientInvalidCharFilter(t *testing.T) {
+	var received string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = string(body)
+
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>` +
+			`<Customer xmlns="urn:example" id="1&#11;"><Name>Jane` + "\x0b" + `Doe</Name></Customer></Body></Envelope>`))
+	}))
+	defer server.Close()
+
+	body := &invalidCharsExample{Name: "John\x0bDoe", Comment: "note\x0b"}
+
+	// Without the filter, the illegal characters of the response fail its decoding.
+	_, err := NewClient(server.Client()).Do(context.Background(), NewRequest("action", server.URL, body, &invalidCharsExample{}, nil))
+	assert.True(t, err != nil && strings.Contains(err.Error(), "illegal character"), "%v", err)
+	assert.Contains(t, received, "<!--note\x0b-->")
+
+	resp := &invalidCharsExample{}
+	client := NewClient(server.Client(), WithInvalidCharFilter(StripInvalidChars))
+	_, err = client.Do(context.Background(), NewRequest("action", server.URL, body, resp, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, "JaneDoe", resp.Name)
+	assert.Equal(t, "1", resp.ID)
+	assert.Contains(t, received, "<Name>JohnDoe</Name>")
+	assert.Contains(t, received, "<!--note-->")
+	assert.Equal(t, "John\x0bDoe", body.Name)
+}
+
+func TestUTF8Reader(t *testing.T) {
+	var tests = []struct {
+		name     string
+		in       string
+		out      string
+		replaced int
+	}{
+		{name: "valid", in: "<a>é 😀 �</a>", out: "<a>é 😀 �</a>"},
+		{name: "latin-1", in: "<a>caf\xe9 cr\xe8me</a>", out: "<a>caf� cr�me</a>", replaced: 2},
+		{name: "truncated sequence", in: "<a>\xe2\x82</a>\xf0", out: "<a>��</a>�", replaced: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var replaced int
+			out, err := ioutil.ReadAll(newUTF8Reader(iotest.OneByteReader(strings.NewReader(tt.in)), &replaced))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.out, string(out))
+			assert.Equal(t, tt.replaced, replaced)
+		})
+	}
+}
+
+func TestClientLenientUTF8(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml; charset=utf-8")
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>` +
+			"<Customer xmlns=\"urn:example\"><Name>Ren\xe9e M\xfcller</Name></Customer></Body></Envelope>"))
+	}))
+	defer server.Close()
+
+	// Without the option, the Latin-1 bytes fail the decoding of the response.
+	_, err := NewClient(server.Client()).Do(context.Background(), NewRequest("action", server.URL, &invalidCharsExample{}, &invalidCharsExample{}, nil))
+	assert.True(t, err != nil && strings.Contains(err.Error(), "invalid UTF-8"), "%v", err)
+
+	var replaced int
+	var entry *LogEntry
+	client := NewClient(server.Client(), WithLenientUTF8(func(ctx context.Context, e *LogEntry, n int) {
+		entry, replaced = e, n
+	}))
+
+	resp := &invalidCharsExample{}
+	_, err = client.Do(context.Background(), NewRequest("action", server.URL, &invalidCharsExample{}, resp, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, "Ren�e M�ller", resp.Name)
+	assert.Equal(t, 2, replaced)
+	if assert.NotNil(t, entry) {
+		assert.Equal(t, server.URL, entry.URL)
+	}
+}
+
+func TestEntityReader(t *testing.T) {
+	entities := map[string]string{"nbsp": "\u00a0", "eacute": "é", "lt": "<", "tag": "<b>&"}
+
+	var tests = []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{name: "no entities", in: `<a b="&amp;">&lt;&#233;</a>`, out: `<a b="&amp;">&lt;&#233;</a>`},
+		{name: "entities", in: `<a b="caf&eacute;">x&nbsp;y</a>`, out: "<a b=\"café\">x\u00a0y</a>"},
+		{name: "escaped values", in: `<a>&tag;</a>`, out: `<a>&lt;b&gt;&amp;</a>`},
+		{name: "unknown entities", in: `<a>&copy;&eacute</a>&`, out: `<a>&copy;&eacute</a>&`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := ioutil.ReadAll(newEntityReader(iotest.OneByteReader(strings.NewReader(tt.in)), entities))
+			assert.Nil(t, err)
+			assert.Equal(t, tt.out, string(out))
+		})
+	}
+}
+
+func TestClientEntities(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>` +
+			`<Customer xmlns="urn:example"><Name>Ren&eacute;e&nbsp;M&uuml;ller</Name></Customer></Body></Envelope>`))
+	}))
+	defer server.Close()
+
+	// Without the option, the entities fail the decoding of the response.
+	_, err := NewClient(server.Client()).Do(context.Background(), NewRequest("action", server.URL, &invalidCharsExample{}, &invalidCharsExample{}, nil))
+	assert.True(t, err != nil && strings.Contains(err.Error(), "invalid character entity"), "%v", err)
+
+	resp := &invalidCharsExample{}
+	client := NewClient(server.Client(), WithEntities(xml.HTMLEntity))
+	_, err = client.Do(context.Background(), NewRequest("action", server.URL, &invalidCharsExample{}, resp, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, "Renée\u00a0Müller", resp.Name)
+}
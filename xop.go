@@ -1,32 +1,35 @@
 package soap
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"io"
 	"io/ioutil"
 	"mime/multipart"
+	"net/textproto"
+	"net/url"
 	"reflect"
 	"strings"
-
-	"github.com/beevik/etree"
+	"sync"
 )
 
 // Implements an XOP decoder.
 // This is used for any MIME multi-part SOAP responses we receive.
 
 const (
-	xopNS = "http://www.w3.org/2004/08/xop/include"
+	xopNS   = "http://www.w3.org/2004/08/xop/include"
 	xmlName = "XMLName"
 )
 
 var (
 	// ErrMultipartBodyEmpty is returned if a multi-part body that is empty is discovered
-	ErrMultipartBodyEmpty = errors.New("multi-part body is empty")
+	ErrMultipartBodyEmpty = newCategoryError(ErrDecode, "multi-part body is empty")
 	// ErrCannotSetBytesElement is an internal error that suggests our parse tree is malformed
-	ErrCannotSetBytesElement = errors.New("cannot set the bytes element")
+	ErrCannotSetBytesElement = newCategoryError(ErrDecode, "cannot set the bytes element")
 	// ErrMissingXOPPart is returned if the decoded body was missing the XOP header
-	ErrMissingXOPPart = errors.New("did not find an xop part for this multipart message")
+	ErrMissingXOPPart = newCategoryError(ErrDecode, "did not find an xop part for this multipart message")
 )
 
 var (
@@ -38,6 +41,27 @@ type xopDecoder struct {
 	reader      io.Reader
 	mediaParams map[string]string
 	includes    map[string][]string
+
+	// attachments, if set, is handed the binary parts instead of them being copied into the decoded envelope.
+	attachments AttachmentHandler
+	// envelopeNS, if set, is accepted in place of the envelope namespace.
+	envelopeNS string
+	// base is the Content-Location of the root part, which relative Content-Locations are resolved against.
+	base string
+	// lenient repairs the framing of the multipart body before it is read.
+	lenient bool
+	// buffering is how the multipart body is buffered as it is read.
+	buffering multipartBuffering
+	// repair, if set, wraps the reader of the root part with the readers repairing it before it is decoded.
+	repair func(r io.Reader) io.Reader
+	// limits are the limits the root part is checked against as it is decoded.
+	limits decodeLimits
+	// verifyCert, if set, makes the signature of the root part be verified before it is decoded, trusting the
+	// certificates it accepts.
+	verifyCert CertificateVerifier
+	// signedTimestamp requires the timestamp in the security header of the root part, if any, to be signed when
+	// verifying its signature.
+	signedTimestamp bool
 }
 
 func newXopDecoder(r io.Reader, mediaParams map[string]string) *xopDecoder {
@@ -49,36 +73,116 @@ func newXopDecoder(r io.Reader, mediaParams map[string]string) *xopDecoder {
 	return d
 }
 
-func (d *xopDecoder) getXopContentIDIncludePath(element *etree.Element, path []string) {
-	for _, token := range element.Child {
-		switch token := token.(type) {
-		case *etree.Element:
-			ns := token.Space
-			href := ""
-
-			for _, attr := range token.Attr {
-				if attr.Key == "xmlns" {
-					ns = attr.Value
-				} else if attr.Key == "href" {
-					href = attr.Value
-				}
+// xopIncludeReader is a token reader which records the element path of every XOP include as the root part is decoded.
+// The include elements themselves are dropped from the token stream, leaving the fields they appear in empty until
+// the binary parts they reference are read.
+// This lets the root part be decoded in a single pass, without first parsing it into a document tree.
+type xopIncludeReader struct {
+	d        *xml.Decoder
+	includes map[string][]string
+	// base is the URI relative references to parts by their Content-Location are resolved against.
+	base string
+
+	// path holds the local names of the open elements, starting with the root element.
+	path []string
+	// skipDepth is the nesting depth within an include element being dropped, or 0 outside of one.
+	skipDepth int
+}
+
+// Token satisfies the xml.TokenReader interface.
+func (r *xopIncludeReader) Token() (xml.Token, error) {
+	for {
+		token, err := r.d.Token()
+		if err != nil {
+			return token, err
+		}
+
+		switch elem := token.(type) {
+		case xml.StartElement:
+			if r.skipDepth > 0 {
+				r.skipDepth++
+				continue
 			}
 
-			if ns == xopNS && token.Tag == "Include" {
-				cleanedHref := strings.Replace(href, "cid:", "", 1)
-				// This is a super ugly hack reflecting how these URIs are stored in the HTTP header
-				// This is an ugly way to make sure we copy the value of path without subsequent modifications
-				d.includes["<" + cleanedHref + ">"] = append([]string(nil), path...)
-				break
+			if elem.Name.Space == xopNS && elem.Name.Local == "Include" {
+				r.addInclude(elem)
+				r.skipDepth = 1
+				continue
+			}
+
+			r.path = append(r.path, elem.Name.Local)
+		case xml.EndElement:
+			if r.skipDepth > 0 {
+				r.skipDepth--
+				continue
 			}
 
-			d.getXopContentIDIncludePath(token, append(path, []string{token.Tag}...))
+			if len(r.path) > 0 {
+				r.path = r.path[:len(r.path)-1]
+			}
 		default:
-			continue
+			if r.skipDepth > 0 {
+				continue
+			}
 		}
+
+		return token, nil
 	}
 }
 
+// addInclude records the path to the element containing the include, relative to the root element.
+func (r *xopIncludeReader) addInclude(include xml.StartElement) {
+	href := ""
+	for _, attr := range include.Attr {
+		if attr.Name.Space == "" && attr.Name.Local == "href" {
+			href = attr.Value
+		}
+	}
+
+	if len(r.path) == 0 || href == "" {
+		return
+	}
+
+	r.includes[includeKey(href, r.base)] = append([]string(nil), r.path[1:]...)
+}
+
+// includeKey returns the key of the part referenced by the href of an include: its Content-ID header for a cid: URI,
+// as it appears in the header of the part, or otherwise the URI resolved against base, to be matched with the
+// Content-Location of the part.
+func includeKey(href string, base string) string {
+	if strings.HasPrefix(strings.ToLower(href), "cid:") {
+		return ContentIDHeader(contentIDFromURI(href))
+	}
+	return resolveLocation(base, href)
+}
+
+// partKey returns the key of the part with the header, matching that of the includes referencing it: its Content-ID
+// if it has one, as parts are referenced by it by default, or otherwise its Content-Location resolved against base,
+// as permitted by SOAP Messages with Attachments.
+func partKey(header textproto.MIMEHeader, base string) string {
+	if contentID := header.Get("Content-ID"); contentID != "" {
+		return contentID
+	}
+	if location := header.Get("Content-Location"); location != "" {
+		return resolveLocation(base, location)
+	}
+	return ""
+}
+
+// resolveLocation resolves the URI reference against the base URI, if both are valid, so that absolute and relative
+// references to the same part match.
+func resolveLocation(base string, ref string) string {
+	refURL, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return refURL.String()
+	}
+	return baseURL.ResolveReference(refURL).String()
+}
+
 func getFieldFromPath(val reflect.Value, path []string) (reflect.Value, error) {
 	val = unwrapValue(val)
 
@@ -106,6 +210,20 @@ func getFieldFromPath(val reflect.Value, path []string) (reflect.Value, error) {
 		// unwrap the value
 		valueField = unwrapValue(valueField)
 
+		// if the field is a map, search its entry keyed by the next elem in the path
+		if valueField.Type().Kind() == reflect.Map {
+			fieldName := getNameFromTag(tag)
+			if fieldName == "" {
+				fieldName = typeField.Name
+			}
+
+			if fieldName == path[0] {
+				return getFieldFromMap(valueField, path[1:])
+			}
+
+			continue
+		}
+
 		// check if the value was unwrapped completely
 		if valueField.Type().Kind() == reflect.Array || valueField.Type().Kind() == reflect.Slice || valueField.Type().Kind() == reflect.Ptr {
 			// if valueField is in path
@@ -123,8 +241,9 @@ func getFieldFromPath(val reflect.Value, path []string) (reflect.Value, error) {
 			continue
 		}
 
-		// if the field is an embedded struct, search its fields
-		if typeField.Anonymous {
+		// if the field is an embedded struct, search its fields. Like encoding/xml, other embedded fields, such as
+		// interfaces, are elements named after their type, and are searched below.
+		if typeField.Anonymous && isStructType(typeField.Type) {
 			result, err := getFieldFromPath(valueField, path)
 			if err == nil {
 				return result, nil
@@ -157,6 +276,37 @@ func getFieldFromPath(val reflect.Value, path []string) (reflect.Value, error) {
 	return reflect.Value{}, errFieldNotFound
 }
 
+// getFieldFromMap searches the entry of the map keyed by the first elem in the path, as maps are filled by custom
+// unmarshalers keying their entries by element name. Map entries aren't addressable, so the field can only be set
+// if the entry is a pointer, or an interface holding one.
+func getFieldFromMap(val reflect.Value, path []string) (reflect.Value, error) {
+	// val must be a map keyed by strings and path must have length > 0
+	if val.IsNil() || val.Type().Key().Kind() != reflect.String || len(path) == 0 {
+		return reflect.Value{}, errFieldNotFound
+	}
+
+	entry := val.MapIndex(reflect.ValueOf(path[0]).Convert(val.Type().Key()))
+	if !entry.IsValid() {
+		return reflect.Value{}, errFieldNotFound
+	}
+
+	entry = unwrapValue(entry)
+	if len(path) == 1 {
+		return entry, nil
+	}
+
+	return getFieldFromPath(entry, path[1:])
+}
+
+// isStructType checks whether the type is a struct or a pointer to one, the embedded types whose fields encoding/xml
+// treats as fields of the embedding struct.
+func isStructType(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
 // Unwrap value as much as possible. A value can no longer be unwrapped if:
 // - it is an empty array or slice
 // - it is a nil pointer
@@ -199,7 +349,7 @@ func getNameFromTag(tag string) string {
 
 	// remove xml namespace from the front of the tag
 	parts := strings.Split(tag, " ")
-	tag = parts[len(parts) - 1]
+	tag = parts[len(parts)-1]
 
 	// return the XMLName from the front of the remaining tag
 	return strings.Split(tag, ",")[0]
@@ -233,8 +383,27 @@ func getExplicitXMLName(val reflect.Value) string {
 	return ""
 }
 
+// isFaultEnvelope checks whether the decoded envelope holds a fault rather than content.
+func isFaultEnvelope(envelope *Envelope) bool {
+	return envelope.Body != nil && envelope.Body.Content == nil && envelope.Body.Fault != nil
+}
+
 func (d *xopDecoder) decode(respEnvelope *Envelope) error {
-	parts := multipart.NewReader(d.reader, d.mediaParams["boundary"])
+	reader := d.reader
+	if d.buffering.readAhead > 0 {
+		readAhead := newReadAheadReader(reader, d.buffering.bufferSize(), d.buffering.readAhead)
+		defer readAhead.Close()
+		reader = readAhead
+	}
+
+	buffered := bufio.NewReaderSize(reader, d.buffering.bufferSize())
+	boundary := multipartBoundary(buffered, d.mediaParams["boundary"])
+
+	reader = buffered
+	if d.lenient {
+		reader = newMultipartNormalizer(reader, boundary)
+	}
+	parts := multipart.NewReader(reader, boundary)
 	parsedXOPHeader := false
 	partNumber := 0
 
@@ -256,31 +425,38 @@ func (d *xopDecoder) decode(respEnvelope *Envelope) error {
 		// Find the include paths in it, store them, and then we'll proceed to the rest of the parts to put them into this document.
 		if strings.Contains(part.Header.Get("Content-Type"), "application/xop+xml") {
 			parsedXOPHeader = true
-			doc := etree.NewDocument()
-			_, err = doc.ReadFrom(part)
-			if err != nil {
-				return err
-			}
 
-			root := doc.Root()
-
-			d.getXopContentIDIncludePath(root, nil)
-
-			pipeReader, pipeWriter := io.Pipe()
-
-			go func() {
-				// Here we re-serialize the object to a pipe for easy deserialization by the standard XML library
-				doc.WriteTo(pipeWriter)
-				defer pipeWriter.Close()
-			}()
+			// The include paths are collected as the envelope is decoded.
+			d.base = part.Header.Get("Content-Location")
+			var root io.Reader = part
+			if d.repair != nil {
+				root = d.repair(root)
+			}
+			if d.verifyCert != nil {
+				data, err := ioutil.ReadAll(root)
+				if err != nil {
+					return err
+				}
+				if err := verifyEnvelope(data, d.verifyCert, d.signedTimestamp); err != nil {
+					return err
+				}
+				root = bytes.NewReader(data)
+			}
+			includeReader := &xopIncludeReader{
+				d:        xml.NewDecoder(root),
+				includes: d.includes,
+				base:     d.base,
+			}
 
-			err = xml.NewDecoder(pipeReader).Decode(&respEnvelope)
+			err = xml.NewTokenDecoder(envelopeTokenReader(includeReader, d.envelopeNS, d.limits)).Decode(&respEnvelope)
 			if err != nil {
 				return err
 			}
 
-			if len(d.includes) < 1 {
-				// We don't have anything more to parse.
+			if len(d.includes) < 1 && d.attachments == nil || isFaultEnvelope(respEnvelope) {
+				// We don't have anything more to parse. The parts following a fault aren't attachments of the content,
+				// so they're discarded rather than being handed to the attachment handler, and are drained along
+				// with the rest of the response body.
 				break
 			}
 
@@ -288,8 +464,16 @@ func (d *xopDecoder) decode(respEnvelope *Envelope) error {
 			continue
 		}
 
+		// If the caller handles the attachments they read the part directly, and the 'bytes' field is left empty.
+		if d.attachments != nil {
+			if err := d.attachments(newAttachment(part, part.Header, d.includes[partKey(part.Header, d.base)])); err != nil {
+				return err
+			}
+			continue
+		}
+
 		// We're now going through the part to put this part into the proper 'bytes' field of the struct deserialized above.
-		if xopObjPath, ok := d.includes[part.Header.Get("Content-ID")]; ok {
+		if xopObjPath, ok := d.includes[partKey(part.Header, d.base)]; ok {
 			rResponse := reflect.ValueOf(respEnvelope)
 
 			field, err := getFieldFromPath(rResponse, xopObjPath)
@@ -297,6 +481,14 @@ func (d *xopDecoder) decode(respEnvelope *Envelope) error {
 				return err
 			}
 
+			// Parts bound to a writer, such as a file, are streamed into it rather than read into memory.
+			if w, ok := partWriter(field); ok {
+				if err := copyPart(w, part); err != nil {
+					return err
+				}
+				continue
+			}
+
 			if !field.CanSet() {
 				return ErrCannotSetBytesElement
 			}
@@ -307,7 +499,7 @@ func (d *xopDecoder) decode(respEnvelope *Envelope) error {
 			}
 
 			// We don't read the content until we know we're able to save it (no point reading something we'll never store).
-			partBytes, err := ioutil.ReadAll(part)
+			partBytes, err := readPart(part, part.Header)
 			if err != nil {
 				return err
 			}
@@ -318,3 +510,73 @@ func (d *xopDecoder) decode(respEnvelope *Envelope) error {
 
 	return nil
 }
+
+// partWriter returns the writer held by the field, as unwrapped by getFieldFromPath, if a pointer to it is a writer.
+func partWriter(field reflect.Value) (io.Writer, bool) {
+	if !field.CanAddr() {
+		return nil, false
+	}
+	w, ok := field.Addr().Interface().(io.Writer)
+	return w, ok
+}
+
+// writerType is the type of io.Writer, which fields parts are streamed into implement.
+var writerType = reflect.TypeOf((*io.Writer)(nil)).Elem()
+
+// writerFieldTypes caches whether types have fields parts may be streamed into, by type.
+var writerFieldTypes sync.Map
+
+// hasWriterFields checks whether the type of v has fields, at any depth, which XOP parts may be streamed into rather
+// than stored, as partWriter finds them. Requests whose response has such fields aren't hedged nor retried: attempts
+// decode into new values of the response type, whose writers are nil, and a part already written into the caller's
+// writer by a failed attempt can't be taken back.
+func hasWriterFields(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return false
+	}
+	if cached, ok := writerFieldTypes.Load(t); ok {
+		return cached.(bool)
+	}
+	found := typeHasWriterFields(t, map[reflect.Type]bool{})
+	writerFieldTypes.Store(t, found)
+	return found
+}
+
+// typeHasWriterFields checks whether the type has fields which are writers, skipping the types already visited.
+func typeHasWriterFields(t reflect.Type, visited map[reflect.Type]bool) bool {
+	if visited[t] {
+		return false
+	}
+	visited[t] = true
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		return typeHasWriterFields(t.Elem(), visited)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			if field.Type.Implements(writerType) || reflect.PtrTo(field.Type).Implements(writerType) {
+				return true
+			}
+			if typeHasWriterFields(field.Type, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// copyPart copies the part into w, then closes w if it is an io.Closer, whether the copy succeeded or not.
+func copyPart(w io.Writer, part io.Reader) error {
+	_, err := io.Copy(w, part)
+	if closer, ok := w.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
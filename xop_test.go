@@ -1,10 +1,19 @@
 package soap
 
 import (
+	"bytes"
+	"context"
 	"encoding/xml"
+	"io"
+	"io/ioutil"
 	"mime"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -194,3 +203,401 @@ func TestGetNameFromTag(t *testing.T) {
 		assert.Equal(t, tt.xmlName, xmlName)
 	}
 }
+
+func TestXopIncludeReader(t *testing.T) {
+	var tests = []struct {
+		name     string
+		doc      string
+		includes map[string][]string
+		decoded  string
+	}{
+		{
+			name:     "default namespace include",
+			doc:      `<Envelope><Body><Data><Include xmlns="http://www.w3.org/2004/08/xop/include" href="cid:part1"/></Data></Body></Envelope>`,
+			includes: map[string][]string{"<part1>": {"Body", "Data"}},
+			decoded:  `<Envelope><Body><Data></Data></Body></Envelope>`,
+		},
+		{
+			name:     "prefixed include with children",
+			doc:      `<Envelope><Body><Data><xop:Include xmlns:xop="http://www.w3.org/2004/08/xop/include" href="cid:part2"><Extra>text</Extra></xop:Include></Data><Other>value</Other></Body></Envelope>`,
+			includes: map[string][]string{"<part2>": {"Body", "Data"}},
+			decoded:  `<Envelope><Body><Data></Data><Other>value</Other></Body></Envelope>`,
+		},
+		{
+			name:     "include in another namespace",
+			doc:      `<Envelope><Body><Data><Include href="cid:part3"/></Data></Body></Envelope>`,
+			includes: map[string][]string{},
+			decoded:  `<Envelope><Body><Data><Include href="cid:part3"></Include></Data></Body></Envelope>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &xopIncludeReader{
+				d:        xml.NewDecoder(strings.NewReader(tt.doc)),
+				includes: map[string][]string{},
+			}
+
+			var out strings.Builder
+			enc := xml.NewEncoder(&out)
+			for {
+				token, err := r.Token()
+				if err != nil {
+					break
+				}
+				assert.Nil(t, enc.EncodeToken(token))
+			}
+			assert.Nil(t, enc.Flush())
+
+			assert.Equal(t, tt.includes, r.includes)
+			assert.Equal(t, tt.decoded, out.String())
+		})
+	}
+}
+
+func BenchmarkMultipartResponseWithCSV(b *testing.B) {
+	_, mediaParams, err := mime.ParseMediaType(testMultipartWithCSVContentType)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		envelope := NewEnvelope(&RunTimeSeriesReportResponse{})
+		if err := newXopDecoder(strings.NewReader(testMultipartWithCSV), mediaParams).decode(envelope); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestMultipartResponseWithAttachmentHandler(t *testing.T) {
+	testResp := &RunTimeSeriesReportResponse{}
+	envelope := NewEnvelope(testResp)
+
+	_, mediaParams, err := mime.ParseMediaType(testMultipartWithCSVContentType)
+	assert.Nil(t, err)
+
+	var attachments []*Attachment
+	var contents []string
+
+	decoder := newXopDecoder(strings.NewReader(testMultipartWithCSV), mediaParams)
+	decoder.attachments = func(attachment *Attachment) error {
+		// The envelope is decoded before any attachment is handled.
+		assert.Equal(t, int32(1), testResp.Report.NumberOfDataSets)
+
+		content, err := ioutil.ReadAll(attachment)
+		attachments = append(attachments, attachment)
+		contents = append(contents, string(content))
+		return err
+	}
+
+	err = decoder.decode(envelope)
+	assert.Nil(t, err)
+	assert.Empty(t, testResp.Report.DataSets.DataSet[0].CsvAttachment.CsvData)
+
+	if assert.Len(t, attachments, 1) {
+		assert.Equal(t, "c9947101-675e-47c9-911b-0aba186b7201@example.jaxws.sun.com", attachments[0].ContentID)
+		assert.Equal(t, "text/csv", attachments[0].ContentType)
+		assert.Equal(t, []string{"Body", "RunTimeSeriesReportResponse", "Report", "DataSets", "DataSet", "CsvAttachment", "CsvData"}, attachments[0].Path)
+		assert.Equal(t, "tn_prod-e03d921e-ed56-4d51-826d-c54f0288bfef,2019-08-19T10:20:59.000Z,332682498\n", contents[0])
+	}
+
+	decoder = newXopDecoder(strings.NewReader(testMultipartWithCSV), mediaParams)
+	decoder.attachments = func(attachment *Attachment) error {
+		return ErrCannotSetBytesElement
+	}
+	assert.Equal(t, ErrCannotSetBytesElement, decoder.decode(NewEnvelope(&RunTimeSeriesReportResponse{})))
+}
+
+type streamedReportResponse struct {
+	XMLName xml.Name        `xml:"RunTimeSeriesReportResponse"`
+	Report  *streamedReport `xml:"Report"`
+}
+
+type streamedReport struct {
+	DataSets struct {
+		DataSet struct {
+			CsvAttachment streamedCsvAttachment `xml:"CsvAttachment"`
+		} `xml:"DataSet"`
+	} `xml:"DataSets"`
+}
+
+type streamedCsvAttachment struct {
+	CsvData io.Writer `xml:"CsvData"`
+}
+
+type closingBuffer struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *closingBuffer) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestMultipartResponseWithWriter(t *testing.T) {
+	_, mediaParams, err := mime.ParseMediaType(testMultipartWithCSVContentType)
+	assert.Nil(t, err)
+	const csv = "tn_prod-e03d921e-ed56-4d51-826d-c54f0288bfef,2019-08-19T10:20:59.000Z,332682498\n"
+
+	// The writer is set in a struct which the decoder reuses, as its pointer is already allocated.
+	var buf bytes.Buffer
+	testResp := &streamedReportResponse{Report: &streamedReport{}}
+	testResp.Report.DataSets.DataSet.CsvAttachment.CsvData = &buf
+
+	assert.Nil(t, newXopDecoder(strings.NewReader(testMultipartWithCSV), mediaParams).decode(NewEnvelope(testResp)))
+	assert.Equal(t, csv, buf.String())
+
+	closer := &closingBuffer{}
+	closerResp := &struct {
+		XMLName xml.Name `xml:"RunTimeSeriesReportResponse"`
+		Report  struct {
+			DataSets struct {
+				DataSet struct {
+					CsvAttachment struct {
+						CsvData io.WriteCloser `xml:"CsvData"`
+					} `xml:"CsvAttachment"`
+				} `xml:"DataSet"`
+			} `xml:"DataSets"`
+		} `xml:"Report"`
+	}{}
+	closerResp.Report.DataSets.DataSet.CsvAttachment.CsvData = closer
+
+	assert.Nil(t, newXopDecoder(strings.NewReader(testMultipartWithCSV), mediaParams).decode(NewEnvelope(closerResp)))
+	assert.Equal(t, csv, closer.String())
+	assert.True(t, closer.closed)
+
+	// Buffers are allocated by the decoder, as any other pointer.
+	bufferResp := &struct {
+		XMLName xml.Name `xml:"RunTimeSeriesReportResponse"`
+		Report  struct {
+			DataSets struct {
+				DataSet []struct {
+					CsvAttachment struct {
+						CsvData *bytes.Buffer `xml:"CsvData"`
+					} `xml:"CsvAttachment"`
+				} `xml:"DataSet"`
+			} `xml:"DataSets"`
+		} `xml:"Report"`
+	}{}
+	assert.Nil(t, newXopDecoder(strings.NewReader(testMultipartWithCSV), mediaParams).decode(NewEnvelope(bufferResp)))
+	if assert.Len(t, bufferResp.Report.DataSets.DataSet, 1) {
+		assert.Equal(t, csv, bufferResp.Report.DataSets.DataSet[0].CsvAttachment.CsvData.String())
+	}
+}
+
+func TestHasWriterFields(t *testing.T) {
+	type recursive struct {
+		Next *recursive
+		Data []byte
+	}
+
+	var tests = []struct {
+		name string
+		v    interface{}
+		want bool
+	}{
+		{name: "nil", v: nil, want: false},
+		{name: "no writers", v: &envelopeContentExample{}, want: false},
+		{name: "bytes", v: &recursive{}, want: false},
+		{name: "nested writer", v: &streamedReportResponse{}, want: true},
+		{name: "writer interface", v: &struct{ W io.WriteCloser }{}, want: true},
+		{name: "buffer in slice", v: &struct{ Items []struct{ B *bytes.Buffer } }{}, want: true},
+		{name: "buffer value", v: &struct{ B bytes.Buffer }{}, want: true},
+		{name: "unexported writer", v: &struct{ w io.Writer }{}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, hasWriterFields(tt.v))
+		})
+	}
+}
+
+func TestClientWriterFieldsNotHedged(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		time.Sleep(100 * time.Millisecond)
+		w.Header().Set("Content-Type", testMultipartWithCSVContentType)
+		w.Write([]byte(testMultipartWithCSV))
+	}))
+	defer server.Close()
+
+	var buf bytes.Buffer
+	resp := &streamedReportResponse{Report: &streamedReport{}}
+	resp.Report.DataSets.DataSet.CsvAttachment.CsvData = &buf
+
+	client := NewClient(server.Client(), WithHedging(10*time.Millisecond, ""), WithRetryPolicy(RetryPolicy{MaxAttempts: 3}))
+	req := NewRequest("action", server.URL, &envelopeContentExample{}, resp, nil)
+	req.MarkIdempotent()
+
+	// The part is streamed into the writer set by the caller, which attempts decoding into a copy wouldn't have.
+	_, err := client.Do(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+	assert.Contains(t, buf.String(), "tn_prod-e03d921e")
+}
+
+func TestMultipartResponseWithContentLocation(t *testing.T) {
+	const rootID = "Content-Id: <rootpart*d7287a84-8be6-4284-afeb-26ee43e46edd@example.jaxws.sun.com>"
+	const partID = "Content-Id: <c9947101-675e-47c9-911b-0aba186b7201@example.jaxws.sun.com>"
+	const href = `href="cid:c9947101-675e-47c9-911b-0aba186b7201@example.jaxws.sun.com"`
+
+	var tests = []struct {
+		name     string
+		root     string
+		href     string
+		location string
+		resolved bool
+	}{
+		{name: "absolute", root: rootID, href: `href="http://example.com/report/data.csv"`, location: "http://example.com/report/data.csv", resolved: true},
+		{name: "relative reference", root: "Content-Location: http://example.com/report/", href: `href="data.csv"`, location: "http://example.com/report/data.csv", resolved: true},
+		{name: "relative location", root: "Content-Location: http://example.com/report/", href: `href="http://example.com/report/data.csv"`, location: "data.csv", resolved: true},
+		{name: "relative without base", root: rootID, href: `href="data.csv"`, location: "data.csv", resolved: true},
+		{name: "mismatch", root: rootID, href: `href="http://example.com/report/data.csv"`, location: "http://example.com/other.csv"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := strings.Replace(testMultipartWithCSV, rootID, tt.root, 1)
+			body = strings.Replace(body, href, tt.href, 1)
+			body = strings.Replace(body, partID, "Content-Location: "+tt.location, 1)
+
+			_, mediaParams, err := mime.ParseMediaType(testMultipartWithCSVContentType)
+			assert.Nil(t, err)
+
+			testResp := &RunTimeSeriesReportResponse{}
+			err = newXopDecoder(strings.NewReader(body), mediaParams).decode(NewEnvelope(testResp))
+			assert.Nil(t, err)
+
+			data := string(testResp.Report.DataSets.DataSet[0].CsvAttachment.CsvData)
+			if tt.resolved {
+				assert.Equal(t, "tn_prod-e03d921e-ed56-4d51-826d-c54f0288bfef,2019-08-19T10:20:59.000Z,332682498\n", data)
+			} else {
+				assert.Empty(t, data)
+			}
+		})
+	}
+}
+
+const testMultipartFault = "--boundary\r\n" +
+	"Content-Type: application/xop+xml; charset=utf-8; type=\"text/xml\"\r\n" +
+	"Content-ID: <root@example.com>\r\n\r\n" +
+	`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+	`<faultcode>soap:Server</faultcode><faultstring>report failed</faultstring>` +
+	`<detail><Error><Code>E1</Code><Message>no data</Message></Error></detail>` +
+	`</soap:Fault></soap:Body></soap:Envelope>` + "\r\n" +
+	"--boundary\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-ID: <log@example.com>\r\n\r\n" +
+	"diagnostic log\r\n" +
+	"--boundary--\r\n"
+
+func TestMultipartResponseFault(t *testing.T) {
+	var tests = []struct {
+		name        string
+		attachments bool
+	}{
+		{name: "without attachment handler"},
+		{name: "with attachment handler", attachments: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", `multipart/related; type="application/xop+xml"; boundary=boundary`)
+				w.WriteHeader(http.StatusInternalServerError)
+				w.Write([]byte(testMultipartFault))
+			}))
+			defer server.Close()
+
+			req := NewRequest("action", server.URL, &headerExample{}, &RunTimeSeriesReportResponse{}, &Error{})
+			handled := 0
+			if tt.attachments {
+				req.HandleAttachments(func(attachment *Attachment) error {
+					handled++
+					return nil
+				})
+			}
+
+			resp, err := NewClient(nil).Do(context.Background(), req)
+			if !assert.Nil(t, err) {
+				return
+			}
+			if assert.NotNil(t, resp.Fault()) {
+				assert.Equal(t, "soap:Server", resp.Fault().Code)
+				assert.Equal(t, "report failed", resp.Fault().String)
+				assert.Equal(t, &Error{Code: "E1", Message: "no data"}, resp.Fault().Detail())
+			}
+			assert.Nil(t, resp.Body().(*RunTimeSeriesReportResponse).ReportResponse)
+			assert.Equal(t, 0, handled)
+		})
+	}
+}
+
+type xopPayload interface{}
+
+type xopFile struct {
+	Data []byte `xml:"Data"`
+}
+
+type xopEmbeddedStruct struct {
+	File xopFile `xml:"File"`
+}
+
+type xopFieldsResponse struct {
+	XMLName xml.Name `xml:"Response"`
+	xopEmbeddedStruct
+	xopPayload
+	Files    map[string]*xopFile    `xml:"Files"`
+	Values   map[string]xopFile     `xml:"Values"`
+	Payloads map[string]interface{} `xml:"Payloads"`
+}
+
+func TestGetFieldFromPath(t *testing.T) {
+	response := &xopFieldsResponse{
+		xopPayload: &xopFile{},
+		Files:      map[string]*xopFile{"a": {}},
+		Values:     map[string]xopFile{"a": {}},
+		Payloads:   map[string]interface{}{"a": &xopFile{}},
+	}
+
+	var tests = []struct {
+		name    string
+		path    []string
+		wantErr error
+	}{
+		{name: "embedded struct", path: []string{"File", "Data"}},
+		{name: "embedded interface", path: []string{"xopPayload", "Data"}},
+		{name: "embedded interface without its name", path: []string{"Data"}, wantErr: errFieldNotFound},
+		{name: "map of pointers", path: []string{"Files", "a", "Data"}},
+		{name: "map of interfaces", path: []string{"Payloads", "a", "Data"}},
+		{name: "missing map entry", path: []string{"Files", "b", "Data"}, wantErr: errFieldNotFound},
+		{name: "map without entry key", path: []string{"Files"}, wantErr: errFieldNotFound},
+		{name: "map of structs", path: []string{"Values", "a", "Data"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			field, err := getFieldFromPath(reflect.ValueOf(response), tt.path)
+			assert.Equal(t, tt.wantErr, err)
+			if err == nil {
+				assert.Equal(t, "[]uint8", field.Type().String())
+			}
+		})
+	}
+
+	// Entries of maps of structs aren't addressable, so their fields can't be set.
+	field, err := getFieldFromPath(reflect.ValueOf(response), []string{"Values", "a", "Data"})
+	assert.Nil(t, err)
+	assert.False(t, field.CanSet())
+
+	field, err = getFieldFromPath(reflect.ValueOf(response), []string{"Files", "a", "Data"})
+	assert.Nil(t, err)
+	if assert.True(t, field.CanSet()) {
+		field.SetBytes([]byte("hello"))
+		assert.Equal(t, "hello", string(response.Files["a"].Data))
+	}
+}